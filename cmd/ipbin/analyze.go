@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"os"
+)
+
+func analyzeUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin analyze [options] <input-file>...
+
+Reports the data quality of the input before merging: how many entries are
+duplicates of others, fully contained in others, or adjacent to others and
+merged with them, across all the inputs.
+
+Options:
+`+inputUsage+`  -l, --list               List each redundant entry along with the entry making it so
+  -h, --help               Show this help message
+`)
+}
+
+func runAnalyze(args []string) {
+	var opts options
+	var list, showHelp bool
+
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	addInputFlags(fs, &opts)
+	fs.BoolVar(&list, "list", false, "List each redundant entry")
+	fs.BoolVar(&list, "l", false, "List each redundant entry (shorthand)")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = analyzeUsage
+	fs.Parse(expandShortFlags(args))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		analyzeUsage()
+		os.Exit(0)
+	}
+	opts.inputs = append(opts.inputs, fs.Args()...)
+	if len(opts.inputs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: input file must be specified.\n")
+		analyzeUsage()
+		os.Exit(exitUsage)
+	}
+
+	// Entries are located by line in text input, by file only otherwise
+	set := setFlags(fs)
+	var sps []ipbin.SourcedPrefix
+	for _, path := range opts.inputs {
+		o := opts
+		o.inputFilepath = path
+		inferInput(&o, set)
+		if o.binIn || (o.inFormat != "" && o.inFormat != "text") {
+			nets, err := readPrefixes(&o)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+				os.Exit(exitStatus(err))
+			}
+			for _, p := range nets {
+				sps = append(sps, ipbin.SourcedPrefix{Prefix: p, Origin: ipbin.Origin{Source: path, Text: p.String()}})
+			}
+			continue
+		}
+		r, closeInput, err := openInput(&o)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			os.Exit(exitStatus(err))
+		}
+		fileSPs, err := ipbin.ParseIPSubnetsWithOrigin(r, path)
+		closeInput()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			os.Exit(exitStatus(err))
+		}
+		sps = append(sps, fileSPs...)
+	}
+
+	a, err := ipbin.AnalyzeInput(sps)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error analyzing input: %v\n", err)
+		os.Exit(exitError)
+	}
+	share := func(n int) string {
+		if a.Entries == 0 {
+			return ""
+		}
+		return fmt.Sprintf(" (%.1f%%)", float64(n)*100/float64(a.Entries))
+	}
+	fmt.Printf("Entries:      %d\n", a.Entries)
+	fmt.Printf("Duplicates:   %d%s\n", a.Duplicates, share(a.Duplicates))
+	fmt.Printf("Contained:    %d%s\n", a.Contained, share(a.Contained))
+	fmt.Printf("Adjacent:     %d%s\n", a.Adjacent, share(a.Adjacent))
+	fmt.Printf("Merged:       %d prefixes%s\n", a.Merged, share(a.Merged))
+	if !list {
+		return
+	}
+	fmt.Println()
+	for _, f := range a.Findings {
+		fmt.Printf("%s %s %s\n", formatOrigin(f.Entry.Origin), f.Kind, formatOrigin(f.Other.Origin))
+	}
+}
+
+// formatOrigin formats the origin of an entry, without line number if
+// unknown
+func formatOrigin(o ipbin.Origin) string {
+	if o.Line == 0 {
+		return o.Source + ": " + o.Text
+	}
+	return o.String()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"io"
+	"net/netip"
+	"os"
+)
+
+// announcer pushes route updates into a running BGP speaker
+type announcer interface {
+	Announce(p netip.Prefix) error
+	Withdraw(p netip.Prefix) error
+	Close() error
+}
+
+// exabgpAnnouncer writes ExaBGP API commands into its named pipe, or to
+// stdout with --dry-run
+type exabgpAnnouncer struct {
+	w         io.WriteCloser
+	nextHop   string
+	community string
+	flowSpec  bool // flowspec rules discarding the traffic instead of routes
+}
+
+func newExaBGPAnnouncer(pipePath, nextHop, community string, flowSpec bool) (*exabgpAnnouncer, error) {
+	f, err := os.OpenFile(pipePath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &exabgpAnnouncer{w: f, nextHop: nextHop, community: community, flowSpec: flowSpec}, nil
+}
+
+func (a *exabgpAnnouncer) Announce(p netip.Prefix) error {
+	cmd := ipbin.ExaBGPAnnounce(p, a.nextHop, a.community)
+	if a.flowSpec {
+		cmd = ipbin.ExaBGPFlowAnnounce(p)
+	}
+	_, err := io.WriteString(a.w, cmd+"\n")
+	return err
+}
+
+func (a *exabgpAnnouncer) Withdraw(p netip.Prefix) error {
+	cmd := ipbin.ExaBGPWithdraw(p, a.nextHop)
+	if a.flowSpec {
+		cmd = ipbin.ExaBGPFlowWithdraw(p)
+	}
+	_, err := io.WriteString(a.w, cmd+"\n")
+	return err
+}
+
+func (a *exabgpAnnouncer) Close() error {
+	return a.w.Close()
+}
+
+func announceUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin announce [options] <state-file>
+
+Announces the merged input prefixes into a running BGP speaker and withdraws
+prefixes announced by the previous run. Announced prefixes are remembered in
+<state-file> (binary format). With --flowspec, they are announced as flowspec
+rules discarding the traffic destined to them instead of routes.
+
+Options:
+`+inputUsage+`      --exabgp string      Path of the ExaBGP API named pipe
+      --gobgp string       GoBGP daemon gRPC API address host[:port] (default port: 50051)
+      --next-hop string    BGP next-hop (default: self)
+      --community string   BGP community, empty for none (default: 65535:666)
+      --flowspec           Announce flowspec rules discarding the traffic to the prefixes, without next-hop
+                           and community, instead of routes
+  -n, --dry-run            Print the updates without pushing them
+  -h, --help               Show this help message
+`)
+}
+
+func runAnnounce(args []string) {
+	var opts options
+	var exabgpPipe, gobgpAddr string
+	var flowSpec, dryRun, showHelp bool
+
+	fs := flag.NewFlagSet("announce", flag.ExitOnError)
+	addInputFlags(fs, &opts)
+	fs.StringVar(&exabgpPipe, "exabgp", "", "Path of the ExaBGP API named pipe")
+	fs.StringVar(&gobgpAddr, "gobgp", "", "GoBGP daemon address")
+	fs.StringVar(&opts.nextHop, "next-hop", "self", "BGP next-hop")
+	fs.StringVar(&opts.community, "community", ipbin.BlackholeCommunity, "BGP community")
+	fs.BoolVar(&flowSpec, "flowspec", false, "Announce flowspec rules discarding the traffic instead of routes")
+	fs.BoolVar(&dryRun, "dry-run", false, "Print the updates without pushing them")
+	fs.BoolVar(&dryRun, "n", false, "Print the updates without pushing them (shorthand)")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = announceUsage
+	fs.Parse(expandShortFlags(args))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		announceUsage()
+		os.Exit(0)
+	}
+	if fs.NArg() < 1 || len(opts.inputs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: input file and state file must be specified.\n")
+		announceUsage()
+		os.Exit(exitUsage)
+	}
+	if !dryRun && (exabgpPipe == "") == (gobgpAddr == "") {
+		fmt.Fprintf(os.Stderr, "Error: exactly one of --exabgp or --gobgp must be specified.\n")
+		announceUsage()
+		os.Exit(exitUsage)
+	}
+	statePath := fs.Arg(0)
+
+	prefixes, err := readInputs(&opts, setFlags(fs))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+	ipset, err := ipbin.MergePrefixes(prefixes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error merging prefixes: %v\n", err)
+		os.Exit(exitError)
+	}
+	next := ipset.Prefixes()
+
+	prev, err := readPrefixes(&options{inputFilepath: statePath, binIn: true})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Error reading state: %v\n", err)
+		os.Exit(exitError)
+	}
+	added, removed := ipbin.DiffPrefixes(prev, next)
+	fmt.Printf("Announcing %d prefixes, withdrawing %d prefixes...\n", len(added), len(removed))
+
+	if dryRun {
+		a := &exabgpAnnouncer{w: os.Stdout, nextHop: opts.nextHop, community: opts.community, flowSpec: flowSpec}
+		if err := pushUpdates(a, added, removed); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	var a announcer
+	if exabgpPipe != "" {
+		a, err = newExaBGPAnnouncer(exabgpPipe, opts.nextHop, opts.community, flowSpec)
+	} else {
+		var c *ipbin.GoBGPClient
+		if c, err = ipbin.NewGoBGPClient(gobgpAddr, opts.nextHop, opts.community); err == nil {
+			c.FlowSpec = flowSpec
+			a = c
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening BGP speaker: %v\n", err)
+		os.Exit(exitError)
+	}
+	// Closed before exiting either way, flushing the updates written
+	err = pushUpdates(a, added, removed)
+	if cerr := a.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("closing BGP speaker: %w", cerr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		os.Exit(exitError)
+	}
+
+	if err := writePrefixes(&options{outputFilepath: statePath, binOut: true}, ipset); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing state: %v\n", err)
+		os.Exit(exitError)
+	}
+	fmt.Println("Done.")
+}
+
+// pushUpdates announces the added prefixes, then withdraws the removed ones,
+// so that replaced prefixes never leave a gap
+func pushUpdates(a announcer, added, removed []netip.Prefix) error {
+	for _, p := range added {
+		if err := a.Announce(p); err != nil {
+			return fmt.Errorf("announcing %s: %w", p, err)
+		}
+	}
+	for _, p := range removed {
+		if err := a.Withdraw(p); err != nil {
+			return fmt.Errorf("withdrawing %s: %w", p, err)
+		}
+	}
+	return nil
+}
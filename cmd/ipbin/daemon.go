@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+func daemonUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin daemon [options] <config-file>
+
+daemon runs the jobs of a configuration file, each an ipbin command run at
+startup then on a cron schedule, logs their runs, and serves their status
+as JSON at /status, and at /healthz, a 503 status if the last run of a job
+failed. On SIGTERM or SIGINT, it waits for the running jobs to complete,
+for at most the shutdown timeout, then kills them. See the README for the
+configuration.
+
+Options:
+      --listen string      Address the status endpoint listens on, unless socket activated by systemd
+                           (default: the listen key of the config)
+      --log-format string  Log format: plain, text or json (default: text)
+`+serverUsage+`  -h, --help               Show this help message
+`)
+}
+
+// jobStatus is the status of a daemon job, as served at /status
+type jobStatus struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Running  bool   `json:"running"`
+	Runs     int    `json:"runs"`
+	Failures int    `json:"failures"`
+	// Of the last run, if any
+	LastStart    *time.Time `json:"last_start,omitempty"`
+	LastDuration float64    `json:"last_duration_seconds"`
+	LastStatus   int        `json:"last_status"`
+	LastError    string     `json:"last_error,omitempty"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+}
+
+// daemon runs the jobs of a configuration and keeps their status
+type daemon struct {
+	self string          // the ipbin executable
+	stop context.Context // done on shutdown, when no job may start
+	kill context.Context // done once the running jobs must be killed
+
+	mu      sync.Mutex
+	status  []*jobStatus
+	running sync.WaitGroup
+}
+
+func runDaemon(args []string) {
+	var listen, logFormat string
+	var showHelp bool
+	var serverOpts serverOptions
+
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	fs.StringVar(&listen, "listen", "", "Address the status endpoint listens on")
+	addLogFlag(fs, &logFormat, "text")
+	addServerFlags(fs, &serverOpts)
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = daemonUsage
+	fs.Parse(expandShortFlags(args))
+
+	if showHelp {
+		daemonUsage()
+		os.Exit(0)
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: config file must be specified.\n")
+		daemonUsage()
+		os.Exit(exitUsage)
+	}
+	setupLogging(logFormat)
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+	config, err := ipbin.ParseDaemonConfig(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+		os.Exit(exitParse)
+	}
+	if listen == "" {
+		listen = config.Listen
+	}
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	kill, killJobs := context.WithCancel(context.Background())
+	d := &daemon{self: self, stop: shutdownContext(), kill: kill}
+	for _, job := range config.Jobs {
+		status := &jobStatus{Name: job.Name, Schedule: job.Schedule.String()}
+		d.status = append(d.status, status)
+		go d.schedule(job, status)
+	}
+	if listen == "" && os.Getenv("LISTEN_FDS") == "" {
+		if serverOpts.pprof != "" {
+			if err := startPprof(serverOpts.pprof); err != nil {
+				logger.Error("Error serving", "error", err)
+				os.Exit(exitError)
+			}
+		}
+		notifyReady()
+		<-d.stop.Done()
+		ipbin.SystemdNotify("STOPPING=1")
+	} else {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /status", d.serveStatus)
+		mux.HandleFunc("GET /healthz", d.serveHealth)
+		serveOpenAPI(mux, apiFeatures{daemon: true, auth: serverOpts.authenticated(), limited: serverOpts.rateLimit > 0})
+		if err := serveHTTP(d.stop, listen, mux, serverOpts); err != nil {
+			logger.Error("Error serving", "error", err)
+			os.Exit(exitError)
+		}
+	}
+
+	// No job starts once stopping, wait for the running ones
+	d.mu.Lock()
+	d.mu.Unlock()
+	drained := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(serverOpts.shutdownTimeout):
+		logger.Warn("killing running jobs", "timeout", serverOpts.shutdownTimeout)
+		killJobs()
+		<-drained
+	}
+	killJobs()
+	logger.Info("stopped")
+}
+
+// schedule runs job at startup, then at each time of its schedule. Runs
+// overlapping the next times skip them.
+func (d *daemon) schedule(job ipbin.DaemonJob, status *jobStatus) {
+	for d.run(job, status) {
+		next := job.Schedule.Next(time.Now())
+		if next.IsZero() {
+			logger.Warn("job not scheduled again", "job", job.Name)
+			return
+		}
+		d.mu.Lock()
+		status.NextRun = &next
+		d.mu.Unlock()
+		select {
+		case <-time.After(time.Until(next)):
+		case <-d.stop.Done():
+			return
+		}
+	}
+}
+
+// run runs job once, then its on-update command if it updated its output,
+// and reports whether it ran, not if the daemon is stopping
+func (d *daemon) run(job ipbin.DaemonJob, status *jobStatus) bool {
+	start := time.Now()
+	d.mu.Lock()
+	if d.stop.Err() != nil {
+		d.mu.Unlock()
+		return false
+	}
+	d.running.Add(1)
+	defer d.running.Done()
+	status.Running, status.LastStart = true, &start
+	d.mu.Unlock()
+	logger.Info("job started", "job", job.Name)
+
+	ctx, cancel := d.kill, func() {}
+	if job.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+	}
+	defer cancel()
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, d.self, job.Args...)
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err := cmd.Run()
+	code := -1 // if not started
+	if cmd.ProcessState != nil {
+		code = cmd.ProcessState.ExitCode()
+	}
+	var lastError string
+	if err != nil {
+		// The error message of ipbin, or why it did not exit
+		lastError = lastLine(output.String())
+		if d.kill.Err() != nil {
+			lastError = "killed on shutdown"
+		} else if ctx.Err() != nil {
+			lastError = "timed out after " + job.Timeout.String()
+		} else if code < 0 || lastError == "" {
+			lastError = err.Error()
+		}
+	}
+	duration := time.Since(start)
+
+	d.mu.Lock()
+	status.Running = false
+	status.Runs++
+	status.LastDuration, status.LastStatus, status.LastError = duration.Seconds(), code, ""
+	jobRuns.Add(job.Name, 1)
+	if code != 0 && code != exitUnchanged {
+		jobFailures.Add(job.Name, 1)
+		status.Failures++
+		status.LastError = lastError
+	}
+	d.mu.Unlock()
+
+	switch code {
+	case 0:
+		logger.Info("job finished", "job", job.Name, "duration", duration)
+	case exitUnchanged:
+		logger.Info("job finished", "job", job.Name, "duration", duration, "unchanged", true)
+		return true
+	default:
+		logger.Error("job failed", "job", job.Name, "duration", duration, "status", code, "error", lastError)
+		return true
+	}
+	if job.OnUpdate == "" {
+		return true
+	}
+	hook := exec.Command("sh", "-c", job.OnUpdate)
+	hook.Env = append(os.Environ(), "IPBIN_JOB="+job.Name)
+	if out, err := hook.CombinedOutput(); err != nil {
+		logger.Error("on-update failed", "job", job.Name, "error", err, "output", lastLine(string(out)))
+	}
+	return true
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\n")
+	return s[strings.LastIndexByte(s, '\n')+1:]
+}
+
+func (d *daemon) serveStatus(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	writeJSON(w, map[string]any{"jobs": d.status})
+}
+
+func (d *daemon) serveHealth(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.status {
+		if s.LastError != "" {
+			http.Error(w, fmt.Sprintf("job %s failed: %s", s.Name, s.LastError), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
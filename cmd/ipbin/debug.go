@@ -0,0 +1,54 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// The counters of the long-running commands, served at /debug/vars with
+// the memstats and cmdline of expvar
+var (
+	requestsServed = expvar.NewMap("requests")      // by status code
+	setVersion     = expvar.NewInt("set_version")   // of publish
+	setPrefixes    = expvar.NewInt("set_prefixes")  // of publish
+	updateErrors   = expvar.NewInt("update_errors") // of publish
+	jobRuns        = expvar.NewMap("job_runs")      // of daemon, by job
+	jobFailures    = expvar.NewMap("job_failures")  // of daemon, by job
+	started        = time.Now()
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	expvar.Publish("uptime_seconds", expvar.Func(func() any { return time.Since(started).Seconds() }))
+}
+
+// startPprof serves net/http/pprof at /debug/pprof/ and the expvar
+// counters at /debug/vars on addr, in the background. They are neither
+// authenticated nor encrypted, so addr should be a local or private one.
+func startPprof(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("--pprof: %w", err)
+	}
+	logger.Info(fmt.Sprintf("Serving pprof and metrics on %s...", l.Addr()), "addr", l.Addr().String())
+	// No write timeout, as CPU profiles and traces last their seconds
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			logger.Error("Error serving pprof", "error", err)
+		}
+	}()
+	return nil
+}
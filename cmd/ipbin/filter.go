@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"go4.org/netipx"
+	"os"
+	"strings"
+)
+
+func filterUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin filter [options] <input-file>...
+
+Writes the parts of the merged input inside, intersecting or outside of the
+given scopes. Scopes are comma-separated IPs, subnets or ranges.
+
+Options:
+`+inputUsage+`      --within string      Keep the addresses inside the scopes
+      --intersecting str   Keep the prefixes overlapping the scopes, in full
+      --outside string     Keep the addresses outside of the scopes
+  -o, --output string      Output file path (default: stdout)
+  -b                       Write output as binary (default for .bin files)
+  -z                       Write output as gzip (default for .gz files)
+      --out-compression s  Output compression: none, gzip or zstd (default: from the extension, .gz or .zst)
+      --encrypt-to str     Recipient or recipient file the output is encrypted to, repeatable (see ipbin keygen)
+  -s, --sep string         Separator for text output, with \n, \r, \t, \0, \\ and \xHH escapes (default: \n)
+      --sep0               Separate text output with NUL bytes, e.g. for xargs -0
+  -f, --format string      Output format, by name or legacy number (default: subnets+ips)
+      --fail-on-empty      Fail with status 6 instead of writing an empty set
+  -h, --help               Show this help message
+`)
+}
+
+// filterModes maps the scope options of the filter command to their filters
+var filterModes = map[string]func(ipset, scopes *netipx.IPSet) (*netipx.IPSet, error){
+	"within":       ipbin.FilterWithin,
+	"intersecting": ipbin.FilterIntersecting,
+	"outside":      ipbin.FilterOutside,
+}
+
+func runFilter(args []string) {
+	var opts options
+	var failOnEmpty, showHelp bool
+	scopes := map[string]*string{}
+
+	fs := flag.NewFlagSet("filter", flag.ExitOnError)
+	addInputFlags(fs, &opts)
+	for mode := range filterModes {
+		scopes[mode] = fs.String(mode, "", "Comma-separated scopes")
+	}
+	fs.StringVar(&opts.outputFilepath, "output", "-", "Output file path")
+	fs.StringVar(&opts.outputFilepath, "o", "-", "Output file path (shorthand)")
+	addOutputFlags(fs, &opts)
+	fs.BoolVar(&failOnEmpty, "fail-on-empty", false, "Fail instead of writing an empty set")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = filterUsage
+	fs.Parse(expandShortFlags(args))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		filterUsage()
+		os.Exit(0)
+	}
+	opts.inputs = append(opts.inputs, fs.Args()...)
+	if len(opts.inputs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: input file must be specified.\n")
+		filterUsage()
+		os.Exit(exitUsage)
+	}
+	var mode string
+	for m, s := range scopes {
+		if *s == "" {
+			continue
+		}
+		if mode != "" {
+			fmt.Fprintf(os.Stderr, "Error: only one of --within, --intersecting or --outside can be specified.\n")
+			os.Exit(exitUsage)
+		}
+		mode = m
+	}
+	if mode == "" {
+		fmt.Fprintf(os.Stderr, "Error: one of --within, --intersecting or --outside must be specified.\n")
+		filterUsage()
+		os.Exit(exitUsage)
+	}
+	if err := unescapeOutput(&opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	set := setFlags(fs)
+	if opts.outputFilepath != "-" {
+		inferOutput(&opts, set)
+	} else {
+		// Terminate the last line on the terminal
+		opts.eol = true
+	}
+
+	nets, err := ipbin.ParseIPSubnets(strings.NewReader(strings.Join(splitList(*scopes[mode]), "\n")))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing scopes: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	scopeSet, err := ipbin.MergePrefixes(nets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing scopes: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	prefixes, err := readInputs(&opts, set)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+	ipset, err := ipbin.MergePrefixes(prefixes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error merging prefixes: %v\n", err)
+		os.Exit(exitError)
+	}
+	if ipset, err = filterModes[mode](ipset, scopeSet); err != nil {
+		fmt.Fprintf(os.Stderr, "Error filtering prefixes: %v\n", err)
+		os.Exit(exitError)
+	}
+	if failOnEmpty && len(ipset.Prefixes()) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: the output set is empty.\n")
+		os.Exit(exitEmpty)
+	}
+	if err := writePrefixes(&opts, ipset); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(exitError)
+	}
+}
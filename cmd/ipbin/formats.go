@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"io"
+	"net/netip"
+)
+
+// Input formats depending on network lookups or local databases, on top of
+// the built-in formats of the library
+func init() {
+	ipbin.RegisterInputFormat("asn", func(r io.Reader, opts ipbin.ParseOptions) ([]netip.Prefix, error) {
+		asns, err := ipbin.ParseASNs(r)
+		if err != nil {
+			return nil, err
+		}
+		resolver, err := asnResolver(opts.Params.Get("asn-source", "ripestat"))
+		if err != nil {
+			return nil, err
+		}
+		return ipbin.ResolveASNs(asns, resolver)
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"go4.org/netipx"
+	"net/netip"
+	"os"
+)
+
+func textconvUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin textconv [options] <file>
+
+Prints the merged prefixes of a set file, binary or text, compressed or
+encrypted, one per line after a line counting them, for git to diff sets
+as text. In the git config, for the files marked diff=ipbin in
+.gitattributes:
+  [diff "ipbin"]
+      textconv = ipbin textconv
+
+Options:
+      --identity file      Identity file decrypting encrypted inputs, repeatable (see ipbin keygen)
+      --in-format string   Text input format (default: text)
+  -h, --help               Show this help message
+`)
+}
+
+func gitdiffUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin gitdiff [options] <old-file> <new-file>
+       ipbin gitdiff [options] <path> <old-file> <old-hex> <old-mode> <new-file> <new-hex> <new-mode>
+
+Prints the prefixes removed from and added to a set file, binary or text,
+compressed or encrypted, in address order, then the counts of prefixes of
+both versions. The second form is the command line of git diff drivers. In
+the git config, for the files marked diff=ipbin in .gitattributes:
+  [diff "ipbin"]
+      command = ipbin gitdiff
+
+Options:
+      --identity file      Identity file decrypting encrypted inputs, repeatable (see ipbin keygen)
+      --in-format string   Text input format (default: text)
+  -h, --help               Show this help message
+`)
+}
+
+// gitFlags returns the flag set of the git commands, parsed from args
+func gitFlags(name string, args []string, usage func(), opts *options) *flag.FlagSet {
+	var showHelp bool
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Func("identity", "Identity file decrypting encrypted inputs, repeatable", func(path string) error {
+		opts.identities = append(opts.identities, path)
+		return nil
+	})
+	fs.StringVar(&opts.inFormat, "in-format", "text", "Text input format")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = usage
+	fs.Parse(expandShortFlags(args))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		usage()
+		os.Exit(0)
+	}
+	return fs
+}
+
+func runTextconv(args []string) {
+	var opts options
+	fs := gitFlags("textconv", args, textconvUsage, &opts)
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: file must be specified.\n")
+		textconvUsage()
+		os.Exit(exitUsage)
+	}
+	ipset, err := readSetFile(fs.Arg(0), &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", fs.Arg(0), err)
+		os.Exit(exitStatus(err))
+	}
+	prefixes := ipset.Prefixes()
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(w, "# %s\n", countPrefixes(prefixes))
+	for _, p := range prefixes {
+		fmt.Fprintln(w, ipbin.FormatPrefixCompact(p))
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(exitError)
+	}
+}
+
+func runGitdiff(args []string) {
+	var opts options
+	fs := gitFlags("gitdiff", args, gitdiffUsage, &opts)
+	var oldPath, newPath, name string
+	switch fs.NArg() {
+	case 2:
+		oldPath, newPath, name = fs.Arg(0), fs.Arg(1), fs.Arg(1)
+	case 7:
+		name, oldPath, newPath = fs.Arg(0), fs.Arg(1), fs.Arg(4)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: old and new files must be specified.\n")
+		gitdiffUsage()
+		os.Exit(exitUsage)
+	}
+	var sets [2]*netipx.IPSet
+	for i, path := range []string{oldPath, newPath} {
+		var err error
+		if sets[i], err = readSetFile(path, &opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+			os.Exit(exitStatus(err))
+		}
+	}
+	oldPrefixes, newPrefixes := sets[0].Prefixes(), sets[1].Prefixes()
+	added, removed := ipbin.DiffPrefixes(oldPrefixes, newPrefixes)
+	summary := fmt.Sprintf("%d added, %d removed: %s -> %s", len(added), len(removed), countPrefixes(oldPrefixes), countPrefixes(newPrefixes))
+
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(w, "ipbin diff %s\n", name)
+	// Both lists are in address order, merge them
+	for len(added) > 0 || len(removed) > 0 {
+		if len(added) == 0 || len(removed) > 0 && removed[0].Addr().Compare(added[0].Addr()) <= 0 {
+			fmt.Fprintf(w, "-%s\n", ipbin.FormatPrefixCompact(removed[0]))
+			removed = removed[1:]
+		} else {
+			fmt.Fprintf(w, "+%s\n", ipbin.FormatPrefixCompact(added[0]))
+			added = added[1:]
+		}
+	}
+	fmt.Fprintln(w, summary)
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(exitError)
+	}
+}
+
+// readSetFile reads the merged set of a file, of any encoding, empty if it
+// is /dev/null as given by git for added and deleted files
+func readSetFile(path string, opts *options) (*netipx.IPSet, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, layers, _, err := peelLayers(raw, opts.identities)
+	if err != nil {
+		return nil, err
+	}
+	var prefixes []netip.Prefix
+	if layers[len(layers)-1] == "binary" {
+		prefixes, err = ipbin.DecodeAll(data, ipbin.DecodeOptions{})
+	} else {
+		parse, ok := ipbin.InputFormat(opts.inFormat)
+		if !ok {
+			return nil, fmt.Errorf("unknown input format: %s", opts.inFormat)
+		}
+		prefixes, err = parse(bytes.NewReader(data), ipbin.ParseOptions{Params: opts.params})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ipbin.MergePrefixes(prefixes)
+}
+
+// countPrefixes formats the count of prefixes by address family
+func countPrefixes(prefixes []netip.Prefix) string {
+	stats := ipbin.PrefixStats(prefixes)
+	return fmt.Sprintf("%d prefixes (IPv4 %d, IPv6 %d)", stats.Records(), stats.IPv4, stats.IPv6)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"io"
+	"os"
+	"time"
+)
+
+func indexUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin index [options] <input.bin> <output.bin>
+
+index writes the binary set of the input, or of the standard input if "-",
+with an index, for lookups reading a single block (see query --indexed).
+Unlike -b --index, it keeps the records as they are, with their expiry and
+values, rather than merging them, so that the indexed format can be built
+from arbitrary record streams: records not sorted by address are detected
+and sorted first, in memory up to --max-memory and through temporary files
+beyond.
+
+Options:
+      --assume-sorted      Skip the check of the order of the records, e.g. for large sets known to be
+                           sorted; indexing then fails on unsorted records
+      --max-memory size    Memory sorting the records takes, e.g. 512M, spilling sorted runs to temporary
+                           files beyond (default: 256M)
+      --source string      Source description of the metadata (default: that of the input, or its path)
+  -h, --help               Show this help message
+`)
+}
+
+func runIndex(args []string) {
+	var assumeSorted, showHelp bool
+	var source string
+	maxMemory := int64(ipbin.DefaultSortMemory)
+
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	fs.BoolVar(&assumeSorted, "assume-sorted", false, "Skip the check of the order of the records")
+	fs.Func("max-memory", "Memory sorting the records takes, e.g. 512M", func(s string) error {
+		var err error
+		maxMemory, err = parseByteSize(s)
+		return err
+	})
+	fs.StringVar(&source, "source", "", "Source description of the metadata")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = indexUsage
+	fs.Parse(expandShortFlags(args))
+
+	if showHelp {
+		indexUsage()
+		os.Exit(0)
+	}
+	if fs.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "Error: input and output files must be specified.\n")
+		indexUsage()
+		os.Exit(exitUsage)
+	}
+	inputPath, outputPath := fs.Arg(0), fs.Arg(1)
+
+	var data []byte
+	var err error
+	if inputPath == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(inputPath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+	m, off, err := ipbin.ReadMetadataFromBytes(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitParse)
+	}
+	records := data[off:]
+
+	if !assumeSorted {
+		sorted, err := ipbin.RecordsSorted(records)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			os.Exit(exitStatus(err))
+		}
+		if !sorted {
+			if outputPath != "-" {
+				fmt.Printf("Sorting %d bytes of records...\n", len(records))
+			}
+			var buf bytes.Buffer
+			buf.Grow(len(records))
+			if err := ipbin.SortRecords(shutdownContext(), &buf, bytes.NewReader(records), maxMemory, ""); err != nil {
+				fmt.Fprintf(os.Stderr, "Error sorting records: %v\n", err)
+				os.Exit(exitStatus(err))
+			}
+			records = buf.Bytes()
+		}
+	}
+	index, err := ipbin.BuildIndex(records, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error indexing records: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+
+	if source != "" {
+		m.Source = source
+	} else if m.Source == "" {
+		m.Source = inputPath
+	}
+	if m.Generated.IsZero() {
+		m.Generated = time.Now()
+	}
+	m.Version, m.Index = toolVersion(), index
+	var w io.Writer = os.Stdout
+	if outputPath != "-" {
+		f, err := os.Create(outputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			os.Exit(exitStatus(err))
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := ipbin.WriteContainer(w, m, records); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+	if outputPath != "-" {
+		fmt.Printf("Indexed %d bytes of records in %d blocks.\n", len(records), len(index))
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+func infoUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin info [options] <file>
+
+info detects the encoding of a set file (encryption, compression, binary or
+text) and prints its record counts by address family, its sizes in each
+encoding, and the metadata of binary sets: when and from which sources it
+was generated, by which version of ipbin, and whether its content matches
+the recorded SHA-256. Binary records are counted without building the set.
+
+Options:
+      --identity file      Identity file decrypting encrypted inputs, repeatable (see ipbin keygen)
+      --in-format string   Text input format (default: text)
+  -h, --help               Show this help message
+`)
+}
+
+func runInfo(args []string) {
+	var opts options
+	var showHelp bool
+
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	fs.Func("identity", "Identity file decrypting encrypted inputs, repeatable", func(path string) error {
+		opts.identities = append(opts.identities, path)
+		return nil
+	})
+	fs.StringVar(&opts.inFormat, "in-format", "text", "Text input format")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = infoUsage
+	fs.Parse(expandShortFlags(args))
+
+	if showHelp {
+		infoUsage()
+		os.Exit(0)
+	}
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Error: file must be specified.\n")
+		infoUsage()
+		os.Exit(exitUsage)
+	}
+	path := fs.Arg(0)
+	opts.params = flagParams(fs)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+	data, layers, compressedSize, err := peelLayers(raw, opts.identities)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s input: %v\n", layers[len(layers)-1], err)
+		os.Exit(exitStatus(err))
+	}
+
+	var stats ipbin.Stats
+	if layers[len(layers)-1] == "binary" {
+		stats, err = ipbin.BinaryStats(data, time.Now())
+	} else {
+		parse, ok := ipbin.InputFormat(opts.inFormat)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: unknown input format: %s\n", opts.inFormat)
+			os.Exit(exitUsage)
+		}
+		prefixes, perr := parse(bytes.NewReader(data), ipbin.ParseOptions{Params: opts.params})
+		stats, err = ipbin.PrefixStats(prefixes), perr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+
+	fmt.Printf("File:         %s\n", path)
+	fmt.Printf("Encoding:     %s\n", strings.Join(layers, ", "))
+	fmt.Printf("Size:         %d bytes\n", len(raw))
+	if compressedSize > 0 {
+		fmt.Printf("Decompressed: %d bytes (ratio %.2f)\n", len(data), float64(len(data))/float64(compressedSize))
+	}
+	fmt.Printf("Records:      %d (IPv4 %d, IPv6 %d)\n", stats.Records(), stats.IPv4, stats.IPv6)
+	if stats.Expiring > 0 {
+		fmt.Printf("Expiring:     %d (%d expired)\n", stats.Expiring, stats.Expired)
+	}
+	if stats.Valued > 0 {
+		fmt.Printf("Valued:       %d\n", stats.Valued)
+	}
+	fmt.Printf("Binary size:  %d bytes of records\n", stats.RecordBytes)
+	fmt.Printf("Text size:    %d bytes\n", stats.TextBytes)
+	if stats.Blocks > 0 {
+		fmt.Printf("Blocks:       %d\n", stats.Blocks)
+	}
+	if stats.Sets > 1 {
+		fmt.Printf("Sets:         %d concatenated\n", stats.Sets)
+	}
+	if stats.HasMetadata {
+		m := stats.Metadata
+		fmt.Printf("Generated:    %s\n", formatTime(m.Generated))
+		fmt.Printf("Source:       %s\n", m.Source)
+		fmt.Printf("Version:      %s\n", m.Version)
+		fmt.Printf("SHA-256:      %x\n", m.SHA256)
+		if len(m.Index) > 0 {
+			fmt.Printf("Index:        %d blocks\n", len(m.Index))
+		}
+		if m.Format > 1 {
+			fmt.Printf("Format:       v%d\n", m.Format)
+		}
+		if m.Merged {
+			fmt.Printf("Merged:       yes\n")
+		}
+	}
+	if stats.Sets == 0 {
+		return
+	}
+	// The content hash of each of concatenated sets covers its own records
+	sections, err := ipbin.Sections(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+	for i, s := range sections {
+		if !s.HasMetadata || s.Metadata.Verify(s.Records) {
+			continue
+		}
+		if len(sections) > 1 {
+			fmt.Fprintf(os.Stderr, "Error: %s: content of set %d does not match the SHA-256\n", path, i+1)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s: content does not match the SHA-256\n", path)
+		}
+		os.Exit(exitValidation)
+	}
+}
+
+// formatTime formats a metadata time, "-" if unknown
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// peelLayers decrypts and decompresses the content of a set file, outermost
+// layer first, and returns it with its encodings, ending with "binary" or
+// "text", and the size of its compressed layer, if any. On error, the last
+// encoding is that of the layer failing.
+func peelLayers(data []byte, identities []string) (_ []byte, layers []string, compressedSize int, err error) {
+	for {
+		encoding := ipbin.DetectEncoding(data)
+		layers = append(layers, encoding)
+		if encoding == "binary" || encoding == "text" {
+			return data, layers, compressedSize, nil
+		}
+		var r io.Reader
+		closeReader := func() {}
+		if encoding == "encrypted" {
+			r, err = decryptInput(bytes.NewReader(data), identities)
+		} else {
+			r, closeReader, err = decompress(bytes.NewReader(data), encoding)
+			compressedSize = len(data)
+		}
+		if err == nil {
+			data, err = io.ReadAll(r)
+			closeReader()
+		}
+		if err != nil {
+			return nil, layers, 0, err
+		}
+	}
+}
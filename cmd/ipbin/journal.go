@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"net/netip"
+	"os"
+	"time"
+)
+
+func journalUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin journal record [options] <journal-file>
+       ipbin journal replay [options] <journal-file>
+       ipbin journal log [options] <journal-file>
+
+A journal is an append-only file of timestamped additions to and removals
+from a set.
+
+record appends the changes turning the journaled set into the merged input.
+Options:
+`+inputUsage+`
+replay writes the set as it was at a point in time.
+Options:
+      --at time            RFC 3339 time to replay the journal up to (default: now)
+  -o, --output string      Output file path (default: stdout)
+  -b                       Write output as binary (default for .bin files)
+  -z                       Write output as gzip (default for .gz files)
+      --out-compression s  Output compression: none, gzip or zstd (default: from the extension, .gz or .zst)
+      --encrypt-to str     Recipient or recipient file the output is encrypted to, repeatable (see ipbin keygen)
+  -s, --sep string         Separator for text output, with \n, \r, \t, \0, \\ and \xHH escapes (default: \n)
+      --sep0               Separate text output with NUL bytes, e.g. for xargs -0
+  -f, --format string      Output format, by name or legacy number (default: subnets+ips)
+
+log prints the entries of the journal.
+Options:
+      --addr string        Only print the entries overlapping this address or prefix
+`)
+}
+
+// readJournal reads the journal at path, empty if it does not exist yet
+func readJournal(path string) ([]ipbin.JournalEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ipbin.ReadJournal(f)
+}
+
+func runJournal(args []string) {
+	if len(args) < 1 {
+		journalUsage()
+		os.Exit(exitUsage)
+	}
+	var opts options
+	var at, addr string
+	var showHelp bool
+
+	fs := flag.NewFlagSet("journal "+args[0], flag.ExitOnError)
+	switch args[0] {
+	case "record":
+		addInputFlags(fs, &opts)
+	case "replay":
+		addOutputFlags(fs, &opts)
+		fs.StringVar(&opts.outputFilepath, "output", "-", "Output file path")
+		fs.StringVar(&opts.outputFilepath, "o", "-", "Output file path (shorthand)")
+		fs.StringVar(&at, "at", "", "RFC 3339 time to replay the journal up to")
+	case "log":
+		fs.StringVar(&addr, "addr", "", "Only print the entries overlapping this address or prefix")
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown journal command: %s\n", args[0])
+		journalUsage()
+		os.Exit(exitUsage)
+	}
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = journalUsage
+	fs.Parse(expandShortFlags(args[1:]))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		journalUsage()
+		os.Exit(0)
+	}
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Error: journal file must be specified.\n")
+		journalUsage()
+		os.Exit(exitUsage)
+	}
+	journalPath := fs.Arg(0)
+	journal, err := readJournal(journalPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading journal: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+
+	switch args[0] {
+	case "record":
+		if len(opts.inputs) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: input file must be specified.\n")
+			journalUsage()
+			os.Exit(exitUsage)
+		}
+		prefixes, err := readInputs(&opts, setFlags(fs))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			os.Exit(exitStatus(err))
+		}
+		next, err := ipbin.MergePrefixes(prefixes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error merging prefixes: %v\n", err)
+			os.Exit(exitError)
+		}
+		now := time.Now()
+		prev, err := ipbin.Replay(journal, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error replaying journal: %v\n", err)
+			os.Exit(exitError)
+		}
+		entries, err := ipbin.JournalChanges(prev, next, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error diffing sets: %v\n", err)
+			os.Exit(exitError)
+		}
+		var b []byte
+		for _, e := range entries {
+			if b, err = ipbin.AppendJournalEntry(b, e); err != nil {
+				fmt.Fprintf(os.Stderr, "Error encoding journal: %v\n", err)
+				os.Exit(exitError)
+			}
+		}
+		f, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening journal: %v\n", err)
+			os.Exit(exitError)
+		}
+		_, err = f.Write(b)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing journal: %v\n", err)
+			os.Exit(exitError)
+		}
+		fmt.Printf("Recorded %d changes.\n", len(entries))
+
+	case "replay":
+		t := time.Now()
+		if at != "" {
+			if t, err = time.Parse(time.RFC3339, at); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid --at time: %v\n", err)
+				os.Exit(exitUsage)
+			}
+		}
+		if err := unescapeOutput(&opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		if opts.outputFilepath != "-" {
+			inferOutput(&opts, setFlags(fs))
+		} else {
+			opts.eol = true
+		}
+		ipset, err := ipbin.Replay(journal, t)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error replaying journal: %v\n", err)
+			os.Exit(exitError)
+		}
+		if err := writePrefixes(&opts, ipset); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			os.Exit(exitError)
+		}
+
+	case "log":
+		var filter netip.Prefix
+		if addr != "" {
+			if filter, err = netip.ParsePrefix(addr); err != nil {
+				a, aerr := netip.ParseAddr(addr)
+				if aerr != nil {
+					fmt.Fprintf(os.Stderr, "Error: invalid --addr: %s\n", addr)
+					os.Exit(exitUsage)
+				}
+				filter = netip.PrefixFrom(a, a.BitLen())
+			}
+		}
+		for _, e := range journal {
+			if !filter.IsValid() || e.Prefix.Overlaps(filter) {
+				fmt.Println(e)
+			}
+		}
+	}
+}
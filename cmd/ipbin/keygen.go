@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"os"
+)
+
+func keygenUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin keygen [options] [<identity-file>]
+
+keygen generates an X25519 identity for encrypted sets, written to the
+identity file (default: stdout), and prints its recipient. Outputs are
+encrypted with --encrypt-to <recipient> and read with --identity <identity-file>.
+
+Options:
+  -h, --help               Show this help message
+`)
+}
+
+func runKeygen(args []string) {
+	var showHelp bool
+
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = keygenUsage
+	fs.Parse(expandShortFlags(args))
+
+	if showHelp {
+		keygenUsage()
+		os.Exit(0)
+	}
+	id, err := ipbin.GenerateIdentity()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating identity: %v\n", err)
+		os.Exit(exitError)
+	}
+	content := fmt.Sprintf("# recipient: %s\n%s\n", id.Recipient(), id)
+	if fs.NArg() < 1 {
+		fmt.Print(content)
+		return
+	}
+	path := fs.Arg(0)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing identity: %v\n", err)
+		os.Exit(exitError)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing identity: %v\n", err)
+		os.Exit(exitError)
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing identity: %v\n", err)
+		os.Exit(exitError)
+	}
+	fmt.Printf("Recipient: %s\n", id.Recipient())
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logUsage documents the option registered by addLogFlag
+const logUsage = `      --log-format string  Log format: plain, the messages only, text or json, with the durations of the stages
+                           and the requests served, on stderr (default: plain)
+`
+
+// logger logs the progress of the commands, set up by setupLogging
+var logger = slog.New(&plainHandler{out: os.Stderr})
+
+// addLogFlag registers the --log-format option, defaulting to format
+func addLogFlag(fs *flag.FlagSet, format *string, def string) {
+	fs.StringVar(format, "log-format", def, "Log format (plain, text, json)")
+}
+
+// setupLogging sets up logger for format, exiting on unknown ones
+func setupLogging(format string) {
+	switch format {
+	case "plain":
+		logger = slog.New(&plainHandler{out: os.Stderr})
+	case "text":
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown log format: %s\n", format)
+		os.Exit(exitUsage)
+	}
+}
+
+// plainHandler prints the messages of the records on out, stderr so that
+// they stay out of output written to stdout with "-": the progress, warnings,
+// prefixed with "Warning: ", and errors, followed by their error attribute.
+// Records with a duration, those measuring stages and requests, are left to
+// the other formats.
+type plainHandler struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	var errAttr string
+	measured := false
+	r.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case "duration":
+			measured = true
+		case "error":
+			errAttr = a.Value.String()
+		}
+		return true
+	})
+	if measured {
+		return nil
+	}
+	line := r.Message
+	switch {
+	case r.Level >= slog.LevelError:
+		if errAttr != "" {
+			line += ": " + errAttr
+		}
+	case r.Level >= slog.LevelWarn:
+		line = "Warning: " + line
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, line+"\n")
+	return err
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *plainHandler) WithGroup(name string) slog.Handler {
+	return h
+}
+
+// stage logs msg at the start of a stage of a command and returns the
+// function logging its end, with its duration and attrs
+func stage(name, msg string, attrs ...any) func(attrs ...any) {
+	logger.Info(msg, attrs...)
+	start := time.Now()
+	return func(attrs ...any) {
+		logger.Info(name+" done", append([]any{"stage", name, "duration", time.Since(start)}, attrs...)...)
+	}
+}
+
+// requestIDKey is the context key of the ID of a request
+type requestIDKey struct{}
+
+// requestID returns the ID of r given by logRequests
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// logRequests returns a handler passing the requests to handler with an
+// ID, that of their X-Request-Id header if sane, e.g. set by a proxy, or a
+// new one, returned in the X-Request-Id header of the response, and logging
+// them once served
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if len(id) == 0 || len(id) > 64 || strings.ContainsFunc(id, func(c rune) bool { return c <= ' ' || c > '~' }) {
+			var b [8]byte
+			rand.Read(b[:])
+			id = hex.EncodeToString(b[:])
+		}
+		w.Header().Set("X-Request-Id", id)
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		handler.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		requestsServed.Add(strconv.Itoa(rw.status), 1)
+		logger.Info("request", "request_id", id, "method", r.Method, "path", r.URL.Path,
+			"status", rw.status, "bytes", rw.bytes, "duration", time.Since(start), "remote", r.RemoteAddr)
+	})
+}
+
+// statusWriter records the status and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status, bytes int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the flushing of the response,
+// e.g. for event streams
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush flushes the response, as the event streams of Publisher need
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
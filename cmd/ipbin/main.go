@@ -2,190 +2,1099 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/anatoly-kussul/ipbin/ipbin"
+	"github.com/klauspost/compress/zstd"
 	"go4.org/netipx"
 	"io"
+	"io/fs"
+	"math"
+	"net"
 	"net/netip"
 	"os"
-)
-
-const (
-	OutFormatSubnetsIPs = 1 + iota
-	OutFormatRangesIPs
-	OutFormatSubnets
-	OutFormatRanges
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type options struct {
-	inputFilepath  string
+	inputs         []string // input file paths, merged
+	inputFilepath  string   // the input file being read
 	outputFilepath string
-	gzipOut        bool
-	gzipIn         bool
+	compressOut    string // "none", "gzip" or "zstd", inferred from the output file extension if empty
+	compressIn     string // "none", "gzip" or "zstd", inferred from the input file extension if empty
 	binIn          bool
 	binOut         bool
-	sepOut         string // only if not binOut, separator for text output, \n by default
-	formatOut      int    // only if not binOut
+	expireNow      bool                 // only if binIn, drop the expired records
+	strict         bool                 // only if binIn, reject non-canonical records
+	maxEntries     int                  // maximum number of prefixes per input, 0 for the defaults
+	maxBytes       int64                // maximum decompressed size per input, 0 for unlimited
+	maxMemory      int64                // memory budget of the merge, spilling to disk beyond, 0 for unlimited
+	assumeMerged   bool                 // the inputs, in order, are sorted and disjoint prefixes, joined in a single pass instead of merged
+	identities     []string             // identity files decrypting encrypted inputs
+	encryptTo      []string             // recipients or recipient files the output is encrypted to
+	ttl            time.Duration        // only if binOut, expiry of the written records from now, none if 0
+	source         string               // only if binOut, source description of the metadata, the inputs if empty
+	metadata       bool                 // only if binOut, precede the records with the metadata block
+	index          bool                 // only if binOut, index the records in the metadata block
+	v2             bool                 // only if binOut, write the records in format v2
+	endMarker      bool                 // only if binOut, end the records with an end-of-stream marker
+	blockRecords   int                  // only if binOut, records per block of the records, none if 0
+	shard          int                  // prefix length of the shards the output directory is split into, 8 or 16, none if 0
+	inFormat       string               // only if not binIn, format of text input, inferred from the extension or "text" if empty
+	sepOut         string               // only if not binOut, separator for text output, \n by default
+	eol            bool                 // only if not binOut, terminate the last record with the separator too
+	header         string               // only if not binOut, written before the output
+	footer         string               // only if not binOut, written after the output
+	prefixEach     string               // only if not binOut, written before each record
+	suffixEach     string               // only if not binOut, written after each record
+	limit          int                  // maximum number of prefixes written, -1 for all
+	offset         int                  // number of leading prefixes skipped
+	workers        int                  // goroutines encoding the output and decoding binary input in blocks, GOMAXPROCS if 0
+	formatOut      string               // only if not binOut, registered output format name or legacy number
+	nextHop        string               // only for announce
+	community      string               // only for announce
+	params         ipbin.Params         // all flags, passed to input and output formats
+	enrich         string               // only for the csv and json formats, comma-separated annotation sources
+	provenance     *ipbin.ProvenanceMap // sources of the merged inputs, for the sources enrichment
+	rdapInterval   time.Duration
+	geoipPath      string              // MaxMind country/city database, annotates the csv and json formats and enables country filters
+	geoipDB        *ipbin.MMDB         // loaded from geoipPath
+	filterCountry  string              // comma-separated countries to keep
+	dropCountry    string              // comma-separated countries to drop
+	asnMapPath     string              // prefix to ASN mapping file, annotates the csv and json formats
+	asnMap         *ipbin.PrefixASNMap // loaded from asnMapPath
+	groupBy        string              // only for the csv and json formats, attribute to group by
+	ctx            context.Context     // bounds the conversion, none if nil
+	// policy for 0.0.0.0/0 and ::/0 in input
+	defaultRoutes ipbin.DefaultRoutePolicy
+	// only for text input, resolves its host names if resolve
+	resolve  bool
+	resolver *ipbin.CachingResolver
+	// only if binOut, the hit counts of the addresses written as valued records
+	counts []ipbin.ValuedPrefix
+	// whether the prefixes read are merged already: with assumeMerged, or
+	// if binIn, for a single set written merged
+	merged bool
+	// the prefixes of the output, if written as read without building its set
+	prefixes []netip.Prefix
+}
+
+// Exit statuses, the contract of the commands with scripts
+const (
+	exitError      = 1 // I/O and other runtime errors
+	exitUsage      = 2 // invalid command line
+	exitUnchanged  = 3 // output unchanged, with --if-changed
+	exitParse      = 4 // malformed input
+	exitValidation = 5 // input or output failing a check: limits, default routes, coverage, hashes, signatures
+	exitEmpty      = 6 // empty output, with --fail-on-empty
+	exitConflict   = 7 // with merge3, conflicting changes
+	exitNotFound   = 8 // with query, an address not in the set, told apart from errors
+)
+
+// exitStatus returns the exit status of a command failing with err
+func exitStatus(err error) int {
+	var parseErr *ipbin.ParseError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, ipbin.ErrTooManyRecords), errors.Is(err, ipbin.ErrInputTooLarge),
+		errors.Is(err, ipbin.ErrDefaultRoute), errors.Is(err, ipbin.ErrSuspiciousCoverage), errors.Is(err, ipbin.ErrNotSorted):
+		return exitValidation
+	case errors.As(err, &parseErr), errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return exitParse
+	}
+	return exitError
+}
+
+// context returns the context bounding the conversion, e.g. by --timeout
+func (opts *options) context() context.Context {
+	if opts.ctx == nil {
+		return context.Background()
+	}
+	return opts.ctx
+}
+
+// inputUsage documents the input options shared by all commands
+const inputUsage = `  -i, --input string       Input file path, repeatable to merge several inputs
+  -B                       Read input as binary (default for .bin files)
+  -Z                       Read input as gzip (default for .gz files)
+      --expire-now         Drop the expired records of binary input
+      --strict             Reject non-canonical records (host bits set) in binary input
+      --max-entries n      Fail on inputs of more prefixes, e.g. for untrusted lists (default: unlimited,
+                           16M for binary input)
+      --max-bytes n        Fail on inputs larger than this once decompressed (default: unlimited)
+      --max-memory size    Merge within this memory, e.g. 512M, spilling to temporary files beyond, so that
+                           containers are not killed for merging large sets (default: unlimited)
+      --default-route str  0.0.0.0/0 and ::/0 in input: allow, reject or drop (default: allow)
+      --resolve            Resolve the host names of text input into their A and AAAA addresses
+      --resolve-timeout d  Timeout of each host name lookup (default: 5s)
+      --identity file      Identity file decrypting encrypted inputs, repeatable (see ipbin keygen)
+      --in-compression str Input compression: none, gzip or zstd (default: from the extension, .gz or .zst)
+      --in-format string   Text input format (text, aws, azure, gcp, cloudflare, asn, stix, taxii,
+                           misp-csv, misp-json, mmdb, p2p, routes, interfaces, pcap, extract, json,
+                           ndjson, yaml, toml)
+                           (default: extract with --extract-regex, detected for .json files, json
+                           for them with --json-path, ndjson for .ndjson and .jsonl files, mmdb for
+                           .mmdb files, p2p for .p2p files, pcap for .pcap and .pcapng files, yaml
+                           for .yaml and .yml files, toml for .toml files, text otherwise)
+      --service string     Comma-separated services to keep from cloud range files
+      --region string      Comma-separated regions to keep from cloud range files
+      --asn-source string  Source resolving AS numbers for the asn input format: "ripestat" or
+                           a prefix to ASN mapping file (pfx2as or MRT RIB dump) (default: ripestat)
+      --taxii-user string  Username for the taxii input format (password from IPBIN_TAXII_PASSWORD)
+      --misp-type string   Comma-separated MISP attribute types to keep (default: ip-src, ip-dst, ip-src|port,
+                           ip-dst|port, domain|ip)
+      --pcap-addrs string  Addresses of the packets read by the pcap input format: source, destination or
+                           both (default: source)
+      --extract-regex re   Extract the addresses of arbitrary text, e.g. logs, within the matches of this
+                           regular expression, or of its first group (implies --in-format extract)
+      --min-count n        Keep the addresses occurring at least n times in extract and pcap input
+                           (default: 1)
+      --top n              Keep only the n most frequent addresses of extract and pcap input (default: all)
+      --json-path string   Path of the addresses in arbitrary JSON input, or in each record of ndjson
+                           input, e.g. .data[].ip or ".items[] | .cidr" (implies --in-format json,
+                           but for .ndjson and .jsonl files)
+      --path string        Path of the addresses in yaml and toml input, e.g. .spec.allowedCIDRs or
+                           .rules[].cidr (default: the whole document)
+`
+
+// addInputFlags registers the input options shared by all commands
+func addInputFlags(fs *flag.FlagSet, opts *options) {
+	input := func(path string) error {
+		opts.inputs = append(opts.inputs, path)
+		return nil
+	}
+	fs.Func("input", "Input file path, repeatable", input)
+	fs.Func("i", "Input file path (shorthand)", input)
+	fs.BoolFunc("Z", "Read input as gzip", func(string) error {
+		opts.compressIn = "gzip"
+		return nil
+	})
+	fs.StringVar(&opts.compressIn, "in-compression", "", "Input compression (none, gzip, zstd)")
+	fs.BoolVar(&opts.binIn, "B", false, "Read input as binary")
+	fs.StringVar(&opts.inFormat, "in-format", "", "Text input format")
+	fs.BoolVar(&opts.expireNow, "expire-now", false, "Drop the expired records of binary input")
+	fs.BoolVar(&opts.strict, "strict", false, "Reject non-canonical records in binary input")
+	fs.IntVar(&opts.maxEntries, "max-entries", 0, "Maximum number of prefixes per input")
+	fs.Int64Var(&opts.maxBytes, "max-bytes", 0, "Maximum decompressed size per input")
+	fs.Func("max-memory", "Memory budget of the merge, e.g. 512M", func(s string) error {
+		var err error
+		opts.maxMemory, err = parseByteSize(s)
+		return err
+	})
+	fs.Func("default-route", "Policy for default routes in input (allow, reject, drop)", func(s string) error {
+		var err error
+		opts.defaultRoutes, err = ipbin.ParseDefaultRoutePolicy(s)
+		return err
+	})
+	// Shared by the copies of opts, looking each host name up once
+	opts.resolver = &ipbin.CachingResolver{Resolver: net.DefaultResolver}
+	fs.BoolVar(&opts.resolve, "resolve", false, "Resolve the host names of text input")
+	fs.DurationVar(&opts.resolver.Timeout, "resolve-timeout", 5*time.Second, "Timeout of each host name lookup")
+	fs.Func("identity", "Identity file decrypting encrypted inputs, repeatable", func(path string) error {
+		opts.identities = append(opts.identities, path)
+		return nil
+	})
+	// Format-specific options, passed to the formats through opts.params
+	fs.String("service", "", "Comma-separated services to keep from cloud range files")
+	fs.String("region", "", "Comma-separated regions to keep from cloud range files")
+	fs.String("asn-source", "ripestat", "Source resolving AS numbers (ripestat or mapping file path)")
+	fs.String("taxii-user", "", "Username for the taxii input format")
+	fs.String("misp-type", "", "Comma-separated MISP attribute types to keep")
+	fs.String("pcap-addrs", "source", "Addresses of the packets read by the pcap input format")
+	fs.String("extract-regex", "", "Regular expression within whose matches addresses are extracted")
+	fs.Int("min-count", 1, "Minimum occurrences of the addresses of extract and pcap input")
+	fs.Int("top", 0, "Number of most frequent addresses of extract and pcap input kept")
+	fs.String("json-path", "", "Path of the addresses in json and ndjson input")
+	fs.String("path", "", "Path of the addresses in yaml and toml input")
+}
+
+// addOutputFlags registers the output options shared by all commands
+// writing sets
+func addOutputFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolFunc("z", "Write output as gzip", func(string) error {
+		opts.compressOut = "gzip"
+		return nil
+	})
+	fs.StringVar(&opts.compressOut, "out-compression", "", "Output compression (none, gzip, zstd)")
+	fs.Func("encrypt-to", "Recipient or recipient file the output is encrypted to, repeatable", func(r string) error {
+		opts.encryptTo = append(opts.encryptTo, r)
+		return nil
+	})
+	fs.BoolVar(&opts.binOut, "b", false, "Write output as binary")
+	fs.StringVar(&opts.sepOut, "sep", "\n", "Separator for text output, with \\n, \\t, \\0... escapes")
+	fs.StringVar(&opts.sepOut, "s", "\n", "Separator for text output (shorthand)")
+	fs.BoolFunc("sep0", "Separate text output with NUL bytes", func(string) error {
+		opts.sepOut = "\x00"
+		return nil
+	})
+	fs.StringVar(&opts.formatOut, "format", "subnets+ips", "Output format")
+	fs.StringVar(&opts.formatOut, "f", "subnets+ips", "Output format (shorthand)")
+	opts.limit = -1
+}
+
+// parseByteSize parses a size in bytes, with an optional K, M or G suffix of
+// powers of 1024, e.g. 512M or 2Gi
+func parseByteSize(s string) (int64, error) {
+	digits := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	shift := 0
+	if i := strings.IndexAny(digits, "KMG"); i >= 0 && i == len(digits)-1 {
+		shift = 10 * (strings.IndexByte("KMG", digits[i]) + 1)
+		digits = digits[:i]
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n << shift, nil
+}
+
+// unescapeOutput interprets the escape sequences of the text output options
+func unescapeOutput(opts *options) error {
+	for _, s := range []*string{&opts.sepOut, &opts.header, &opts.footer, &opts.prefixEach, &opts.suffixEach} {
+		v, err := ipbin.UnescapeSeparator(*s)
+		if err != nil {
+			return err
+		}
+		*s = v
+	}
+	return nil
+}
+
+// compressionExts maps file extensions to compression methods
+var compressionExts = map[string]string{".gz": "gzip", ".zst": "zstd"}
+
+// fileExt returns the lowercased extension of path, after stripping a
+// compression extension, and the compression method of the latter
+func fileExt(path string) (ext, compression string) {
+	ext = strings.ToLower(filepath.Ext(path))
+	if c, ok := compressionExts[ext]; ok {
+		return strings.ToLower(filepath.Ext(strings.TrimSuffix(path, filepath.Ext(path)))), c
+	}
+	return ext, "none"
+}
+
+// setFlags returns the names of the flags of fs given on the command line
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// inferInput fills in the input options not given explicitly from the
+// extension of the input file
+func inferInput(opts *options, set map[string]bool) {
+	ext, compression := fileExt(opts.inputFilepath)
+	if opts.compressIn == "" {
+		opts.compressIn = compression
+	}
+	if set["B"] || set["in-format"] {
+		return
+	}
+	if set["extract-regex"] {
+		opts.inFormat = "extract"
+		return
+	}
+	if set["json-path"] {
+		// The addresses of an arbitrary JSON document, or of each record of
+		// NDJSON
+		opts.inFormat = "json"
+		if ext == ".ndjson" || ext == ".jsonl" {
+			opts.inFormat = "ndjson"
+		}
+		return
+	}
+	switch ext {
+	case ".bin":
+		opts.binIn = true
+	case ".json":
+		opts.inFormat = "detect"
+	case ".ndjson", ".jsonl":
+		opts.inFormat = "ndjson"
+	case ".mmdb":
+		opts.inFormat = "mmdb"
+	case ".p2p":
+		opts.inFormat = "p2p"
+	case ".pcap", ".pcapng":
+		opts.inFormat = "pcap"
+	case ".yaml", ".yml":
+		opts.inFormat = "yaml"
+	case ".toml":
+		opts.inFormat = "toml"
+	}
+}
+
+// inferOutput fills in the output options not given explicitly from the
+// extension of the output file
+func inferOutput(opts *options, set map[string]bool) {
+	ext, compression := fileExt(opts.outputFilepath)
+	if opts.compressOut == "" {
+		opts.compressOut = compression
+	}
+	if set["b"] || set["format"] || set["f"] {
+		return
+	}
+	switch ext {
+	case ".bin":
+		opts.binOut = true
+	case ".json":
+		opts.formatOut = "json"
+	case ".parquet":
+		opts.formatOut = "parquet"
+	case ".sqlite", ".sqlite3", ".db":
+		opts.formatOut = "sqlite"
+	}
+}
+
+// toolVersion returns the version of ipbin, as recorded in the metadata of
+// binary outputs
+func toolVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return "ipbin " + info.Main.Version
+	}
+	return "ipbin (devel)"
+}
+
+// flagParams returns the values of all flags of fs, including defaults
+func flagParams(fs *flag.FlagSet) ipbin.Params {
+	params := ipbin.Params{}
+	fs.VisitAll(func(f *flag.Flag) {
+		params[f.Name] = f.Value.String()
+	})
+	return params
 }
 
 func usage() {
 	fmt.Fprintf(os.Stderr, `Usage: ipbin [options] <output-file>
+       ipbin announce [options] <state-file>
+       ipbin report [options]
+       ipbin filter [options] <input-file>...
+       ipbin query [options] <address>...
+       ipbin analyze [options] <input-file>...
+       ipbin journal record|replay|log [options] <journal-file>
+       ipbin sign|verify [options] <file>
+       ipbin keygen [<identity-file>]
+       ipbin info [options] <file>
+       ipbin index [options] <input.bin> <output.bin>
+       ipbin publish [options]
+       ipbin subscribe [options] <url> <output-file>
+       ipbin merge3 [options] <base> <ours> <theirs>
+       ipbin textconv [options] <file>
+       ipbin gitdiff [options] <old-file> <new-file>
+       ipbin watch [options] -i <input>... <output-file>
+       ipbin daemon [options] <config-file>
 
 Options:
-  -i, --input string       Input file path
-  -B                       Read input as binary
-  -Z                       Read input as gzip
-  -b                       Write output as binary
-  -z                       Write output as gzip
-  -s, --sep string         Separator for text output (default: \n)
-  -f, --format int         Output format (1=subnets+ips, 2=ranges+ips, 3=subnets, 4=ranges)
+`+inputUsage+`  -b                       Write output as binary (default for .bin files)
+  -z                       Write output as gzip (default for .gz files)
+      --out-compression s  Output compression: none, gzip or zstd (default: from the extension, .gz or .zst)
+      --encrypt-to str     Recipient or recipient file the output is encrypted to, repeatable (see ipbin keygen)
+      --ttl duration       Expiry of the binary output records from now, e.g. 24h (default: none)
+      --source string      Source description recorded in the binary output metadata (default: the inputs)
+      --metadata           Precede binary output with a metadata block, with its generation time, source and
+                           SHA-256, which ipbin versions before it cannot read
+      --index              Index binary output for lookups reading a single block (see query --indexed), in
+                           the metadata block, implying --metadata
+      --v2                 Write binary output in format v2, leaving out runs of zero bytes of IPv6 prefixes,
+                           e.g. of 2001:db8::1, which ipbin versions before it cannot read
+      --end-marker         End binary output with an end-of-stream marker, telling readers of streams the set
+                           is whole
+      --block-records n    Write binary output in blocks of n records, each with a CRC-32C checksum, for
+                           integrity checks and parallel decoding, compressed in frames decompressed in
+                           parallel too (default: none)
+      --counts             Store the hit counts of extract and pcap input in binary output, as valued records
+      --assume-merged      Convert the inputs, in order, as sorted and disjoint prefixes, e.g. lists aggregated
+                           beforehand, without merging them, failing with status 5 if they are not
+      --shard n            Write the output directory as binary shards per /8 or /16 (n = 8 or 16) with a manifest
+      --timeout duration   Fail if the conversion takes longer, e.g. 30s (default: none)
+`+logUsage+`      --max-coverage pct   Warn if the merged set covers more of the IPv4 or IPv6 space, 0 for no check (default: 10)
+      --coverage-error     Fail instead of warning beyond --max-coverage, e.g. for firewall pipelines
+      --if-changed         Rewrite the output file only if its content changes, exiting with status 3 if not
+      --new                With --if-changed, write changed output to <output-file>.new instead
+      --fail-on-empty      Fail with status 6 instead of writing an empty set, e.g. from a truncated feed
+      --workers int        Goroutines encoding binary and line-oriented text output, and decompressing and
+                           decoding binary input written in blocks (default: the CPU count)
+  -s, --sep string         Separator for text output, with \n, \r, \t, \0, \\ and \xHH escapes (default: \n)
+      --sep0               Separate text output with NUL bytes, e.g. for xargs -0
+      --eol                Terminate the last record with the separator too
+      --header string      Text written before the output, with the --sep escapes
+      --footer string      Text written after the output, with the --sep escapes
+      --prefix-each str    Text written before each record of line-oriented formats
+      --suffix-each str    Text written after each record of line-oriented formats
+      --limit int          Write at most this many prefixes, e.g. to preview a large set (default: all)
+      --offset int         Skip this many leading prefixes, to page through a set with --limit
+  -f, --format string      Output format, by name or legacy number (default: subnets+ips):
+                           subnets+ips (1), ranges+ips (2), subnets (3), ranges (4), rpz, rtbh, exabgp,
+                           exabgp-flow, csv, json, iprep, zeek-intel, nginx, apache, hosts-deny, envoy,
+                           aws-waf, aws-sg, k8s-netpol, cilium-cidrgroup, tfvars, tfvars-json, integers,
+                           clickhouse, bigquery, parquet, sqlite, rdns-zones, rdns-delegation, spf
+      --rpz-action string  RPZ policy action for the rpz format (nxdomain, nodata, passthru, drop) (default: nxdomain)
+      --rtbh-tag int       Route tag for the rtbh format (default: 666)
+      --next-hop string    BGP next-hop for the exabgp format (default: self)
+      --community string   BGP community for the exabgp format, empty for none (default: 65535:666)
+      --iprep-category int Suricata reputation category id for the iprep format (default: 1)
+      --iprep-score int    Suricata reputation score for the iprep format, 0-127 (default: 127)
+      --intel-source str   Zeek intel meta.source for the zeek-intel format (default: ipbin)
+      --hosts-daemon str   Daemon list of hosts-deny rules (default: ALL)
+      --waf-name string    WAFv2 IP set name for the aws-waf format (default: ipbin)
+      --waf-scope string   WAFv2 IP set scope for the aws-waf format, REGIONAL or CLOUDFRONT (default: REGIONAL)
+      --waf-id string      WAFv2 IP set id for the aws-waf format, writes an update-ip-set payload
+      --waf-lock-token str WAFv2 IP set lock token for the aws-waf format updates
+      --sg-id string       Security group id for the aws-sg format
+      --sg-protocol string Security group rule protocol for the aws-sg format (tcp, udp, icmp, -1 for all) (default: -1)
+      --sg-ports string    Security group rule port or from-to port range for the aws-sg format
+      --k8s-name string    Manifest name for k8s-netpol and cilium-cidrgroup (default: ipbin)
+      --k8s-namespace str  NetworkPolicy namespace for k8s-netpol
+      --k8s-ingress        Allow ingress from the set instead of egress to it in k8s-netpol
+      --k8s-max-entries n  Maximum CIDRs per manifest for k8s-netpol and cilium-cidrgroup (default: 1000)
+      --tf-var string      Terraform variable name for the tfvars formats (default: prefixes)
+      --int-base string    Base of the integers format: dec or hex, zero-padded (default: dec)
+      --int-ipv4 string    IPv4 addresses of the integers format: uint32 or uint128 (default: uint32)
+      --int-ipv6 string    IPv6 addresses of the integers format: uint128 or uint64x2, the high then
+                           the low half (default: uint128)
+      --ch-value string    Attribute value of the prefixes for the clickhouse format (default: 1)
+      --rdns-ns string     Comma-separated fully qualified nameservers of the rdns formats, e.g. ns1.example.com.
+      --rdns-hostmaster s  SOA mailbox of the rdns-zones format (default: hostmaster in the first nameserver's domain)
+      --spf-domain string  Name of the SPF record of the spf format, e.g. _spf.example.com
+      --spf-all string     All mechanism ending the SPF record, empty for none (default: ~all)
+      --enrich string      Comma-separated annotation sources for the csv and json formats (rdap, sources)
+      --rdap-interval dur  Minimum delay between RDAP requests (default: 500ms)
+      --geoip string       MaxMind country or city database (.mmdb), adds a country column to the csv and json formats
+      --filter-country str Comma-separated country codes to keep (requires --geoip)
+      --drop-country str   Comma-separated country codes to drop (requires --geoip)
+      --asn-map string     Prefix to ASN mapping file (pfx2as or MRT RIB dump), adds an asn column to the csv and json formats
+      --group-by string    Group the csv and json formats by an attribute (e.g. asn, country) and print a summary to stderr
   -h, --help               Show this help message
 `)
 }
 
-// readPrefixes reads prefixes from the input file according to options
-func readPrefixes(opts *options) ([]netip.Prefix, error) {
-	var r io.Reader
+// openInput opens the input file and decompresses it according to options.
+// The returned function closes it.
+func openInput(opts *options) (io.Reader, func(), error) {
 	f, err := os.Open(opts.inputFilepath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer f.Close()
-	r = f
-	if opts.gzipIn {
+	// Encryption is the outermost layer, recognized by its magic
+	br := bufio.NewReader(ipbin.ContextReader(opts.context(), f))
+	var r io.Reader = br
+	if magic, _ := br.Peek(len(ipbin.EncryptedMagic)); ipbin.IsEncrypted(magic) {
+		r, err = decryptInput(br, opts.identities)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+	}
+	if opts.binIn && (opts.compressIn == "gzip" || opts.compressIn == "zstd") {
+		// Read whole anyway, decompressed in parallel if written in frames
+		data, err := io.ReadAll(r)
+		if err == nil {
+			data, err = ipbin.DecompressFramed(data, opts.compressIn, opts.workers, opts.maxBytes)
+		}
+		f.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		return bytes.NewReader(data), func() {}, nil
+	}
+	r, closeReader, err := decompress(r, opts.compressIn)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return r, func() { closeReader(); f.Close() }, nil
+}
+
+// decompress returns the decompressed content of r. The returned function
+// releases the decompressor.
+func decompress(r io.Reader, compression string) (io.Reader, func(), error) {
+	switch compression {
+	case "gzip":
 		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gzr, func() { gzr.Close() }, nil
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	case "", "none":
+		return bufio.NewReaderSize(r, 1024*32), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown compression: %s", compression)
+	}
+}
+
+// decryptInput decrypts an encrypted input with the identities of the
+// identity files
+func decryptInput(r io.Reader, identityFiles []string) (io.Reader, error) {
+	if len(identityFiles) == 0 {
+		return nil, fmt.Errorf("input is encrypted, use --identity")
+	}
+	var identities []*ipbin.Identity
+	for _, path := range identityFiles {
+		lines, err := readKeyLines(path)
 		if err != nil {
 			return nil, err
 		}
-		r = gzr
-		defer gzr.Close()
-	} else {
-		r = bufio.NewReaderSize(r, 1024*32)
+		for _, line := range lines {
+			id, err := ipbin.ParseIdentity(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			identities = append(identities, id)
+		}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = ipbin.Decrypt(data, identities...); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// readKeyLines returns the lines of a key file, without blank lines and
+// # comments
+func readKeyLines(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// parseRecipients parses the --encrypt-to values, each a recipient or the
+// path of a file of recipients
+func parseRecipients(values []string) ([]*ipbin.Recipient, error) {
+	var recipients []*ipbin.Recipient
+	for _, v := range values {
+		lines := []string{v}
+		if _, err := os.Stat(v); err == nil {
+			if lines, err = readKeyLines(v); err != nil {
+				return nil, err
+			}
+		}
+		for _, line := range lines {
+			r, err := ipbin.ParseRecipient(line)
+			if err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, r)
+		}
+	}
+	return recipients, nil
+}
+
+// readPrefixes reads prefixes from the input file according to options
+func readPrefixes(opts *options) ([]netip.Prefix, error) {
+	if opts.inFormat == "taxii" && !opts.binIn {
+		// The input is the URL of a TAXII collection
+		c := &ipbin.TAXIIClient{
+			CollectionURL: opts.inputFilepath,
+			Username:      opts.params.Get("taxii-user", ""),
+			Password:      os.Getenv("IPBIN_TAXII_PASSWORD"),
+		}
+		nets, err := c.Prefixes()
+		if err != nil {
+			return nil, err
+		}
+		return ipbin.ApplyDefaultRoutePolicy(nets, opts.defaultRoutes)
+	}
+
+	if opts.inFormat == "interfaces" && !opts.binIn {
+		// The input is the name of a local network interface, or all
+		name := opts.inputFilepath
+		if name == "all" {
+			name = ""
+		}
+		return ipbin.InterfaceAddrs(name)
 	}
 
+	r, closeInput, err := openInput(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeInput()
+
+	if opts.maxBytes > 0 {
+		r = ipbin.LimitReader(r, opts.maxBytes)
+	}
 	if opts.binIn {
 		// Read all bytes, decode prefixes
 		data, err := io.ReadAll(r)
 		if err != nil {
 			return nil, err
 		}
-		var prefixes []netip.Prefix
-		for len(data) > 0 {
-			prefix, n, err := ipbin.ReadPrefixFromBytes(data)
-			if err != nil {
-				return nil, err
+		decodeOpts := ipbin.DecodeOptions{Strict: opts.strict, MaxRecords: opts.maxEntries, DefaultRoutes: opts.defaultRoutes, Workers: opts.workers}
+		if opts.expireNow {
+			decodeOpts.ExpiredAt = time.Now()
+		}
+		// Dropping records of a merged set leaves it merged
+		opts.merged = ipbin.IsMerged(data)
+		return ipbin.DecodeAllCtx(opts.context(), data, decodeOpts)
+	}
+
+	inFormat := opts.inFormat
+	if inFormat == "" {
+		inFormat = "text"
+	}
+	if inFormat == "detect" {
+		// Recognize JSON documents by their keys
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if inFormat = ipbin.DetectJSONFormat(data); inFormat == "" {
+			return nil, fmt.Errorf("unrecognized JSON input, use --in-format")
+		}
+		r = bytes.NewReader(data)
+	}
+	parse, ok := ipbin.InputFormat(inFormat)
+	if !ok {
+		return nil, fmt.Errorf("unknown input format: %s", inFormat)
+	}
+	parseOpts := ipbin.ParseOptions{Params: opts.params, MaxEntries: opts.maxEntries, DefaultRoutes: opts.defaultRoutes}
+	if opts.resolve {
+		parseOpts.Resolver = opts.resolver
+	}
+	return parse(r, parseOpts)
+}
+
+// readSources reads the prefixes of each input file, inferring the input
+// options not given explicitly from its extension
+func readSources(opts *options, set map[string]bool) ([][]netip.Prefix, error) {
+	sources := make([][]netip.Prefix, len(opts.inputs))
+	for i, path := range opts.inputs {
+		o := *opts
+		o.inputFilepath = path
+		inferInput(&o, set)
+		prefixes, err := readPrefixes(&o)
+		if err != nil {
+			if len(opts.inputs) > 1 {
+				err = fmt.Errorf("%s: %w", path, err)
 			}
-			prefixes = append(prefixes, prefix)
-			data = data[n:]
+			return nil, err
 		}
-		return prefixes, nil
-	} else {
-		return ipbin.ParseIPSubnets(r)
+		sources[i] = prefixes
+		opts.merged = opts.assumeMerged || len(opts.inputs) == 1 && o.merged
+	}
+	return sources, nil
+}
+
+// readCounts counts the addresses of all input files, in the extract or
+// pcap input format, keeping their total counts in opts.counts
+func readCounts(opts *options, set map[string]bool) ([][]netip.Prefix, error) {
+	total := ipbin.AddrCounts{}
+	for _, path := range opts.inputs {
+		o := *opts
+		o.inputFilepath = path
+		inferInput(&o, set)
+		if o.binIn || o.inFormat != "extract" && o.inFormat != "pcap" {
+			return nil, fmt.Errorf("%s: --counts needs extract or pcap input", path)
+		}
+		r, closeInput, err := openInput(&o)
+		if err != nil {
+			return nil, err
+		}
+		if o.maxBytes > 0 {
+			r = ipbin.LimitReader(r, o.maxBytes)
+		}
+		counts, err := ipbin.CountInputAddrs(o.inFormat, r, o.params)
+		closeInput()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		total.Merge(counts)
+	}
+	total, err := total.FilterParams(opts.params)
+	if err != nil {
+		return nil, err
 	}
+	opts.counts = total.Valued()
+	return [][]netip.Prefix{total.Prefixes(1)}, nil
+}
+
+// readInputs reads the prefixes of all input files
+func readInputs(opts *options, set map[string]bool) ([]netip.Prefix, error) {
+	sources, err := readSources(opts, set)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Concat(sources...), nil
+}
+
+// writtenAsRead reports whether the merged prefixes read may be written as
+// read, without building their set, when converting a binary set written
+// merged or inputs taken as merged by --assume-merged to binary output with
+// no set operation in between.
+func writtenAsRead(opts *options) bool {
+	return opts.merged && opts.binOut && opts.counts == nil && opts.shard == 0 && opts.offset == 0 && opts.limit < 0 &&
+		opts.filterCountry == "" && opts.dropCountry == ""
+}
+
+// outputPrefixes returns the prefixes of the output, those of ipset unless
+// written as read
+func outputPrefixes(opts *options, ipset *netipx.IPSet) []netip.Prefix {
+	if ipset == nil {
+		return opts.prefixes
+	}
+	return ipset.Prefixes()
+}
+
+// mergePrefixes merges prefixes within the --max-memory budget, if any, or
+// only joins them, sorted and disjoint, with --assume-merged
+func mergePrefixes(opts *options, prefixes []netip.Prefix) (*netipx.IPSet, error) {
+	if opts.assumeMerged {
+		return ipbin.FromSortedPrefixes(prefixes)
+	}
+	if opts.maxMemory > 0 {
+		return ipbin.MergePrefixesSpill(opts.context(), prefixes, opts.maxMemory, "")
+	}
+	return ipbin.MergePrefixesCtx(opts.context(), prefixes)
+}
+
+// asnResolver returns the ASN resolver for the --asn-source option
+func asnResolver(source string) (ipbin.ASNResolver, error) {
+	if source == "" || source == "ripestat" {
+		return &ipbin.RIPEStatResolver{}, nil
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ipbin.LoadPrefixASNMap(f)
+}
+
+// splitList splits a comma-separated flag value, ignoring empty items
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
 }
 
 // writePrefixes writes prefixes to the output file according to options
 func writePrefixes(opts *options, ipset *netipx.IPSet) error {
-	var w io.Writer
-	f, err := os.Create(opts.outputFilepath)
+	return writeOutput(opts, func(w io.Writer) error {
+		return renderPrefixes(w, opts, ipset)
+	})
+}
+
+// writeOutput creates the output file and writes to it with render,
+// compressed and encrypted according to options
+func writeOutput(opts *options, render func(w io.Writer) error) error {
+	var recipients []*ipbin.Recipient
+	if len(opts.encryptTo) > 0 {
+		var err error
+		if recipients, err = parseRecipients(opts.encryptTo); err != nil {
+			return err
+		}
+	}
+	var w io.Writer = os.Stdout
+	if opts.outputFilepath != "-" {
+		f, err := os.Create(opts.outputFilepath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	w = ipbin.ContextWriter(opts.context(), w)
+	if recipients == nil {
+		return compressOutput(w, opts, render)
+	}
+	// Encryption is the outermost layer, of the whole compressed output
+	var buf bytes.Buffer
+	if err := compressOutput(&buf, opts, render); err != nil {
+		return err
+	}
+	data, err := ipbin.Encrypt(buf.Bytes(), recipients...)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	w = f
-	if opts.gzipOut {
+	_, err = w.Write(data)
+	return err
+}
+
+// writeIfChanged writes prefixes like writePrefixes unless the output file
+// already has the same content, ignoring the metadata of binary output, and
+// reports whether it did. With newFile, the output is written to a .new
+// file beside it instead.
+func writeIfChanged(opts *options, ipset *netipx.IPSet, newFile bool) (bool, error) {
+	var content bytes.Buffer
+	if err := renderPrefixes(&content, opts, ipset); err != nil {
+		return false, err
+	}
+	o := *opts
+	o.inputFilepath, o.compressIn = opts.outputFilepath, opts.compressOut
+	o.identities = nil
+	old, closeOld, err := openInput(&o)
+	if err == nil {
+		var data []byte
+		data, err = io.ReadAll(old)
+		closeOld()
+		if err == nil && sameOutput(opts, data, content.Bytes()) {
+			if newFile {
+				os.Remove(opts.outputFilepath + ".new")
+			}
+			return false, nil
+		}
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if newFile {
+		o.outputFilepath += ".new"
+	}
+	return true, writeOutput(&o, func(w io.Writer) error {
+		_, err := w.Write(content.Bytes())
+		return err
+	})
+}
+
+// sameOutput reports whether the previous and current contents of the
+// output are the same, comparing the records of binary output
+func sameOutput(opts *options, prev, cur []byte) bool {
+	if opts.binOut {
+		_, n, err := ipbin.ReadMetadataFromBytes(prev)
+		if err != nil {
+			return false
+		}
+		prev = prev[n:]
+		_, n, _ = ipbin.ReadMetadataFromBytes(cur)
+		cur = cur[n:]
+	}
+	return bytes.Equal(prev, cur)
+}
+
+// writeShards writes prefixes to the output directory as a sharded set
+func writeShards(opts *options, ipset *netipx.IPSet) error {
+	source := opts.source
+	if source == "" {
+		source = strings.Join(opts.inputs, ",")
+	}
+	manifest, err := ipbin.WriteSharded(opts.outputFilepath, ipset, opts.shard, ipbin.Metadata{
+		Generated: time.Now(),
+		Source:    source,
+		Version:   toolVersion(),
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Wrote %d shards.", len(manifest.Shards)), "shards", len(manifest.Shards))
+	return nil
+}
+
+// compressOutput writes to w with render, compressed according to options
+func compressOutput(w io.Writer, opts *options, render func(w io.Writer) error) error {
+	if opts.binOut && opts.blockRecords > 0 && (opts.compressOut == "gzip" || opts.compressOut == "zstd") {
+		// In frames decompressed in parallel
+		var buf bytes.Buffer
+		if err := render(&buf); err != nil {
+			return err
+		}
+		return ipbin.WriteFramed(w, buf.Bytes(), opts.compressOut, 0, opts.workers)
+	}
+	switch opts.compressOut {
+	case "gzip":
 		gz := gzip.NewWriter(w)
 		defer gz.Close()
 		w = gz
-	} else {
+	case "zstd":
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		defer zw.Close()
+		w = zw
+	case "", "none":
 		bufw := bufio.NewWriterSize(w, 1024*32)
 		defer bufw.Flush()
 		w = bufw
+	default:
+		return fmt.Errorf("unknown compression: %s", opts.compressOut)
 	}
+	return render(w)
+}
 
+// renderPrefixes writes prefixes to w, formatted according to options
+func renderPrefixes(w io.Writer, opts *options, ipset *netipx.IPSet) error {
 	if opts.binOut {
-		for _, p := range ipset.Prefixes() {
-			if _, err = ipbin.WriteEncoded(w, p); err != nil {
-				return err
-			}
+		var expires time.Time
+		if opts.ttl > 0 {
+			expires = time.Now().Add(opts.ttl)
 		}
-		return nil
-	}
-
-	// Text output with format
-	sep := opts.sepOut
-
-	switch opts.formatOut {
-	case OutFormatSubnets:
-		// Output merged subnets
-		out := ipset.Prefixes()
-		for i, p := range out {
-			if i > 0 {
-				if _, err = w.Write([]byte(sep)); err != nil {
-					return err
-				}
+		prefixes := outputPrefixes(opts, ipset)
+		n, record := len(prefixes), func(dst []byte, i int) ([]byte, error) {
+			return ipbin.AppendEncodedExpiring(dst, ipbin.ExpiringPrefix{Prefix: prefixes[i], Expires: expires})
+		}
+		if opts.counts != nil {
+			// The counted addresses, unmerged, left by the filters
+			counts := slices.DeleteFunc(slices.Clone(opts.counts), func(vp ipbin.ValuedPrefix) bool {
+				return !ipset.ContainsPrefix(vp.Prefix)
+			})
+			n, record = len(counts), func(dst []byte, i int) ([]byte, error) {
+				return ipbin.AppendEncodedValued(dst, counts[i])
 			}
-			if _, err = w.Write([]byte(p.String())); err != nil {
+		}
+		var buf bytes.Buffer
+		err := ipbin.EncodeParallel(&buf, n, opts.workers, record)
+		if err != nil {
+			return err
+		}
+		records := buf.Bytes()
+		if opts.v2 {
+			if records, err = ipbin.AppendRecordsV2(nil, records); err != nil {
 				return err
 			}
 		}
-	case OutFormatSubnetsIPs:
-		// Output IP if prefix is a single IP, otherwise output prefix
-		out := ipset.Prefixes()
-		for i, p := range out {
-			if i > 0 {
-				if _, err = w.Write([]byte(sep)); err != nil {
-					return err
-				}
-			}
-			if p.Addr().BitLen() == p.Bits() {
-				if _, err = w.Write([]byte(p.Addr().String())); err != nil {
-					return err
-				}
-			} else {
-				if _, err = w.Write([]byte(p.String())); err != nil {
-					return err
-				}
+		if opts.blockRecords > 0 {
+			if records, err = ipbin.AppendBlocks(nil, records, opts.blockRecords); err != nil {
+				return err
 			}
 		}
-	case OutFormatRanges:
-		// Output each range as start-end using ipset.Ranges()
-		ranges := ipset.Ranges()
-		for i, r := range ranges {
-			if i > 0 {
-				if _, err = w.Write([]byte(sep)); err != nil {
-					return err
-				}
-			}
-			if _, err = w.Write([]byte(r.From().String() + "-" + r.To().String())); err != nil {
+		if opts.endMarker {
+			records = append(records, ipbin.EndHeader)
+		}
+		if !opts.metadata && !opts.index {
+			_, err := w.Write(records)
+			return err
+		}
+		source := opts.source
+		if source == "" {
+			source = strings.Join(opts.inputs, ",")
+		}
+		m := ipbin.Metadata{
+			Generated: time.Now(),
+			Source:    source,
+			Version:   toolVersion(),
+		}
+		if opts.v2 {
+			m.Format = 2
+		}
+		// Valued records are the counted addresses, unmerged
+		m.Merged = opts.counts == nil
+		if opts.index {
+			if m.Index, err = ipbin.BuildIndex(records, 0); err != nil {
 				return err
 			}
 		}
-	case OutFormatRangesIPs:
-		// Output IP if range is a single IP, otherwise output range as start-end using ipset.Ranges()
-		ranges := ipset.Ranges()
-		for i, r := range ranges {
-			if i > 0 {
-				if _, err = w.Write([]byte(sep)); err != nil {
-					return err
-				}
-			}
-			if r.From() == r.To() {
-				if _, err = w.Write([]byte(r.From().String())); err != nil {
-					return err
-				}
-			} else {
-				if _, err = w.Write([]byte(r.From().String() + "-" + r.To().String())); err != nil {
-					return err
-				}
-			}
+		return ipbin.WriteContainer(w, m, records)
+	}
+
+	name, err := ipbin.ParseOutputFormat(opts.formatOut)
+	if err != nil {
+		return err
+	}
+	render, _ := ipbin.OutputFormat(name)
+	annotators, err := buildAnnotators(opts)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, opts.header); err != nil {
+		return err
+	}
+	err = render(w, ipset, ipbin.RenderOptions{
+		Sep:        opts.sepOut,
+		EOL:        opts.eol,
+		PrefixEach: opts.prefixEach,
+		SuffixEach: opts.suffixEach,
+		Params:     opts.params,
+		Annotators: annotators,
+		Summary:    os.Stderr, // kept out of the output, which may be stdout
+		Workers:    opts.workers,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, opts.footer)
+	return err
+}
+
+// buildAnnotators returns the annotators for the --enrich option
+func buildAnnotators(opts *options) ([]ipbin.Annotator, error) {
+	var annotators []ipbin.Annotator
+	if opts.geoipDB != nil {
+		annotators = append(annotators, &ipbin.GeoIPAnnotator{DB: opts.geoipDB})
+	}
+	if opts.asnMap != nil {
+		annotators = append(annotators, opts.asnMap)
+	}
+	for _, source := range splitList(opts.enrich) {
+		switch source {
+		case "rdap":
+			annotators = append(annotators, &ipbin.RDAPAnnotator{Interval: opts.rdapInterval})
+		case "sources":
+			annotators = append(annotators, opts.provenance)
+		default:
+			return nil, fmt.Errorf("unknown enrichment source: %s", source)
 		}
-	default:
-		return fmt.Errorf("unknown output format: %d", opts.formatOut)
 	}
-	return nil
+	return annotators, nil
+}
+
+// filterCountries keeps or drops the parts of ipset located in the countries
+// given by the --filter-country and --drop-country options
+func filterCountries(opts *options, ipset *netipx.IPSet) (*netipx.IPSet, error) {
+	if opts.filterCountry == "" && opts.dropCountry == "" {
+		return ipset, nil
+	}
+	if opts.geoipDB == nil {
+		return nil, fmt.Errorf("country filters require a --geoip database")
+	}
+	aps, err := ipbin.Annotate(ipset, &ipbin.GeoIPAnnotator{DB: opts.geoipDB})
+	if err != nil {
+		return nil, err
+	}
+	if keep := splitList(opts.filterCountry); len(keep) > 0 {
+		aps = ipbin.FilterAnnotated(aps, "country", keep, true)
+	}
+	if drop := splitList(opts.dropCountry); len(drop) > 0 {
+		aps = ipbin.FilterAnnotated(aps, "country", drop, false)
+	}
+	return ipbin.MergePrefixes(ipbin.AnnotatedPrefixes(aps))
+}
+
+// pageSet skips the first opts.offset prefixes of ipset and keeps at most
+// opts.limit of the following ones, all of them if opts.limit is negative
+func pageSet(opts *options, ipset *netipx.IPSet) (*netipx.IPSet, error) {
+	if opts.offset > 0 {
+		var b netipx.IPSetBuilder
+		b.AddSet(ipset)
+		b.RemoveSet(ipbin.HeadPrefixes(ipset, opts.offset))
+		var err error
+		if ipset, err = b.IPSet(); err != nil {
+			return nil, err
+		}
+	}
+	return ipbin.HeadPrefixes(ipset, opts.limit), nil
 }
 
 // expandShortFlags expands combined single-letter flags (e.g., -bz to -b -z)
@@ -205,18 +1114,132 @@ func expandShortFlags(args []string) []string {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "announce":
+			runAnnounce(os.Args[2:])
+			return
+		case "report":
+			runReport(os.Args[2:])
+			return
+		case "filter":
+			runFilter(os.Args[2:])
+			return
+		case "query":
+			runQuery(os.Args[2:])
+			return
+		case "analyze":
+			runAnalyze(os.Args[2:])
+			return
+		case "journal":
+			runJournal(os.Args[2:])
+			return
+		case "sign", "verify":
+			runSign(os.Args[1], os.Args[2:])
+			return
+		case "keygen":
+			runKeygen(os.Args[2:])
+			return
+		case "info":
+			runInfo(os.Args[2:])
+			return
+		case "index":
+			runIndex(os.Args[2:])
+			return
+		case "publish":
+			runPublish(os.Args[2:])
+			return
+		case "subscribe":
+			runSubscribe(os.Args[2:])
+			return
+		case "merge3":
+			runMerge3(os.Args[2:])
+			return
+		case "textconv":
+			runTextconv(os.Args[2:])
+			return
+		case "gitdiff":
+			runGitdiff(os.Args[2:])
+			return
+		case "watch":
+			runWatch(os.Args[2:])
+			return
+		case "daemon":
+			runDaemon(os.Args[2:])
+			return
+		}
+	}
+
 	var opts options
 	var showHelp bool
+	var timeout time.Duration
+	var logFormat string
+	var maxCoverage float64
+	var coverageError, ifChanged, newFile, failOnEmpty, counts bool
 
-	flag.StringVar(&opts.inputFilepath, "input", "", "Input file path")
-	flag.StringVar(&opts.inputFilepath, "i", "", "Input file path (shorthand)")
-	flag.BoolVar(&opts.gzipIn, "Z", false, "Read input as gzip")
-	flag.BoolVar(&opts.gzipOut, "z", false, "Write output as gzip")
-	flag.BoolVar(&opts.binIn, "B", false, "Read input as binary")
-	flag.BoolVar(&opts.binOut, "b", false, "Write output as binary")
-	flag.StringVar(&opts.sepOut, "sep", "\n", "Separator for text output")
-	flag.IntVar(&opts.formatOut, "format", OutFormatSubnetsIPs, "Output format (1=subnets, 2=subnets+ips, 3=ranges, 4=ranges+ips)")
-	flag.IntVar(&opts.formatOut, "f", OutFormatSubnetsIPs, "Output format (shorthand)")
+	addInputFlags(flag.CommandLine, &opts)
+	addOutputFlags(flag.CommandLine, &opts)
+	flag.DurationVar(&opts.ttl, "ttl", 0, "Expiry of the binary output records from now")
+	flag.StringVar(&opts.source, "source", "", "Source description recorded in the binary output metadata")
+	flag.BoolVar(&opts.metadata, "metadata", false, "Precede binary output with a metadata block")
+	flag.BoolVar(&opts.index, "index", false, "Index binary output")
+	flag.BoolVar(&opts.v2, "v2", false, "Write binary output in format v2")
+	flag.BoolVar(&opts.endMarker, "end-marker", false, "End binary output with an end-of-stream marker")
+	flag.IntVar(&opts.blockRecords, "block-records", 0, "Write binary output in blocks of n records")
+	flag.IntVar(&opts.shard, "shard", 0, "Shard the output directory per /8 or /16")
+	flag.DurationVar(&timeout, "timeout", 0, "Maximum duration of the conversion")
+	addLogFlag(flag.CommandLine, &logFormat, "plain")
+	flag.Float64Var(&maxCoverage, "max-coverage", 10, "Percentage of the IPv4 or IPv6 space covered beyond which to warn")
+	flag.BoolVar(&coverageError, "coverage-error", false, "Fail instead of warning beyond --max-coverage")
+	flag.BoolVar(&ifChanged, "if-changed", false, "Rewrite the output file only if its content changes")
+	flag.BoolVar(&newFile, "new", false, "Write changed output to <output-file>.new instead")
+	flag.BoolVar(&failOnEmpty, "fail-on-empty", false, "Fail instead of writing an empty set")
+	flag.BoolVar(&counts, "counts", false, "Store the hit counts of extract and pcap input as valued records")
+	flag.BoolVar(&opts.assumeMerged, "assume-merged", false, "Convert the inputs as sorted and disjoint prefixes without merging them")
+	flag.IntVar(&opts.workers, "workers", 0, "Goroutines encoding the output")
+	flag.BoolVar(&opts.eol, "eol", false, "Terminate the last record with the separator too")
+	flag.StringVar(&opts.header, "header", "", "Text written before the output")
+	flag.StringVar(&opts.footer, "footer", "", "Text written after the output")
+	flag.StringVar(&opts.prefixEach, "prefix-each", "", "Text written before each record")
+	flag.StringVar(&opts.suffixEach, "suffix-each", "", "Text written after each record")
+	flag.IntVar(&opts.limit, "limit", -1, "Maximum number of prefixes to write")
+	flag.IntVar(&opts.offset, "offset", 0, "Number of leading prefixes to skip")
+	// Format-specific options, passed to the formats through opts.params
+	flag.String("rpz-action", "nxdomain", "RPZ policy action (nxdomain, nodata, passthru, drop)")
+	flag.Int("rtbh-tag", 666, "Route tag for RTBH static routes")
+	flag.String("next-hop", "self", "BGP next-hop for ExaBGP announcements")
+	flag.String("community", ipbin.BlackholeCommunity, "BGP community for ExaBGP announcements")
+	flag.Int("iprep-category", 1, "Suricata reputation category id")
+	flag.Int("iprep-score", ipbin.MaxIPRepScore, "Suricata reputation score")
+	flag.String("intel-source", "ipbin", "Zeek intel meta.source")
+	flag.String("hosts-daemon", "ALL", "Daemon list of hosts.deny rules")
+	flag.String("waf-name", "ipbin", "WAFv2 IP set name")
+	flag.String("waf-scope", "REGIONAL", "WAFv2 IP set scope")
+	flag.String("waf-id", "", "WAFv2 IP set id")
+	flag.String("waf-lock-token", "", "WAFv2 IP set lock token")
+	flag.String("sg-id", "", "Security group id")
+	flag.String("sg-protocol", "-1", "Security group rule protocol")
+	flag.String("sg-ports", "", "Security group rule port range")
+	flag.String("k8s-name", "ipbin", "Kubernetes manifest name")
+	flag.String("k8s-namespace", "", "NetworkPolicy namespace")
+	flag.Bool("k8s-ingress", false, "Allow ingress from the set instead of egress to it")
+	flag.Int("k8s-max-entries", ipbin.DefaultManifestEntries, "Maximum CIDRs per manifest")
+	flag.String("tf-var", "prefixes", "Terraform variable name")
+	flag.String("int-base", "dec", "Base of the integers format (dec, hex)")
+	flag.String("int-ipv4", "uint32", "IPv4 addresses of the integers format (uint32, uint128)")
+	flag.String("int-ipv6", "uint128", "IPv6 addresses of the integers format (uint128, uint64x2)")
+	flag.String("ch-value", "1", "ClickHouse ip_trie attribute value")
+	flag.String("rdns-ns", "", "Comma-separated nameservers of the reverse zones")
+	flag.String("rdns-hostmaster", "", "SOA mailbox of the reverse zones")
+	flag.String("spf-domain", "", "Name of the SPF record")
+	flag.String("spf-all", "~all", "All mechanism ending the SPF record")
+	flag.StringVar(&opts.enrich, "enrich", "", "Comma-separated annotation sources (rdap, sources)")
+	flag.DurationVar(&opts.rdapInterval, "rdap-interval", 500*time.Millisecond, "Minimum delay between RDAP requests")
+	flag.StringVar(&opts.geoipPath, "geoip", "", "MaxMind country or city database")
+	flag.StringVar(&opts.filterCountry, "filter-country", "", "Comma-separated country codes to keep")
+	flag.StringVar(&opts.dropCountry, "drop-country", "", "Comma-separated country codes to drop")
+	flag.StringVar(&opts.asnMapPath, "asn-map", "", "Prefix to ASN mapping file")
+	flag.StringVar(&opts.groupBy, "group-by", "", "Attribute to group annotated output by")
 	flag.BoolVar(&showHelp, "help", false, "Show help message")
 	flag.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
 
@@ -224,46 +1247,182 @@ func main() {
 	// Expand combined short flags before parsing
 	os.Args = expandShortFlags(os.Args)
 	flag.Parse()
+	opts.params = flagParams(flag.CommandLine)
 
 	if showHelp {
 		usage()
 		os.Exit(0)
 	}
+	setupLogging(logFormat)
 
 	// Output file is now a required positional argument
 	args := flag.Args()
 	if len(args) < 1 {
 		fmt.Fprintf(os.Stderr, "Error: output file must be specified as a positional argument.\n")
 		usage()
-		os.Exit(2)
+		os.Exit(exitUsage)
 	}
 	opts.outputFilepath = args[0]
 
-	if opts.inputFilepath == "" || opts.outputFilepath == "" {
+	if len(opts.inputs) == 0 || opts.outputFilepath == "" {
 		fmt.Fprintf(os.Stderr, "Error: input and output file paths must be specified.\n")
 		usage()
-		os.Exit(2)
+		os.Exit(exitUsage)
+	}
+	if err := unescapeOutput(&opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if opts.shard != 0 && opts.shard != 8 && opts.shard != 16 {
+		fmt.Fprintf(os.Stderr, "Error: --shard must be 8 or 16.\n")
+		os.Exit(exitUsage)
+	}
+	if opts.blockRecords < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --block-records must not be negative.\n")
+		os.Exit(exitUsage)
+	}
+	if newFile {
+		ifChanged = true
+	}
+	if ifChanged && (opts.outputFilepath == "-" || opts.shard > 0 || len(opts.encryptTo) > 0) {
+		fmt.Fprintf(os.Stderr, "Error: --if-changed needs an output file, without --shard or --encrypt-to.\n")
+		os.Exit(exitUsage)
+	}
+	set := setFlags(flag.CommandLine)
+	inferOutput(&opts, set)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		opts.ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		defer cancel()
 	}
 
-	fmt.Printf("Reading input from %s...\n", opts.inputFilepath)
-	prefixes, err := readPrefixes(&opts)
+	if counts && (!opts.binOut || opts.ttl > 0 || opts.shard > 0) {
+		fmt.Fprintf(os.Stderr, "Error: --counts needs binary output, without --ttl or --shard.\n")
+		os.Exit(exitUsage)
+	}
+	if counts && opts.assumeMerged {
+		fmt.Fprintf(os.Stderr, "Error: --assume-merged cannot be combined with --counts.\n")
+		os.Exit(exitUsage)
+	}
+
+	readDone := stage("read", fmt.Sprintf("Reading input from %s...", strings.Join(opts.inputs, ", ")), "inputs", opts.inputs)
+	var sources [][]netip.Prefix
+	var err error
+	if counts {
+		sources, err = readCounts(&opts, set)
+	} else {
+		sources, err = readSources(&opts, set)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-		os.Exit(1)
+		logger.Error("Error reading input", "error", err)
+		os.Exit(exitStatus(err))
+	}
+	read := 0
+	for _, prefixes := range sources {
+		read += len(prefixes)
 	}
+	readDone("prefixes", read)
 
-	fmt.Println("Merging prefixes...")
-	ipset, err := ipbin.MergePrefixes(prefixes)
+	mergeDone := stage("merge", "Merging prefixes...")
+	var ipset *netipx.IPSet
+	if slices.Contains(splitList(opts.enrich), "sources") {
+		// Track which input covers which addresses
+		ipset, opts.provenance, err = ipbin.MergeWithProvenance(opts.inputs, sources)
+	} else if writtenAsRead(&opts) {
+		// Prefixes merged already are written as read, without building their set
+		if opts.prefixes = sources[0]; len(sources) > 1 {
+			opts.prefixes = slices.Concat(sources...)
+		}
+		if opts.assumeMerged {
+			// As merged as without --assume-merged, adjacent prefixes joined
+			opts.prefixes, err = ipbin.JoinSortedPrefixes(opts.prefixes)
+		}
+	} else {
+		ipset, err = mergePrefixes(&opts, slices.Concat(sources...))
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error merging prefixes: %v\n", err)
-		os.Exit(1)
+		logger.Error("Error merging prefixes", "error", err)
+		os.Exit(exitStatus(err))
+	}
+	if ipset != nil {
+		mergeDone("ranges", len(ipset.Ranges()))
+	} else {
+		mergeDone("prefixes", len(opts.prefixes), "merged", true)
+	}
+	limits := ipbin.SanityLimits{MaxIPv4: maxCoverage / 100, MaxIPv6: maxCoverage / 100}
+	if err := ipbin.SanityCheckPrefixes(outputPrefixes(&opts, ipset), limits); err != nil {
+		if coverageError {
+			for _, line := range strings.Split(err.Error(), "\n") {
+				logger.Error("Error: " + line)
+			}
+			os.Exit(exitValidation)
+		}
+		for _, line := range strings.Split(err.Error(), "\n") {
+			logger.Warn(line)
+		}
+	}
+
+	if opts.geoipPath != "" {
+		if opts.geoipDB, err = ipbin.OpenMMDB(opts.geoipPath); err != nil {
+			logger.Error("Error opening GeoIP database", "error", err)
+			os.Exit(exitError)
+		}
+	}
+	if opts.asnMapPath != "" {
+		f, err := os.Open(opts.asnMapPath)
+		if err != nil {
+			logger.Error("Error opening ASN mapping", "error", err)
+			os.Exit(exitError)
+		}
+		opts.asnMap, err = ipbin.LoadPrefixASNMap(f)
+		f.Close()
+		if err != nil {
+			logger.Error("Error reading ASN mapping", "error", err)
+			os.Exit(exitError)
+		}
+	}
+	if name, err := ipbin.ParseOutputFormat(opts.formatOut); err != nil && !opts.binOut {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	} else if opts.groupBy != "" && name != "csv" && name != "json" {
+		fmt.Fprintf(os.Stderr, "Error: --group-by requires an annotated output format (csv or json).\n")
+		os.Exit(exitUsage)
+	}
+	if ipset != nil {
+		if ipset, err = filterCountries(&opts, ipset); err != nil {
+			logger.Error("Error filtering countries", "error", err)
+			os.Exit(exitError)
+		}
+		if ipset, err = pageSet(&opts, ipset); err != nil {
+			logger.Error("Error paging output", "error", err)
+			os.Exit(exitError)
+		}
+	}
+
+	if failOnEmpty && len(outputPrefixes(&opts, ipset)) == 0 {
+		logger.Error("Error: the output set is empty.")
+		os.Exit(exitEmpty)
 	}
 
-	fmt.Printf("Writing output to %s...\n", opts.outputFilepath)
-	if err := writePrefixes(&opts, ipset); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
-		os.Exit(1)
+	writeDone := stage("write", fmt.Sprintf("Writing output to %s...", opts.outputFilepath), "output", opts.outputFilepath)
+	changed := true
+	switch {
+	case opts.shard > 0:
+		err = writeShards(&opts, ipset)
+	case ifChanged:
+		changed, err = writeIfChanged(&opts, ipset, newFile)
+	default:
+		err = writePrefixes(&opts, ipset)
+	}
+	if err != nil {
+		logger.Error("Error writing output", "error", err)
+		os.Exit(exitError)
+	}
+	writeDone("changed", changed)
+	if !changed {
+		logger.Info("Unchanged.")
+		os.Exit(exitUnchanged)
 	}
 
-	fmt.Println("Done.")
+	logger.Info("Done.")
 }
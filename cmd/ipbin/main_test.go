@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain runs the command instead of the tests in the processes started
+// by runCommand
+func TestMain(m *testing.M) {
+	if os.Getenv("IPBIN_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCommand runs the command with args, returning its stdout and stderr
+func runCommand(t *testing.T, args ...string) (stdout, stderr []byte) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "IPBIN_TEST_MAIN=1")
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("ipbin %v: %v: %s", args, err, errOut.Bytes())
+	}
+	return out.Bytes(), errOut.Bytes()
+}
+
+func TestStdoutOutput(t *testing.T) {
+	in := filepath.Join(t.TempDir(), "in.txt")
+	if err := os.WriteFile(in, []byte("2001:db8::/32\n192.0.2.0/25\n192.0.2.128/25\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := runCommand(t, "-i", in, "-")
+	if want := "192.0.2.0/24\n2001:db8::/32"; string(stdout) != want {
+		t.Errorf("got stdout %q, want %q", stdout, want)
+	}
+	if !bytes.Contains(stderr, []byte("Reading input from")) || !bytes.Contains(stderr, []byte("Done.")) {
+		t.Errorf("got stderr %q", stderr)
+	}
+}
+
+func TestBinaryOutputMetadata(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.txt")
+	if err := os.WriteFile(in, []byte("192.0.2.0/24\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Readable by readers predating the metadata block unless asked for
+	stdout, _ := runCommand(t, "-i", in, "-b", "-")
+	if want := []byte{24, 192, 0, 2}; !bytes.Equal(stdout, want) {
+		t.Errorf("got %v, want %v", stdout, want)
+	}
+	for _, flag := range []string{"--metadata", "--index"} {
+		stdout, _ := runCommand(t, "-i", in, "-b", flag, "-")
+		if len(stdout) == 0 || stdout[0] != ipbin.ContainerHeader || !bytes.HasSuffix(stdout, []byte{24, 192, 0, 2}) {
+			t.Errorf("with %s got %v", flag, stdout)
+		}
+	}
+}
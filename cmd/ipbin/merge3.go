@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"go4.org/netipx"
+	"os"
+)
+
+func merge3Usage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin merge3 [options] <base> <ours> <theirs>
+
+Merges the changes of ours and theirs to their common base: the result has
+the addresses of base removed by neither side, and those added by either.
+A prefix added by one side overlapping a prefix removed by the other is
+reported as a conflict, and the status is 7. As a git merge driver:
+  ipbin merge3 -B -b -o %%A %%O %%A %%B
+
+Options:
+`+inputUsage+`  -o, --output string      Output file path (default: stdout)
+  -b                       Write output as binary (default for .bin files)
+  -z                       Write output as gzip (default for .gz files)
+      --out-compression s  Output compression: none, gzip or zstd (default: from the extension, .gz or .zst)
+      --encrypt-to str     Recipient or recipient file the output is encrypted to, repeatable (see ipbin keygen)
+  -s, --sep string         Separator for text output, with \n, \r, \t, \0, \\ and \xHH escapes (default: \n)
+      --sep0               Separate text output with NUL bytes, e.g. for xargs -0
+  -f, --format string      Output format, by name or legacy number (default: subnets+ips)
+  -h, --help               Show this help message
+`)
+}
+
+func runMerge3(args []string) {
+	var opts options
+	var showHelp bool
+
+	fs := flag.NewFlagSet("merge3", flag.ExitOnError)
+	addInputFlags(fs, &opts)
+	fs.StringVar(&opts.outputFilepath, "output", "-", "Output file path")
+	fs.StringVar(&opts.outputFilepath, "o", "-", "Output file path (shorthand)")
+	addOutputFlags(fs, &opts)
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = merge3Usage
+	fs.Parse(expandShortFlags(args))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		merge3Usage()
+		os.Exit(0)
+	}
+	opts.inputs = append(opts.inputs, fs.Args()...)
+	if len(opts.inputs) != 3 {
+		fmt.Fprintf(os.Stderr, "Error: base, ours and theirs must be specified.\n")
+		merge3Usage()
+		os.Exit(exitUsage)
+	}
+	if err := unescapeOutput(&opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	set := setFlags(fs)
+	if opts.outputFilepath != "-" {
+		inferOutput(&opts, set)
+	} else {
+		// Terminate the last line on the terminal
+		opts.eol = true
+	}
+
+	var sets [3]*netipx.IPSet
+	for i, path := range opts.inputs {
+		o := opts
+		o.inputFilepath = path
+		inferInput(&o, set)
+		nets, err := readPrefixes(&o)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+			os.Exit(exitStatus(err))
+		}
+		if sets[i], err = ipbin.MergePrefixes(nets); err != nil {
+			fmt.Fprintf(os.Stderr, "Error merging prefixes: %v\n", err)
+			os.Exit(exitError)
+		}
+	}
+	merged, conflicts, err := ipbin.Merge3(sets[0], sets[1], sets[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error merging sets: %v\n", err)
+		os.Exit(exitError)
+	}
+	if err := writePrefixes(&opts, merged); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(exitError)
+	}
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "CONFLICT: %s\n", c)
+	}
+	if len(conflicts) > 0 {
+		os.Exit(exitConflict)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"net/http"
+	"strings"
+)
+
+// apiFeatures are the endpoints served by an ipbin server, described by
+// its OpenAPI document
+type apiFeatures struct {
+	publish bool // the set of ipbin publish at /
+	ui      bool // the web UI of publish --ui
+	admin   bool // the admin API of publish --overrides
+	daemon  bool // the status endpoints of ipbin daemon
+	auth    bool // all requests need a bearer token
+	limited bool // requests are rate limited
+}
+
+// serveOpenAPI serves the OpenAPI 3 document of the endpoints of features
+// at GET /openapi.json of mux
+func serveOpenAPI(mux *http.ServeMux, features apiFeatures) {
+	doc := openAPI(features)
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, doc)
+	})
+}
+
+// openAPI returns the OpenAPI 3 document of the endpoints of features, so
+// that clients can be generated for them
+func openAPI(features apiFeatures) map[string]any {
+	paths := map[string]any{
+		"/openapi.json": map[string]any{"get": apiOperation("getOpenAPI", "This OpenAPI document", nil,
+			map[string]any{"200": apiJSON("The OpenAPI document", map[string]any{"type": "object"})})},
+	}
+	schemas := map[string]any{}
+	if features.publish {
+		paths["/"] = map[string]any{"get": apiOperation("getSet", "The set, its changes since a version, or a stream of its changes",
+			[]any{
+				map[string]any{"name": "since", "in": "query", "schema": map[string]any{"type": "integer", "minimum": 0},
+					"description": "Hold the request until a version newer than this one is published, then answer with the changes, or the whole set if too old"},
+				map[string]any{"name": "epoch", "in": "query", "schema": map[string]any{"type": "string"},
+					"description": "The epoch of the since version, answered with the whole set if not that of the publisher, e.g. restarted since"},
+				map[string]any{"name": "Last-Event-ID", "in": "header", "schema": map[string]any{"type": "string"},
+					"description": "With Accept: text/event-stream, the epoch:version after which to stream the changes"},
+			},
+			map[string]any{
+				"200": map[string]any{
+					"description": "The set, its changes as journal entries, or server-sent add, remove and reset events with Accept: text/event-stream",
+					"headers":     map[string]any{ipbin.VersionHeader: apiVersionHeader(), ipbin.EpochHeader: apiEpochHeader()},
+					"content": map[string]any{
+						ipbin.SnapshotContentType:    map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+						ipbin.DiffContentType:        map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+						ipbin.EventStreamContentType: map[string]any{"schema": map[string]any{"type": "string"}},
+					},
+				},
+				"304": map[string]any{
+					"description": "No new version before the poll timed out",
+					"headers":     map[string]any{ipbin.VersionHeader: apiVersionHeader(), ipbin.EpochHeader: apiEpochHeader()},
+				},
+				"400": apiError("Invalid since version"),
+			})}
+	}
+	if features.admin {
+		body := map[string]any{"required": true, "content": map[string]any{"text/plain": map[string]any{
+			"schema":  map[string]any{"type": "string"},
+			"example": "198.51.100.7\n203.0.113.0/24\n",
+		}}}
+		change := map[string]any{"200": apiJSON("The change was published", apiRef("AdminChange")), "400": apiError("Invalid or no prefix")}
+		admin := []any{map[string]any{"bearerAuth": []any{}}}
+		paths["/prefixes"] = map[string]any{
+			"get": apiSecured(apiOperation("getOverrides", "The prefixes added and removed through the admin API", nil,
+				map[string]any{"200": apiJSON("The overrides", apiRef("Overrides"))}), admin),
+			"post":   apiSecured(apiBody(apiOperation("addPrefixes", "Add prefixes to the set, whatever the inputs", nil, change), body), admin),
+			"delete": apiSecured(apiBody(apiOperation("removePrefixes", "Remove prefixes from the set, whatever the inputs", nil, change), body), admin),
+		}
+		schemas["Overrides"] = apiObject(map[string]any{"added": apiPrefixes(), "removed": apiPrefixes()})
+		schemas["AdminChange"] = apiObject(map[string]any{
+			"version": map[string]any{"type": "integer"}, "added": map[string]any{"type": "integer"}, "removed": map[string]any{"type": "integer"},
+		})
+	}
+	if features.ui {
+		paths["/ui/"] = map[string]any{"get": apiOperation("getUI", "The web UI", nil,
+			map[string]any{"200": map[string]any{"description": "The page", "content": map[string]any{"text/html": map[string]any{}}}})}
+		paths["/ui/api/lookup"] = map[string]any{"get": apiOperation("lookup", "Whether an address is in the set, and the prefix containing it",
+			[]any{map[string]any{"name": "ip", "in": "query", "required": true, "schema": map[string]any{"type": "string"}}},
+			map[string]any{"200": apiJSON("The lookup result", apiRef("Lookup")), "400": apiError("Invalid address")})}
+		paths["/ui/api/prefixes"] = map[string]any{"get": apiOperation("listPrefixes", "A page of the prefixes of the set",
+			[]any{
+				map[string]any{"name": "offset", "in": "query", "schema": map[string]any{"type": "integer", "minimum": 0, "default": 0}},
+				map[string]any{"name": "limit", "in": "query", "schema": map[string]any{"type": "integer", "minimum": 1, "maximum": 1000, "default": 100}},
+			},
+			map[string]any{"200": apiJSON("The page", apiRef("PrefixPage"))})}
+		paths["/ui/api/stats"] = map[string]any{"get": apiOperation("getStats", "The stats of the set", nil,
+			map[string]any{"200": apiJSON("The stats", apiRef("Stats"))})}
+		paths["/ui/api/formats"] = map[string]any{"get": apiOperation("listFormats", "The formats the set may be downloaded in", nil,
+			map[string]any{"200": apiJSON("The format names", map[string]any{"type": "array", "items": map[string]any{"type": "string"}})})}
+		paths["/ui/api/download"] = map[string]any{"get": apiOperation("download", "The set in an output format",
+			[]any{map[string]any{"name": "format", "in": "query", "required": true, "schema": map[string]any{"type": "string"}}},
+			map[string]any{
+				"200": map[string]any{"description": "The set", "content": map[string]any{"application/octet-stream": map[string]any{
+					"schema": map[string]any{"type": "string", "format": "binary"}}}},
+				"400": apiError("Unknown format, or one needing parameters"),
+			})}
+		integer := map[string]any{"type": "integer"}
+		counts := map[string]any{"type": "array", "items": integer}
+		schemas["Lookup"] = apiObject(map[string]any{
+			"ip": map[string]any{"type": "string"}, "version": integer, "found": map[string]any{"type": "boolean"}, "prefix": map[string]any{"type": "string"},
+		})
+		schemas["PrefixPage"] = apiObject(map[string]any{"version": integer, "total": integer, "offset": integer, "prefixes": apiPrefixes()})
+		schemas["Stats"] = apiObject(map[string]any{
+			"version": integer, "prefixes": integer, "ipv4_prefixes": integer, "ipv6_prefixes": integer,
+			"ipv4_addresses": integer, "ipv4_lengths": counts, "ipv6_lengths": counts,
+		})
+	}
+	if features.daemon {
+		paths["/status"] = map[string]any{"get": apiOperation("getStatus", "The status of the jobs", nil,
+			map[string]any{"200": apiJSON("The jobs", apiObject(map[string]any{"jobs": map[string]any{"type": "array", "items": apiRef("JobStatus")}}))})}
+		paths["/healthz"] = map[string]any{"get": apiOperation("getHealth", "Whether the last run of every job succeeded", nil,
+			map[string]any{
+				"200": map[string]any{"description": "All jobs succeeded", "content": map[string]any{"text/plain": map[string]any{}}},
+				"503": apiError("The last run of a job failed"),
+			})}
+		str, integer, number := map[string]any{"type": "string"}, map[string]any{"type": "integer"}, map[string]any{"type": "number"}
+		timestamp := map[string]any{"type": "string", "format": "date-time"}
+		schemas["JobStatus"] = apiObject(map[string]any{
+			"name": str, "schedule": str, "running": map[string]any{"type": "boolean"}, "runs": integer, "failures": integer,
+			"last_start": timestamp, "last_duration_seconds": number, "last_status": integer, "last_error": str, "next_run": timestamp,
+		})
+	}
+
+	for _, path := range paths {
+		for _, op := range path.(map[string]any) {
+			responses := op.(map[string]any)["responses"].(map[string]any)
+			if features.auth {
+				responses["401"] = apiError("Missing or invalid bearer token")
+			}
+			if features.limited {
+				responses["429"] = map[string]any{
+					"description": "Rate limit exceeded",
+					"headers":     map[string]any{"Retry-After": map[string]any{"description": "Seconds until the next request is allowed", "schema": map[string]any{"type": "integer"}}},
+				}
+			}
+		}
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "ipbin",
+			"version": strings.TrimPrefix(toolVersion(), "ipbin "),
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}
+	if features.auth || features.admin {
+		doc["components"].(map[string]any)["securitySchemes"] = map[string]any{
+			"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "description": "A static token or a JWT"},
+		}
+	}
+	if features.auth {
+		doc["security"] = []any{map[string]any{"bearerAuth": []any{}}}
+	}
+	return doc
+}
+
+// apiOperation returns an OpenAPI operation
+func apiOperation(id, summary string, params []any, responses map[string]any) map[string]any {
+	op := map[string]any{"operationId": id, "summary": summary, "responses": responses}
+	if params != nil {
+		op["parameters"] = params
+	}
+	return op
+}
+
+// apiSecured returns op requiring security
+func apiSecured(op map[string]any, security []any) map[string]any {
+	op["security"] = security
+	op["responses"].(map[string]any)["401"] = apiError("Missing or invalid bearer token")
+	return op
+}
+
+// apiBody returns op with a request body
+func apiBody(op, body map[string]any) map[string]any {
+	op["requestBody"] = body
+	return op
+}
+
+func apiJSON(description string, schema any) map[string]any {
+	return map[string]any{"description": description, "content": map[string]any{"application/json": map[string]any{"schema": schema}}}
+}
+
+func apiError(description string) map[string]any {
+	return map[string]any{"description": description, "content": map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}}}
+}
+
+func apiRef(schema string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + schema}
+}
+
+func apiObject(properties map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func apiPrefixes() map[string]any {
+	return map[string]any{"type": "array", "items": map[string]any{"type": "string", "example": "192.0.2.0/24"}}
+}
+
+func apiVersionHeader() map[string]any {
+	return map[string]any{"description": "The version of the set", "schema": map[string]any{"type": "integer"}}
+}
+
+func apiEpochHeader() map[string]any {
+	return map[string]any{"description": "The random ID of the publisher numbering the versions", "schema": map[string]any{"type": "string"}}
+}
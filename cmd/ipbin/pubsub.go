@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"go4.org/netipx"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+func publishUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin publish [options]
+
+publish serves the merged input to subscribers over HTTP long-polling,
+re-reading the inputs every interval and pushing the changes, as journal
+entries, to the subscribers waiting for them. Clients accepting
+text/event-stream get instead a stream of server-sent "add" and "remove"
+events, e.g. to mirror the set into edge enforcement points.
+
+With --overrides, the admin API adds prefixes to the served set with
+POST /prefixes and removes them with DELETE /prefixes, whatever the
+inputs, the body listing them as text input; GET /prefixes lists them.
+They are published at once and persisted in the --overrides journal.
+
+Options:
+`+inputUsage+`      --listen string      Address to listen on, unless socket activated by systemd (default: :8080)
+      --interval duration  Delay between reads of the inputs (default: 1m)
+      --history int        Versions whose changes are kept to answer with diffs (default: 100)
+      --overrides file     Journal persisting the prefixes added and removed with the admin API, which it enables
+      --admin-tokens file  Bearer tokens of the admin API, one per line (required with --overrides)
+      --ui                 Serve a web UI at /ui/ to search, browse, chart and download the set
+`+serverUsage+logUsage+`  -h, --help               Show this help message
+`)
+}
+
+func subscribeUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin subscribe [options] <url> <output-file>
+
+subscribe follows the set served by ipbin publish at the URL, replacing the
+output file atomically with each new version, so that readers can open or
+mmap it at any time.
+
+Options:
+  -b                       Write output as binary (default for .bin files)
+  -z                       Write output as gzip (default for .gz files)
+      --out-compression s  Output compression: none, gzip or zstd (default: from the extension, .gz or .zst)
+      --encrypt-to str     Recipient or recipient file the output is encrypted to, repeatable (see ipbin keygen)
+  -s, --sep string         Separator for text output, with \n, \r, \t, \0, \\ and \xHH escapes (default: \n)
+      --sep0               Separate text output with NUL bytes, e.g. for xargs -0
+  -f, --format string      Output format, by name or legacy number (default: subnets+ips)
+      --once               Exit after the first version instead of following the set
+      --ca file            Verify an HTTPS publisher with the CAs of the PEM file (default: those of the system)
+      --tls-cert file      PEM client certificate, for publishers requiring one (mutual TLS)
+      --tls-key file       PEM private key of --tls-cert
+      --token-file file    Send the bearer token of file, for publishers requiring one
+`+logUsage+`  -h, --help               Show this help message
+`)
+}
+
+func runPublish(args []string) {
+	var opts options
+	var listen, overridesPath, logFormat string
+	var interval time.Duration
+	var withUI, showHelp bool
+	var serverOpts serverOptions
+	pub := &ipbin.Publisher{}
+
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	addInputFlags(fs, &opts)
+	fs.StringVar(&listen, "listen", ":8080", "Address to listen on")
+	fs.DurationVar(&interval, "interval", time.Minute, "Delay between reads of the inputs")
+	fs.IntVar(&pub.History, "history", 100, "Versions whose changes are kept")
+	fs.StringVar(&overridesPath, "overrides", "", "Journal of the admin API changes")
+	fs.StringVar(&serverOpts.adminTokens, "admin-tokens", "", "Bearer tokens of the admin API")
+	fs.BoolVar(&withUI, "ui", false, "Serve a web UI browsing the set at /ui/")
+	addLogFlag(fs, &logFormat, "plain")
+	addServerFlags(fs, &serverOpts)
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = publishUsage
+	fs.Parse(expandShortFlags(args))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		publishUsage()
+		os.Exit(0)
+	}
+	if len(opts.inputs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: input file must be specified.\n")
+		publishUsage()
+		os.Exit(exitUsage)
+	}
+	setupLogging(logFormat)
+	if (overridesPath == "") != (serverOpts.adminTokens == "") {
+		fmt.Fprintf(os.Stderr, "Error: --overrides and --admin-tokens must be given together.\n")
+		os.Exit(exitUsage)
+	}
+	set := setFlags(fs)
+	var overrides *ipbin.Overrides
+	if overridesPath != "" {
+		var err error
+		if overrides, err = ipbin.OpenOverrides(overridesPath); err != nil {
+			logger.Error("Error reading overrides", "error", err)
+			os.Exit(exitStatus(err))
+		}
+	}
+
+	// The merged input, published with the overrides
+	var mu sync.Mutex
+	var input *netipx.IPSet
+	publish := func() error {
+		ipset := input
+		if overrides != nil {
+			var err error
+			if ipset, err = overrides.Apply(input); err != nil {
+				return err
+			}
+		}
+		prev := pub.Version()
+		if err := pub.Publish(ipset); err != nil {
+			return err
+		}
+		if v := pub.Version(); v != prev {
+			n := len(ipset.Prefixes())
+			logger.Info(fmt.Sprintf("Published version %d (%d prefixes).", v, n), "version", v, "prefixes", n)
+			setVersion.Set(int64(v))
+			setPrefixes.Set(int64(n))
+		}
+		return nil
+	}
+	// The first read must succeed, later failures keep the last version
+	update := func() error {
+		start := time.Now()
+		prefixes, err := readInputs(&opts, set)
+		if err != nil {
+			return err
+		}
+		read := time.Since(start)
+		ipset, err := mergePrefixes(&opts, prefixes)
+		if err != nil {
+			return err
+		}
+		merge := time.Since(start) - read
+		mu.Lock()
+		defer mu.Unlock()
+		input = ipset
+		if err := publish(); err != nil {
+			return err
+		}
+		logger.Info("update done", "stage", "update", "duration", time.Since(start), "read", read, "merge", merge, "version", pub.Version())
+		return nil
+	}
+	if err := update(); err != nil {
+		updateErrors.Add(1)
+		logger.Error("Error reading input", "error", err)
+		os.Exit(exitStatus(err))
+	}
+	go func() {
+		for range time.Tick(interval) {
+			if err := update(); err != nil {
+				updateErrors.Add(1)
+				logger.Error("Error reading input", "error", err)
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", pub)
+	if withUI {
+		mux.Handle("/ui/", newUI(pub))
+	}
+	serveOpenAPI(mux, apiFeatures{
+		publish: true, ui: withUI, admin: overrides != nil,
+		auth: serverOpts.authenticated(), limited: serverOpts.rateLimit > 0,
+	})
+	if overrides != nil {
+		tokens, err := readTokens(serverOpts.adminTokens)
+		if err != nil {
+			logger.Error("Error reading admin tokens", "error", err)
+			os.Exit(exitStatus(err))
+		}
+		admin := &ipbin.Authenticator{Tokens: tokens}
+		mux.Handle("/prefixes", admin.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				added, removed := overrides.Sets()
+				writeJSON(w, map[string]any{"added": prefixStrings(added), "removed": prefixStrings(removed)})
+				return
+			}
+			change := overrides.Add
+			switch r.Method {
+			case http.MethodPost:
+			case http.MethodDelete:
+				change = overrides.Remove
+			default:
+				w.Header().Set("Allow", "GET, POST, DELETE")
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			prefixes, err := ipbin.ParseIPSubnets(http.MaxBytesReader(w, r.Body, 1<<20))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(prefixes) == 0 {
+				http.Error(w, "no prefix", http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err := change(prefixes); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := publish(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			verb := map[string]string{http.MethodPost: "added", http.MethodDelete: "removed"}[r.Method]
+			client := ipbin.RequestClient(r)
+			logger.Info(fmt.Sprintf("Admin %s %s %d prefixes.", client, verb, len(prefixes)),
+				"request_id", requestID(r), "client", client, "op", verb, "prefixes", len(prefixes))
+			writeJSON(w, map[string]any{"version": pub.Version(), verb: len(prefixes)})
+		})))
+	}
+
+	if err := serveHTTP(shutdownContext(), listen, mux, serverOpts); err != nil {
+		logger.Error("Error serving", "error", err)
+		os.Exit(exitError)
+	}
+}
+
+func runSubscribe(args []string) {
+	var opts options
+	var once, showHelp bool
+	var caFile, tlsCert, tlsKey, tokenFile, logFormat string
+
+	fs := flag.NewFlagSet("subscribe", flag.ExitOnError)
+	addOutputFlags(fs, &opts)
+	fs.BoolVar(&once, "once", false, "Exit after the first version")
+	fs.StringVar(&caFile, "ca", "", "PEM CAs to verify the publisher with")
+	fs.StringVar(&tlsCert, "tls-cert", "", "PEM client certificate")
+	fs.StringVar(&tlsKey, "tls-key", "", "PEM private key of --tls-cert")
+	fs.StringVar(&tokenFile, "token-file", "", "File of the bearer token to send")
+	addLogFlag(fs, &logFormat, "plain")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = subscribeUsage
+	fs.Parse(expandShortFlags(args))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		subscribeUsage()
+		os.Exit(0)
+	}
+	if fs.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "Error: URL and output file must be specified.\n")
+		subscribeUsage()
+		os.Exit(exitUsage)
+	}
+	if err := unescapeOutput(&opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	setupLogging(logFormat)
+	if (tlsCert == "") != (tlsKey == "") {
+		fmt.Fprintf(os.Stderr, "Error: --tls-cert and --tls-key must be given together.\n")
+		os.Exit(exitUsage)
+	}
+	outputPath := fs.Arg(1)
+	opts.outputFilepath = outputPath
+	inferOutput(&opts, setFlags(fs))
+	// Write next to the output file, so that renaming it is atomic
+	opts.outputFilepath = filepath.Join(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".tmp")
+	opts.source = fs.Arg(0)
+
+	// SIGTERM and SIGINT interrupt the polls, not the writes
+	ctx := shutdownContext()
+	sub := &ipbin.Subscriber{URL: fs.Arg(0)}
+	if caFile != "" || tlsCert != "" {
+		config, err := ipbin.ClientTLSConfig(tlsCert, tlsKey, caFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: TLS: %v\n", err)
+			os.Exit(exitError)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		sub.Client = &http.Client{Transport: transport}
+	}
+	if tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			logger.Error("Error reading token", "error", err)
+			os.Exit(exitStatus(err))
+		}
+		sub.Token = strings.TrimSpace(string(token))
+	}
+	for {
+		ipset, changed, err := sub.Poll(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error("Error polling", "error", err)
+			if once {
+				os.Exit(exitError)
+			}
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := writePrefixes(&opts, ipset); err != nil {
+			logger.Error("Error writing output", "error", err)
+			os.Exit(exitError)
+		}
+		if err := os.Rename(opts.outputFilepath, outputPath); err != nil {
+			logger.Error("Error writing output", "error", err)
+			os.Exit(exitError)
+		}
+		n := len(ipset.Prefixes())
+		logger.Info(fmt.Sprintf("Updated %s to version %d (%d prefixes).", outputPath, sub.Version(), n),
+			"output", outputPath, "version", sub.Version(), "prefixes", n)
+		if once {
+			return
+		}
+	}
+}
+
+// writeJSON writes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// prefixStrings returns the prefixes of ipset as strings, an empty slice
+// rather than nil so that they marshal as a JSON array
+func prefixStrings(ipset *netipx.IPSet) []string {
+	s := []string{}
+	for _, p := range ipset.Prefixes() {
+		s = append(s, p.String())
+	}
+	return s
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+func queryUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin query [options] <address>...
+
+Prints the merged prefix of the input covering each address and, for text
+input, the input lines that contributed to it. Exits with status 8 if an
+address is not in the set.
+
+With --indexed, the inputs are indexed binary sets (see --index), local
+files or http(s) URLs, e.g. presigned S3 or GCS URLs, in which each address
+is looked up by reading a single block instead of the whole set.
+
+Options:
+`+inputUsage+`      --indexed            Look the addresses up in indexed binary inputs without reading them
+  -h, --help               Show this help message
+`)
+}
+
+func runQuery(args []string) {
+	var opts options
+	var indexed, showHelp bool
+
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	addInputFlags(fs, &opts)
+	fs.BoolVar(&indexed, "indexed", false, "Look the addresses up in indexed binary inputs")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = queryUsage
+	fs.Parse(expandShortFlags(args))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		queryUsage()
+		os.Exit(0)
+	}
+	if len(opts.inputs) == 0 || fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: input file and at least one address must be specified.\n")
+		queryUsage()
+		os.Exit(exitUsage)
+	}
+	addrs := make([]netip.Addr, fs.NArg())
+	for i, arg := range fs.Args() {
+		addr, err := netip.ParseAddr(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		addrs[i] = addr
+	}
+	if indexed {
+		os.Exit(queryIndexed(opts.inputs, addrs))
+	}
+
+	// Provenance is only known for text input, other formats are merged
+	// without it
+	set := setFlags(fs)
+	var sps []ipbin.SourcedPrefix
+	var prefixes []netip.Prefix
+	for _, path := range opts.inputs {
+		o := opts
+		o.inputFilepath = path
+		inferInput(&o, set)
+		if o.binIn || (o.inFormat != "" && o.inFormat != "text") {
+			nets, err := readPrefixes(&o)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+				os.Exit(exitStatus(err))
+			}
+			prefixes = append(prefixes, nets...)
+			continue
+		}
+		r, closeInput, err := openInput(&o)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			os.Exit(exitStatus(err))
+		}
+		fileSPs, err := ipbin.ParseIPSubnetsWithOrigin(r, path)
+		closeInput()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			os.Exit(exitStatus(err))
+		}
+		sps = append(sps, fileSPs...)
+		prefixes = append(prefixes, ipbin.SourcedPrefixes(fileSPs)...)
+	}
+	ipset, err := ipbin.MergePrefixes(prefixes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error merging prefixes: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	status := 0
+	for _, addr := range addrs {
+		p, ok := ipbin.CoveringPrefix(ipset, addr)
+		if !ok {
+			fmt.Printf("%s not found\n", addr)
+			status = exitNotFound
+			continue
+		}
+		fmt.Printf("%s %s\n", addr, p)
+		for _, o := range ipbin.Contributors(sps, p) {
+			fmt.Printf("  %s\n", o)
+		}
+	}
+	os.Exit(status)
+}
+
+// queryIndexed looks addrs up in the indexed sets at paths, files or URLs,
+// and returns the exit status
+func queryIndexed(paths []string, addrs []netip.Addr) int {
+	sets := make([]*ipbin.IndexedSet, len(paths))
+	for i, path := range paths {
+		var err error
+		if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+			sets[i], err = ipbin.OpenRemote(context.Background(), path, nil)
+		} else {
+			var f *os.File
+			if f, err = os.Open(path); err == nil {
+				defer f.Close()
+				var fi os.FileInfo
+				if fi, err = f.Stat(); err == nil {
+					sets[i], err = ipbin.OpenIndexed(f, fi.Size())
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", path, err)
+			return 1
+		}
+	}
+
+	status := 0
+	now := time.Now()
+	for _, addr := range addrs {
+		found := false
+		for i, s := range sets {
+			ep, ok, err := s.Lookup(addr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", paths[i], err)
+				return 1
+			}
+			if ok && !ep.Expired(now) {
+				fmt.Printf("%s %s\n  %s\n", addr, ep.Prefix, paths[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			fmt.Printf("%s not found\n", addr)
+			status = exitNotFound
+		}
+	}
+	return status
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"io"
+	"os"
+)
+
+func reportUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin report [options]
+
+Buckets the address space of the merged input by RIR and by country.
+Registries and countries come from RIR delegated statistics files; with a
+GeoIP database, countries come from it instead.
+
+Options:
+`+inputUsage+`      --delegated string   Comma-separated RIR delegated statistics files (delegated-<rir>-latest)
+      --geoip string       MaxMind country or city database (.mmdb)
+      --json               Write the report as JSON
+  -h, --help               Show this help message
+`)
+}
+
+// reportGroup is the JSON representation of an ipbin.AnnotatedGroup
+type reportGroup struct {
+	Value         string `json:"value"`
+	Prefixes      int    `json:"prefixes"`
+	IPv4Addresses uint64 `json:"ipv4_addresses"`
+	IPv6Addresses string `json:"ipv6_addresses"`
+}
+
+func reportGroups(groups []ipbin.AnnotatedGroup) []reportGroup {
+	out := make([]reportGroup, len(groups))
+	for i, g := range groups {
+		out[i] = reportGroup{g.Value, len(g.Prefixes), g.IPv4Addresses, g.IPv6Addresses.String()}
+	}
+	return out
+}
+
+func runReport(args []string) {
+	var opts options
+	var delegated string
+	var jsonOut, showHelp bool
+
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	addInputFlags(fs, &opts)
+	fs.StringVar(&delegated, "delegated", "", "Comma-separated RIR delegated statistics files")
+	fs.StringVar(&opts.geoipPath, "geoip", "", "MaxMind country or city database")
+	fs.BoolVar(&jsonOut, "json", false, "Write the report as JSON")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = reportUsage
+	fs.Parse(expandShortFlags(args))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		reportUsage()
+		os.Exit(0)
+	}
+	if len(opts.inputs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: input file must be specified.\n")
+		reportUsage()
+		os.Exit(exitUsage)
+	}
+	if delegated == "" && opts.geoipPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: at least one of --delegated or --geoip must be specified.\n")
+		reportUsage()
+		os.Exit(exitUsage)
+	}
+
+	var annotators []ipbin.Annotator
+	var ds []ipbin.Delegation
+	for _, path := range splitList(delegated) {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening delegated statistics: %v\n", err)
+			os.Exit(exitError)
+		}
+		d, err := ipbin.ParseDelegatedStats(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+			os.Exit(exitStatus(err))
+		}
+		ds = append(ds, d...)
+	}
+	if len(ds) > 0 {
+		annotators = append(annotators, ipbin.NewDelegationMap(ds))
+	}
+	if opts.geoipPath != "" {
+		db, err := ipbin.OpenMMDB(opts.geoipPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening GeoIP database: %v\n", err)
+			os.Exit(exitError)
+		}
+		annotators = append(annotators, &ipbin.GeoIPAnnotator{DB: db})
+	}
+
+	prefixes, err := readInputs(&opts, setFlags(fs))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(exitStatus(err))
+	}
+	ipset, err := ipbin.MergePrefixes(prefixes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error merging prefixes: %v\n", err)
+		os.Exit(exitError)
+	}
+	aps, err := ipbin.Annotate(ipset, annotators...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error annotating prefixes: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	byTotal := ipbin.GroupAnnotated(aps, "")
+	byRIR := ipbin.GroupAnnotated(aps, "rir")
+	byCountry := ipbin.GroupAnnotated(aps, "country")
+
+	if jsonOut {
+		report := map[string]any{
+			"total":   reportGroups(totalGroup(byTotal)),
+			"country": reportGroups(byCountry),
+		}
+		if len(ds) > 0 {
+			report["rir"] = reportGroups(byRIR)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	if err := writeSummaries(os.Stdout, len(ds) > 0, byRIR, byCountry, totalGroup(byTotal)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		os.Exit(exitError)
+	}
+}
+
+// writeSummaries writes the text tables of the report to w, that of the
+// RIRs first if withRIR, each ending with the total
+func writeSummaries(w io.Writer, withRIR bool, byRIR, byCountry, total []ipbin.AnnotatedGroup) error {
+	if withRIR {
+		if err := ipbin.WriteGroupSummary(w, "rir", append(byRIR, total...)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return ipbin.WriteGroupSummary(w, "country", append(byCountry, total...))
+}
+
+// totalGroup renames the single group of GroupAnnotated(aps, "") for
+// display as the last row of a summary
+func totalGroup(groups []ipbin.AnnotatedGroup) []ipbin.AnnotatedGroup {
+	if len(groups) == 0 {
+		return nil
+	}
+	g := groups[0]
+	g.Value = "total"
+	return []ipbin.AnnotatedGroup{g}
+}
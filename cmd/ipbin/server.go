@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// serverUsage documents the options registered by addServerFlags
+const serverUsage = `      --read-timeout dur   Longest a client may take to send a request (default: 10s)
+      --idle-timeout dur   Longest a keep-alive connection is kept idle (default: 2m)
+      --shutdown-timeout d Longest SIGTERM and SIGINT wait for in-flight requests to complete (default: 30s)
+      --tls-cert file      Serve HTTPS with the PEM certificate of file, re-read when rotated
+      --tls-key file       PEM private key of --tls-cert
+      --client-ca file     Require client certificates signed by a CA of the PEM file (mutual TLS)
+      --auth-tokens file   Require a bearer token among those of file, one per line
+      --jwt-key file       Require a bearer JWT verified with the PEM public key or the HMAC secret of file
+      --jwt-issuer string  Required iss claim of the JWTs
+      --jwt-audience str   Required aud claim of the JWTs
+      --rate-limit float   Requests per second of each client, by token or address (default: unlimited)
+      --rate-burst int     Requests a client may make at once over --rate-limit (default: 10)
+      --pprof addr         Serve net/http/pprof at /debug/pprof/ and expvar metrics at /debug/vars on
+                           this address, unauthenticated, e.g. localhost:6060 (default: off)
+`
+
+// serverOptions are the options of the commands running an HTTP server
+type serverOptions struct {
+	readTimeout, idleTimeout, shutdownTimeout  time.Duration
+	tlsCert, tlsKey, clientCA                  string
+	authTokens, jwtKey, jwtIssuer, jwtAudience string
+	adminTokens                                string // of the admin API of publish, if any
+	rateLimit                                  float64
+	rateBurst                                  int
+	pprof                                      string // address of the debug endpoints, if any
+}
+
+// addServerFlags registers the options of the commands running an HTTP
+// server
+func addServerFlags(fs *flag.FlagSet, opts *serverOptions) {
+	fs.DurationVar(&opts.readTimeout, "read-timeout", 10*time.Second, "Longest a client may take to send a request")
+	fs.DurationVar(&opts.idleTimeout, "idle-timeout", 2*time.Minute, "Longest a keep-alive connection is kept idle")
+	fs.DurationVar(&opts.shutdownTimeout, "shutdown-timeout", 30*time.Second, "Longest wait for in-flight requests on shutdown")
+	fs.StringVar(&opts.tlsCert, "tls-cert", "", "PEM certificate to serve HTTPS with")
+	fs.StringVar(&opts.tlsKey, "tls-key", "", "PEM private key of --tls-cert")
+	fs.StringVar(&opts.clientCA, "client-ca", "", "PEM CAs client certificates must be signed by")
+	fs.StringVar(&opts.authTokens, "auth-tokens", "", "File of the bearer tokens accepted")
+	fs.StringVar(&opts.jwtKey, "jwt-key", "", "File of the key verifying bearer JWTs")
+	fs.StringVar(&opts.jwtIssuer, "jwt-issuer", "", "Required iss claim of the JWTs")
+	fs.StringVar(&opts.jwtAudience, "jwt-audience", "", "Required aud claim of the JWTs")
+	fs.Float64Var(&opts.rateLimit, "rate-limit", 0, "Requests per second of each client")
+	fs.IntVar(&opts.rateBurst, "rate-burst", 10, "Requests a client may make at once")
+	fs.StringVar(&opts.pprof, "pprof", "", "Address serving pprof and expvar metrics")
+}
+
+// shutdownContext returns a context canceled on SIGTERM or SIGINT, which
+// then restore their default behavior, so that a second one kills at once
+func shutdownContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	context.AfterFunc(ctx, stop)
+	return ctx
+}
+
+// protect wraps handler with the authentication and rate limiting of opts,
+// if any.
+func protect(handler http.Handler, opts serverOptions) (http.Handler, error) {
+	if opts.rateLimit < 0 {
+		return nil, errors.New("--rate-limit must not be negative")
+	}
+	if opts.rateLimit > 0 {
+		handler = (&ipbin.RateLimiter{Rate: opts.rateLimit, Burst: opts.rateBurst}).Handler(handler)
+	}
+	if !opts.authenticated() {
+		if opts.jwtIssuer != "" || opts.jwtAudience != "" {
+			return nil, errors.New("--jwt-issuer and --jwt-audience require --jwt-key")
+		}
+		return handler, nil
+	}
+	auth := &ipbin.Authenticator{Issuer: opts.jwtIssuer, Audience: opts.jwtAudience, Leeway: time.Minute}
+	for _, path := range []string{opts.authTokens, opts.adminTokens} {
+		if path == "" {
+			continue
+		}
+		// Admin tokens may read too
+		tokens, err := readTokens(path)
+		if err != nil {
+			return nil, err
+		}
+		auth.Tokens = append(auth.Tokens, tokens...)
+	}
+	if opts.jwtKey != "" {
+		data, err := os.ReadFile(opts.jwtKey)
+		if err != nil {
+			return nil, err
+		}
+		if auth.JWTKey, err = ipbin.ParseJWTKey(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", opts.jwtKey, err)
+		}
+	}
+	return auth.Handler(handler), nil
+}
+
+// authenticated reports whether opts require a bearer token
+func (opts serverOptions) authenticated() bool {
+	return opts.authTokens != "" || opts.jwtKey != ""
+}
+
+// readTokens reads the bearer tokens of a file, one per line, ignoring
+// empty lines and comments starting with '#'.
+func readTokens(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s: no token", path)
+	}
+	return tokens, nil
+}
+
+// serveHTTP serves handler on the socket passed by systemd socket
+// activation, if any, or on addr otherwise, over TLS if opts has a
+// certificate, to the clients authenticated by opts, if required, and
+// notifies systemd once listening. The requests are logged, with an ID, and
+// counted, and the debug endpoints of opts served, if any.
+// Once ctx is done, it stops accepting connections and returns when the
+// in-flight requests have completed, or after the shutdown timeout. The
+// contexts of the requests are canceled too, so that long polls return at
+// once.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler, opts serverOptions) error {
+	var tlsConfig *tls.Config
+	if opts.tlsCert != "" || opts.tlsKey != "" {
+		if opts.tlsCert == "" || opts.tlsKey == "" {
+			return errors.New("--tls-cert and --tls-key must be given together")
+		}
+		var err error
+		if tlsConfig, err = ipbin.ServerTLSConfig(opts.tlsCert, opts.tlsKey, opts.clientCA); err != nil {
+			return fmt.Errorf("TLS: %w", err)
+		}
+	} else if opts.clientCA != "" {
+		return errors.New("--client-ca requires --tls-cert and --tls-key")
+	}
+	handler, err := protect(handler, opts)
+	if err != nil {
+		return err
+	}
+	if opts.pprof != "" {
+		if err := startPprof(opts.pprof); err != nil {
+			return err
+		}
+	}
+	listeners, err := ipbin.SystemdListeners()
+	if err != nil {
+		return err
+	}
+	var l net.Listener
+	if len(listeners) > 0 {
+		l = listeners[0]
+		logger.Info(fmt.Sprintf("Listening on %s (socket activation)...", l.Addr()), "addr", l.Addr().String(), "socket_activation", true)
+	} else {
+		if l, err = net.Listen("tcp", addr); err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("Listening on %s...", l.Addr()), "addr", l.Addr().String())
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+	srv := &http.Server{
+		Handler:           logRequests(handler),
+		ReadHeaderTimeout: opts.readTimeout,
+		ReadTimeout:       opts.readTimeout,
+		IdleTimeout:       opts.idleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+	notifyReady()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	logger.Info("Shutting down...")
+	ipbin.SystemdNotify("STOPPING=1")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), opts.shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// notifyReady notifies systemd that the service is ready, when run as a
+// service of Type=notify, and pings its watchdog, if enabled, from then on.
+func notifyReady() {
+	if _, err := ipbin.SystemdNotify("READY=1"); err != nil {
+		logger.Error("Error notifying systemd", "error", err)
+	}
+	if interval := ipbin.SystemdWatchdog(); interval > 0 {
+		go func() {
+			// Twice per interval, as recommended by sd_watchdog_enabled(3)
+			for range time.Tick(interval / 2) {
+				ipbin.SystemdNotify("WATCHDOG=1")
+			}
+		}()
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"os"
+	"strings"
+)
+
+func signUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin sign [options] <file>
+       ipbin verify [options] <file>
+
+sign writes the detached Ed25519 signature of a file, base64-encoded, to
+<file>.sig. verify checks it, exiting with status 5 if it does not match.
+Keys are PEM files, e.g. generated with:
+  openssl genpkey -algorithm ed25519 -out key.pem
+  openssl pkey -in key.pem -pubout -out pub.pem
+
+Options:
+  -k, --key string         Private key (sign) or public key (verify) file
+      --sig string         Signature file (default: <file>.sig)
+  -h, --help               Show this help message
+`)
+}
+
+func runSign(command string, args []string) {
+	var keyPath, sigPath string
+	var showHelp bool
+
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.StringVar(&keyPath, "key", "", "Key file")
+	fs.StringVar(&keyPath, "k", "", "Key file (shorthand)")
+	fs.StringVar(&sigPath, "sig", "", "Signature file")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = signUsage
+	fs.Parse(expandShortFlags(args))
+
+	if showHelp {
+		signUsage()
+		os.Exit(0)
+	}
+	if fs.NArg() < 1 || keyPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: key and file must be specified.\n")
+		signUsage()
+		os.Exit(exitUsage)
+	}
+	path := fs.Arg(0)
+	if sigPath == "" {
+		sigPath = path + ".sig"
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading key: %v\n", err)
+		os.Exit(exitError)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening file: %v\n", err)
+		os.Exit(exitError)
+	}
+	defer f.Close()
+
+	if command == "sign" {
+		key, err := ipbin.ParsePrivateKeyPEM(keyPEM)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading key: %v\n", err)
+			os.Exit(exitError)
+		}
+		sig, err := ipbin.SignReader(f, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error signing: %v\n", err)
+			os.Exit(exitError)
+		}
+		if err := os.WriteFile(sigPath, []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing signature: %v\n", err)
+			os.Exit(exitError)
+		}
+		fmt.Printf("Signature written to %s.\n", sigPath)
+		return
+	}
+
+	key, err := ipbin.ParsePublicKeyPEM(keyPEM)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading key: %v\n", err)
+		os.Exit(exitError)
+	}
+	b, err := os.ReadFile(sigPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading signature: %v\n", err)
+		os.Exit(exitError)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading signature: %v\n", err)
+		os.Exit(exitError)
+	}
+	if err := ipbin.VerifyReader(f, sig, key); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+		os.Exit(exitValidation)
+	}
+	fmt.Printf("%s: signature OK\n", path)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"go4.org/netipx"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+//go:embed ui/index.html
+var uiPage []byte
+
+// ui serves the web UI browsing the set of a Publisher under /ui/: the page
+// and the JSON API it calls
+type ui struct {
+	pub *ipbin.Publisher
+
+	// The prefixes of the last version browsed, so that pages do not list
+	// the set again
+	mu       sync.Mutex
+	version  uint64
+	prefixes []netip.Prefix
+}
+
+// newUI returns the handler of the web UI of pub
+func newUI(pub *ipbin.Publisher) http.Handler {
+	u := &ui{pub: pub}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ui/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(uiPage)
+	})
+	mux.HandleFunc("GET /ui/api/lookup", u.lookup)
+	mux.HandleFunc("GET /ui/api/prefixes", u.page)
+	mux.HandleFunc("GET /ui/api/stats", u.stats)
+	mux.HandleFunc("GET /ui/api/formats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, append([]string{"binary"}, ipbin.OutputFormats()...))
+	})
+	mux.HandleFunc("GET /ui/api/download", u.download)
+	return mux
+}
+
+// current returns the current version of the set, empty if none yet, and
+// its prefixes
+func (u *ui) current() (*netipx.IPSet, uint64, []netip.Prefix) {
+	set, version := u.pub.Current()
+	if set == nil {
+		set = &netipx.IPSet{}
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.prefixes == nil || u.version != version {
+		u.version, u.prefixes = version, set.Prefixes()
+	}
+	return set, version, u.prefixes
+}
+
+func (u *ui) lookup(w http.ResponseWriter, r *http.Request) {
+	addr, err := netip.ParseAddr(r.URL.Query().Get("ip"))
+	if err != nil {
+		http.Error(w, "invalid ip", http.StatusBadRequest)
+		return
+	}
+	_, version, prefixes := u.current()
+	result := map[string]any{"ip": addr.String(), "version": version, "found": false}
+	// The last prefix starting at or before addr is the only one which may
+	// contain it
+	i := sort.Search(len(prefixes), func(i int) bool { return addr.Less(prefixes[i].Addr()) })
+	if i > 0 && prefixes[i-1].Contains(addr) {
+		result["found"], result["prefix"] = true, prefixes[i-1].String()
+	}
+	writeJSON(w, result)
+}
+
+func (u *ui) page(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	_, version, prefixes := u.current()
+	offset = min(max(offset, 0), len(prefixes))
+	end := min(offset+min(limit, 1000), len(prefixes))
+	page := make([]string, 0, end-offset)
+	for _, p := range prefixes[offset:end] {
+		page = append(page, p.String())
+	}
+	writeJSON(w, map[string]any{"version": version, "total": len(prefixes), "offset": offset, "prefixes": page})
+}
+
+func (u *ui) stats(w http.ResponseWriter, r *http.Request) {
+	_, version, prefixes := u.current()
+	var v4, v6 int
+	var v4Addresses uint64
+	v4Lengths, v6Lengths := make([]int, 33), make([]int, 129)
+	for _, p := range prefixes {
+		if p.Addr().Is4() {
+			v4++
+			v4Addresses += 1 << (32 - p.Bits())
+			v4Lengths[p.Bits()]++
+		} else {
+			v6++
+			v6Lengths[p.Bits()]++
+		}
+	}
+	writeJSON(w, map[string]any{
+		"version":        version,
+		"prefixes":       len(prefixes),
+		"ipv4_prefixes":  v4,
+		"ipv6_prefixes":  v6,
+		"ipv4_addresses": v4Addresses,
+		"ipv4_lengths":   v4Lengths,
+		"ipv6_lengths":   v6Lengths,
+	})
+}
+
+func (u *ui) download(w http.ResponseWriter, r *http.Request) {
+	set, version, prefixes := u.current()
+	name := r.URL.Query().Get("format")
+	var body bytes.Buffer
+	ext := "txt"
+	if name == "binary" {
+		ext = "bin"
+		if err := ipbin.WriteEncodedAll(&body, prefixes); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		format, err := ipbin.ParseOutputFormat(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		render, _ := ipbin.OutputFormat(format)
+		// Formats needing parameters, e.g. rdns-zones, fail without them
+		if err := render(&body, set, ipbin.RenderOptions{EOL: true}); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name = format
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="ipbin-v%d-%s.%s"`, version, name, ext))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body.Bytes())
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/anatoly-kussul/ipbin/ipbin"
+	"go4.org/netipx"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+func watchUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: ipbin watch [options] -i <input>... <output-file>
+
+watch converts the inputs to the output file, then again each time they
+change, replacing the output file atomically when the set changes and
+running the --on-update command, if any. The inputs are polled, so that
+changes on network file systems and files replaced by renames are seen.
+
+Options:
+`+inputUsage+`  -b                       Write output as binary (default for .bin files)
+  -z                       Write output as gzip (default for .gz files)
+      --out-compression s  Output compression: none, gzip or zstd (default: from the extension, .gz or .zst)
+      --encrypt-to str     Recipient or recipient file the output is encrypted to, repeatable (see ipbin keygen)
+  -s, --sep string         Separator for text output, with \n, \r, \t, \0, \\ and \xHH escapes (default: \n)
+      --sep0               Separate text output with NUL bytes, e.g. for xargs -0
+  -f, --format string      Output format, by name or legacy number (default: subnets+ips)
+      --poll duration      Delay between checks of the inputs for changes (default: 1s)
+      --debounce duration  Delay without changes before converting, e.g. for feeds written in several steps (default: 2s)
+      --on-update command  Shell command run after each update of the output, e.g. "nginx -s reload",
+                           with IPBIN_OUTPUT set to the output file and IPBIN_PREFIXES to the prefix count
+`+logUsage+`  -h, --help               Show this help message
+`)
+}
+
+func runWatch(args []string) {
+	var opts options
+	var poll, debounce time.Duration
+	var onUpdate, logFormat string
+	var showHelp bool
+
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	addInputFlags(fs, &opts)
+	addOutputFlags(fs, &opts)
+	fs.DurationVar(&poll, "poll", time.Second, "Delay between checks of the inputs for changes")
+	fs.DurationVar(&debounce, "debounce", 2*time.Second, "Delay without changes before converting")
+	fs.StringVar(&onUpdate, "on-update", "", "Shell command run after each update of the output")
+	addLogFlag(fs, &logFormat, "plain")
+	fs.BoolVar(&showHelp, "help", false, "Show help message")
+	fs.BoolVar(&showHelp, "h", false, "Show help message (shorthand)")
+	fs.Usage = watchUsage
+	fs.Parse(expandShortFlags(args))
+	opts.params = flagParams(fs)
+
+	if showHelp {
+		watchUsage()
+		os.Exit(0)
+	}
+	if len(opts.inputs) == 0 || fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Error: input and output file paths must be specified.\n")
+		watchUsage()
+		os.Exit(exitUsage)
+	}
+	setupLogging(logFormat)
+	if poll <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --poll must be positive.\n")
+		os.Exit(exitUsage)
+	}
+	if err := unescapeOutput(&opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	set := setFlags(fs)
+	outputPath := fs.Arg(0)
+	opts.outputFilepath = outputPath
+	inferOutput(&opts, set)
+	// Write next to the output file, so that renaming it is atomic
+	opts.outputFilepath = filepath.Join(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".tmp")
+
+	// The first conversion must succeed, later failures keep the last output
+	var last []netipx.IPRange
+	update := func() error {
+		start := time.Now()
+		prefixes, err := readInputs(&opts, set)
+		if err != nil {
+			return err
+		}
+		ipset, err := mergePrefixes(&opts, prefixes)
+		if err != nil {
+			return err
+		}
+		if last != nil && slices.Equal(ipset.Ranges(), last) {
+			return nil
+		}
+		if err := writePrefixes(&opts, ipset); err != nil {
+			return err
+		}
+		if err := os.Rename(opts.outputFilepath, outputPath); err != nil {
+			return err
+		}
+		last = ipset.Ranges()
+		n := len(ipset.Prefixes())
+		logger.Info(fmt.Sprintf("Updated %s (%d prefixes).", outputPath, n), "output", outputPath, "prefixes", n, "duration", time.Since(start))
+		if onUpdate == "" {
+			return nil
+		}
+		cmd := exec.Command("sh", "-c", onUpdate)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		cmd.Env = append(os.Environ(), "IPBIN_OUTPUT="+outputPath, "IPBIN_PREFIXES="+strconv.Itoa(n))
+		if err := cmd.Run(); err != nil {
+			logger.Error("Error running --on-update", "error", err)
+		}
+		return nil
+	}
+	if err := update(); err != nil {
+		logger.Error("Error converting input", "error", err)
+		os.Exit(exitStatus(err))
+	}
+	logger.Info(fmt.Sprintf("Watching %d inputs...", len(opts.inputs)), "inputs", opts.inputs)
+	ipbin.WatchFiles(context.Background(), opts.inputs, poll, debounce, func() {
+		if err := update(); err != nil {
+			logger.Error("Error converting input", "error", err)
+		}
+	})
+}
@@ -1,5 +1,8 @@
 module github.com/anatoly-kussul/ipbin
 
-go 1.23
+go 1.24
 
-require go4.org/netipx v0.0.0-20220812043211-3cc044ffd68d
+require (
+	github.com/klauspost/compress v1.18.0
+	go4.org/netipx v0.0.0-20220812043211-3cc044ffd68d
+)
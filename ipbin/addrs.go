@@ -0,0 +1,53 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+	"net/netip"
+)
+
+// PrefixesFromAddrs returns the single-address prefixes of addrs, e.g. to
+// build a set from the addresses a service already holds in memory without
+// formatting and parsing them. Zones are dropped and invalid addresses
+// skipped.
+func PrefixesFromAddrs(addrs []netip.Addr) []netip.Prefix {
+	nets := make([]netip.Prefix, 0, len(addrs))
+	for _, a := range addrs {
+		if a.IsValid() {
+			a = a.WithZone("")
+			nets = append(nets, netip.PrefixFrom(a, a.BitLen()))
+		}
+	}
+	return nets
+}
+
+// MergeAddrs merges addrs into the minimal set of covering prefixes, like
+// MergePrefixes(PrefixesFromAddrs(addrs)) without the intermediate slice.
+func MergeAddrs(addrs []netip.Addr) (*netipx.IPSet, error) {
+	var b netipx.IPSetBuilder
+	for _, a := range addrs {
+		if a.IsValid() {
+			b.Add(a.WithZone(""))
+		}
+	}
+	return b.IPSet()
+}
+
+// PrefixesFromUint32 returns the single-address prefixes of IPv4 addresses
+// held as big-endian uint32 values, 0x0A000001 for 10.0.0.1.
+func PrefixesFromUint32(addrs []uint32) []netip.Prefix {
+	nets := make([]netip.Prefix, len(addrs))
+	for i, u := range addrs {
+		nets[i] = netip.PrefixFrom(uint32ToIPv4(u), 32)
+	}
+	return nets
+}
+
+// MergeUint32 merges IPv4 addresses held as big-endian uint32 values into
+// the minimal set of covering prefixes.
+func MergeUint32(addrs []uint32) (*netipx.IPSet, error) {
+	var b netipx.IPSetBuilder
+	for _, u := range addrs {
+		b.Add(uint32ToIPv4(u))
+	}
+	return b.IPSet()
+}
@@ -0,0 +1,45 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestAddrs(t *testing.T) {
+	addrs := []netip.Addr{
+		netip.MustParseAddr("10.0.0.1"),
+		netip.MustParseAddr("10.0.0.0"),
+		{},
+		netip.MustParseAddr("fe80::1%eth0"),
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.1/32"),
+		netip.MustParsePrefix("10.0.0.0/32"),
+		netip.MustParsePrefix("fe80::1/128"),
+	}
+	if got := PrefixesFromAddrs(addrs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("PrefixesFromAddrs got %v, want %v", got, expected)
+	}
+	ipset, err := MergeAddrs(addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/31"), netip.MustParsePrefix("fe80::1/128")}
+	if got := ipset.Prefixes(); !reflect.DeepEqual(got, merged) {
+		t.Errorf("MergeAddrs got %v, want %v", got, merged)
+	}
+
+	u := []uint32{0x0A000001, 0x0A000000, 0xC0000201}
+	if got := PrefixesFromUint32(u); len(got) != 3 || got[2] != netip.MustParsePrefix("192.0.2.1/32") {
+		t.Errorf("PrefixesFromUint32 got %v", got)
+	}
+	ipset, err = MergeUint32(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/31"), netip.MustParsePrefix("192.0.2.1/32")}
+	if got := ipset.Prefixes(); !reflect.DeepEqual(got, merged) {
+		t.Errorf("MergeUint32 got %v, want %v", got, merged)
+	}
+}
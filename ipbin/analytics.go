@@ -0,0 +1,63 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"go4.org/netipx"
+	"math/big"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// clickHouseEscaper escapes the values of TabSeparated data.
+var clickHouseEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// ClickHouseTrieRecord returns the TabSeparated row of p in the source file
+// of a ClickHouse ip_trie dictionary: the prefix, then value as its
+// attribute, e.g. "192.0.2.0/24\t1". With the dictionary
+//
+//	CREATE DICTIONARY blocklist (prefix String, listed UInt8 DEFAULT 0)
+//	PRIMARY KEY prefix
+//	SOURCE(FILE(path 'blocklist.tsv' format 'TabSeparated'))
+//	LAYOUT(IP_TRIE) LIFETIME(300)
+//
+// dictGet('blocklist', 'listed', tuple(ip)) is 1 for the addresses of the
+// set.
+func ClickHouseTrieRecord(p netip.Prefix, value string) string {
+	return p.Masked().String() + "\t" + clickHouseEscaper.Replace(value)
+}
+
+// AppendBigQueryRange appends r to dst as a line of newline-delimited JSON
+// loadable by BigQuery, with the integers of its first and last addresses,
+// the addresses themselves and their version, e.g.
+//
+//	{"start":3221225984,"end":3221226239,"first_ip":"192.0.2.0","last_ip":"192.0.2.255","version":4}
+//
+// The integers of IPv6 addresses exceed INT64, so tables of sets including
+// them need BIGNUMERIC start and end columns.
+func AppendBigQueryRange(dst []byte, r netipx.IPRange) []byte {
+	dst = append(dst, `{"start":`...)
+	dst = AppendAddrDecimal(dst, r.From())
+	dst = append(dst, `,"end":`...)
+	dst = AppendAddrDecimal(dst, r.To())
+	dst = append(dst, `,"first_ip":"`...)
+	dst = r.From().AppendTo(dst)
+	dst = append(dst, `","last_ip":"`...)
+	dst = r.To().AppendTo(dst)
+	version := 4
+	if r.From().Is6() {
+		version = 6
+	}
+	return append(strconv.AppendInt(append(dst, `","version":`...), int64(version), 10), '}')
+}
+
+// AppendAddrDecimal appends addr as an unsigned decimal integer to dst, as
+// the analytics databases store addresses.
+func AppendAddrDecimal(dst []byte, addr netip.Addr) []byte {
+	if addr.Is4() {
+		a := addr.As4()
+		return strconv.AppendUint(dst, uint64(binary.BigEndian.Uint32(a[:])), 10)
+	}
+	a := addr.As16()
+	return new(big.Int).SetBytes(a[:]).Append(dst, 10)
+}
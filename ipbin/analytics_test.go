@@ -0,0 +1,39 @@
+package ipbin
+
+import (
+	"encoding/json"
+	"go4.org/netipx"
+	"net/netip"
+	"testing"
+)
+
+func TestClickHouseTrieRecord(t *testing.T) {
+	p := netip.MustParsePrefix("192.0.2.7/24")
+	if got := ClickHouseTrieRecord(p, "1"); got != "192.0.2.0/24\t1" {
+		t.Errorf("got %q", got)
+	}
+	if got := ClickHouseTrieRecord(p, "a\tb\\c"); got != `192.0.2.0/24`+"\t"+`a\tb\\c` {
+		t.Errorf("escaped got %q", got)
+	}
+}
+
+func TestAppendBigQueryRange(t *testing.T) {
+	r := netipx.IPRangeFrom(netip.MustParseAddr("192.0.2.0"), netip.MustParseAddr("192.0.2.255"))
+	want := `{"start":3221225984,"end":3221226239,"first_ip":"192.0.2.0","last_ip":"192.0.2.255","version":4}`
+	if got := string(AppendBigQueryRange(nil, r)); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	r = netipx.IPRangeFrom(netip.MustParseAddr("2001:db8::"), netip.MustParseAddr("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"))
+	var row struct {
+		Start   json.Number `json:"start"`
+		End     json.Number `json:"end"`
+		Version int         `json:"version"`
+	}
+	if err := json.Unmarshal(AppendBigQueryRange(nil, r), &row); err != nil {
+		t.Fatal(err)
+	}
+	if row.Start != "42540766411282592856903984951653826560" || row.End != "340282366920938463463374607431768211455" || row.Version != 6 {
+		t.Errorf("got %+v", row)
+	}
+}
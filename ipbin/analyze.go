@@ -0,0 +1,85 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+	"slices"
+)
+
+// FindingKind is the kind of redundancy of an input entry.
+type FindingKind int
+
+const (
+	FindingDuplicate FindingKind = iota // equal to another entry
+	FindingContained                    // strictly within another entry
+	FindingAdjacent                     // adjacent to another entry, merging with it
+)
+
+var findingKindNames = []string{
+	FindingDuplicate: "duplicate of",
+	FindingContained: "contained in",
+	FindingAdjacent:  "adjacent to",
+}
+
+func (k FindingKind) String() string {
+	return findingKindNames[k]
+}
+
+// Finding is a redundant input entry, along with the entry making it so.
+type Finding struct {
+	Kind  FindingKind
+	Entry SourcedPrefix
+	Other SourcedPrefix
+}
+
+// InputAnalysis is the data quality report of an input, as the feed
+// maintainers see it: how many of its entries merging makes redundant.
+type InputAnalysis struct {
+	Entries    int // prefixes in the input, several for a range line
+	Duplicates int // entries equal to an earlier one
+	Contained  int // entries strictly within another one
+	Adjacent   int // entries adjacent to another one, from another line
+	Merged     int // prefixes after merging
+	Findings   []Finding
+}
+
+// AnalyzeInput reports the duplicate, contained and adjacent entries of
+// sps, in address order. The prefixes of a range line are adjacent by
+// construction and not reported.
+func AnalyzeInput(sps []SourcedPrefix) (InputAnalysis, error) {
+	a := InputAnalysis{Entries: len(sps)}
+	sorted := slices.Clone(sps)
+	slices.SortStableFunc(sorted, func(x, y SourcedPrefix) int {
+		if c := x.Prefix.Masked().Addr().Compare(y.Prefix.Masked().Addr()); c != 0 {
+			return c
+		}
+		return x.Prefix.Bits() - y.Prefix.Bits()
+	})
+	var b netipx.IPSetBuilder
+	var cover SourcedPrefix // last entry not redundant, covering the following ones if any
+	var coverRange netipx.IPRange
+	for i, sp := range sorted {
+		b.AddPrefix(sp.Prefix)
+		r := netipx.RangeOfPrefix(sp.Prefix.Masked())
+		switch {
+		case i > 0 && sp.Prefix.Masked() == sorted[i-1].Prefix.Masked():
+			// Equal prefixes are sorted together, in input order
+			a.Duplicates++
+			a.Findings = append(a.Findings, Finding{FindingDuplicate, sp, sorted[i-1]})
+		case coverRange.IsValid() && coverRange.To().Compare(r.To()) >= 0:
+			a.Contained++
+			a.Findings = append(a.Findings, Finding{FindingContained, sp, cover})
+		default:
+			if coverRange.IsValid() && coverRange.To().Next() == r.From() && cover.Origin != sp.Origin {
+				a.Adjacent++
+				a.Findings = append(a.Findings, Finding{FindingAdjacent, sp, cover})
+			}
+			cover, coverRange = sp, r
+		}
+	}
+	ipset, err := b.IPSet()
+	if err != nil {
+		return InputAnalysis{}, err
+	}
+	a.Merged = len(ipset.Prefixes())
+	return a, nil
+}
@@ -0,0 +1,41 @@
+package ipbin
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeInput(t *testing.T) {
+	input := `10.0.0.0/8
+10.1.0.0/16
+192.0.2.0/25
+10.1.0.0/16
+192.0.2.128/25
+198.51.100.0-198.51.100.255
+2001:db8::/32
+2001:db8::/32
+`
+	sps, err := ParseIPSubnetsWithOrigin(strings.NewReader(input), "feed.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := AnalyzeInput(sps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var findings []string
+	for _, f := range a.Findings {
+		findings = append(findings, fmt.Sprintf("%d %s %d", f.Entry.Origin.Line, f.Kind, f.Other.Origin.Line))
+	}
+	want := []string{"2 contained in 1", "4 duplicate of 2", "5 adjacent to 3", "8 duplicate of 7"}
+	if !reflect.DeepEqual(findings, want) {
+		t.Errorf("got findings %q, want %q", findings, want)
+	}
+	// 10.0.0.0/8, 192.0.2.0/24, 198.51.100.0/24, 2001:db8::/32
+	a.Findings = nil
+	if want := (InputAnalysis{Entries: 8, Duplicates: 2, Contained: 1, Adjacent: 1, Merged: 4}); !reflect.DeepEqual(a, want) {
+		t.Errorf("got %+v, want %+v", a, want)
+	}
+}
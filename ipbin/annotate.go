@@ -0,0 +1,211 @@
+package ipbin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"math/big"
+	"net/netip"
+	"slices"
+	"text/tabwriter"
+)
+
+// AnnotatedPrefix is a prefix with named attributes attached by
+// annotators, e.g. its registry holder or country.
+type AnnotatedPrefix struct {
+	Prefix netip.Prefix
+	Attrs  map[string]string
+}
+
+// MarshalJSON encodes ap as a flat JSON object with a "prefix" member and
+// one member per attribute.
+func (ap AnnotatedPrefix) MarshalJSON() ([]byte, error) {
+	m := make(map[string]string, len(ap.Attrs)+1)
+	for k, v := range ap.Attrs {
+		m[k] = v
+	}
+	m["prefix"] = ap.Prefix.String()
+	return json.Marshal(m)
+}
+
+// Annotator looks up attributes of a prefix. Attributes that are unknown
+// for the prefix are omitted from the returned map.
+type Annotator interface {
+	Annotate(p netip.Prefix) (map[string]string, error)
+}
+
+// Splitter is implemented by annotators whose attributes may differ
+// within a prefix, e.g. a merged prefix spanning several countries. Split
+// returns p divided into prefixes with uniform attributes.
+type Splitter interface {
+	Split(p netip.Prefix) ([]netip.Prefix, error)
+}
+
+// Annotate returns the prefixes of ipset with the attributes of all
+// annotators merged in order; later annotators override attributes of
+// earlier ones with the same name. Prefixes are first split by every
+// annotator implementing Splitter.
+func Annotate(ipset *netipx.IPSet, annotators ...Annotator) ([]AnnotatedPrefix, error) {
+	prefixes := ipset.Prefixes()
+	for _, a := range annotators {
+		s, ok := a.(Splitter)
+		if !ok {
+			continue
+		}
+		var split []netip.Prefix
+		for _, p := range prefixes {
+			parts, err := s.Split(p)
+			if err != nil {
+				return nil, err
+			}
+			split = append(split, parts...)
+		}
+		prefixes = split
+	}
+	out := make([]AnnotatedPrefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		ap := AnnotatedPrefix{Prefix: p, Attrs: map[string]string{}}
+		for _, a := range annotators {
+			attrs, err := a.Annotate(p)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range attrs {
+				ap.Attrs[k] = v
+			}
+		}
+		out = append(out, ap)
+	}
+	return out, nil
+}
+
+// FilterAnnotated returns the annotated prefixes whose attribute key is
+// (keep) or is not (!keep) one of values, compared case-insensitively.
+// Prefixes lacking the attribute never match.
+func FilterAnnotated(aps []AnnotatedPrefix, key string, values []string, keep bool) []AnnotatedPrefix {
+	var out []AnnotatedPrefix
+	for _, ap := range aps {
+		v, ok := ap.Attrs[key]
+		if (ok && matchAny(values, v)) == keep {
+			out = append(out, ap)
+		}
+	}
+	return out
+}
+
+// AnnotatedPrefixes returns the prefixes of aps.
+func AnnotatedPrefixes(aps []AnnotatedPrefix) []netip.Prefix {
+	out := make([]netip.Prefix, len(aps))
+	for i, ap := range aps {
+		out[i] = ap.Prefix
+	}
+	return out
+}
+
+// AnnotatedGroup is a group of annotated prefixes sharing the value of an
+// attribute, with the number of addresses they cover per family.
+type AnnotatedGroup struct {
+	Value         string
+	Prefixes      []AnnotatedPrefix
+	IPv4Addresses uint64
+	IPv6Addresses *big.Int
+}
+
+// GroupAnnotated groups aps by the value of attribute key (prefixes
+// lacking it form a group with an empty value). Groups are ordered by the
+// number of IPv4, then IPv6 addresses they cover, largest first.
+func GroupAnnotated(aps []AnnotatedPrefix, key string) []AnnotatedGroup {
+	index := map[string]int{}
+	var groups []AnnotatedGroup
+	for _, ap := range aps {
+		v := ap.Attrs[key]
+		i, ok := index[v]
+		if !ok {
+			i = len(groups)
+			index[v] = i
+			groups = append(groups, AnnotatedGroup{Value: v, IPv6Addresses: new(big.Int)})
+		}
+		g := &groups[i]
+		g.Prefixes = append(g.Prefixes, ap)
+		hostBits := uint(ap.Prefix.Addr().BitLen() - ap.Prefix.Bits())
+		if ap.Prefix.Addr().Is4() {
+			g.IPv4Addresses += 1 << hostBits
+		} else {
+			g.IPv6Addresses.Add(g.IPv6Addresses, new(big.Int).Lsh(big.NewInt(1), hostBits))
+		}
+	}
+	slices.SortStableFunc(groups, func(a, b AnnotatedGroup) int {
+		if a.IPv4Addresses != b.IPv4Addresses {
+			if a.IPv4Addresses > b.IPv4Addresses {
+				return -1
+			}
+			return 1
+		}
+		return b.IPv6Addresses.Cmp(a.IPv6Addresses)
+	})
+	return groups
+}
+
+// WriteGroupSummary writes a text table with the number of prefixes and
+// addresses of each group, named after the grouping attribute key.
+func WriteGroupSummary(w io.Writer, key string, groups []AnnotatedGroup) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tprefixes\tipv4 addresses\tipv6 addresses\n", key)
+	for _, g := range groups {
+		value := g.Value
+		if value == "" {
+			value = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", value, len(g.Prefixes), g.IPv4Addresses, g.IPv6Addresses)
+	}
+	return tw.Flush()
+}
+
+// AttrKeys returns the sorted names of all attributes present in aps.
+func AttrKeys(aps []AnnotatedPrefix) []string {
+	var keys []string
+	for _, ap := range aps {
+		for k := range ap.Attrs {
+			if !slices.Contains(keys, k) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// WriteAnnotatedCSV writes aps as CSV with a header row. The first column
+// is the prefix, followed by one column per attribute name (see AttrKeys).
+func WriteAnnotatedCSV(w io.Writer, aps []AnnotatedPrefix) error {
+	keys := AttrKeys(aps)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"prefix"}, keys...)); err != nil {
+		return err
+	}
+	row := make([]string, len(keys)+1)
+	for _, ap := range aps {
+		row[0] = ap.Prefix.String()
+		for i, k := range keys {
+			row[i+1] = ap.Attrs[k]
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteAnnotatedJSON writes aps as a JSON array of objects (see
+// AnnotatedPrefix.MarshalJSON).
+func WriteAnnotatedJSON(w io.Writer, aps []AnnotatedPrefix) error {
+	if aps == nil {
+		aps = []AnnotatedPrefix{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(aps)
+}
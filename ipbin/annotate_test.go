@@ -0,0 +1,88 @@
+package ipbin
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+// familyAnnotator annotates prefixes with their address family
+type familyAnnotator struct{}
+
+func (familyAnnotator) Annotate(p netip.Prefix) (map[string]string, error) {
+	if p.Addr().Is4() {
+		return map[string]string{"family": "ipv4"}, nil
+	}
+	return map[string]string{"family": "ipv6", "note": "v6, \"quoted\""}, nil
+}
+
+func TestAnnotate(t *testing.T) {
+	ipset, err := MergePrefixes([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	aps, err := Annotate(ipset, familyAnnotator{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err = WriteAnnotatedCSV(&buf, aps); err != nil {
+		t.Error(err)
+		return
+	}
+	wantCSV := "prefix,family,note\n10.0.0.0/24,ipv4,\n2001:db8::/32,ipv6,\"v6, \"\"quoted\"\"\"\n"
+	if buf.String() != wantCSV {
+		t.Errorf("WriteAnnotatedCSV got %q, want %q", buf.String(), wantCSV)
+	}
+
+	buf.Reset()
+	if err = WriteAnnotatedJSON(&buf, aps); err != nil {
+		t.Error(err)
+		return
+	}
+	wantJSON := `[
+  {
+    "family": "ipv4",
+    "prefix": "10.0.0.0/24"
+  },
+  {
+    "family": "ipv6",
+    "note": "v6, \"quoted\"",
+    "prefix": "2001:db8::/32"
+  }
+]
+`
+	if buf.String() != wantJSON {
+		t.Errorf("WriteAnnotatedJSON got %s, want %s", buf.String(), wantJSON)
+	}
+}
+
+func TestGroupAnnotated(t *testing.T) {
+	aps := []AnnotatedPrefix{
+		{netip.MustParsePrefix("10.0.0.0/24"), map[string]string{"asn": "AS64500"}},
+		{netip.MustParsePrefix("10.0.1.0/24"), map[string]string{"asn": "AS64501"}},
+		{netip.MustParsePrefix("10.1.0.0/16"), map[string]string{"asn": "AS64501"}},
+		{netip.MustParsePrefix("2001:db8::/64"), map[string]string{"asn": "AS64500"}},
+		{netip.MustParsePrefix("192.0.2.1/32"), map[string]string{}},
+	}
+	groups := GroupAnnotated(aps, "asn")
+	var buf bytes.Buffer
+	if err := WriteGroupSummary(&buf, "asn", groups); err != nil {
+		t.Error(err)
+		return
+	}
+	want := `asn      prefixes  ipv4 addresses  ipv6 addresses
+AS64501  2         65792           0
+AS64500  2         256             18446744073709551616
+-        1         1               0
+`
+	if buf.String() != want {
+		t.Errorf("WriteGroupSummary got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,473 @@
+package ipbin
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ASNResolver resolves an autonomous system number into the prefixes it
+// originates.
+type ASNResolver interface {
+	ASNPrefixes(asn uint32) ([]netip.Prefix, error)
+}
+
+// ParseASN parses an AS number written as "AS13335", "as13335" or "13335".
+func ParseASN(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	digits := s
+	if len(s) > 2 && strings.EqualFold(s[:2], "as") {
+		digits = s[2:]
+	}
+	asn, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AS number %q", s)
+	}
+	return uint32(asn), nil
+}
+
+// ParseASNs reads AS numbers from r, one per line. Empty lines and lines
+// starting with '#' are skipped; anything after the first comma is ignored.
+func ParseASNs(r io.Reader) (asns []uint32, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := normalizeLine(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		asn, err := ParseASN(strings.Split(line, ",")[0])
+		if err != nil {
+			return nil, err
+		}
+		asns = append(asns, asn)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return asns, nil
+}
+
+// ResolveASNs resolves every AS number in asns with res and returns all
+// their prefixes.
+func ResolveASNs(asns []uint32, res ASNResolver) (nets []netip.Prefix, err error) {
+	for _, asn := range asns {
+		prefixes, err := res.ASNPrefixes(asn)
+		if err != nil {
+			return nil, fmt.Errorf("AS%d: %w", asn, err)
+		}
+		nets = append(nets, prefixes...)
+	}
+	return nets, nil
+}
+
+// RIPEStatResolver resolves AS numbers with the RIPEstat announced-prefixes
+// data API (https://stat.ripe.net/docs/data_api).
+type RIPEStatResolver struct {
+	// BaseURL defaults to https://stat.ripe.net.
+	BaseURL string
+	// Client defaults to an http.Client with a 30 second timeout.
+	Client *http.Client
+}
+
+func (r *RIPEStatResolver) ASNPrefixes(asn uint32) ([]netip.Prefix, error) {
+	base := r.BaseURL
+	if base == "" {
+		base = "https://stat.ripe.net"
+	}
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	u := base + "/data/announced-prefixes/data.json?resource=" + url.QueryEscape("AS"+strconv.FormatUint(uint64(asn), 10))
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ripestat: unexpected status %s", resp.Status)
+	}
+	var doc struct {
+		Data struct {
+			Prefixes []struct {
+				Prefix string `json:"prefix"`
+			} `json:"prefixes"`
+		} `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+	var nets []netip.Prefix
+	for _, p := range doc.Data.Prefixes {
+		prefix, err := netip.ParsePrefix(p.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, prefix)
+	}
+	return nets, nil
+}
+
+// PrefixASNMap maps prefixes to the AS numbers originating them. A prefix
+// announced by several ASes (MOAS) maps to all of them.
+//
+// PrefixASNMap implements Annotator and Splitter, setting the "asn"
+// attribute to the origin of the most specific mapped prefix covering a
+// prefix, e.g. "AS13335" ("AS38803 AS56203" for MOAS prefixes).
+type PrefixASNMap struct {
+	origins map[netip.Prefix][]uint32
+	byASN   map[uint32][]netip.Prefix
+	sorted  []netip.Prefix // mapped prefixes, built on demand by Split
+}
+
+// NewPrefixASNMap returns an empty PrefixASNMap.
+func NewPrefixASNMap() *PrefixASNMap {
+	return &PrefixASNMap{
+		origins: make(map[netip.Prefix][]uint32),
+		byASN:   make(map[uint32][]netip.Prefix),
+	}
+}
+
+// Add records that prefix p is originated by asn.
+func (m *PrefixASNMap) Add(p netip.Prefix, asn uint32) {
+	p = p.Masked()
+	if slices.Contains(m.origins[p], asn) {
+		return
+	}
+	if _, ok := m.origins[p]; !ok {
+		m.sorted = nil
+	}
+	m.origins[p] = append(m.origins[p], asn)
+	m.byASN[asn] = append(m.byASN[asn], p)
+}
+
+// Len returns the number of distinct prefixes in the map.
+func (m *PrefixASNMap) Len() int {
+	return len(m.origins)
+}
+
+// Origins returns the AS numbers originating exactly prefix p.
+func (m *PrefixASNMap) Origins(p netip.Prefix) []uint32 {
+	return m.origins[p.Masked()]
+}
+
+// ASNPrefixes returns the prefixes originated by asn, sorted.
+func (m *PrefixASNMap) ASNPrefixes(asn uint32) ([]netip.Prefix, error) {
+	nets := slices.Clone(m.byASN[asn])
+	slices.SortFunc(nets, comparePrefixes)
+	return nets, nil
+}
+
+func (m *PrefixASNMap) Annotate(p netip.Prefix) (map[string]string, error) {
+	for bits := p.Bits(); bits >= 0; bits-- {
+		q, _ := p.Addr().Prefix(bits)
+		origins, ok := m.origins[q]
+		if !ok {
+			continue
+		}
+		asns := make([]string, len(origins))
+		for i, asn := range origins {
+			asns[i] = "AS" + strconv.FormatUint(uint64(asn), 10)
+		}
+		return map[string]string{"asn": strings.Join(asns, " ")}, nil
+	}
+	return map[string]string{}, nil
+}
+
+// Split divides p until none of the resulting prefixes contains a mapped
+// prefix more specific than itself.
+func (m *PrefixASNMap) Split(p netip.Prefix) ([]netip.Prefix, error) {
+	if m.sorted == nil {
+		m.sorted = make([]netip.Prefix, 0, len(m.origins))
+		for q := range m.origins {
+			m.sorted = append(m.sorted, q)
+		}
+		slices.SortFunc(m.sorted, comparePrefixes)
+	}
+	var out []netip.Prefix
+	m.split(p.Masked(), &out)
+	return out, nil
+}
+
+func (m *PrefixASNMap) split(p netip.Prefix, out *[]netip.Prefix) {
+	if !m.hasMoreSpecific(p) {
+		*out = append(*out, p)
+		return
+	}
+	left, right := splitPrefix(p)
+	m.split(left, out)
+	m.split(right, out)
+}
+
+// hasMoreSpecific reports whether a mapped prefix longer than p lies
+// within p.
+func (m *PrefixASNMap) hasMoreSpecific(p netip.Prefix) bool {
+	r := netipx.RangeOfPrefix(p)
+	i, _ := slices.BinarySearchFunc(m.sorted, r.From(), func(q netip.Prefix, a netip.Addr) int {
+		return q.Addr().Compare(a)
+	})
+	for ; i < len(m.sorted) && m.sorted[i].Addr().Compare(r.To()) <= 0; i++ {
+		if m.sorted[i].Bits() > p.Bits() {
+			return true
+		}
+	}
+	return false
+}
+
+// comparePrefixes orders prefixes by address, then by prefix length.
+func comparePrefixes(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return a.Bits() - b.Bits()
+}
+
+// LoadPrefixASNMap reads a prefix to origin ASN mapping from r. Plain,
+// gzip and bzip2 compressed inputs are accepted, containing either an MRT
+// TABLE_DUMP_V2 RIB dump (see ParseMRT) or a text mapping (see ParsePfx2AS).
+func LoadPrefixASNMap(r io.Reader) (*PrefixASNMap, error) {
+	br := bufio.NewReaderSize(r, 1024*32)
+	magic, _ := br.Peek(3)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gzr.Close()
+		return LoadPrefixASNMap(gzr)
+	case bytes.Equal(magic, []byte("BZh")):
+		return LoadPrefixASNMap(bzip2.NewReader(br))
+	}
+	hdr, _ := br.Peek(mrtHeaderLen)
+	if len(hdr) == mrtHeaderLen && isMRTType(binary.BigEndian.Uint16(hdr[4:6])) {
+		return ParseMRT(br)
+	}
+	return ParsePfx2AS(br)
+}
+
+// ParsePfx2AS parses a text prefix to ASN mapping, such as CAIDA's
+// RouteViews pfx2as files. Each line is either "<address> <length> <asn>"
+// or "<prefix> <asn>", separated by any whitespace. Multi-origin ("13335_4826")
+// and AS set ("13335,4826") notations map the prefix to every AS listed.
+func ParsePfx2AS(r io.Reader) (*PrefixASNMap, error) {
+	m := NewPrefixASNMap()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := normalizeLine(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		var prefixS, asnS string
+		switch len(fields) {
+		case 2:
+			prefixS, asnS = fields[0], fields[1]
+		case 3:
+			prefixS, asnS = fields[0]+"/"+fields[1], fields[2]
+		default:
+			return nil, fmt.Errorf("invalid pfx2as line %q", line)
+		}
+		prefix, err := netip.ParsePrefix(prefixS)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range strings.FieldsFunc(asnS, func(r rune) bool { return r == '_' || r == ',' }) {
+			asn, err := ParseASN(s)
+			if err != nil {
+				return nil, err
+			}
+			m.Add(prefix, asn)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MRT record types and TABLE_DUMP_V2 subtypes (RFC 6396, RFC 8050).
+const (
+	mrtHeaderLen = 12
+
+	mrtTypeTableDump   = 12
+	mrtTypeTableDumpV2 = 13
+	mrtTypeBGP4MP      = 16
+	mrtTypeBGP4MPET    = 17
+
+	mrtRIBIPv4Unicast        = 2
+	mrtRIBIPv6Unicast        = 4
+	mrtRIBIPv4UnicastAddPath = 8
+	mrtRIBIPv6UnicastAddPath = 10
+
+	bgpAttrASPath     = 2
+	bgpASPathSet      = 1
+	bgpASPathSequence = 2
+)
+
+func isMRTType(t uint16) bool {
+	switch t {
+	case mrtTypeTableDump, mrtTypeTableDumpV2, mrtTypeBGP4MP, mrtTypeBGP4MPET:
+		return true
+	}
+	return false
+}
+
+var errMRTTruncated = errors.New("mrt: truncated record")
+
+// ParseMRT reads an MRT TABLE_DUMP_V2 RIB dump (as published by RIPE RIS
+// and RouteViews) and maps every unicast prefix to the origin AS of each of
+// its paths. Records of other types are skipped.
+func ParseMRT(r io.Reader) (*PrefixASNMap, error) {
+	m := NewPrefixASNMap()
+	var hdr [mrtHeaderLen]byte
+	var body []byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return m, nil
+			}
+			return nil, errMRTTruncated
+		}
+		typ := binary.BigEndian.Uint16(hdr[4:6])
+		subtype := binary.BigEndian.Uint16(hdr[6:8])
+		length := binary.BigEndian.Uint32(hdr[8:12])
+		if cap(body) < int(length) {
+			body = make([]byte, length)
+		}
+		body = body[:length]
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, errMRTTruncated
+		}
+		if typ != mrtTypeTableDumpV2 {
+			continue
+		}
+		var bitLen int
+		var addPath bool
+		switch subtype {
+		case mrtRIBIPv4Unicast:
+			bitLen = 32
+		case mrtRIBIPv6Unicast:
+			bitLen = 128
+		case mrtRIBIPv4UnicastAddPath:
+			bitLen, addPath = 32, true
+		case mrtRIBIPv6UnicastAddPath:
+			bitLen, addPath = 128, true
+		default:
+			continue
+		}
+		if err := parseMRTRIB(m, body, bitLen, addPath); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseMRTRIB parses the body of a TABLE_DUMP_V2 RIB_*_UNICAST record.
+func parseMRTRIB(m *PrefixASNMap, b []byte, bitLen int, addPath bool) error {
+	if len(b) < 5 {
+		return errMRTTruncated
+	}
+	bits := int(b[4])
+	n := (bits + 7) / 8
+	if bits > bitLen {
+		return fmt.Errorf("mrt: invalid prefix length %d", bits)
+	}
+	b = b[5:]
+	if len(b) < n+2 {
+		return errMRTTruncated
+	}
+	var ip [16]byte
+	copy(ip[:], b[:n])
+	addr := netip.AddrFrom16(ip)
+	if bitLen == 32 {
+		addr = netip.AddrFrom4([4]byte(ip[:4]))
+	}
+	prefix := netip.PrefixFrom(addr, bits)
+	count := int(binary.BigEndian.Uint16(b[n:]))
+	b = b[n+2:]
+	for i := 0; i < count; i++ {
+		// peer index (2), originated time (4), optional path identifier (4)
+		skip := 6
+		if addPath {
+			skip += 4
+		}
+		if len(b) < skip+2 {
+			return errMRTTruncated
+		}
+		attrLen := int(binary.BigEndian.Uint16(b[skip:]))
+		b = b[skip+2:]
+		if len(b) < attrLen {
+			return errMRTTruncated
+		}
+		origins, err := bgpOrigins(b[:attrLen])
+		if err != nil {
+			return err
+		}
+		for _, asn := range origins {
+			m.Add(prefix, asn)
+		}
+		b = b[attrLen:]
+	}
+	return nil
+}
+
+// bgpOrigins returns the origin AS numbers found in the AS_PATH attribute
+// of BGP path attributes b (4-octet AS numbers, as used by TABLE_DUMP_V2).
+// An AS path ending with an AS_SET yields all of its members.
+func bgpOrigins(b []byte) ([]uint32, error) {
+	for len(b) >= 3 {
+		flags, typ := b[0], b[1]
+		var length, hdrLen int
+		if flags&0x10 != 0 { // extended length
+			if len(b) < 4 {
+				return nil, errMRTTruncated
+			}
+			length, hdrLen = int(binary.BigEndian.Uint16(b[2:])), 4
+		} else {
+			length, hdrLen = int(b[2]), 3
+		}
+		if len(b) < hdrLen+length {
+			return nil, errMRTTruncated
+		}
+		value := b[hdrLen : hdrLen+length]
+		b = b[hdrLen+length:]
+		if typ != bgpAttrASPath {
+			continue
+		}
+		var origins []uint32
+		for len(value) >= 2 {
+			segType, segLen := value[0], int(value[1])
+			if len(value) < 2+4*segLen {
+				return nil, errMRTTruncated
+			}
+			asns := make([]uint32, segLen)
+			for i := range asns {
+				asns[i] = binary.BigEndian.Uint32(value[2+4*i:])
+			}
+			value = value[2+4*segLen:]
+			switch {
+			case segLen == 0:
+			case segType == bgpASPathSet:
+				origins = asns
+			case segType == bgpASPathSequence:
+				origins = asns[segLen-1:]
+			}
+		}
+		return origins, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,164 @@
+package ipbin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseASNs(t *testing.T) {
+	input := "AS13335\n# comment\nas15169, Google\n\n64512\n"
+	asns, err := ParseASNs(strings.NewReader(input))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if expected := []uint32{13335, 15169, 64512}; !reflect.DeepEqual(asns, expected) {
+		t.Errorf("got %v, want %v", asns, expected)
+	}
+	if _, err := ParseASN("ASX1"); err == nil {
+		t.Errorf("ParseASN(%q) expected error", "ASX1")
+	}
+}
+
+func TestParsePfx2AS(t *testing.T) {
+	input := "1.0.0.0\t24\t13335\n1.0.4.0\t22\t38803_56203\n2001:db8::/32 64512\n"
+	m, err := ParsePfx2AS(strings.NewReader(input))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if m.Len() != 3 {
+		t.Errorf("Len got %d, want 3", m.Len())
+	}
+	if got := m.Origins(netip.MustParsePrefix("1.0.4.0/22")); !reflect.DeepEqual(got, []uint32{38803, 56203}) {
+		t.Errorf("Origins got %v", got)
+	}
+	nets, err := ResolveASNs([]uint32{13335, 64512}, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []netip.Prefix{netip.MustParsePrefix("1.0.0.0/24"), netip.MustParsePrefix("2001:db8::/32")}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v, want %v", nets, expected)
+	}
+}
+
+// mrtRIBRecord builds a TABLE_DUMP_V2 RIB_IPV4_UNICAST record for prefix
+// with one RIB entry per AS path.
+func mrtRIBRecord(prefix netip.Prefix, paths ...[]uint32) []byte {
+	var body []byte
+	body = binary.BigEndian.AppendUint32(body, 0) // sequence number
+	body = append(body, byte(prefix.Bits()))
+	ip := prefix.Addr().As4()
+	body = append(body, ip[:(prefix.Bits()+7)/8]...)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(paths)))
+	for _, path := range paths {
+		body = binary.BigEndian.AppendUint16(body, 0) // peer index
+		body = binary.BigEndian.AppendUint32(body, 0) // originated time
+		// ORIGIN attribute, then AS_PATH with a single AS_SEQUENCE segment
+		attrs := []byte{0x40, 1, 1, 0}
+		attrs = append(attrs, 0x40, bgpAttrASPath, byte(2+4*len(path)), bgpASPathSequence, byte(len(path)))
+		for _, asn := range path {
+			attrs = binary.BigEndian.AppendUint32(attrs, asn)
+		}
+		body = binary.BigEndian.AppendUint16(body, uint16(len(attrs)))
+		body = append(body, attrs...)
+	}
+	var rec []byte
+	rec = binary.BigEndian.AppendUint32(rec, 0) // timestamp
+	rec = binary.BigEndian.AppendUint16(rec, mrtTypeTableDumpV2)
+	rec = binary.BigEndian.AppendUint16(rec, mrtRIBIPv4Unicast)
+	rec = binary.BigEndian.AppendUint32(rec, uint32(len(body)))
+	return append(rec, body...)
+}
+
+func TestParseMRT(t *testing.T) {
+	var dump []byte
+	// PEER_INDEX_TABLE records are skipped
+	dump = append(dump, 0, 0, 0, 0, 0, mrtTypeTableDumpV2, 0, 1, 0, 0, 0, 2, 0xaa, 0xbb)
+	dump = append(dump, mrtRIBRecord(netip.MustParsePrefix("1.1.1.0/24"), []uint32{3356, 13335}, []uint32{174, 13335})...)
+	dump = append(dump, mrtRIBRecord(netip.MustParsePrefix("8.8.8.0/24"), []uint32{3356, 15169})...)
+
+	var gz bytes.Buffer
+	gzw := gzip.NewWriter(&gz)
+	gzw.Write(dump)
+	gzw.Close()
+
+	m, err := LoadPrefixASNMap(&gz)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got := m.Origins(netip.MustParsePrefix("1.1.1.0/24")); !reflect.DeepEqual(got, []uint32{13335}) {
+		t.Errorf("Origins(1.1.1.0/24) got %v", got)
+	}
+	if got := m.Origins(netip.MustParsePrefix("8.8.8.0/24")); !reflect.DeepEqual(got, []uint32{15169}) {
+		t.Errorf("Origins(8.8.8.0/24) got %v", got)
+	}
+
+	if _, err := ParseMRT(bytes.NewReader(dump[:len(dump)-3])); err == nil {
+		t.Errorf("ParseMRT of truncated dump expected error")
+	}
+}
+
+func TestRIPEStatResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/data/announced-prefixes/data.json" || r.URL.Query().Get("resource") != "AS13335" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data": {"prefixes": [{"prefix": "1.1.1.0/24"}, {"prefix": "2606:4700::/32"}]}, "status": "ok"}`))
+	}))
+	defer srv.Close()
+
+	res := &RIPEStatResolver{BaseURL: srv.URL}
+	nets, err := res.ASNPrefixes(13335)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []netip.Prefix{netip.MustParsePrefix("1.1.1.0/24"), netip.MustParsePrefix("2606:4700::/32")}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v, want %v", nets, expected)
+	}
+	if _, err := res.ASNPrefixes(1); err == nil {
+		t.Errorf("ASNPrefixes(1) expected error")
+	}
+}
+
+func TestPrefixASNMapAnnotate(t *testing.T) {
+	m, err := ParsePfx2AS(strings.NewReader("10.0.0.0\t8\t64500\n10.1.0.0\t16\t64501_64502\n"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ipset, err := MergePrefixes([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/15"),
+		netip.MustParsePrefix("192.0.2.0/24"),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	aps, err := Annotate(ipset, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []AnnotatedPrefix{
+		{netip.MustParsePrefix("10.0.0.0/16"), map[string]string{"asn": "AS64500"}},
+		{netip.MustParsePrefix("10.1.0.0/16"), map[string]string{"asn": "AS64501 AS64502"}},
+		{netip.MustParsePrefix("192.0.2.0/24"), map[string]string{}},
+	}
+	if !reflect.DeepEqual(aps, want) {
+		t.Errorf("Annotate got %v, want %v", aps, want)
+	}
+}
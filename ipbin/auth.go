@@ -0,0 +1,243 @@
+package ipbin
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnauthorized is returned by Authenticator.Authenticate for requests
+// without a valid token.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Authenticator checks the bearer tokens of the requests of an HTTP server,
+// either static tokens or JSON Web Tokens (RFC 7519). Requests pass with
+// either kind.
+type Authenticator struct {
+	// Tokens are the static tokens accepted.
+	Tokens []string
+	// JWTKey verifies the signature of JWTs: a []byte secret for the HS256,
+	// HS384 and HS512 algorithms, or an *rsa.PublicKey, *ecdsa.PublicKey or
+	// ed25519.PublicKey, e.g. parsed by ParseJWTKey. JWTs are not accepted
+	// if nil.
+	JWTKey any
+	// Issuer and Audience, if not empty, must be the iss claim of the JWTs
+	// and one of their aud claim.
+	Issuer, Audience string
+	// Leeway is the clock skew allowed checking the exp and nbf claims.
+	Leeway time.Duration
+}
+
+// clientKey is the context key of the client of a request.
+type clientKey struct{}
+
+// Authenticate returns the client of the bearer token of r: the sub claim
+// of a JWT, or "token:N" for the Nth static token. It returns an error
+// wrapping ErrUnauthorized if the token is missing or invalid.
+func (a *Authenticator) Authenticate(r *http.Request) (string, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", fmt.Errorf("%w: no bearer token", ErrUnauthorized)
+	}
+	for i, t := range a.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return "token:" + strconv.Itoa(i+1), nil
+		}
+	}
+	if a.JWTKey == nil || strings.Count(token, ".") != 2 {
+		return "", fmt.Errorf("%w: invalid token", ErrUnauthorized)
+	}
+	claims, err := a.verifyJWT(token, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	return claims.Subject, nil
+}
+
+// Handler returns a handler answering the requests without a valid token
+// with 401 Unauthorized, and passing the others to next, with their client
+// (see RequestClient).
+func (a *Authenticator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := a.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ipbin"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, client)))
+	})
+}
+
+// RequestClient returns the client of r as authenticated by an
+// Authenticator, or its remote address otherwise.
+func RequestClient(r *http.Request) string {
+	if client, ok := r.Context().Value(clientKey{}).(string); ok {
+		return client
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// jwtClaims are the registered claims of a JWT checked by Authenticator.
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+}
+
+// audiences returns the aud claim, a string or an array of strings.
+func (c *jwtClaims) audiences() []string {
+	var aud []string
+	if json.Unmarshal(c.Audience, &aud) != nil {
+		var s string
+		if json.Unmarshal(c.Audience, &s) == nil {
+			aud = []string{s}
+		}
+	}
+	return aud
+}
+
+// verifyJWT checks the signature and the claims of the JWS compact
+// serialization token at now.
+func (a *Authenticator) verifyJWT(token string, now time.Time) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	var claims jwtClaims
+	for i, v := range []any{&header, &claims} {
+		data, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			return nil, errors.New("invalid JWT encoding")
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			return nil, errors.New("invalid JWT encoding")
+		}
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid JWT encoding")
+	}
+	if err := verifyJWS(header.Alg, a.JWTKey, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt != nil && now.Add(-a.Leeway).After(time.Unix(int64(*claims.ExpiresAt), 0)) {
+		return nil, errors.New("expired JWT")
+	}
+	if claims.NotBefore != nil && now.Add(a.Leeway).Before(time.Unix(int64(*claims.NotBefore), 0)) {
+		return nil, errors.New("JWT not valid yet")
+	}
+	if a.Issuer != "" && claims.Issuer != a.Issuer {
+		return nil, fmt.Errorf("JWT issuer %q not accepted", claims.Issuer)
+	}
+	if a.Audience != "" && !slices.Contains(claims.audiences(), a.Audience) {
+		return nil, errors.New("JWT audience not accepted")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("JWT without subject")
+	}
+	return &claims, nil
+}
+
+// verifyJWS checks the signature sig of signed with the algorithm alg of
+// RFC 7518 and key.
+func verifyJWS(alg string, key any, signed string, sig []byte) error {
+	var h crypto.Hash
+	switch {
+	case strings.HasSuffix(alg, "256"):
+		h = crypto.SHA256
+	case strings.HasSuffix(alg, "384"):
+		h = crypto.SHA384
+	case strings.HasSuffix(alg, "512"):
+		h = crypto.SHA512
+	}
+	ok := false
+	switch key := key.(type) {
+	case []byte:
+		if strings.HasPrefix(alg, "HS") && h != 0 {
+			mac := hmac.New(h.New, key)
+			mac.Write([]byte(signed))
+			ok = hmac.Equal(mac.Sum(nil), sig)
+		}
+	case *rsa.PublicKey:
+		if h != 0 && (strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")) {
+			digest := hashOf(h, signed)
+			if alg[0] == 'R' {
+				ok = rsa.VerifyPKCS1v15(key, h, digest, sig) == nil
+			} else {
+				ok = rsa.VerifyPSS(key, h, digest, sig, nil) == nil
+			}
+		}
+	case *ecdsa.PublicKey:
+		// The signature is r and s of the size of the curve, not DER
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if strings.HasPrefix(alg, "ES") && h != 0 && len(sig) == 2*size {
+			r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+			ok = ecdsa.Verify(key, hashOf(h, signed), r, s)
+		}
+	case ed25519.PublicKey:
+		if alg == "EdDSA" {
+			ok = ed25519.Verify(key, []byte(signed), sig)
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid JWT signature (%s)", alg)
+	}
+	return nil
+}
+
+func hashOf(h crypto.Hash, s string) []byte {
+	w := h.New()
+	w.Write([]byte(s))
+	return w.Sum(nil)
+}
+
+// ParseJWTKey parses the key verifying JWTs for Authenticator.JWTKey: a
+// PEM-encoded PKIX public key or certificate, RSA, ECDSA or Ed25519, or
+// otherwise the secret of HMAC algorithms, without trailing newlines.
+func ParseJWTKey(b []byte) (any, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		secret := []byte(strings.TrimRight(string(b), "\r\n"))
+		if len(secret) < 32 {
+			return nil, errors.New("JWT secret shorter than 32 bytes")
+		}
+		return secret, nil
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
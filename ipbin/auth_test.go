@@ -0,0 +1,133 @@
+package ipbin
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signTestJWT returns the JWT of claims signed with alg and key.
+func signTestJWT(t *testing.T, alg string, key any, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, hashOf(crypto.SHA256, signed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, []byte(signed))
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestAuthenticator(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Now().Unix()
+	valid := map[string]any{"sub": "edge-1", "iss": "idp", "aud": []string{"ipbin"}, "exp": now + 60}
+
+	tests := []struct {
+		name   string
+		a      *Authenticator
+		header string
+		client string
+	}{
+		{"static token", &Authenticator{Tokens: []string{"s1", "s2"}}, "Bearer s2", "token:2"},
+		{"wrong token", &Authenticator{Tokens: []string{"s1"}}, "Bearer s3", ""},
+		{"no token", &Authenticator{Tokens: []string{"s1"}}, "", ""},
+		{"basic", &Authenticator{Tokens: []string{"s1"}}, "Basic s1", ""},
+		{"HS256", &Authenticator{JWTKey: secret, Issuer: "idp", Audience: "ipbin"},
+			"Bearer " + signTestJWT(t, "HS256", secret, valid), "edge-1"},
+		{"ES256", &Authenticator{JWTKey: &ecKey.PublicKey},
+			"Bearer " + signTestJWT(t, "ES256", ecKey, valid), "edge-1"},
+		{"EdDSA", &Authenticator{JWTKey: edPub},
+			"Bearer " + signTestJWT(t, "EdDSA", edKey, map[string]any{"sub": "edge-2", "aud": "x"}), "edge-2"},
+		{"algorithm of another key", &Authenticator{JWTKey: &ecKey.PublicKey},
+			"Bearer " + signTestJWT(t, "HS256", secret, valid), ""},
+		{"none", &Authenticator{JWTKey: secret},
+			"Bearer " + signTestJWT(t, "none", nil, valid), ""},
+		{"expired", &Authenticator{JWTKey: secret},
+			"Bearer " + signTestJWT(t, "HS256", secret, map[string]any{"sub": "a", "exp": now - 60}), ""},
+		{"leeway", &Authenticator{JWTKey: secret, Leeway: 2 * time.Minute},
+			"Bearer " + signTestJWT(t, "HS256", secret, map[string]any{"sub": "a", "exp": now - 60}), "a"},
+		{"not yet valid", &Authenticator{JWTKey: secret},
+			"Bearer " + signTestJWT(t, "HS256", secret, map[string]any{"sub": "a", "nbf": now + 60}), ""},
+		{"wrong audience", &Authenticator{JWTKey: secret, Audience: "other"},
+			"Bearer " + signTestJWT(t, "HS256", secret, valid), ""},
+		{"wrong issuer", &Authenticator{JWTKey: secret, Issuer: "other"},
+			"Bearer " + signTestJWT(t, "HS256", secret, valid), ""},
+		{"no subject", &Authenticator{JWTKey: secret},
+			"Bearer " + signTestJWT(t, "HS256", secret, map[string]any{"exp": now + 60}), ""},
+		{"garbage", &Authenticator{JWTKey: secret}, "Bearer a.b.c", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		client, err := tt.a.Authenticate(r)
+		if client != tt.client || (err != nil) != (tt.client == "") {
+			t.Errorf("%s: got %q, %v", tt.name, client, err)
+		}
+		if err != nil && !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%s: error %v does not wrap ErrUnauthorized", tt.name, err)
+		}
+	}
+
+	a := &Authenticator{Tokens: []string{"s1"}}
+	var got string
+	h := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = RequestClient(r) }))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("without token got status %d", w.Code)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer s1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got != "token:1" {
+		t.Errorf("RequestClient got %q", got)
+	}
+	if client := RequestClient(httptest.NewRequest("GET", "/", nil)); client != "192.0.2.1" {
+		t.Errorf("RequestClient without Authenticator got %q", client)
+	}
+}
+
+func TestParseJWTKey(t *testing.T) {
+	if _, err := ParseJWTKey([]byte("short\n")); err == nil {
+		t.Error("short secret accepted")
+	}
+	if key, err := ParseJWTKey([]byte("0123456789abcdef0123456789abcdef\n")); err != nil || string(key.([]byte)) != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("secret got %v, %v", key, err)
+	}
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	key, err := ParseJWTKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if pub, ok := key.(*ecdsa.PublicKey); err != nil || !ok || !pub.Equal(&ecKey.PublicKey) {
+		t.Errorf("PEM public key got %v, %v", key, err)
+	}
+}
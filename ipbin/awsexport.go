@@ -0,0 +1,139 @@
+package ipbin
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// AWS limits applied when chunking prefixes into WAF IP sets and security
+// group rules.
+const (
+	MaxWAFIPSetAddresses  = 10000 // addresses per WAFv2 IP set
+	MaxSecurityGroupRules = 60    // default inbound or outbound rules per security group, per IP version
+)
+
+// WAFIPSet is a WAFv2 IP set payload, accepted by
+// "aws wafv2 create-ip-set --cli-input-json" or, with Id and LockToken set
+// and IPAddressVersion cleared, by "aws wafv2 update-ip-set --cli-input-json".
+type WAFIPSet struct {
+	Name             string   `json:"Name"`
+	Scope            string   `json:"Scope"` // REGIONAL or CLOUDFRONT
+	Id               string   `json:"Id,omitempty"`
+	IPAddressVersion string   `json:"IPAddressVersion,omitempty"` // IPV4 or IPV6
+	Addresses        []string `json:"Addresses"`
+	LockToken        string   `json:"LockToken,omitempty"`
+}
+
+// chunkByVersion splits prefixes into chunks of at most size prefixes of a
+// single IP version, IPv4 chunks first.
+func chunkByVersion(prefixes []netip.Prefix, size int) (v4, v6 [][]netip.Prefix) {
+	for _, p := range prefixes {
+		chunks := &v6
+		if p.Addr().Is4() {
+			chunks = &v4
+		}
+		if n := len(*chunks); n == 0 || len((*chunks)[n-1]) == size {
+			*chunks = append(*chunks, nil)
+		}
+		(*chunks)[len(*chunks)-1] = append((*chunks)[len(*chunks)-1], p.Masked())
+	}
+	return v4, v6
+}
+
+// WAFIPSets returns the WAFv2 IP sets holding prefixes. An IP set holds a
+// single IP version and at most MaxWAFIPSetAddresses addresses, so
+// prefixes are split into as many sets as needed, IPv4 sets first. The
+// first set is named name, the following ones name-2, name-3...
+func WAFIPSets(prefixes []netip.Prefix, name, scope string) []WAFIPSet {
+	var sets []WAFIPSet
+	v4, v6 := chunkByVersion(prefixes, MaxWAFIPSetAddresses)
+	add := func(chunks [][]netip.Prefix, version string) {
+		for _, chunk := range chunks {
+			set := WAFIPSet{Name: chunkName(name, len(sets)), Scope: scope, IPAddressVersion: version, Addresses: make([]string, len(chunk))}
+			for i, p := range chunk {
+				set.Addresses[i] = p.String()
+			}
+			sets = append(sets, set)
+		}
+	}
+	add(v4, "IPV4")
+	add(v6, "IPV6")
+	return sets
+}
+
+// SecurityGroupIngress is a security group rules payload, accepted by
+// "aws ec2 authorize-security-group-ingress --cli-input-json" (and, for
+// egress rules, authorize-security-group-egress).
+type SecurityGroupIngress struct {
+	GroupId       string         `json:"GroupId"`
+	IpPermissions []IpPermission `json:"IpPermissions"`
+}
+
+// IpPermission is a security group rule set for one protocol and port
+// range.
+type IpPermission struct {
+	IpProtocol string      `json:"IpProtocol"` // "tcp", "udp", "icmp" or "-1" for all
+	FromPort   *int        `json:"FromPort,omitempty"`
+	ToPort     *int        `json:"ToPort,omitempty"`
+	IpRanges   []IpRange   `json:"IpRanges,omitempty"`
+	Ipv6Ranges []Ipv6Range `json:"Ipv6Ranges,omitempty"`
+}
+
+type IpRange struct {
+	CidrIp string `json:"CidrIp"`
+}
+
+type Ipv6Range struct {
+	CidrIpv6 string `json:"CidrIpv6"`
+}
+
+// ParseIpPermission returns the security group rule for protocol ("tcp",
+// "udp", "icmp" or "-1" for all) and ports, a port or a from-to port
+// range, empty for all ports.
+func ParseIpPermission(protocol, ports string) (IpPermission, error) {
+	perm := IpPermission{IpProtocol: protocol}
+	if ports == "" {
+		return perm, nil
+	}
+	fromStr, toStr, found := strings.Cut(ports, "-")
+	if !found {
+		toStr = fromStr
+	}
+	from, err := strconv.Atoi(fromStr)
+	if err != nil {
+		return perm, fmt.Errorf("invalid port range: %s", ports)
+	}
+	to, err := strconv.Atoi(toStr)
+	if err != nil {
+		return perm, fmt.Errorf("invalid port range: %s", ports)
+	}
+	perm.FromPort, perm.ToPort = &from, &to
+	return perm, nil
+}
+
+// SecurityGroupPayloads returns the payloads authorizing prefixes in
+// security group groupID with perm's protocol and ports. Each payload
+// holds at most MaxSecurityGroupRules rules per IP version, so that large
+// sets can be spread over several groups by changing GroupId.
+func SecurityGroupPayloads(prefixes []netip.Prefix, groupID string, perm IpPermission) []SecurityGroupIngress {
+	v4, v6 := chunkByVersion(prefixes, MaxSecurityGroupRules)
+	payloads := make([]SecurityGroupIngress, max(len(v4), len(v6)))
+	for i := range payloads {
+		p := perm
+		p.IpRanges, p.Ipv6Ranges = nil, nil
+		if i < len(v4) {
+			for _, prefix := range v4[i] {
+				p.IpRanges = append(p.IpRanges, IpRange{CidrIp: prefix.String()})
+			}
+		}
+		if i < len(v6) {
+			for _, prefix := range v6[i] {
+				p.Ipv6Ranges = append(p.Ipv6Ranges, Ipv6Range{CidrIpv6: prefix.String()})
+			}
+		}
+		payloads[i] = SecurityGroupIngress{GroupId: groupID, IpPermissions: []IpPermission{p}}
+	}
+	return payloads
+}
@@ -0,0 +1,59 @@
+package ipbin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+func TestWAFIPSets(t *testing.T) {
+	var prefixes []netip.Prefix
+	for i := 0; i < MaxWAFIPSetAddresses+1; i++ {
+		prefixes = append(prefixes, netip.PrefixFrom(uint32ToIPv4(uint32(i)<<8), 24))
+	}
+	prefixes = append(prefixes, netip.MustParsePrefix("2001:db8::/32"))
+	sets := WAFIPSets(prefixes, "blocklist", "REGIONAL")
+	if len(sets) != 3 {
+		t.Errorf("got %d sets, want 3", len(sets))
+		return
+	}
+	for i, expected := range []struct {
+		name, version string
+		n             int
+	}{{"blocklist", "IPV4", MaxWAFIPSetAddresses}, {"blocklist-2", "IPV4", 1}, {"blocklist-3", "IPV6", 1}} {
+		if s := sets[i]; s.Name != expected.name || s.IPAddressVersion != expected.version || len(s.Addresses) != expected.n {
+			t.Errorf("set %d got %s %s with %d addresses", i, s.Name, s.IPAddressVersion, len(s.Addresses))
+		}
+	}
+	if got := sets[2].Addresses[0]; got != "2001:db8::/32" {
+		t.Errorf("ipv6 address got %s", got)
+	}
+}
+
+func TestSecurityGroupPayloads(t *testing.T) {
+	var prefixes []netip.Prefix
+	for i := 0; i < MaxSecurityGroupRules+1; i++ {
+		prefixes = append(prefixes, netip.PrefixFrom(uint32ToIPv4(uint32(i)<<8), 24))
+	}
+	prefixes = append(prefixes, netip.MustParsePrefix("2001:db8::/32"))
+	port := 443
+	payloads := SecurityGroupPayloads(prefixes, "sg-1", IpPermission{IpProtocol: "tcp", FromPort: &port, ToPort: &port})
+	if len(payloads) != 2 {
+		t.Errorf("got %d payloads, want 2", len(payloads))
+		return
+	}
+	if n := len(payloads[0].IpPermissions[0].IpRanges); n != MaxSecurityGroupRules {
+		t.Errorf("first payload got %d ipv4 rules", n)
+	}
+	data, err := json.Marshal(payloads[1])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := fmt.Sprintf(`{"GroupId":"sg-1","IpPermissions":[{"IpProtocol":"tcp","FromPort":443,"ToPort":443,"IpRanges":[{"CidrIp":"%s"}]}]}`,
+		prefixes[MaxSecurityGroupRules])
+	if string(data) != expected {
+		t.Errorf("got %s, want %s", data, expected)
+	}
+}
@@ -0,0 +1,75 @@
+package ipbin
+
+import (
+	"net/netip"
+	"strconv"
+)
+
+// BlackholeCommunity is the well-known BLACKHOLE community (RFC 7999).
+const BlackholeCommunity = "65535:666"
+
+// RTBHRoute returns a static route, in Cisco IOS syntax, discarding traffic
+// destined to prefix p. The route is tagged with tag so that it can be
+// redistributed into BGP as a remotely-triggered blackhole trigger.
+//
+// Example:
+//   - 192.0.2.0/24 → ip route 192.0.2.0 255.255.255.0 Null0 tag 666
+//   - 2001:db8::/32 → ipv6 route 2001:db8::/32 Null0 tag 666
+func RTBHRoute(p netip.Prefix, tag int) string {
+	p = p.Masked()
+	if p.Addr().Is4() {
+		return "ip route " + p.Addr().String() + " " + netmask4(p.Bits()) + " Null0 tag " + strconv.Itoa(tag)
+	}
+	return "ipv6 route " + p.String() + " Null0 tag " + strconv.Itoa(tag)
+}
+
+// ExaBGPAnnounce returns an ExaBGP API command announcing prefix p with the
+// given next-hop ("self" is accepted by ExaBGP) and community. The
+// community is omitted if empty.
+//
+// Example:
+//   - announce route 192.0.2.0/24 next-hop self community [65535:666]
+func ExaBGPAnnounce(p netip.Prefix, nextHop, community string) string {
+	cmd := "announce route " + p.Masked().String() + " next-hop " + nextHop
+	if community != "" {
+		cmd += " community [" + community + "]"
+	}
+	return cmd
+}
+
+// ExaBGPWithdraw returns an ExaBGP API command withdrawing prefix p
+// previously announced with ExaBGPAnnounce.
+//
+// Example:
+//   - withdraw route 192.0.2.0/24 next-hop self
+func ExaBGPWithdraw(p netip.Prefix, nextHop string) string {
+	return "withdraw route " + p.Masked().String() + " next-hop " + nextHop
+}
+
+// ExaBGPFlowAnnounce returns an ExaBGP API command announcing a BGP
+// flowspec rule (RFC 8955, RFC 8956) discarding the traffic destined to
+// prefix p, filtered by the routers themselves rather than blackholed.
+//
+// Example:
+//   - announce flow route { match { destination 192.0.2.0/24; } then { discard; } }
+func ExaBGPFlowAnnounce(p netip.Prefix) string {
+	return "announce flow route { match { destination " + p.Masked().String() + "; } then { discard; } }"
+}
+
+// ExaBGPFlowWithdraw returns an ExaBGP API command withdrawing the flowspec
+// rule of prefix p previously announced with ExaBGPFlowAnnounce.
+//
+// Example:
+//   - withdraw flow route { match { destination 192.0.2.0/24; } then { discard; } }
+func ExaBGPFlowWithdraw(p netip.Prefix) string {
+	return "withdraw flow route { match { destination " + p.Masked().String() + "; } then { discard; } }"
+}
+
+// netmask4 returns the dotted-quad IPv4 netmask for prefix length bits.
+func netmask4(bits int) string {
+	mask := ^uint32(0) << (32 - bits)
+	if bits == 0 {
+		mask = 0
+	}
+	return netip.AddrFrom4([4]byte{byte(mask >> 24), byte(mask >> 16), byte(mask >> 8), byte(mask)}).String()
+}
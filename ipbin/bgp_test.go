@@ -0,0 +1,53 @@
+package ipbin
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestRTBHRoute(t *testing.T) {
+	cases := []struct {
+		p    netip.Prefix
+		want string
+	}{
+		{netip.MustParsePrefix("192.0.2.0/24"), "ip route 192.0.2.0 255.255.255.0 Null0 tag 666"},
+		{netip.MustParsePrefix("198.51.100.7/32"), "ip route 198.51.100.7 255.255.255.255 Null0 tag 666"},
+		{netip.MustParsePrefix("10.0.0.0/9"), "ip route 10.0.0.0 255.128.0.0 Null0 tag 666"},
+		{netip.MustParsePrefix("0.0.0.0/0"), "ip route 0.0.0.0 0.0.0.0 Null0 tag 666"},
+		{netip.MustParsePrefix("2001:db8::/32"), "ipv6 route 2001:db8::/32 Null0 tag 666"},
+	}
+	for _, tc := range cases {
+		if got := RTBHRoute(tc.p, 666); got != tc.want {
+			t.Errorf("RTBHRoute(%v) got %q, want %q", tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestExaBGPAnnounce(t *testing.T) {
+	got := ExaBGPAnnounce(netip.MustParsePrefix("192.0.2.0/24"), "self", BlackholeCommunity)
+	if want := "announce route 192.0.2.0/24 next-hop self community [65535:666]"; got != want {
+		t.Errorf("ExaBGPAnnounce got %q, want %q", got, want)
+	}
+	got = ExaBGPAnnounce(netip.MustParsePrefix("2001:db8::/48"), "2001:db8::1", "")
+	if want := "announce route 2001:db8::/48 next-hop 2001:db8::1"; got != want {
+		t.Errorf("ExaBGPAnnounce got %q, want %q", got, want)
+	}
+}
+
+func TestExaBGPWithdraw(t *testing.T) {
+	got := ExaBGPWithdraw(netip.MustParsePrefix("192.0.2.0/24"), "self")
+	if want := "withdraw route 192.0.2.0/24 next-hop self"; got != want {
+		t.Errorf("ExaBGPWithdraw got %q, want %q", got, want)
+	}
+}
+
+func TestExaBGPFlow(t *testing.T) {
+	got := ExaBGPFlowAnnounce(netip.MustParsePrefix("192.0.2.7/24"))
+	if want := "announce flow route { match { destination 192.0.2.0/24; } then { discard; } }"; got != want {
+		t.Errorf("ExaBGPFlowAnnounce got %q, want %q", got, want)
+	}
+	got = ExaBGPFlowWithdraw(netip.MustParsePrefix("2001:db8::/48"))
+	if want := "withdraw flow route { match { destination 2001:db8::/48; } then { discard; } }"; got != want {
+		t.Errorf("ExaBGPFlowWithdraw got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,195 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// BlockHeader is the header byte of a block of records: it is followed by
+// the size of the records of the block as a uvarint, their number (of
+// prefix and range records) as a uvarint and their CRC-32C as a big-endian
+// uint32, then by the records. Readers may skip a block whole, check it
+// against its checksum, or decode blocks in parallel; those reading records
+// one by one read its records as if it had no header.
+const BlockHeader = 252
+
+// DefaultBlockRecords is the number of records per block AppendBlocks
+// writes unless told otherwise.
+const DefaultBlockRecords = 4096
+
+// ErrChecksum is returned for a block of records not matching its
+// checksum.
+var ErrChecksum = errors.New("block checksum mismatch")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// AppendBlocks appends the records of a binary set, without metadata block,
+// to dst in blocks of n records each (DefaultBlockRecords if 0), the last
+// block holding the rest. Records already in blocks are split into blocks
+// anew, and the end-of-stream markers and metadata blocks of concatenated
+// sets are kept between blocks.
+func AppendBlocks(dst, records []byte, n int) ([]byte, error) {
+	if n <= 0 {
+		n = DefaultBlockRecords
+	}
+	var block []byte
+	count := 0
+	for off := 0; off < len(records); {
+		rec, m, err := readRecord(records[off:])
+		if err != nil {
+			return nil, &ParseError{Offset: off, Err: err}
+		}
+		switch rec.kind {
+		case KindBlock:
+			// Its records are read one by one
+		case KindEnd, KindContainer:
+			dst = appendBlock(dst, block, count)
+			dst = append(dst, records[off:off+m]...)
+			block, count = block[:0], 0
+		default:
+			block = append(block, records[off:off+m]...)
+			if rec.kind == KindIPv4 || rec.kind == KindIPv6 || rec.kind == KindRange {
+				count++
+			}
+			if count == n {
+				dst = appendBlock(dst, block, count)
+				block, count = block[:0], 0
+			}
+		}
+		off += m
+	}
+	return appendBlock(dst, block, count), nil
+}
+
+// appendBlock appends the block of records holding count records to dst,
+// nothing if records is empty.
+func appendBlock(dst, records []byte, count int) []byte {
+	if len(records) == 0 {
+		return dst
+	}
+	dst = append(dst, BlockHeader)
+	dst = binary.AppendUvarint(dst, uint64(len(records)))
+	dst = binary.AppendUvarint(dst, uint64(count))
+	dst = binary.BigEndian.AppendUint32(dst, crc32.Checksum(records, castagnoli))
+	return append(dst, records...)
+}
+
+// readBlockHeader reads the header of a block of records from buf, the
+// block itself being left to the caller.
+func readBlockHeader(buf []byte) (record, int, error) {
+	size, n := binary.Uvarint(buf[1:])
+	if n <= 0 {
+		if n == 0 {
+			return record{}, 0, io.ErrUnexpectedEOF
+		}
+		return record{}, 0, errors.New("invalid block length")
+	}
+	count, m := binary.Uvarint(buf[1+n:])
+	if m <= 0 {
+		if m == 0 {
+			return record{}, 0, io.ErrUnexpectedEOF
+		}
+		return record{}, 0, errors.New("invalid block record count")
+	}
+	end := 1 + n + m + 4
+	if len(buf) < end {
+		return record{}, 0, io.ErrUnexpectedEOF
+	}
+	// Records take a byte or more
+	if size > 1<<40 || count > size {
+		return record{}, 0, fmt.Errorf("invalid block of %d records in %d bytes", count, size)
+	}
+	rec := record{kind: KindBlock, blockSize: int(size), blockRecords: int(count), blockCRC: binary.BigEndian.Uint32(buf[end-4 : end])}
+	return rec, end, nil
+}
+
+// blockCheck checks the blocks of records read one by one: that each
+// matches its checksum and has its number of records, none across its end.
+type blockCheck struct {
+	end     int // offset of the end of the current block, 0 if none
+	records int // records left in the current block
+}
+
+// next checks the record or block rec, of n bytes at offset off of buf.
+func (c *blockCheck) next(buf []byte, off int, rec record, n int) error {
+	if c.end > 0 {
+		switch {
+		case rec.kind == KindBlock || rec.kind == KindContainer || rec.kind == KindEnd:
+			return fmt.Errorf("%s within a block", rec.kind)
+		case off+n > c.end:
+			return errors.New("record across the end of a block")
+		}
+		if rec.kind == KindIPv4 || rec.kind == KindIPv6 || rec.kind == KindRange {
+			c.records--
+		}
+		if off+n == c.end {
+			c.end = 0
+			if c.records != 0 {
+				return fmt.Errorf("block short of %d records", c.records)
+			}
+		}
+		return nil
+	}
+	if rec.kind != KindBlock || rec.blockSize == 0 {
+		return nil
+	}
+	start := off + n
+	if len(buf)-start < rec.blockSize {
+		return io.ErrUnexpectedEOF
+	}
+	if crc32.Checksum(buf[start:start+rec.blockSize], castagnoli) != rec.blockCRC {
+		return ErrChecksum
+	}
+	c.end, c.records = start+rec.blockSize, rec.blockRecords
+	return nil
+}
+
+// done checks that the records read did not end within a block.
+func (c *blockCheck) done() error {
+	if c.end > 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// blockSpan locates a block of records, with its header, in a set
+type blockSpan struct {
+	start, end int
+	records    int
+}
+
+// blockSpans returns the blocks of records of buf from offset off, if the
+// records are all in blocks, of maxRecords records in all at most if
+// positive. It returns nil otherwise, or on malformed records, left to
+// decoding them one by one to report.
+func blockSpans(buf []byte, off, maxRecords int) []blockSpan {
+	var spans []blockSpan
+	total := 0
+	for off < len(buf) {
+		rec, n, err := readRecord(buf[off:])
+		if err != nil {
+			return nil
+		}
+		switch rec.kind {
+		case KindBlock:
+			end := off + n + rec.blockSize
+			if end > len(buf) {
+				return nil
+			}
+			spans = append(spans, blockSpan{start: off, end: end, records: rec.blockRecords})
+			total += rec.blockRecords
+			off = end
+		case KindExtension, KindEnd, KindContainer:
+			off += n
+		default:
+			return nil
+		}
+	}
+	if maxRecords > 0 && total > maxRecords {
+		return nil
+	}
+	return spans
+}
@@ -0,0 +1,75 @@
+package ipbin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBlocks(t *testing.T) {
+	var records []byte
+	for i := range 10 {
+		records, _ = AppendEncoded(records, netip.MustParsePrefix(fmt.Sprintf("2001:db8::%x/128", i)))
+	}
+	records = append(records, EndHeader)
+	want, err := DecodeAll(records, DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocked, err := AppendBlocks(nil, records, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// In parallel and serially
+	for _, workers := range []int{0, 1} {
+		if got, err := DecodeAll(blocked, DecodeOptions{Workers: workers}); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DecodeAll of blocks with %d workers got %v, %v", workers, got, err)
+		}
+	}
+	if stats, err := BinaryStats(blocked, time.Now()); err != nil || stats.Blocks != 3 || stats.Records() != 10 {
+		t.Errorf("BinaryStats got %+v, %v", stats, err)
+	}
+	if blocked[len(blocked)-1] != EndHeader {
+		t.Errorf("AppendBlocks did not keep the end-of-stream marker out of the blocks")
+	}
+	// Split anew, and converted to format v2
+	again, err := AppendBlocks(nil, blocked, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := BinaryStats(again, time.Now()); err != nil || stats.Blocks != 1 || stats.Records() != 10 {
+		t.Errorf("BinaryStats of blocks split anew got %+v, %v", stats, err)
+	}
+	v2, err := AppendRecordsV2(nil, blocked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DecodeAll(v2, DecodeOptions{}); err != nil || !reflect.DeepEqual(got, want) || len(v2) >= len(blocked) {
+		t.Errorf("DecodeAll of blocks in format v2 got %v, %v", got, err)
+	}
+
+	corrupt := append([]byte(nil), blocked...)
+	corrupt[len(corrupt)-2] ^= 1
+	for _, workers := range []int{0, 1} {
+		if _, err := DecodeAll(corrupt, DecodeOptions{Workers: workers}); !errors.Is(err, ErrChecksum) {
+			t.Errorf("DecodeAll of a corrupt block with %d workers got %v, want ErrChecksum", workers, err)
+		}
+	}
+	if _, err := DecodeValued(corrupt, time.Time{}); !errors.Is(err, ErrChecksum) {
+		t.Errorf("DecodeValued of a corrupt block got %v, want ErrChecksum", err)
+	}
+	if _, err := DecodeAll(blocked[:len(blocked)-3], DecodeOptions{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("DecodeAll of a truncated block got %v, want io.ErrUnexpectedEOF", err)
+	}
+	// Records other than the block header says, or across its end
+	for _, b := range [][]byte{appendBlock(nil, []byte{8, 10}, 2), append(appendBlock(nil, []byte{16, 10}, 1), 0)} {
+		if _, err := DecodeAll(b, DecodeOptions{}); err == nil {
+			t.Errorf("DecodeAll(%v) succeeded", b)
+		}
+	}
+}
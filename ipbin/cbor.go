@@ -0,0 +1,216 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go4.org/netipx"
+	"net/netip"
+)
+
+// CBOR tags of IPv4 and IPv6 addresses and prefixes (RFC 9164)
+const (
+	CBORTagIPv4 = 52
+	CBORTagIPv6 = 54
+)
+
+// CBOR major types
+const (
+	cborUint   = 0
+	cborBytes  = 2
+	cborArray  = 4
+	cborTag    = 6
+	cborSimple = 7
+	cborNull   = cborSimple<<5 | 22
+)
+
+// AppendCBORPrefix appends p to b as a CBOR network address of RFC 9164:
+// single-address prefixes as tagged addresses, other prefixes as tagged
+// arrays of their length and address, without its trailing zero bytes.
+func AppendCBORPrefix(b []byte, p netip.Prefix) []byte {
+	p = p.Masked()
+	tag := uint64(CBORTagIPv6)
+	if p.Addr().Is4() {
+		tag = CBORTagIPv4
+	}
+	b = appendCBORHead(b, cborTag, tag)
+	addr := p.Addr().AsSlice()
+	if p.IsSingleIP() {
+		b = appendCBORHead(b, cborBytes, uint64(len(addr)))
+		return append(b, addr...)
+	}
+	addr = addr[:(p.Bits()+7)/8]
+	for len(addr) > 0 && addr[len(addr)-1] == 0 {
+		addr = addr[:len(addr)-1]
+	}
+	b = appendCBORHead(b, cborArray, 2)
+	b = appendCBORHead(b, cborUint, uint64(p.Bits()))
+	b = appendCBORHead(b, cborBytes, uint64(len(addr)))
+	return append(b, addr...)
+}
+
+// DecodeCBORPrefix decodes the RFC 9164 network address at the start of
+// data, returning it as a prefix along with its size. Addresses are
+// single-address prefixes, and interface addresses, tagged arrays of an
+// address and a prefix length, the prefixes they belong to.
+func DecodeCBORPrefix(data []byte) (netip.Prefix, int, error) {
+	major, tag, n, err := readCBORHead(data)
+	if err != nil {
+		return netip.Prefix{}, 0, err
+	}
+	if major != cborTag || tag != CBORTagIPv4 && tag != CBORTagIPv6 {
+		return netip.Prefix{}, 0, errors.New("invalid CBOR prefix: not a network address tag")
+	}
+	size := 4
+	if tag == CBORTagIPv6 {
+		size = 16
+	}
+	off := n
+	major, length, n, err := readCBORHead(data[off:])
+	if err != nil {
+		return netip.Prefix{}, 0, err
+	}
+	off += n
+	switch {
+	case major == cborBytes && int(length) == size:
+		// An address
+		addr, _ := netip.AddrFromSlice(data[off : off+size])
+		return netip.PrefixFrom(addr, addr.BitLen()), off + size, nil
+	case major == cborArray && length == 2:
+	default:
+		return netip.Prefix{}, 0, errors.New("invalid CBOR prefix: not an address or prefix")
+	}
+
+	// A prefix [length, address] or an interface address [address, length]
+	var bits uint64
+	var addrBytes []byte
+	iface := false
+	for i := 0; i < 2; i++ {
+		major, v, n, err := readCBORHead(data[off:])
+		if err != nil {
+			return netip.Prefix{}, 0, err
+		}
+		off += n
+		switch major {
+		case cborUint:
+			bits = v
+		case cborBytes:
+			if v > uint64(size) {
+				return netip.Prefix{}, 0, fmt.Errorf("invalid CBOR prefix: %d address bytes", v)
+			}
+			addrBytes, iface = data[off:off+int(v)], i == 0
+			off += int(v)
+		default:
+			return netip.Prefix{}, 0, errors.New("invalid CBOR prefix: not an address or prefix")
+		}
+	}
+	if addrBytes == nil || bits > uint64(size*8) {
+		return netip.Prefix{}, 0, errors.New("invalid CBOR prefix: not an address or prefix")
+	}
+	var a [16]byte
+	copy(a[:], addrBytes)
+	addr := netip.AddrFrom16(a)
+	if size == 4 {
+		addr = netip.AddrFrom4([4]byte(a[:4]))
+	}
+	p := netip.PrefixFrom(addr, int(bits))
+	if iface && len(addrBytes) == size {
+		// An interface address, whose host bits may be set
+		return p.Masked(), off, nil
+	}
+	if p.Masked() != p {
+		return netip.Prefix{}, 0, fmt.Errorf("invalid CBOR prefix %s: bits set beyond its length", p)
+	}
+	return p, off, nil
+}
+
+// MarshalCBOR returns s as a CBOR array of RFC 9164 network addresses. It
+// implements the Marshaler interface of CBOR libraries like
+// github.com/fxamacker/cbor, without depending on them.
+func (s PrefixSet) MarshalCBOR() ([]byte, error) {
+	prefixes := s.Prefixes()
+	b := appendCBORHead(nil, cborArray, uint64(len(prefixes)))
+	for _, p := range prefixes {
+		b = AppendCBORPrefix(b, p)
+	}
+	return b, nil
+}
+
+// UnmarshalCBOR replaces the content of s by the CBOR array of RFC 9164
+// network addresses data, or empties it if data is null.
+func (s *PrefixSet) UnmarshalCBOR(data []byte) error {
+	if len(data) == 1 && data[0] == cborNull {
+		s.IPSet = netipx.IPSet{}
+		return nil
+	}
+	major, count, off, err := readCBORHead(data)
+	if err != nil {
+		return err
+	}
+	if major != cborArray {
+		return errors.New("invalid CBOR set: not an array")
+	}
+	var b netipx.IPSetBuilder
+	for ; count > 0; count-- {
+		p, n, err := DecodeCBORPrefix(data[off:])
+		if err != nil {
+			return err
+		}
+		b.AddPrefix(p)
+		off += n
+	}
+	if off != len(data) {
+		return fmt.Errorf("invalid CBOR set: %d trailing bytes", len(data)-off)
+	}
+	ipset, err := b.IPSet()
+	if err != nil {
+		return err
+	}
+	s.IPSet = *ipset
+	return nil
+}
+
+// appendCBORHead appends the head of a CBOR data item of the given major
+// type and argument to b.
+func appendCBORHead(b []byte, major byte, v uint64) []byte {
+	switch {
+	case v < 24:
+		return append(b, major<<5|byte(v))
+	case v <= 0xff:
+		return append(b, major<<5|24, byte(v))
+	case v <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(v))
+	case v <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major<<5|27), v)
+}
+
+// readCBORHead reads the head of the CBOR data item at the start of data,
+// returning its major type, its argument and the size of the head. For
+// byte strings, the argument is checked against the bytes remaining.
+// Indefinite lengths are not supported.
+func readCBORHead(data []byte) (major byte, v uint64, n int, err error) {
+	if len(data) == 0 {
+		return 0, 0, 0, errors.New("truncated CBOR item")
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	switch {
+	case info < 24:
+		v, n = uint64(info), 1
+	case info <= 27:
+		n = 1 + 1<<(info-24)
+		if len(data) < n {
+			return 0, 0, 0, errors.New("truncated CBOR item")
+		}
+		for _, c := range data[1:n] {
+			v = v<<8 | uint64(c)
+		}
+	default:
+		return 0, 0, 0, fmt.Errorf("unsupported CBOR item 0x%02x", data[0])
+	}
+	if major == cborBytes && v > uint64(len(data)-n) {
+		return 0, 0, 0, errors.New("truncated CBOR byte string")
+	}
+	return major, v, n, nil
+}
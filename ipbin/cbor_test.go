@@ -0,0 +1,87 @@
+package ipbin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"go4.org/netipx"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestCBORPrefix(t *testing.T) {
+	// Examples of RFC 9164
+	tests := []struct {
+		prefix string
+		cbor   string
+	}{
+		{"192.0.2.1/32", "d83444c0000201"},
+		{"192.0.2.0/24", "d834821818 43c00002"},
+		{"2001:db8:1234::/48", "d836821830 4620010db81234"},
+		{"2001:db8:1234:deed:beef:cafe:face:feed/128", "d8365020010db81234deedbeefcafefacefeed"},
+		{"0.0.0.0/0", "d834820040"},
+		{"10.0.0.0/8", "d834820841 0a"},
+	}
+	for _, tt := range tests {
+		want, _ := hex.DecodeString(string(bytes.ReplaceAll([]byte(tt.cbor), []byte(" "), nil)))
+		p := netip.MustParsePrefix(tt.prefix)
+		if got := AppendCBORPrefix(nil, p); !bytes.Equal(got, want) {
+			t.Errorf("AppendCBORPrefix(%s) = %x, want %x", p, got, want)
+		}
+		got, n, err := DecodeCBORPrefix(append(want, 0xff))
+		if err != nil || got != p || n != len(want) {
+			t.Errorf("DecodeCBORPrefix(%x) = %v, %d, %v", want, got, n, err)
+		}
+	}
+
+	// An interface address, the prefix it belongs to
+	data, _ := hex.DecodeString("d8348244c00002011818")
+	if got, _, err := DecodeCBORPrefix(data); err != nil || got != netip.MustParsePrefix("192.0.2.0/24") {
+		t.Errorf("interface address got %v, %v", got, err)
+	}
+
+	for _, s := range []string{
+		"d8348218184401020304",   // host bits set
+		"d83482182143c00002",     // length too long
+		"d8218218184301",         // not a network address tag
+		"d8348218184543c0000200", // too many address bytes
+		"d83482181843c000",       // truncated
+		"d834",
+	} {
+		data, _ := hex.DecodeString(s)
+		if p, _, err := DecodeCBORPrefix(data); err == nil {
+			t.Errorf("DecodeCBORPrefix(%s) = %v, expected an error", s, p)
+		}
+	}
+}
+
+func TestPrefixSetCBOR(t *testing.T) {
+	var b netipx.IPSetBuilder
+	for _, s := range []string{"10.0.0.0/8", "192.168.1.1/32", "2001:db8::/32", "2001:db9::1/128"} {
+		b.AddPrefix(netip.MustParsePrefix(s))
+	}
+	ipset, _ := b.IPSet()
+	data, err := NewPrefixSet(ipset).MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != 0x84 {
+		t.Errorf("got %x, want an array of 4 items", data)
+	}
+	var set PrefixSet
+	if err := set.UnmarshalCBOR(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(set.Prefixes(), ipset.Prefixes()) {
+		t.Errorf("got %v, want %v", set.Prefixes(), ipset.Prefixes())
+	}
+	if err := set.UnmarshalCBOR([]byte{0xf6}); err != nil || len(set.Prefixes()) != 0 {
+		t.Errorf("null got %v, %v", set.Prefixes(), err)
+	}
+	if err := set.UnmarshalCBOR(append(data, 0)); err == nil {
+		t.Error("expected an error for trailing bytes")
+	}
+	if err := set.UnmarshalCBOR(data[1:]); err == nil {
+		t.Error("expected an error for a non-array")
+	}
+}
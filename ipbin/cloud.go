@@ -0,0 +1,174 @@
+package ipbin
+
+import (
+	"encoding/json"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// CloudFilter selects entries of cloud provider range files by service and
+// region. Values are matched case-insensitively; an empty list matches
+// everything.
+type CloudFilter struct {
+	Services []string
+	Regions  []string
+}
+
+func matchAny(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f CloudFilter) match(service, region string) bool {
+	return matchAny(f.Services, service) && matchAny(f.Regions, region)
+}
+
+// appendParsedPrefix parses s as a prefix or a single address and appends
+// it to nets. Empty strings are skipped.
+func appendParsedPrefix(nets []netip.Prefix, s string) ([]netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nets, nil
+	}
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		return append(nets, prefix), nil
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return nil, err
+	}
+	return append(nets, netip.PrefixFrom(ip, ip.BitLen())), nil
+}
+
+// ParseAWSRanges parses the AWS ip-ranges.json file
+// (https://ip-ranges.amazonaws.com/ip-ranges.json), returning the IPv4 and
+// IPv6 prefixes whose service and region match f.
+func ParseAWSRanges(r io.Reader, f CloudFilter) (nets []netip.Prefix, err error) {
+	var doc struct {
+		Prefixes []struct {
+			IPPrefix string `json:"ip_prefix"`
+			Region   string `json:"region"`
+			Service  string `json:"service"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPv6Prefix string `json:"ipv6_prefix"`
+			Region     string `json:"region"`
+			Service    string `json:"service"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err = json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	for _, p := range doc.Prefixes {
+		if f.match(p.Service, p.Region) {
+			if nets, err = appendParsedPrefix(nets, p.IPPrefix); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, p := range doc.IPv6Prefixes {
+		if f.match(p.Service, p.Region) {
+			if nets, err = appendParsedPrefix(nets, p.IPv6Prefix); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nets, nil
+}
+
+// ParseAzureServiceTags parses an Azure Service Tags file
+// (ServiceTags_Public_*.json), returning the prefixes of the tags matching f.
+// Services are matched against both the tag name (e.g. "AzureCloud.eastus")
+// and its system service (e.g. "AzureStorage").
+func ParseAzureServiceTags(r io.Reader, f CloudFilter) (nets []netip.Prefix, err error) {
+	var doc struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				SystemService   string   `json:"systemService"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err = json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	for _, v := range doc.Values {
+		props := v.Properties
+		if !f.match(v.Name, props.Region) && !f.match(props.SystemService, props.Region) {
+			continue
+		}
+		for _, s := range props.AddressPrefixes {
+			if nets, err = appendParsedPrefix(nets, s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nets, nil
+}
+
+// ParseGCPRanges parses the Google Cloud cloud.json or goog.json range
+// files (https://www.gstatic.com/ipranges/cloud.json). Regions are matched
+// against the entry scope.
+func ParseGCPRanges(r io.Reader, f CloudFilter) (nets []netip.Prefix, err error) {
+	var doc struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err = json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	for _, p := range doc.Prefixes {
+		if !f.match(p.Service, p.Scope) {
+			continue
+		}
+		if nets, err = appendParsedPrefix(nets, p.IPv4Prefix); err != nil {
+			return nil, err
+		}
+		if nets, err = appendParsedPrefix(nets, p.IPv6Prefix); err != nil {
+			return nil, err
+		}
+	}
+	return nets, nil
+}
+
+// ParseCloudflareRanges parses the Cloudflare IP ranges API response
+// (https://api.cloudflare.com/client/v4/ips). Cloudflare publishes neither
+// services nor regions, so any non-empty filter yields no prefixes.
+func ParseCloudflareRanges(r io.Reader, f CloudFilter) (nets []netip.Prefix, err error) {
+	var doc struct {
+		Result struct {
+			IPv4CIDRs []string `json:"ipv4_cidrs"`
+			IPv6CIDRs []string `json:"ipv6_cidrs"`
+		} `json:"result"`
+	}
+	if err = json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if !f.match("", "") {
+		return nil, nil
+	}
+	for _, s := range append(doc.Result.IPv4CIDRs, doc.Result.IPv6CIDRs...) {
+		if nets, err = appendParsedPrefix(nets, s); err != nil {
+			return nil, err
+		}
+	}
+	return nets, nil
+}
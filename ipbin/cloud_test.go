@@ -0,0 +1,94 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAWSRanges(t *testing.T) {
+	input := `{
+	  "syncToken": "1700000000",
+	  "prefixes": [
+	    {"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2", "service": "AMAZON"},
+	    {"ip_prefix": "52.94.76.0/22", "region": "us-east-1", "service": "EC2"},
+	    {"ip_prefix": "52.95.0.0/20", "region": "us-east-1", "service": "S3"}
+	  ],
+	  "ipv6_prefixes": [
+	    {"ipv6_prefix": "2600:1f18::/33", "region": "us-east-1", "service": "EC2"}
+	  ]
+	}`
+	nets, err := ParseAWSRanges(strings.NewReader(input), CloudFilter{Services: []string{"ec2"}, Regions: []string{"us-east-1"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("52.94.76.0/22"),
+		netip.MustParsePrefix("2600:1f18::/33"),
+	}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v\nwant %v", nets, expected)
+	}
+}
+
+func TestParseAzureServiceTags(t *testing.T) {
+	input := `{
+	  "changeNumber": 1,
+	  "values": [
+	    {"name": "AzureCloud.eastus", "properties": {"region": "eastus", "systemService": "", "addressPrefixes": ["13.68.128.0/17", "2603:1030:210::/47"]}},
+	    {"name": "Storage.westeurope", "properties": {"region": "westeurope", "systemService": "AzureStorage", "addressPrefixes": ["13.69.40.0/24"]}}
+	  ]
+	}`
+	nets, err := ParseAzureServiceTags(strings.NewReader(input), CloudFilter{Services: []string{"AzureStorage"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []netip.Prefix{netip.MustParsePrefix("13.69.40.0/24")}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v\nwant %v", nets, expected)
+	}
+	nets, err = ParseAzureServiceTags(strings.NewReader(input), CloudFilter{Regions: []string{"eastus"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected = []netip.Prefix{netip.MustParsePrefix("13.68.128.0/17"), netip.MustParsePrefix("2603:1030:210::/47")}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v\nwant %v", nets, expected)
+	}
+}
+
+func TestParseGCPRanges(t *testing.T) {
+	input := `{
+	  "prefixes": [
+	    {"ipv4Prefix": "34.1.208.0/20", "service": "Google Cloud", "scope": "africa-south1"},
+	    {"ipv6Prefix": "2600:1900:8000::/44", "service": "Google Cloud", "scope": "us-central1"},
+	    {"ipv4Prefix": "34.22.0.0/19", "service": "Google Cloud", "scope": "us-central1"}
+	  ]
+	}`
+	nets, err := ParseGCPRanges(strings.NewReader(input), CloudFilter{Regions: []string{"us-central1"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []netip.Prefix{netip.MustParsePrefix("2600:1900:8000::/44"), netip.MustParsePrefix("34.22.0.0/19")}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v\nwant %v", nets, expected)
+	}
+}
+
+func TestParseCloudflareRanges(t *testing.T) {
+	input := `{"result": {"ipv4_cidrs": ["173.245.48.0/20"], "ipv6_cidrs": ["2400:cb00::/32"], "etag": "x"}, "success": true}`
+	nets, err := ParseCloudflareRanges(strings.NewReader(input), CloudFilter{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []netip.Prefix{netip.MustParsePrefix("173.245.48.0/20"), netip.MustParsePrefix("2400:cb00::/32")}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v\nwant %v", nets, expected)
+	}
+}
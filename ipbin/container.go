@@ -0,0 +1,215 @@
+package ipbin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"time"
+)
+
+// ContainerHeader is the header byte of the metadata block which may start
+// a binary set: it is followed by the length of the block as a uvarint,
+// then by its fields, each a tag byte, the length of the value as a uvarint
+// and the value. Readers skip the fields with unknown tags.
+const ContainerHeader = 254
+
+// Metadata field tags
+const (
+	metaGenerated = 1 // big-endian int64 of Unix seconds
+	metaSource    = 2
+	metaVersion   = 3
+	metaSHA256    = 4
+	metaIndex     = 5 // entries of a full-length prefix record and the uvarint offset delta
+	metaFormat    = 6 // uvarint format version of the records, 1 if none
+	metaMerged    = 7 // empty
+)
+
+// Metadata describes the build of a binary set.
+type Metadata struct {
+	Generated time.Time    // when the set was written
+	Source    string       // description of the inputs, e.g. feed names
+	Version   string       // version of the writing tool
+	SHA256    []byte       // SHA-256 of the records following the metadata block
+	Index     []IndexEntry // blocks of the records, for lookups without reading them all
+	Format    int          // format version of the records, 2 if they may be ZeroRunHeader records, 1 if 0
+	Merged    bool         // whether the records are the sorted prefixes of a merged set, e.g. of netipx.IPSet.Prefixes
+}
+
+// ContentHash returns the SHA-256 of the records of a binary set, as stored
+// in its metadata.
+func ContentHash(records []byte) []byte {
+	sum := sha256.Sum256(records)
+	return sum[:]
+}
+
+// Verify reports whether records match the content hash of m. It returns
+// false if m has no content hash.
+func (m Metadata) Verify(records []byte) bool {
+	return len(m.SHA256) > 0 && bytes.Equal(m.SHA256, ContentHash(records))
+}
+
+// AppendMetadata appends the metadata block of m to dst.
+func AppendMetadata(dst []byte, m Metadata) []byte {
+	var fields []byte
+	field := func(tag byte, value []byte) {
+		fields = append(fields, tag)
+		fields = binary.AppendUvarint(fields, uint64(len(value)))
+		fields = append(fields, value...)
+	}
+	if !m.Generated.IsZero() {
+		field(metaGenerated, binary.BigEndian.AppendUint64(nil, uint64(m.Generated.Unix())))
+	}
+	if m.Source != "" {
+		field(metaSource, []byte(m.Source))
+	}
+	if m.Version != "" {
+		field(metaVersion, []byte(m.Version))
+	}
+	if len(m.SHA256) > 0 {
+		field(metaSHA256, m.SHA256)
+	}
+	if len(m.Index) > 0 {
+		var index []byte
+		var prev int64
+		for _, e := range m.Index {
+			index, _ = AppendEncoded(index, netip.PrefixFrom(e.First, e.First.BitLen()))
+			index = binary.AppendUvarint(index, uint64(e.Offset-prev))
+			prev = e.Offset
+		}
+		field(metaIndex, index)
+	}
+	if m.Format > 1 {
+		field(metaFormat, binary.AppendUvarint(nil, uint64(m.Format)))
+	}
+	if m.Merged {
+		field(metaMerged, nil)
+	}
+	dst = append(dst, ContainerHeader)
+	dst = binary.AppendUvarint(dst, uint64(len(fields)))
+	return append(dst, fields...)
+}
+
+// ReadMetadataFromBytes reads a metadata block from buf and returns it
+// along with the number of bytes read. A buf not starting with a metadata
+// block returns zero Metadata and 0 bytes read.
+func ReadMetadataFromBytes(buf []byte) (Metadata, int, error) {
+	var m Metadata
+	if len(buf) == 0 || buf[0] != ContainerHeader {
+		return m, 0, nil
+	}
+	size, n := binary.Uvarint(buf[1:])
+	if n <= 0 || uint64(len(buf)-1-n) < size {
+		return m, 0, io.ErrUnexpectedEOF
+	}
+	end := 1 + n + int(size)
+	fields := buf[1+n : end]
+	for len(fields) > 0 {
+		tag := fields[0]
+		l, n := binary.Uvarint(fields[1:])
+		if n <= 0 || uint64(len(fields)-1-n) < l {
+			return Metadata{}, 0, fmt.Errorf("invalid metadata field %d", tag)
+		}
+		value := fields[1+n : 1+n+int(l)]
+		fields = fields[1+n+int(l):]
+		switch tag {
+		case metaGenerated:
+			if len(value) != 8 {
+				return Metadata{}, 0, fmt.Errorf("invalid metadata generation time")
+			}
+			m.Generated = time.Unix(int64(binary.BigEndian.Uint64(value)), 0).UTC()
+		case metaSource:
+			m.Source = string(value)
+		case metaVersion:
+			m.Version = string(value)
+		case metaSHA256:
+			m.SHA256 = bytes.Clone(value)
+		case metaFormat:
+			format, n := binary.Uvarint(value)
+			if n <= 0 || format > 255 {
+				return Metadata{}, 0, fmt.Errorf("invalid metadata format version")
+			}
+			m.Format = int(format)
+		case metaMerged:
+			m.Merged = true
+		case metaIndex:
+			var prev int64
+			for len(value) > 0 {
+				p, n, err := ReadPrefixFromBytes(value)
+				if err != nil {
+					return Metadata{}, 0, fmt.Errorf("invalid metadata index: %w", err)
+				}
+				delta, dn := binary.Uvarint(value[n:])
+				if dn <= 0 {
+					return Metadata{}, 0, fmt.Errorf("invalid metadata index")
+				}
+				prev += int64(delta)
+				m.Index = append(m.Index, IndexEntry{First: p.Addr(), Offset: prev})
+				value = value[n+dn:]
+			}
+		}
+	}
+	return m, end, nil
+}
+
+// WriteContainer writes the metadata block of m, with the content hash of
+// records, followed by records.
+func WriteContainer(w io.Writer, m Metadata, records []byte) error {
+	m.SHA256 = ContentHash(records)
+	if _, err := w.Write(AppendMetadata(nil, m)); err != nil {
+		return err
+	}
+	_, err := w.Write(records)
+	return err
+}
+
+// IsMerged reports whether buf is a single binary set whose metadata says
+// its records are merged, their content hash matching, so that their
+// prefixes are those of the merged set already and need no merging. A set
+// concatenated to others, or modified since, is not.
+func IsMerged(buf []byte) bool {
+	m, n, err := ReadMetadataFromBytes(buf)
+	return err == nil && m.Merged && m.Verify(buf[n:])
+}
+
+// Section is one of the sets of a binary file or stream of concatenated
+// sets, e.g. written by cat a.bin b.bin > c.bin, which readers decode as
+// the union of the sets.
+type Section struct {
+	Metadata    Metadata // zero if the set has no metadata block
+	HasMetadata bool
+	Records     []byte // the records, with the end-of-stream marker if any
+	Ended       bool   // whether the records end with an end-of-stream marker
+}
+
+// Sections splits buf into the concatenated sets it holds, each starting
+// with a metadata block or after an end-of-stream marker, so that their
+// content hashes can be verified one by one.
+func Sections(buf []byte) ([]Section, error) {
+	var sections []Section
+	for off := 0; off < len(buf); {
+		var s Section
+		m, n, err := ReadMetadataFromBytes(buf[off:])
+		if err != nil {
+			return nil, &ParseError{Offset: off, Err: err}
+		}
+		s.Metadata, s.HasMetadata = m, n > 0
+		start := off + n
+		for off = start; off < len(buf) && buf[off] != ContainerHeader; {
+			rec, n, err := readRecord(buf[off:])
+			if err != nil {
+				return nil, &ParseError{Offset: off, Err: err}
+			}
+			off += n
+			if rec.kind == KindEnd {
+				s.Ended = true
+				break
+			}
+		}
+		s.Records = buf[start:off]
+		sections = append(sections, s)
+	}
+	return sections, nil
+}
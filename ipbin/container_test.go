@@ -0,0 +1,123 @@
+package ipbin
+
+import (
+	"bytes"
+	"io"
+	"net/netip"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestContainer(t *testing.T) {
+	records := []byte{16, 1, 3, 32, 1, 5, 5, 5}
+	m := Metadata{
+		Generated: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Source:    "feed.txt",
+		Version:   "v1.2.0",
+	}
+	var buf bytes.Buffer
+	if err := WriteContainer(&buf, m, records); err != nil {
+		t.Error(err)
+		return
+	}
+	b := buf.Bytes()
+	if b[0] != ContainerHeader {
+		t.Errorf("got header %d", b[0])
+	}
+	got, n, err := ReadMetadataFromBytes(b)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	m.SHA256 = ContentHash(records)
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("got %+v, want %+v", got, m)
+	}
+	if !bytes.Equal(b[n:], records) || !got.Verify(b[n:]) {
+		t.Errorf("got records %v", b[n:])
+	}
+	if got.Verify(records[:4]) {
+		t.Errorf("Verify of modified records expected false")
+	}
+
+	// Unknown fields are skipped
+	b = AppendMetadata(nil, Metadata{Source: "a"})
+	b = append(b[:1], append([]byte{b[1] + 3, 99, 1, 0}, b[2:]...)...)
+	if got, _, err := ReadMetadataFromBytes(b); err != nil || got.Source != "a" {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	if got, n, err := ReadMetadataFromBytes(records); err != nil || n != 0 || got.Source != "" {
+		t.Errorf("plain records got %+v, %d, %v", got, n, err)
+	}
+	if _, _, err := ReadMetadataFromBytes([]byte{ContainerHeader, 5, 1}); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated block got %v", err)
+	}
+}
+
+func TestConcatenatedSets(t *testing.T) {
+	// cat a.bin b.bin c.bin, c without metadata following the end marker of
+	// b, as records following those of a set without marker are its own
+	var a, b bytes.Buffer
+	if err := WriteContainer(&a, Metadata{Source: "a"}, []byte{16, 1, 3, EndHeader}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteContainer(&b, Metadata{Source: "b"}, []byte{16, 1, 3, 32, 1, 5, 5, 5, EndHeader}); err != nil {
+		t.Fatal(err)
+	}
+	c := []byte{8, 10}
+	buf := slices.Concat(a.Bytes(), b.Bytes(), c)
+
+	prefixes, err := DecodeAll(buf, DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []netip.Prefix
+	for _, s := range []string{"1.3.0.0/16", "1.3.0.0/16", "1.5.5.5/32", "10.0.0.0/8"} {
+		expected = append(expected, netip.MustParsePrefix(s))
+	}
+	if !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("DecodeAll got %v, want %v", prefixes, expected)
+	}
+	if stats, err := BinaryStats(buf, time.Now()); err != nil || stats.Sets != 3 || stats.Metadata.Source != "a" {
+		t.Errorf("BinaryStats got %+v, %v", stats, err)
+	}
+
+	sections, err := Sections(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 3 || !sections[0].Ended || !sections[1].Ended || sections[2].Ended || sections[2].HasMetadata {
+		t.Fatalf("Sections got %+v", sections)
+	}
+	for _, s := range sections[:2] {
+		if !s.Metadata.Verify(s.Records) {
+			t.Errorf("set %s does not verify", s.Metadata.Source)
+		}
+	}
+	if !bytes.Equal(sections[2].Records, c) {
+		t.Errorf("Sections got records %v, want %v", sections[2].Records, c)
+	}
+}
+
+func TestIsMerged(t *testing.T) {
+	records := []byte{16, 1, 3, 32, 1, 5, 5, 5}
+	var buf bytes.Buffer
+	if err := WriteContainer(&buf, Metadata{Source: "a", Merged: true}, records); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if m, _, err := ReadMetadataFromBytes(b); err != nil || !m.Merged {
+		t.Errorf("ReadMetadataFromBytes got %+v, %v", m, err)
+	}
+	if !IsMerged(b) {
+		t.Errorf("IsMerged of a merged set got false")
+	}
+	// Concatenated to another set, or without the flag
+	for _, b := range [][]byte{slices.Concat(b, b), append(AppendMetadata(nil, Metadata{SHA256: ContentHash(records)}), records...), records} {
+		if IsMerged(b) {
+			t.Errorf("IsMerged(%v) got true", b)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package ipbin
+
+import (
+	"context"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+)
+
+// ctxCheckInterval is the number of lines, prefixes or records processed
+// between checks of the context
+const ctxCheckInterval = 4096
+
+// ContextReader returns a reader reading from r which fails with the error
+// of ctx once it is done, e.g. to bound the parsing of any input format.
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &ctxReader{ctx, r}
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// ContextWriter returns a writer writing to w which fails with the error of
+// ctx once it is done, e.g. to bound the rendering of any output format.
+func ContextWriter(ctx context.Context, w io.Writer) io.Writer {
+	return &ctxWriter{ctx, w}
+}
+
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// ParseIPSubnetsCtx is ParseIPSubnets, returning the error of ctx once it
+// is done.
+func ParseIPSubnetsCtx(ctx context.Context, r io.Reader) ([]netip.Prefix, error) {
+	return parseIPSubnets(ctx, r, ParseOptions{})
+}
+
+// MergePrefixesCtx is MergePrefixes, returning the error of ctx once it is
+// done.
+func MergePrefixesCtx(ctx context.Context, prefixes []netip.Prefix) (*netipx.IPSet, error) {
+	builder := netipx.IPSetBuilder{}
+	for i, prefix := range prefixes {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		builder.AddPrefix(prefix)
+	}
+	return builder.IPSet()
+}
+
+// WriteEncodedAll writes the binary records of prefixes to w.
+func WriteEncodedAll(w io.Writer, prefixes []netip.Prefix) error {
+	return WriteEncodedAllCtx(context.Background(), w, prefixes)
+}
+
+// WriteEncodedAllCtx is WriteEncodedAll, returning the error of ctx once it
+// is done.
+func WriteEncodedAllCtx(ctx context.Context, w io.Writer, prefixes []netip.Prefix) error {
+	buf := make([]byte, 0, 32*1024)
+	for i, p := range prefixes {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		var err error
+		if buf, err = AppendEncoded(buf, p); err != nil {
+			return err
+		}
+		if len(buf) > cap(buf)-17 {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
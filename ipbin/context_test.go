@@ -0,0 +1,52 @@
+package ipbin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("1.3.0.0/16"), netip.MustParsePrefix("2001:db8::/32")}
+	ctx := context.Background()
+	var buf bytes.Buffer
+	if err := WriteEncodedAllCtx(ctx, &buf, prefixes); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, err := DecodeAllCtx(ctx, buf.Bytes(), DecodeOptions{}); err != nil || !reflect.DeepEqual(got, prefixes) {
+		t.Errorf("DecodeAllCtx got %v, %v", got, err)
+	}
+	if got, err := ParseIPSubnetsCtx(ctx, strings.NewReader("1.3.0.0/16\n2001:db8::/32\n")); err != nil || !reflect.DeepEqual(got, prefixes) {
+		t.Errorf("ParseIPSubnetsCtx got %v, %v", got, err)
+	}
+	if ipset, err := MergePrefixesCtx(ctx, prefixes); err != nil || len(ipset.Prefixes()) != 2 {
+		t.Errorf("MergePrefixesCtx got %v, %v", ipset, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := WriteEncodedAllCtx(cancelled, io.Discard, prefixes); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled WriteEncodedAllCtx got %v", err)
+	}
+	if _, err := DecodeAllCtx(cancelled, buf.Bytes(), DecodeOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled DecodeAllCtx got %v", err)
+	}
+	if _, err := ParseIPSubnetsCtx(cancelled, strings.NewReader("1.3.0.0/16\n")); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled ParseIPSubnetsCtx got %v", err)
+	}
+	if _, err := MergePrefixesCtx(cancelled, prefixes); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled MergePrefixesCtx got %v", err)
+	}
+	if _, err := io.ReadAll(ContextReader(cancelled, strings.NewReader("1.3.0.0/16\n"))); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled ContextReader got %v", err)
+	}
+	if _, err := ContextWriter(cancelled, io.Discard).Write([]byte{16, 1, 3}); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled ContextWriter got %v", err)
+	}
+}
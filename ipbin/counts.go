@@ -0,0 +1,112 @@
+package ipbin
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// AddrCounts counts the occurrences of addresses, e.g. the packets of each
+// source address of a capture or the hits of each client in a log.
+type AddrCounts map[netip.Addr]int
+
+// Add counts an occurrence of addr, without its zone and as IPv4 if it is
+// an IPv4-mapped IPv6 address.
+func (c AddrCounts) Add(addr netip.Addr) {
+	c[addr.Unmap().WithZone("")]++
+}
+
+// Merge adds the counts of other to c.
+func (c AddrCounts) Merge(other AddrCounts) {
+	for addr, n := range other {
+		c[addr] += n
+	}
+}
+
+// Filter returns the addresses occurring at least minCount times, and
+// among them only the top most frequent unless top is 0. Addresses of equal
+// counts are ranked by address.
+func (c AddrCounts) Filter(minCount, top int) AddrCounts {
+	var addrs []netip.Addr
+	for addr, n := range c {
+		if n >= minCount {
+			addrs = append(addrs, addr)
+		}
+	}
+	if top > 0 && len(addrs) > top {
+		slices.SortFunc(addrs, func(a, b netip.Addr) int {
+			return cmp.Or(cmp.Compare(c[b], c[a]), a.Compare(b))
+		})
+		addrs = addrs[:top]
+	}
+	out := make(AddrCounts, len(addrs))
+	for _, addr := range addrs {
+		out[addr] = c[addr]
+	}
+	return out
+}
+
+// FilterParams is Filter with the "min-count" and "top" parameters, 1 and
+// 0 if unset.
+func (c AddrCounts) FilterParams(params Params) (AddrCounts, error) {
+	minCount, err := params.Int("min-count", 1)
+	if err != nil {
+		return nil, err
+	}
+	top, err := params.Int("top", 0)
+	if err != nil {
+		return nil, err
+	}
+	return c.Filter(minCount, top), nil
+}
+
+// Prefixes returns the addresses occurring at least minCount times as
+// single-address prefixes, sorted.
+func (c AddrCounts) Prefixes(minCount int) []netip.Prefix {
+	var nets []netip.Prefix
+	for addr, n := range c {
+		if n >= minCount {
+			nets = append(nets, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	slices.SortFunc(nets, func(a, b netip.Prefix) int { return a.Addr().Compare(b.Addr()) })
+	return nets
+}
+
+// Valued returns the addresses as single-address prefixes valued with
+// their count, sorted, e.g. to store the counts as valued records.
+func (c AddrCounts) Valued() []ValuedPrefix {
+	vps := make([]ValuedPrefix, 0, len(c))
+	for _, p := range c.Prefixes(0) {
+		vps = append(vps, ValuedPrefix{Prefix: p, Value: strconv.Itoa(c[p.Addr()])})
+	}
+	return vps
+}
+
+// CountInputAddrs counts the addresses of an input in one of the counting
+// input formats: "extract", with the "extract-regex" parameter, or "pcap",
+// with the "pcap-addrs" parameter.
+func CountInputAddrs(format string, r io.Reader, params Params) (AddrCounts, error) {
+	switch format {
+	case "pcap":
+		which, err := ParsePcapAddrs(params.Get("pcap-addrs", "source"))
+		if err != nil {
+			return nil, err
+		}
+		return CountPcapAddrs(r, which)
+	case "extract":
+		var re *regexp.Regexp
+		if s := params.Get("extract-regex", ""); s != "" {
+			var err error
+			if re, err = regexp.Compile(s); err != nil {
+				return nil, err
+			}
+		}
+		return ExtractAddrs(r, re)
+	}
+	return nil, fmt.Errorf("input format %s does not count addresses", format)
+}
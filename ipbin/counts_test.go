@@ -0,0 +1,34 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestAddrCountsFilter(t *testing.T) {
+	a, b, c, d := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2"), netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("10.0.0.1")
+	counts := AddrCounts{a: 12, b: 3, c: 12, d: 40}
+	if got, want := counts.Filter(10, 0), (AddrCounts{a: 12, c: 12, d: 40}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter(10, 0) got %v, want %v", got, want)
+	}
+	if got, want := counts.Filter(1, 2), (AddrCounts{a: 12, d: 40}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter(1, 2) got %v, want %v", got, want)
+	}
+	got, err := counts.FilterParams(Params{"min-count": "4", "top": "1"})
+	if want := (AddrCounts{d: 40}); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterParams got %v, %v, want %v", got, err, want)
+	}
+
+	counts.Merge(AddrCounts{b: 2, netip.MustParseAddr("192.0.2.3"): 1})
+	expected := []ValuedPrefix{
+		{netip.MustParsePrefix("10.0.0.1/32"), "40"},
+		{netip.MustParsePrefix("192.0.2.1/32"), "12"},
+		{netip.MustParsePrefix("192.0.2.2/32"), "5"},
+		{netip.MustParsePrefix("192.0.2.3/32"), "1"},
+		{netip.MustParsePrefix("2001:db8::1/128"), "12"},
+	}
+	if got := counts.Valued(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Valued got %v\nwant %v", got, expected)
+	}
+}
@@ -0,0 +1,153 @@
+package ipbin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// DaemonConfig is the configuration of the jobs of the ipbin daemon, read
+// from a TOML file like:
+//
+//	listen = "127.0.0.1:9090"
+//
+//	[[job]]
+//	name = "nginx"
+//	schedule = "*/15 * * * *"
+//	args = ["-i", "https://www.spamhaus.org/drop/drop.txt", "-f", "nginx", "--if-changed", "/etc/nginx/blocklist.conf"]
+//	on-update = "nginx -s reload"
+//	timeout = "5m"
+type DaemonConfig struct {
+	// Listen is the address the status endpoint listens on, none if empty.
+	Listen string
+	Jobs   []DaemonJob
+}
+
+// DaemonJob is a job of the ipbin daemon: an ipbin command run on a
+// schedule.
+type DaemonJob struct {
+	// Name identifies the job in logs and status.
+	Name     string
+	Schedule Schedule
+	// Args are the arguments of the ipbin command, e.g. a conversion or
+	// "filter" and its arguments.
+	Args []string
+	// OnUpdate is a shell command run after each successful run, except
+	// those exiting with the unchanged status of --if-changed.
+	OnUpdate string
+	// Timeout is the longest a run may take before being killed, unlimited
+	// if 0.
+	Timeout time.Duration
+}
+
+// ParseDaemonConfig parses the configuration of the ipbin daemon (see
+// DaemonConfig). Unknown keys are rejected, to catch typos.
+func ParseDaemonConfig(r io.Reader) (*DaemonConfig, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeTOML(string(data))
+	if err != nil {
+		return nil, err
+	}
+	config := &DaemonConfig{}
+	for key, v := range doc {
+		switch key {
+		case "listen":
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("listen must be a string")
+			}
+			config.Listen = s
+		case "job":
+			tables, ok := v.([]any)
+			if !ok {
+				return nil, errors.New("jobs must be [[job]] tables")
+			}
+			for i, t := range tables {
+				job, err := parseDaemonJob(t)
+				if err != nil {
+					return nil, fmt.Errorf("job %d: %w", i+1, err)
+				}
+				if slices.ContainsFunc(config.Jobs, func(j DaemonJob) bool { return j.Name == job.Name }) {
+					return nil, fmt.Errorf("job %d: duplicate name %q", i+1, job.Name)
+				}
+				config.Jobs = append(config.Jobs, job)
+			}
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if len(config.Jobs) == 0 {
+		return nil, errors.New("no [[job]] defined")
+	}
+	return config, nil
+}
+
+// parseDaemonJob parses a [[job]] table of the daemon configuration.
+func parseDaemonJob(v any) (DaemonJob, error) {
+	table, ok := v.(map[string]any)
+	if !ok {
+		return DaemonJob{}, errors.New("not a table")
+	}
+	var job DaemonJob
+	var schedule string
+	for key, v := range table {
+		var err error
+		switch key {
+		case "name":
+			job.Name, err = daemonString(key, v)
+		case "schedule":
+			schedule, err = daemonString(key, v)
+		case "on-update":
+			job.OnUpdate, err = daemonString(key, v)
+		case "timeout":
+			var s string
+			if s, err = daemonString(key, v); err == nil {
+				if job.Timeout, err = time.ParseDuration(s); err == nil && job.Timeout < 0 {
+					err = errors.New("negative timeout")
+				}
+			}
+		case "args":
+			list, ok := v.([]any)
+			if !ok {
+				return DaemonJob{}, errors.New("args must be an array of strings")
+			}
+			for _, item := range list {
+				s, ok := item.(string)
+				if !ok {
+					return DaemonJob{}, errors.New("args must be an array of strings")
+				}
+				job.Args = append(job.Args, s)
+			}
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return DaemonJob{}, err
+		}
+	}
+	if job.Name == "" {
+		return DaemonJob{}, errors.New("missing name")
+	}
+	if len(job.Args) == 0 {
+		return DaemonJob{}, fmt.Errorf("%s: missing args", job.Name)
+	}
+	var err error
+	if job.Schedule, err = ParseSchedule(schedule); err != nil {
+		return DaemonJob{}, fmt.Errorf("%s: %w", job.Name, err)
+	}
+	return job, nil
+}
+
+// daemonString returns the string value of key.
+func daemonString(key string, v any) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	return s, nil
+}
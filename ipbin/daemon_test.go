@@ -0,0 +1,58 @@
+package ipbin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDaemonConfig(t *testing.T) {
+	config, err := ParseDaemonConfig(strings.NewReader(`
+listen = "127.0.0.1:9090"
+
+[[job]]
+name = "nginx"
+schedule = "*/15 * * * *"
+args = ["-i", "drop.txt", "-f", "nginx", "--if-changed", "blocklist.conf"]
+on-update = "nginx -s reload"
+timeout = "5m"
+
+[[job]]
+name = "bin"
+schedule = "@every 1h"
+args = ["-i", "drop.txt", "drop.bin"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Listen != "127.0.0.1:9090" || len(config.Jobs) != 2 {
+		t.Fatalf("got %+v", config)
+	}
+	job := config.Jobs[0]
+	if job.Name != "nginx" || job.Schedule.String() != "*/15 * * * *" || job.OnUpdate != "nginx -s reload" || job.Timeout != 5*time.Minute {
+		t.Errorf("got %+v", job)
+	}
+	if want := []string{"-i", "drop.txt", "-f", "nginx", "--if-changed", "blocklist.conf"}; !reflect.DeepEqual(job.Args, want) {
+		t.Errorf("got args %q, want %q", job.Args, want)
+	}
+	if job := config.Jobs[1]; job.Name != "bin" || job.Schedule.String() != "@every 1h" || job.Timeout != 0 {
+		t.Errorf("got %+v", job)
+	}
+
+	for _, s := range []string{
+		``,
+		`listen = ":9090"`,
+		"[[job]]\nname = \"a\"\nschedule = \"@daily\"",
+		"[[job]]\nname = \"a\"\nschedule = \"daily\"\nargs = [\"x\"]",
+		"[[job]]\nschedule = \"@daily\"\nargs = [\"x\"]",
+		"[[job]]\nname = \"a\"\nschedule = \"@daily\"\nargs = [\"x\"]\nschedul = \"@daily\"",
+		"[[job]]\nname = \"a\"\nschedule = \"@daily\"\nargs = [\"x\"]\ntimeout = \"soon\"",
+		"[[job]]\nname = \"a\"\nschedule = \"@daily\"\nargs = [\"x\"]\n[[job]]\nname = \"a\"\nschedule = \"@daily\"\nargs = [\"y\"]",
+		"lisen = \":9090\"\n[[job]]\nname = \"a\"\nschedule = \"@daily\"\nargs = [\"x\"]",
+	} {
+		if _, err := ParseDaemonConfig(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package ipbin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// DefaultMaxRecords is the number of records DecodeAll decodes at most
+// unless DecodeOptions.MaxRecords says otherwise. As a record may be a
+// single byte (0.0.0.0/0) but decodes to a 32-byte netip.Prefix, a hostile
+// file could otherwise take 32 times its size in memory.
+const DefaultMaxRecords = 1 << 24
+
+// ErrNonCanonical is returned by strict decoding for a record with host
+// bits set beyond its prefix length in the stored bytes.
+var ErrNonCanonical = errors.New("non-canonical prefix record")
+
+// ErrTooManyRecords is returned by DecodeAll when a set has more records
+// than allowed.
+var ErrTooManyRecords = errors.New("too many records")
+
+// DecodeOptions are the options of DecodeAll.
+type DecodeOptions struct {
+	// Strict rejects non-canonical records with ErrNonCanonical. Encoders
+	// never write them, so they reveal corrupt or crafted files.
+	Strict bool
+	// MaxRecords is the maximum number of records, DefaultMaxRecords if
+	// zero and unlimited if negative.
+	MaxRecords int
+	// ExpiredAt drops the records expired at that time, if not zero.
+	ExpiredAt time.Time
+	// DefaultRoutes is the policy for 0.0.0.0/0 and ::/0 records, allowed
+	// by default.
+	DefaultRoutes DefaultRoutePolicy
+	// Workers is the number of goroutines decoding the blocks of records of
+	// sets written in blocks, GOMAXPROCS if 0 or less and serially if 1.
+	Workers int
+}
+
+// ReadPrefixFromBytesStrict is ReadPrefixFromBytes, rejecting non-canonical
+// records with ErrNonCanonical.
+func ReadPrefixFromBytesStrict(buf []byte) (netip.Prefix, int, error) {
+	p, n, err := ReadPrefixFromBytes(buf)
+	if err == nil && p != p.Masked() {
+		return netip.Prefix{}, 0, ErrNonCanonical
+	}
+	return p, n, err
+}
+
+// DecodeAll decodes the prefixes of a binary set: its records, with or
+// without expiry, after the optional metadata block. Range records decode
+// to the prefixes of their range, extension blocks are skipped, blocks of
+// records are checked against their checksum, and concatenated sets decode
+// to the prefixes of them all. Malformed records
+// are reported as a *ParseError giving their offset.
+func DecodeAll(buf []byte, opts DecodeOptions) ([]netip.Prefix, error) {
+	return DecodeAllCtx(context.Background(), buf, opts)
+}
+
+// DecodeAllCtx is DecodeAll, returning the error of ctx once it is done.
+func DecodeAllCtx(ctx context.Context, buf []byte, opts DecodeOptions) ([]netip.Prefix, error) {
+	return decodeAllInto(ctx, nil, buf, opts)
+}
+
+// DecodeAllInto is DecodeAll appending the prefixes to dst, e.g. the slice
+// of the previous version of a set truncated to zero length, so that
+// reloading large sets again and again does not allocate, and leave to the
+// garbage collector, a new slice each time. On error, it returns dst as
+// given.
+func DecodeAllInto(dst []netip.Prefix, buf []byte, opts DecodeOptions) ([]netip.Prefix, error) {
+	return decodeAllInto(context.Background(), dst, buf, opts)
+}
+
+func decodeAllInto(ctx context.Context, dst []netip.Prefix, buf []byte, opts DecodeOptions) ([]netip.Prefix, error) {
+	maxRecords := opts.MaxRecords
+	if maxRecords == 0 {
+		maxRecords = DefaultMaxRecords
+	}
+	_, off, err := ReadMetadataFromBytes(buf)
+	if err != nil {
+		return dst, err
+	}
+	if opts.Workers != 1 {
+		if spans := blockSpans(buf, off, maxRecords); len(spans) > 1 {
+			return decodeBlocks(ctx, dst, buf, spans, opts)
+		}
+	}
+	// Records take 3 bytes or more in real sets, do not trust the size
+	// further than that
+	size := len(buf) / 3
+	if maxRecords > 0 {
+		size = min(size, maxRecords)
+	}
+	prefixes, err := decodeRecords(ctx, slices.Grow(dst, size), buf, off, len(buf), opts, maxRecords)
+	if err != nil {
+		return dst, err
+	}
+	return prefixes, nil
+}
+
+// decodeRecords appends the prefixes of the records of buf from offset off
+// to end to prefixes, maxRecords records at most if positive.
+func decodeRecords(ctx context.Context, prefixes []netip.Prefix, buf []byte, off, end int, opts DecodeOptions, maxRecords int) ([]netip.Prefix, error) {
+	buf = buf[:end]
+	var blocks blockCheck
+	for records := 0; off < len(buf); records++ {
+		if records%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if maxRecords > 0 && records == maxRecords {
+			return nil, fmt.Errorf("offset %d: %w (maximum %d)", off, ErrTooManyRecords, maxRecords)
+		}
+		rec, n, err := readRecord(buf[off:])
+		if err == nil && opts.Strict && rec.prefix.Prefix != rec.prefix.Prefix.Masked() {
+			err = ErrNonCanonical
+		}
+		if err == nil {
+			err = blocks.next(buf, off, rec, n)
+		}
+		if err != nil {
+			return nil, &ParseError{Offset: off, Err: err}
+		}
+		// Range records decode to their prefixes
+		start := len(prefixes)
+		prefixes = rec.appendPrefixes(prefixes)
+		for i := start; i < len(prefixes); i++ {
+			if !IsDefaultRoute(prefixes[i]) {
+				continue
+			}
+			switch opts.DefaultRoutes {
+			case DefaultRouteReject:
+				return nil, fmt.Errorf("offset %d: %w %s", off, ErrDefaultRoute, prefixes[i])
+			case DefaultRouteDrop:
+				prefixes = slices.Delete(prefixes, i, i+1)
+				i--
+			}
+		}
+		if !opts.ExpiredAt.IsZero() && rec.prefix.Expired(opts.ExpiredAt) {
+			prefixes = prefixes[:start]
+		}
+		off += n
+	}
+	if err := blocks.done(); err != nil {
+		return nil, &ParseError{Offset: off, Err: err}
+	}
+	return prefixes, nil
+}
+
+// Decoder decodes binary sets over and over, e.g. a service reloading a
+// multi-million-entry set, reusing the buffer of the last set read and the
+// slice of its prefixes, so that reloads allocate only when a set outgrows
+// them.
+type Decoder struct {
+	// Options are the options of the decoding.
+	Options DecodeOptions
+
+	data     []byte
+	prefixes []netip.Prefix
+}
+
+// Decode reads the binary set of r and returns its prefixes, valid until
+// the next call of Decode.
+func (d *Decoder) Decode(r io.Reader) ([]netip.Prefix, error) {
+	buf := bytes.NewBuffer(d.data[:0])
+	_, err := buf.ReadFrom(r)
+	d.data = buf.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	d.prefixes, err = DecodeAllInto(d.prefixes[:0], d.data, d.Options)
+	if err != nil {
+		return nil, err
+	}
+	return d.prefixes, nil
+}
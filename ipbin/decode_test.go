@@ -0,0 +1,120 @@
+package ipbin
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeAll(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	buf := AppendMetadata(nil, Metadata{Source: "feed"})
+	for _, ep := range []ExpiringPrefix{
+		{Prefix: netip.MustParsePrefix("1.3.0.0/16")},
+		{Prefix: netip.MustParsePrefix("2001:db8::/32"), Expires: now.Add(-time.Hour)},
+		{Prefix: netip.MustParsePrefix("1.5.5.5/32"), Expires: now.Add(time.Hour)},
+	} {
+		var err error
+		if buf, err = AppendEncodedExpiring(buf, ep); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	got, err := DecodeAll(buf, DecodeOptions{Strict: true, ExpiredAt: now})
+	want := []netip.Prefix{netip.MustParsePrefix("1.3.0.0/16"), netip.MustParsePrefix("1.5.5.5/32")}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeAll got %v, %v", got, err)
+	}
+	if got, err := DecodeAll(buf, DecodeOptions{}); err != nil || len(got) != 3 {
+		t.Errorf("DecodeAll without expiry got %v, %v", got, err)
+	}
+	if _, err := DecodeAll(buf, DecodeOptions{MaxRecords: 2}); !errors.Is(err, ErrTooManyRecords) {
+		t.Errorf("DecodeAll with 2 records at most got %v", err)
+	}
+	if got, err := DecodeAll(buf, DecodeOptions{MaxRecords: -1}); err != nil || len(got) != 3 {
+		t.Errorf("DecodeAll unlimited got %v, %v", got, err)
+	}
+
+	// 1.2.3.1/31 has its host bit set
+	nonCanonical := []byte{16, 1, 3, 31, 1, 2, 3, 1}
+	if got, err := DecodeAll(nonCanonical, DecodeOptions{}); err != nil || len(got) != 2 {
+		t.Errorf("DecodeAll of non-canonical records got %v, %v", got, err)
+	}
+	if _, err := DecodeAll(nonCanonical, DecodeOptions{Strict: true}); !errors.Is(err, ErrNonCanonical) || err.Error() != "offset 3: non-canonical prefix record" {
+		t.Errorf("strict DecodeAll of non-canonical records got %v", err)
+	}
+	if _, _, err := ReadPrefixFromBytesStrict(nonCanonical[3:]); err != ErrNonCanonical {
+		t.Errorf("ReadPrefixFromBytesStrict got %v", err)
+	}
+	if _, err := DecodeAll([]byte{16, 1, 3, 200}, DecodeOptions{}); err == nil {
+		t.Errorf("invalid header expected error")
+	}
+}
+
+func FuzzDecodeAll(f *testing.F) {
+	for _, tc := range cases {
+		f.Add(tc.b)
+	}
+	f.Add(AppendMetadata([]byte(nil), Metadata{Source: "feed", SHA256: make([]byte, 32)}))
+	f.Add([]byte{ExpiryHeader, 0, 0, 0, 0, 0x65, 0x92, 0x00, 0x80, 16, 1, 3})
+	f.Add([]byte{31, 1, 2, 3, 1})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		prefixes, err := DecodeAll(b, DecodeOptions{Strict: true, MaxRecords: 1000})
+		if err != nil {
+			return
+		}
+		for _, p := range prefixes {
+			if p != p.Masked() {
+				t.Errorf("strict DecodeAll returned non-canonical %v", p)
+			}
+		}
+		// Plain canonical records of format v1 encode back to themselves
+		var out []byte
+		for rest := b; len(rest) > 0; {
+			if rest[0] == ZeroRunHeader {
+				return
+			}
+			p, n, err := ReadPrefixFromBytesStrict(rest)
+			if err != nil {
+				return
+			}
+			if out, err = AppendEncoded(out, p); err != nil {
+				t.Error(err)
+				return
+			}
+			rest = rest[n:]
+		}
+		if !bytes.Equal(out, b) {
+			t.Errorf("re-encoding %x got %x", b, out)
+		}
+	})
+}
+
+func TestDecodeAllInto(t *testing.T) {
+	var buf []byte
+	for _, s := range []string{"1.3.0.0/16", "2001:db8::/32"} {
+		buf, _ = AppendEncoded(buf, netip.MustParsePrefix(s))
+	}
+	dst := make([]netip.Prefix, 1, 8)
+	dst[0] = netip.MustParsePrefix("10.0.0.0/8")
+	got, err := DecodeAllInto(dst, buf, DecodeOptions{})
+	want := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("1.3.0.0/16"), netip.MustParsePrefix("2001:db8::/32")}
+	if err != nil || !reflect.DeepEqual(got, want) || &got[0] != &dst[0] {
+		t.Errorf("DecodeAllInto got %v, %v", got, err)
+	}
+	if got, err := DecodeAllInto(dst, append(buf, 200), DecodeOptions{}); err == nil || len(got) != 1 {
+		t.Errorf("DecodeAllInto of a bad record got %v, %v", got, err)
+	}
+
+	var d Decoder
+	first, err := d.Decode(bytes.NewReader(buf))
+	if err != nil || !reflect.DeepEqual(first, want[1:]) {
+		t.Errorf("Decode got %v, %v", first, err)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { d.Decode(bytes.NewReader(buf)) }); allocs > 1 {
+		t.Errorf("Decode allocated %v times again", allocs)
+	}
+}
@@ -0,0 +1,67 @@
+package ipbin
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrDefaultRoute is returned for a default route, 0.0.0.0/0 or ::/0, in
+// input read with DefaultRouteReject.
+var ErrDefaultRoute = errors.New("default route")
+
+// DefaultRoutePolicy says what to do with the default routes 0.0.0.0/0 and
+// ::/0 in input. Merged with anything else, a default route swallows its
+// whole address family, so a single stray one, from a typo or a poisoned
+// feed, turns a blocklist into "block everything".
+type DefaultRoutePolicy int
+
+const (
+	DefaultRouteAllow  DefaultRoutePolicy = iota // kept like any other prefix
+	DefaultRouteReject                           // an error wrapping ErrDefaultRoute
+	DefaultRouteDrop                             // dropped from the input
+)
+
+var defaultRoutePolicyNames = []string{
+	DefaultRouteAllow:  "allow",
+	DefaultRouteReject: "reject",
+	DefaultRouteDrop:   "drop",
+}
+
+func (p DefaultRoutePolicy) String() string {
+	if p >= 0 && int(p) < len(defaultRoutePolicyNames) {
+		return defaultRoutePolicyNames[p]
+	}
+	return "DefaultRoutePolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// ParseDefaultRoutePolicy returns the policy named s: "allow", "reject" or
+// "drop".
+func ParseDefaultRoutePolicy(s string) (DefaultRoutePolicy, error) {
+	if i := slices.Index(defaultRoutePolicyNames, strings.ToLower(s)); i >= 0 {
+		return DefaultRoutePolicy(i), nil
+	}
+	return 0, fmt.Errorf("unknown default route policy: %s", s)
+}
+
+// IsDefaultRoute reports whether p is 0.0.0.0/0 or ::/0.
+func IsDefaultRoute(p netip.Prefix) bool {
+	return p.IsValid() && p.Bits() == 0
+}
+
+// ApplyDefaultRoutePolicy applies policy to the default routes of prefixes,
+// dropping them in place with DefaultRouteDrop.
+func ApplyDefaultRoutePolicy(prefixes []netip.Prefix, policy DefaultRoutePolicy) ([]netip.Prefix, error) {
+	switch policy {
+	case DefaultRouteReject:
+		if i := slices.IndexFunc(prefixes, IsDefaultRoute); i >= 0 {
+			return nil, fmt.Errorf("entry %d: %w %s (allow it explicitly if intended)", i+1, ErrDefaultRoute, prefixes[i])
+		}
+	case DefaultRouteDrop:
+		return slices.DeleteFunc(prefixes, IsDefaultRoute), nil
+	}
+	return prefixes, nil
+}
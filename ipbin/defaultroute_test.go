@@ -0,0 +1,47 @@
+package ipbin
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDefaultRoutePolicy(t *testing.T) {
+	for _, name := range []string{"allow", "reject", "drop"} {
+		p, err := ParseDefaultRoutePolicy(name)
+		if err != nil || p.String() != name {
+			t.Errorf("ParseDefaultRoutePolicy(%s) = %v, %v", name, p, err)
+		}
+	}
+	if _, err := ParseDefaultRoutePolicy("keep"); err == nil {
+		t.Errorf("unknown policy expected error")
+	}
+
+	input := "192.0.2.0/24\n0.0.0.0/0\n2001:db8::/32\n::/0\n"
+	parse, _ := InputFormat("text")
+	nets, err := parse(strings.NewReader(input), ParseOptions{})
+	if err != nil || len(nets) != 4 {
+		t.Errorf("allow got %v, %v", nets, err)
+	}
+	if _, err := parse(strings.NewReader(input), ParseOptions{DefaultRoutes: DefaultRouteReject}); !errors.Is(err, ErrDefaultRoute) || !strings.Contains(err.Error(), "entry 2") {
+		t.Errorf("reject got %v", err)
+	}
+	want := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("2001:db8::/32")}
+	if nets, err := parse(strings.NewReader(input), ParseOptions{DefaultRoutes: DefaultRouteDrop}); err != nil || !reflect.DeepEqual(nets, want) {
+		t.Errorf("drop got %v, %v", nets, err)
+	}
+
+	// 0.0.0.0/0 is the single byte 0
+	records := []byte{24, 192, 0, 2, 0}
+	if _, err := DecodeAll(records, DecodeOptions{DefaultRoutes: DefaultRouteReject}); !errors.Is(err, ErrDefaultRoute) || !strings.Contains(err.Error(), "offset 4") {
+		t.Errorf("decode reject got %v", err)
+	}
+	if nets, err := DecodeAll(records, DecodeOptions{DefaultRoutes: DefaultRouteDrop}); err != nil || !reflect.DeepEqual(nets, want[:1]) {
+		t.Errorf("decode drop got %v, %v", nets, err)
+	}
+	if nets, err := DecodeAll(records, DecodeOptions{}); err != nil || len(nets) != 2 {
+		t.Errorf("decode allow got %v, %v", nets, err)
+	}
+}
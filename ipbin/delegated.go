@@ -0,0 +1,155 @@
+package ipbin
+
+import (
+	"bufio"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Delegation is an address block record of an RIR statistics exchange
+// file ("delegated-<rir>-latest").
+type Delegation struct {
+	Registry string // e.g. "ripencc", "arin"
+	Country  string // ISO 3166 country code, empty if unknown
+	Status   string // e.g. "allocated", "assigned", "available", "reserved"
+	Range    netipx.IPRange
+}
+
+// ParseDelegatedStats parses an RIR statistics exchange file
+// (https://www.nro.net/wp-content/uploads/nro-extended-stats-readme5.txt),
+// standard or extended, returning its ipv4 and ipv6 records. Header,
+// summary and asn records are skipped.
+func ParseDelegatedStats(r io.Reader) (ds []Delegation, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := normalizeLine(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		if len(fields) < 7 || (fields[2] != "ipv4" && fields[2] != "ipv6") || fields[1] == "*" {
+			continue
+		}
+		start, err := netip.ParseAddr(fields[3])
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseUint(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delegated stats value in %q", line)
+		}
+		var rng netipx.IPRange
+		if fields[2] == "ipv4" {
+			first := uint64(ipv4ToUint32(start))
+			if !start.Is4() || value == 0 || first+value-1 > 0xffffffff {
+				return nil, fmt.Errorf("invalid delegated stats ipv4 record %q", line)
+			}
+			rng = netipx.IPRangeFrom(start, uint32ToIPv4(uint32(first+value-1)))
+		} else {
+			prefix, err := start.Prefix(int(value))
+			if err != nil || !start.Is6() {
+				return nil, fmt.Errorf("invalid delegated stats ipv6 record %q", line)
+			}
+			rng = netipx.RangeOfPrefix(prefix)
+		}
+		cc := strings.ToUpper(fields[1])
+		if cc == "ZZ" {
+			cc = ""
+		}
+		ds = append(ds, Delegation{Registry: fields[0], Country: cc, Status: fields[6], Range: rng})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+func ipv4ToUint32(a netip.Addr) uint32 {
+	ip := a.As4()
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
+
+func uint32ToIPv4(u uint32) netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(u >> 24), byte(u >> 16), byte(u >> 8), byte(u)})
+}
+
+// DelegationMap annotates prefixes with the registry ("rir" attribute) and
+// country ("country" attribute) of the delegation containing them.
+// DelegationMap implements Annotator and Splitter.
+type DelegationMap struct {
+	ds []Delegation // sorted by range start
+}
+
+// NewDelegationMap returns a DelegationMap of ds, which should not overlap.
+func NewDelegationMap(ds []Delegation) *DelegationMap {
+	ds = slices.Clone(ds)
+	slices.SortFunc(ds, func(a, b Delegation) int {
+		return a.Range.From().Compare(b.Range.From())
+	})
+	return &DelegationMap{ds: ds}
+}
+
+// first returns the index of the first delegation ending at or after a.
+func (m *DelegationMap) first(a netip.Addr) int {
+	i, _ := slices.BinarySearchFunc(m.ds, a, func(d Delegation, a netip.Addr) int {
+		return d.Range.From().Compare(a)
+	})
+	if i > 0 && m.ds[i-1].Range.To().Compare(a) >= 0 {
+		i--
+	}
+	return i
+}
+
+func (m *DelegationMap) Annotate(p netip.Prefix) (map[string]string, error) {
+	attrs := map[string]string{}
+	a := p.Masked().Addr()
+	if i := m.first(a); i < len(m.ds) && m.ds[i].Range.Contains(a) {
+		attrs["rir"] = m.ds[i].Registry
+		if m.ds[i].Country != "" {
+			attrs["country"] = m.ds[i].Country
+		}
+	}
+	return attrs, nil
+}
+
+// Split divides p at the boundaries of the delegations it overlaps.
+func (m *DelegationMap) Split(p netip.Prefix) ([]netip.Prefix, error) {
+	pr := netipx.RangeOfPrefix(p)
+	var pieces []netipx.IPRange
+	cursor := pr.From()
+	for i := m.first(pr.From()); i < len(m.ds) && cursor.IsValid() && cursor.Compare(pr.To()) <= 0; i++ {
+		d := m.ds[i].Range
+		if d.From().Compare(pr.To()) > 0 {
+			break
+		}
+		if d.To().Compare(cursor) < 0 {
+			continue
+		}
+		if d.From().Compare(cursor) > 0 {
+			pieces = append(pieces, netipx.IPRangeFrom(cursor, d.From().Prev()))
+			cursor = d.From()
+		}
+		end := d.To()
+		if end.Compare(pr.To()) > 0 {
+			end = pr.To()
+		}
+		pieces = append(pieces, netipx.IPRangeFrom(cursor, end))
+		cursor = end.Next()
+	}
+	if len(pieces) == 0 || (len(pieces) == 1 && pieces[0] == pr) {
+		return []netip.Prefix{p.Masked()}, nil
+	}
+	if cursor.IsValid() && cursor.Compare(pr.To()) <= 0 {
+		pieces = append(pieces, netipx.IPRangeFrom(cursor, pr.To()))
+	}
+	var out []netip.Prefix
+	for _, r := range pieces {
+		out = r.AppendPrefixes(out)
+	}
+	return out, nil
+}
@@ -0,0 +1,71 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDelegated = `2|ripencc|1700000000|3|19830705|20240101|+0100
+ripencc|*|ipv4|*|2|summary
+ripencc|*|ipv6|*|1|summary
+ripencc|FR|ipv4|2.0.0.0|1048576|20100712|allocated
+ripencc|DE|ipv4|2.16.0.0|768|20100725|allocated
+ripencc|NL|asn|1101|1|19930901|allocated
+ripencc||ipv4|2.16.3.0|256||available
+ripencc|DE|ipv6|2001:db8::|32|20020801|allocated
+`
+
+func TestParseDelegatedStats(t *testing.T) {
+	ds, err := ParseDelegatedStats(strings.NewReader(testDelegated))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(ds) != 4 {
+		t.Errorf("got %d delegations, want 4", len(ds))
+		return
+	}
+	if got := ds[1].Range.String(); got != "2.16.0.0-2.16.2.255" {
+		t.Errorf("ipv4 range got %s", got)
+	}
+	if got := ds[3].Range.String(); got != "2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff" {
+		t.Errorf("ipv6 range got %s", got)
+	}
+	if ds[2].Country != "" || ds[2].Status != "available" {
+		t.Errorf("available record got %+v", ds[2])
+	}
+}
+
+func TestDelegationMap(t *testing.T) {
+	ds, err := ParseDelegatedStats(strings.NewReader(testDelegated))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ipset, err := MergePrefixes([]netip.Prefix{
+		netip.MustParsePrefix("2.15.255.0/24"),
+		netip.MustParsePrefix("2.16.0.0/22"),
+		netip.MustParsePrefix("198.51.100.0/24"),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	aps, err := Annotate(ipset, NewDelegationMap(ds))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []AnnotatedPrefix{
+		{netip.MustParsePrefix("2.15.255.0/24"), map[string]string{"rir": "ripencc", "country": "FR"}},
+		{netip.MustParsePrefix("2.16.0.0/23"), map[string]string{"rir": "ripencc", "country": "DE"}},
+		{netip.MustParsePrefix("2.16.2.0/24"), map[string]string{"rir": "ripencc", "country": "DE"}},
+		{netip.MustParsePrefix("2.16.3.0/24"), map[string]string{"rir": "ripencc"}},
+		{netip.MustParsePrefix("198.51.100.0/24"), map[string]string{}},
+	}
+	if !reflect.DeepEqual(aps, want) {
+		t.Errorf("Annotate got %v, want %v", aps, want)
+	}
+}
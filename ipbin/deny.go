@@ -0,0 +1,48 @@
+package ipbin
+
+import (
+	"net/netip"
+	"strconv"
+)
+
+// NginxDeny returns an nginx access module directive denying prefix p.
+//
+// Example:
+//   - 192.0.2.0/24 → deny 192.0.2.0/24;
+func NginxDeny(p netip.Prefix) string {
+	return "deny " + FormatPrefixCompact(p) + ";"
+}
+
+// ApacheRequireNotIP returns an Apache mod_authz_host directive excluding
+// prefix p. The directives must be placed in a <RequireAll> block that
+// also grants access, e.g. with "Require all granted".
+//
+// Example:
+//   - 192.0.2.0/24 → Require not ip 192.0.2.0/24
+func ApacheRequireNotIP(p netip.Prefix) string {
+	return "Require not ip " + FormatPrefixCompact(p)
+}
+
+// HostsDenyRecord returns a hosts.deny(5) rule denying access to daemon
+// (e.g. "ALL", "sshd") from prefix p. IPv4 networks are written as
+// address/netmask and IPv6 addresses in brackets, as understood by
+// tcp_wrappers.
+//
+// Example:
+//   - 192.0.2.0/24 → ALL: 192.0.2.0/255.255.255.0
+//   - 2001:db8::/32 → ALL: [2001:db8::]/32
+func HostsDenyRecord(p netip.Prefix, daemon string) string {
+	p = p.Masked()
+	var client string
+	switch {
+	case p.Addr().Is4() && p.IsSingleIP():
+		client = p.Addr().String()
+	case p.Addr().Is4():
+		client = p.Addr().String() + "/" + netmask4(p.Bits())
+	case p.IsSingleIP():
+		client = "[" + p.Addr().String() + "]"
+	default:
+		client = "[" + p.Addr().String() + "]/" + strconv.Itoa(p.Bits())
+	}
+	return daemon + ": " + client
+}
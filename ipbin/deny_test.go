@@ -0,0 +1,32 @@
+package ipbin
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestDenyRecords(t *testing.T) {
+	cases := []struct {
+		prefix    string
+		nginx     string
+		apache    string
+		hostsDeny string
+	}{
+		{"192.0.2.0/24", "deny 192.0.2.0/24;", "Require not ip 192.0.2.0/24", "ALL: 192.0.2.0/255.255.255.0"},
+		{"192.0.2.1/32", "deny 192.0.2.1;", "Require not ip 192.0.2.1", "ALL: 192.0.2.1"},
+		{"2001:db8::/32", "deny 2001:db8::/32;", "Require not ip 2001:db8::/32", "ALL: [2001:db8::]/32"},
+		{"2001:db8::1/128", "deny 2001:db8::1;", "Require not ip 2001:db8::1", "ALL: [2001:db8::1]"},
+	}
+	for _, c := range cases {
+		p := netip.MustParsePrefix(c.prefix)
+		if got := NginxDeny(p); got != c.nginx {
+			t.Errorf("NginxDeny(%s) got %q, want %q", c.prefix, got, c.nginx)
+		}
+		if got := ApacheRequireNotIP(p); got != c.apache {
+			t.Errorf("ApacheRequireNotIP(%s) got %q, want %q", c.prefix, got, c.apache)
+		}
+		if got := HostsDenyRecord(p, "ALL"); got != c.hostsDeny {
+			t.Errorf("HostsDenyRecord(%s) got %q, want %q", c.prefix, got, c.hostsDeny)
+		}
+	}
+}
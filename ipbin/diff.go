@@ -0,0 +1,35 @@
+package ipbin
+
+import (
+	"net/netip"
+)
+
+// DiffPrefixes compares two prefix lists entry by entry and returns the
+// prefixes present in next but not in prev (added) and the prefixes present
+// in prev but not in next (removed).
+//
+// Prefixes are compared exactly, not by the addresses they cover: replacing
+// 10.0.0.0/24 with 10.0.0.0/25 and 10.0.0.128/25 reports one removed and two
+// added prefixes. This matches how routes or firewall entries generated from
+// the lists have to be updated.
+//
+// Results keep the order of the input lists.
+func DiffPrefixes(prev, next []netip.Prefix) (added, removed []netip.Prefix) {
+	prevSet := make(map[netip.Prefix]struct{}, len(prev))
+	for _, p := range prev {
+		prevSet[p] = struct{}{}
+	}
+	nextSet := make(map[netip.Prefix]struct{}, len(next))
+	for _, p := range next {
+		nextSet[p] = struct{}{}
+		if _, ok := prevSet[p]; !ok {
+			added = append(added, p)
+		}
+	}
+	for _, p := range prev {
+		if _, ok := nextSet[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	return added, removed
+}
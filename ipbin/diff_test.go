@@ -0,0 +1,40 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestDiffPrefixes(t *testing.T) {
+	prev := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	next := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/25"),
+		netip.MustParsePrefix("10.0.0.128/25"),
+		netip.MustParsePrefix("192.0.2.0/24"),
+	}
+	added, removed := DiffPrefixes(prev, next)
+	wantAdded := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/25"),
+		netip.MustParsePrefix("10.0.0.128/25"),
+	}
+	wantRemoved := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	if !reflect.DeepEqual(added, wantAdded) {
+		t.Errorf("added got %v, want %v", added, wantAdded)
+	}
+	if !reflect.DeepEqual(removed, wantRemoved) {
+		t.Errorf("removed got %v, want %v", removed, wantRemoved)
+	}
+
+	added, removed = DiffPrefixes(next, next)
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("DiffPrefixes of equal lists got added %v, removed %v", added, removed)
+	}
+}
@@ -0,0 +1,281 @@
+package ipbin
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EncryptedMagic starts the files written by Encrypt.
+//
+// An encrypted file is the magic, the number of recipients as a byte, then
+// for each recipient an ephemeral X25519 public key (32 bytes) and the
+// AES-256-GCM encrypted file key (48 bytes), then the HMAC-SHA256 of this
+// header (32 bytes), a random nonce (12 bytes) and the AES-256-GCM
+// encrypted content, authenticating the header and its MAC as additional
+// data. The key encrypting the file key is derived with HKDF-SHA256 from
+// the X25519 shared secret of the ephemeral key and the recipient, and the
+// keys of the MAC and the content from the file key, like age does, so
+// that a recipient cannot alter the stanzas of the others unnoticed.
+const EncryptedMagic = "IPBE\x02"
+
+const (
+	identityPrefix  = "IPBIN-IDENTITY-"
+	recipientPrefix = "ipbin-recipient-"
+	fileKeySize     = 32
+	stanzaSize      = 32 + fileKeySize + 16
+	headerMACSize   = sha256.Size
+)
+
+// ErrNoIdentity is returned by Decrypt when none of the identities is a
+// recipient of the file.
+var ErrNoIdentity = errors.New("no identity matches a recipient of the file")
+
+// Identity is the X25519 private key decrypting the files encrypted to its
+// Recipient.
+type Identity struct {
+	key *ecdh.PrivateKey
+}
+
+// Recipient is the X25519 public key files are encrypted to.
+type Recipient struct {
+	key *ecdh.PublicKey
+}
+
+// GenerateIdentity returns a new random identity.
+func GenerateIdentity() (*Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{key}, nil
+}
+
+// ParseIdentity parses an identity written by Identity.String.
+func ParseIdentity(s string) (*Identity, error) {
+	b, err := parseKeyString(s, identityPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	return &Identity{key}, nil
+}
+
+// String returns the identity as "IPBIN-IDENTITY-" followed by the
+// base64url-encoded key.
+func (id *Identity) String() string {
+	return identityPrefix + base64.RawURLEncoding.EncodeToString(id.key.Bytes())
+}
+
+// Recipient returns the recipient of the identity.
+func (id *Identity) Recipient() *Recipient {
+	return &Recipient{id.key.PublicKey()}
+}
+
+// ParseRecipient parses a recipient written by Recipient.String.
+func ParseRecipient(s string) (*Recipient, error) {
+	b, err := parseKeyString(s, recipientPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	return &Recipient{key}, nil
+}
+
+// String returns the recipient as "ipbin-recipient-" followed by the
+// base64url-encoded key.
+func (r *Recipient) String() string {
+	return recipientPrefix + base64.RawURLEncoding.EncodeToString(r.key.Bytes())
+}
+
+func parseKeyString(s, prefix string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, prefix) {
+		return nil, fmt.Errorf("missing %s prefix", prefix)
+	}
+	return base64.RawURLEncoding.DecodeString(s[len(prefix):])
+}
+
+// wrapKey derives the key encrypting the file key from the X25519 shared
+// secret, with HKDF-SHA256 bound to both public keys.
+func wrapKey(secret, ephemeral, recipient []byte) ([]byte, error) {
+	return hkdf.Key(sha256.New, secret, append(bytes.Clone(ephemeral), recipient...), "ipbin X25519", fileKeySize)
+}
+
+// headerMAC returns the HMAC-SHA256 of the header of an encrypted file,
+// under a key derived from the file key.
+func headerMAC(fileKey, header []byte) ([]byte, error) {
+	key, err := hkdf.Key(sha256.New, fileKey, nil, "ipbin header", sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(header)
+	return mac.Sum(nil), nil
+}
+
+// payloadKey derives the key encrypting the content from the file key and
+// the nonce of the content.
+func payloadKey(fileKey, nonce []byte) ([]byte, error) {
+	return hkdf.Key(sha256.New, fileKey, nonce, "ipbin payload", fileKeySize)
+}
+
+func sealGCM(key, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+func openGCM(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// IsEncrypted reports whether b starts like a file written by Encrypt, of
+// any version.
+func IsEncrypted(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(EncryptedMagic[:len(EncryptedMagic)-1]))
+}
+
+// Encrypt encrypts plaintext, e.g. a binary set, so that any of recipients
+// can decrypt it.
+func Encrypt(plaintext []byte, recipients ...*Recipient) ([]byte, error) {
+	if len(recipients) == 0 || len(recipients) > 255 {
+		return nil, fmt.Errorf("encryption requires 1 to 255 recipients, got %d", len(recipients))
+	}
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+	out := append([]byte(EncryptedMagic), byte(len(recipients)))
+	zeroNonce := make([]byte, 12) // each wrapping key is used once
+	for _, r := range recipients {
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := ephemeral.ECDH(r.key)
+		if err != nil {
+			return nil, err
+		}
+		key, err := wrapKey(secret, ephemeral.PublicKey().Bytes(), r.key.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := sealGCM(key, zeroNonce, fileKey, nil)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ephemeral.PublicKey().Bytes()...)
+		out = append(out, wrapped...)
+	}
+	mac, err := headerMAC(fileKey, out)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, mac...)
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key, err := payloadKey(fileKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := sealGCM(key, nonce, plaintext, out)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return append(out, ciphertext...), nil
+}
+
+// Decrypt decrypts a file written by Encrypt with the first of identities
+// being one of its recipients.
+func Decrypt(ciphertext []byte, identities ...*Identity) ([]byte, error) {
+	if !IsEncrypted(ciphertext) || len(ciphertext) < len(EncryptedMagic)+1 {
+		return nil, fmt.Errorf("not an encrypted file")
+	}
+	if v := ciphertext[len(EncryptedMagic)-1]; v != EncryptedMagic[len(EncryptedMagic)-1] {
+		return nil, fmt.Errorf("unsupported encrypted file version %d", v)
+	}
+	b := ciphertext[len(EncryptedMagic):]
+	n := int(b[0])
+	b = b[1:]
+	if len(b) < n*stanzaSize+headerMACSize+12 {
+		return nil, fmt.Errorf("truncated encrypted file")
+	}
+	stanzas, b := b[:n*stanzaSize], b[n*stanzaSize:]
+	headerEnd := len(EncryptedMagic) + 1 + n*stanzaSize
+	header, mac := ciphertext[:headerEnd], ciphertext[headerEnd:headerEnd+headerMACSize]
+	b = b[headerMACSize:]
+	zeroNonce := make([]byte, 12)
+	var fileKey []byte
+	for _, id := range identities {
+		for i := 0; i < n && fileKey == nil; i++ {
+			stanza := stanzas[i*stanzaSize : (i+1)*stanzaSize]
+			ephemeral, err := ecdh.X25519().NewPublicKey(stanza[:32])
+			if err != nil {
+				return nil, err
+			}
+			secret, err := id.key.ECDH(ephemeral)
+			if err != nil {
+				continue
+			}
+			key, err := wrapKey(secret, stanza[:32], id.key.PublicKey().Bytes())
+			if err != nil {
+				return nil, err
+			}
+			// A failed authentication means another recipient
+			fileKey, _ = openGCM(key, zeroNonce, stanza[32:], nil)
+		}
+	}
+	if fileKey == nil {
+		return nil, ErrNoIdentity
+	}
+	// The stanzas of the other recipients, not authenticated by ours
+	want, err := headerMAC(fileKey, header)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, want) {
+		return nil, fmt.Errorf("encrypted file header does not match its MAC")
+	}
+	key, err := payloadKey(fileKey, b[:12])
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openGCM(key, b[:12], b[12:], ciphertext[:headerEnd+headerMACSize])
+	if err != nil {
+		return nil, fmt.Errorf("decrypting file: %w", err)
+	}
+	return plaintext, nil
+}
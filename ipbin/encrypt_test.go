@@ -0,0 +1,75 @@
+package ipbin
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncrypt(t *testing.T) {
+	alice, err := GenerateIdentity()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	bob, err := GenerateIdentity()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	eve, err := GenerateIdentity()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	plaintext := []byte{24, 192, 0, 2, 32, 198, 51, 100, 7}
+	ciphertext, err := Encrypt(plaintext, alice.Recipient(), bob.Recipient())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !IsEncrypted(ciphertext) || bytes.Contains(ciphertext, plaintext) {
+		t.Errorf("ciphertext not encrypted: %x", ciphertext)
+	}
+	for _, id := range []*Identity{alice, bob} {
+		got, err := Decrypt(ciphertext, eve, id)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("Decrypt got %v, %v", got, err)
+		}
+	}
+	if _, err := Decrypt(ciphertext, eve); err != ErrNoIdentity {
+		t.Errorf("Decrypt with another identity got %v", err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := Decrypt(ciphertext, alice); err == nil {
+		t.Errorf("Decrypt of modified ciphertext expected error")
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+
+	// Tampering with the stanza of bob, or the header MAC, is detected by alice
+	for _, i := range []int{len(EncryptedMagic) + 1 + stanzaSize + 40, len(EncryptedMagic) + 1 + 2*stanzaSize} {
+		ciphertext[i] ^= 1
+		if _, err := Decrypt(ciphertext, alice); err == nil {
+			t.Errorf("Decrypt with byte %d modified expected error", i)
+		}
+		ciphertext[i] ^= 1
+	}
+	if _, err := Decrypt(ciphertext, alice); err != nil {
+		t.Errorf("Decrypt of restored ciphertext got %v", err)
+	}
+	v1 := append([]byte("IPBE\x01"), ciphertext[len(EncryptedMagic):]...)
+	if _, err := Decrypt(v1, alice); !IsEncrypted(v1) || err == nil {
+		t.Errorf("Decrypt of version 1 got %v", err)
+	}
+
+	id, err := ParseIdentity(alice.String())
+	if err != nil || id.String() != alice.String() {
+		t.Errorf("ParseIdentity got %v, %v", id, err)
+	}
+	r, err := ParseRecipient(alice.Recipient().String() + "\n")
+	if err != nil || r.String() != alice.Recipient().String() {
+		t.Errorf("ParseRecipient got %v, %v", r, err)
+	}
+	if _, err := ParseRecipient(alice.String()); err == nil {
+		t.Errorf("ParseRecipient of an identity expected error")
+	}
+}
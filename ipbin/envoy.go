@@ -0,0 +1,25 @@
+package ipbin
+
+import "net/netip"
+
+// EnvoyCidrRange is the JSON representation of an Envoy
+// config.core.v3.CidrRange, as used by RBAC principals and permissions
+// (source_ip, direct_remote_ip, destination_ip) and listener filter chain
+// matches.
+type EnvoyCidrRange struct {
+	AddressPrefix string `json:"address_prefix"`
+	PrefixLen     int    `json:"prefix_len"`
+}
+
+// EnvoyCidrRanges converts prefixes into Envoy CidrRanges.
+//
+// Example:
+//   - 192.0.2.0/24 → {"address_prefix": "192.0.2.0", "prefix_len": 24}
+func EnvoyCidrRanges(prefixes []netip.Prefix) []EnvoyCidrRange {
+	out := make([]EnvoyCidrRange, len(prefixes))
+	for i, p := range prefixes {
+		p = p.Masked()
+		out[i] = EnvoyCidrRange{AddressPrefix: p.Addr().String(), PrefixLen: p.Bits()}
+	}
+	return out
+}
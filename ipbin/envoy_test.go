@@ -0,0 +1,23 @@
+package ipbin
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+)
+
+func TestEnvoyCidrRanges(t *testing.T) {
+	ranges := EnvoyCidrRanges([]netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	})
+	data, err := json.Marshal(ranges)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := `[{"address_prefix":"192.0.2.0","prefix_len":24},{"address_prefix":"2001:db8::1","prefix_len":128}]`
+	if string(data) != expected {
+		t.Errorf("got %s, want %s", data, expected)
+	}
+}
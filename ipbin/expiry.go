@@ -0,0 +1,96 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"time"
+)
+
+// ExpiryHeader is the header byte of an expiring record: it is followed by
+// the expiry time as a big-endian uint64 of Unix seconds, then by the
+// encoded prefix.
+const ExpiryHeader = 162
+
+// ExpiringPrefix is a prefix valid until Expires, or forever if Expires is
+// zero.
+type ExpiringPrefix struct {
+	Prefix  netip.Prefix
+	Expires time.Time
+}
+
+// Expired reports whether ep has expired at t.
+func (ep ExpiringPrefix) Expired(t time.Time) bool {
+	return !ep.Expires.IsZero() && !ep.Expires.After(t)
+}
+
+// AppendEncodedExpiring appends the expiring record of ep to dst, or the
+// plain encoded prefix if ep never expires.
+func AppendEncodedExpiring(dst []byte, ep ExpiringPrefix) ([]byte, error) {
+	if !ep.Expires.IsZero() {
+		dst = append(dst, ExpiryHeader)
+		dst = binary.BigEndian.AppendUint64(dst, uint64(ep.Expires.Unix()))
+	}
+	return AppendEncoded(dst, ep.Prefix)
+}
+
+// WriteEncodedExpiring writes the expiring record of ep to w, or the plain
+// encoded prefix if ep never expires.
+func WriteEncodedExpiring(w io.Writer, ep ExpiringPrefix) (int, error) {
+	var buf [1 + 8 + 17]byte
+	b, err := AppendEncodedExpiring(buf[:0], ep)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(b)
+}
+
+// ReadExpiringPrefixFromBytes reads an expiring record or a plain encoded
+// prefix, which never expires, from buf and returns it along with the
+// number of bytes read. The value of a valued record is skipped.
+func ReadExpiringPrefixFromBytes(buf []byte) (ExpiringPrefix, int, error) {
+	_, off, err := readValue(buf)
+	if err != nil {
+		return ExpiringPrefix{}, 0, err
+	}
+	ep, n, err := readExpiringRecord(buf[off:])
+	if err == io.EOF && off > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return ExpiringPrefix{}, 0, err
+	}
+	return ep, off + n, nil
+}
+
+// readExpiringRecord reads an expiring record or a plain encoded prefix
+// from buf.
+func readExpiringRecord(buf []byte) (ExpiringPrefix, int, error) {
+	if len(buf) == 0 || buf[0] != ExpiryHeader {
+		p, n, err := ReadPrefixFromBytes(buf)
+		return ExpiringPrefix{Prefix: p}, n, err
+	}
+	if len(buf) < 1+8 {
+		return ExpiringPrefix{}, 0, io.ErrUnexpectedEOF
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(buf[1:9])), 0).UTC()
+	p, n, err := ReadPrefixFromBytes(buf[9:])
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return ExpiringPrefix{}, 0, err
+	}
+	return ExpiringPrefix{Prefix: p, Expires: expires}, 9 + n, nil
+}
+
+// ExpireBefore returns the prefixes of eps which have not expired at t.
+func ExpireBefore(eps []ExpiringPrefix, t time.Time) []ExpiringPrefix {
+	var out []ExpiringPrefix
+	for _, ep := range eps {
+		if !ep.Expired(t) {
+			out = append(out, ep)
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package ipbin
+
+import (
+	"bytes"
+	"io"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpiringPrefix(t *testing.T) {
+	expires := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	eps := []ExpiringPrefix{
+		{Prefix: netip.MustParsePrefix("1.3.0.0/16"), Expires: expires},
+		{Prefix: netip.MustParsePrefix("2001:db8::/32")},
+		{Prefix: netip.MustParsePrefix("1.5.5.5/32"), Expires: expires.Add(time.Hour)},
+	}
+	var buf bytes.Buffer
+	for _, ep := range eps {
+		if _, err := WriteEncodedExpiring(&buf, ep); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	b := buf.Bytes()
+	if !bytes.Equal(b[:12], []byte{ExpiryHeader, 0, 0, 0, 0, 0x65, 0x92, 0x00, 0x80, 16, 1, 3}) {
+		t.Errorf("got %#v", b[:12])
+	}
+
+	var got []ExpiringPrefix
+	for len(b) > 0 {
+		ep, n, err := ReadExpiringPrefixFromBytes(b)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		got = append(got, ep)
+		b = b[n:]
+	}
+	if !reflect.DeepEqual(got, eps) {
+		t.Errorf("got %v\nwant %v", got, eps)
+	}
+
+	if live := ExpireBefore(eps, expires); !reflect.DeepEqual(live, eps[1:]) {
+		t.Errorf("ExpireBefore got %v", live)
+	}
+	if live := ExpireBefore(eps, expires.Add(-time.Second)); len(live) != 3 {
+		t.Errorf("ExpireBefore got %v", live)
+	}
+
+	if _, _, err := ReadExpiringPrefixFromBytes([]byte{ExpiryHeader, 0, 0, 0, 0, 0x65, 0x92, 0x00, 0x80}); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated record got %v", err)
+	}
+}
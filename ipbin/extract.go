@@ -0,0 +1,64 @@
+package ipbin
+
+import (
+	"bufio"
+	"io"
+	"net/netip"
+	"regexp"
+)
+
+// addrCandidate matches the tokens of text which may be IPv6 or IPv4
+// addresses, checked by netip.ParseAddr.
+var addrCandidate = regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:(?:[0-9]{1,3}\.){3}[0-9]{1,3})?|(?:[0-9]{1,3}\.){3}[0-9]{1,3}`)
+
+// maxExtractLine is the longest line of text ExtractAddrs scans.
+const maxExtractLine = 1 << 20
+
+// ExtractAddrs counts the occurrences of the IPv4 and IPv6 addresses in
+// arbitrary text, e.g. web server logs or syslog. If re is not nil, only
+// the addresses within its matches, or within their first group if it has
+// any, are counted, e.g. `Failed password for .* from (\S+)`.
+func ExtractAddrs(r io.Reader, re *regexp.Regexp) (AddrCounts, error) {
+	counts := AddrCounts{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxExtractLine)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if re == nil {
+			extractLineAddrs(counts, line)
+			continue
+		}
+		for _, m := range re.FindAllStringSubmatchIndex(line, -1) {
+			if len(m) > 2 && m[2] >= 0 {
+				m = m[2:]
+			}
+			extractLineAddrs(counts, line[m[0]:m[1]])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// extractLineAddrs counts the addresses of s, skipping the candidates
+// which are part of a longer token, like a version number or a word.
+func extractLineAddrs(counts AddrCounts, s string) {
+	for _, m := range addrCandidate.FindAllStringIndex(s, -1) {
+		if m[0] > 0 && (isAlnum(s[m[0]-1]) || s[m[0]-1] == '.') {
+			continue
+		}
+		if m[1] < len(s) && (isAlnum(s[m[1]]) || s[m[1]] == '.' && m[1]+1 < len(s) && isAlnum(s[m[1]+1])) {
+			continue
+		}
+		addr, err := netip.ParseAddr(s[m[0]:m[1]])
+		if err != nil || addr.IsUnspecified() {
+			continue
+		}
+		counts.Add(addr)
+	}
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
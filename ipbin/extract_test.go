@@ -0,0 +1,43 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const testLog = `203.0.113.7 - - [10/Oct/2026:13:55:36 +0000] "GET /wp-login.php HTTP/1.1" 404 153 "-" "curl/8.1.2"
+2001:db8::42 - - [10/Oct/2026:13:55:37 +0000] "GET / HTTP/1.1" 200 612 "-" "Mozilla/5.0"
+Oct 10 13:55:38 host sshd[1234]: Failed password for root from 198.51.100.23 port 52231 ssh2
+Oct 10 13:55:39 host sshd[1234]: Failed password for invalid user admin from 198.51.100.23 port 52232 ssh2
+Oct 10 13:55:40 host sshd[1234]: Accepted publickey for deploy from 192.0.2.10 port 40000 ssh2
+Oct 10 13:55:41 host kernel: version 1.2.3.4.5, mac aa:bb:cc:dd:ee:ff, std::vector, peer [2001:db8::1]:443 via 10.0.0.1:8080.
+`
+
+func TestExtractAddrs(t *testing.T) {
+	counts, err := ExtractAddrs(strings.NewReader(testLog), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := AddrCounts{
+		netip.MustParseAddr("203.0.113.7"):   1,
+		netip.MustParseAddr("2001:db8::42"):  1,
+		netip.MustParseAddr("198.51.100.23"): 2,
+		netip.MustParseAddr("192.0.2.10"):    1,
+		netip.MustParseAddr("2001:db8::1"):   1,
+		netip.MustParseAddr("10.0.0.1"):      1,
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("got %v\nwant %v", counts, expected)
+	}
+
+	counts, err = ExtractAddrs(strings.NewReader(testLog), regexp.MustCompile(`Failed password for .* from (\S+)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (AddrCounts{netip.MustParseAddr("198.51.100.23"): 2}); !reflect.DeepEqual(counts, want) {
+		t.Errorf("with regex got %v, want %v", counts, want)
+	}
+}
@@ -0,0 +1,34 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+)
+
+// FilterWithin returns the part of ipset inside scopes. Prefixes of ipset
+// straddling a scope boundary are cut down to the addresses inside it.
+func FilterWithin(ipset, scopes *netipx.IPSet) (*netipx.IPSet, error) {
+	var b netipx.IPSetBuilder
+	b.AddSet(ipset)
+	b.Intersect(scopes)
+	return b.IPSet()
+}
+
+// FilterOutside returns the part of ipset outside scopes.
+func FilterOutside(ipset, scopes *netipx.IPSet) (*netipx.IPSet, error) {
+	var b netipx.IPSetBuilder
+	b.AddSet(ipset)
+	b.RemoveSet(scopes)
+	return b.IPSet()
+}
+
+// FilterIntersecting returns the prefixes of ipset overlapping scopes, in
+// full: unlike FilterWithin, a prefix partly inside a scope is kept whole.
+func FilterIntersecting(ipset, scopes *netipx.IPSet) (*netipx.IPSet, error) {
+	var b netipx.IPSetBuilder
+	for _, p := range ipset.Prefixes() {
+		if scopes.OverlapsPrefix(p) {
+			b.AddPrefix(p)
+		}
+	}
+	return b.IPSet()
+}
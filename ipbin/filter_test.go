@@ -0,0 +1,51 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	ipset, err := MergePrefixes([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/23"),
+		netip.MustParsePrefix("192.0.2.7/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	scopes, err := MergePrefixes([]netip.Prefix{
+		netip.MustParsePrefix("10.0.1.0/24"),
+		netip.MustParsePrefix("2000::/3"),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	cases := []struct {
+		name     string
+		filter   func(ipset, scopes *netipx.IPSet) (*netipx.IPSet, error)
+		expected []string
+	}{
+		{"within", FilterWithin, []string{"10.0.1.0/24", "2001:db8::/32"}},
+		{"outside", FilterOutside, []string{"10.0.0.0/24", "192.0.2.7/32"}},
+		{"intersecting", FilterIntersecting, []string{"10.0.0.0/23", "2001:db8::/32"}},
+	}
+	for _, c := range cases {
+		got, err := c.filter(ipset, scopes)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		var expected []netip.Prefix
+		for _, s := range c.expected {
+			expected = append(expected, netip.MustParsePrefix(s))
+		}
+		if !reflect.DeepEqual(got.Prefixes(), expected) {
+			t.Errorf("%s got %v\nwant %v", c.name, got.Prefixes(), expected)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package ipbin
+
+import (
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Params holds the format-specific options of parsers and renderers, keyed
+// by option name (the ipbin command passes its flags, e.g. "rpz-action").
+type Params map[string]string
+
+// Get returns the value of key, or def if key is not set.
+func (p Params) Get(key, def string) string {
+	if v, ok := p[key]; ok {
+		return v
+	}
+	return def
+}
+
+// Int returns the value of key as an int, or def if key is not set.
+func (p Params) Int(key string, def int) (int, error) {
+	v, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q", key, v)
+	}
+	return n, nil
+}
+
+// Bool returns the value of key as a bool, or false if key is not set.
+func (p Params) Bool(key string) (bool, error) {
+	v, ok := p[key]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q", key, v)
+	}
+	return b, nil
+}
+
+// List returns the comma-separated values of key, ignoring empty items.
+func (p Params) List(key string) []string {
+	var out []string
+	for _, item := range strings.Split(p[key], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// ParseOptions configures a ParserFunc.
+type ParseOptions struct {
+	Params Params
+	// MaxEntries is the maximum number of prefixes parsed, unlimited if 0.
+	// Parsing more fails with ErrTooManyRecords.
+	MaxEntries int
+	// MaxBytes is the maximum size of the input read, unlimited if 0.
+	// Reading more fails with ErrInputTooLarge.
+	MaxBytes int64
+	// DefaultRoutes is the policy for 0.0.0.0/0 and ::/0 in the input,
+	// allowed by default.
+	DefaultRoutes DefaultRoutePolicy
+	// Resolver, if set, resolves the host names of text input into their
+	// addresses, e.g. a CachingResolver. Host names are an error otherwise.
+	Resolver HostResolver
+}
+
+// ParserFunc parses prefixes in an input format.
+type ParserFunc func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error)
+
+// RenderOptions configures a RendererFunc.
+type RenderOptions struct {
+	// Sep separates the records of line-oriented formats, "\n" if empty.
+	Sep string
+	// EOL terminates the last record of line-oriented formats with Sep too.
+	EOL bool
+	// PrefixEach and SuffixEach wrap each record of line-oriented formats,
+	// e.g. "\"" and "\"," to quote them.
+	PrefixEach, SuffixEach string
+	Params                 Params
+	// Annotators are used by annotated formats (csv, json).
+	Annotators []Annotator
+	// Summary receives the group summary of annotated formats when the
+	// "group-by" parameter is set, if not nil.
+	Summary io.Writer
+	// Workers is the number of goroutines rendering the records of
+	// line-oriented formats, GOMAXPROCS if 0.
+	Workers int
+}
+
+// sep returns the record separator of opts.
+func (opts RenderOptions) sep() string {
+	if opts.Sep == "" {
+		return "\n"
+	}
+	return opts.Sep
+}
+
+// UnescapeSeparator interprets the escape sequences \n, \r, \t, \0, \\ and
+// \xHH in a separator given on the command line, e.g. "\\t" becomes a tab.
+func UnescapeSeparator(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return "", fmt.Errorf("invalid separator %q: trailing backslash", s)
+		}
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '0':
+			b.WriteByte(0)
+		case '\\':
+			b.WriteByte('\\')
+		case 'x':
+			if i+3 > len(s) {
+				return "", fmt.Errorf("invalid separator %q: bad \\x escape", s)
+			}
+			n, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid separator %q: bad \\x escape", s)
+			}
+			b.WriteByte(byte(n))
+			i += 2
+		default:
+			return "", fmt.Errorf("invalid separator %q: unknown escape \\%c", s, s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// RendererFunc writes a set in an output format.
+type RendererFunc func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error
+
+var (
+	formatsMu     sync.RWMutex
+	inputFormats  = map[string]ParserFunc{}
+	outputFormats = map[string]RendererFunc{}
+)
+
+// RegisterInputFormat makes an input format available by name, e.g. to the
+// --in-format option of the ipbin command. It panics if parse is nil or if
+// a format is already registered under name.
+func RegisterInputFormat(name string, parse ParserFunc) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if parse == nil {
+		panic("ipbin: RegisterInputFormat parser is nil")
+	}
+	if _, dup := inputFormats[name]; dup {
+		panic("ipbin: RegisterInputFormat called twice for format " + name)
+	}
+	inputFormats[name] = parse
+}
+
+// RegisterOutputFormat makes an output format available by name, e.g. to
+// the --format option of the ipbin command. It panics if render is nil or
+// if a format is already registered under name.
+func RegisterOutputFormat(name string, render RendererFunc) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if render == nil {
+		panic("ipbin: RegisterOutputFormat renderer is nil")
+	}
+	if _, dup := outputFormats[name]; dup {
+		panic("ipbin: RegisterOutputFormat called twice for format " + name)
+	}
+	outputFormats[name] = render
+}
+
+// InputFormat returns the parser registered under name, enforcing the
+// limits of its ParseOptions.
+func InputFormat(name string) (ParserFunc, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	parse, ok := inputFormats[name]
+	if !ok {
+		return nil, false
+	}
+	return limitParser(parse), true
+}
+
+// OutputFormat returns the renderer registered under name.
+func OutputFormat(name string) (RendererFunc, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	render, ok := outputFormats[name]
+	return render, ok
+}
+
+// outputFormatNumbers are the numbers the ipbin command used for its first
+// four output formats before they were named, still accepted by
+// ParseOutputFormat. Formats added since have names only.
+var outputFormatNumbers = []string{
+	1: "subnets+ips",
+	2: "ranges+ips",
+	3: "subnets",
+	4: "ranges",
+}
+
+// ParseOutputFormat returns the name of the registered output format s,
+// which is either a name, matched case-insensitively, or one of the
+// numbers of the ipbin command's legacy -f values (1=subnets+ips,
+// 2=ranges+ips, 3=subnets, 4=ranges).
+func ParseOutputFormat(s string) (string, error) {
+	name := strings.TrimSpace(s)
+	if n, err := strconv.Atoi(name); err == nil {
+		if n <= 0 || n >= len(outputFormatNumbers) {
+			return "", fmt.Errorf("unknown output format: %s", s)
+		}
+		name = outputFormatNumbers[n]
+	}
+	if _, ok := OutputFormat(name); ok {
+		return name, nil
+	}
+	// Names are registered as given, e.g. with capitals by other packages
+	for _, registered := range OutputFormats() {
+		if strings.EqualFold(registered, name) {
+			return registered, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format: %s", s)
+}
+
+// InputFormats returns the sorted names of the registered input formats.
+func InputFormats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	names := make([]string, 0, len(inputFormats))
+	for name := range inputFormats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// OutputFormats returns the sorted names of the registered output formats.
+func OutputFormats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,198 @@
+package ipbin
+
+import (
+	"bytes"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFormats(t *testing.T) {
+	RegisterInputFormat("test-upper", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return ParseIPSubnets(strings.NewReader(strings.ToLower(string(data))))
+	})
+	RegisterOutputFormat("test-count", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		_, err := io.WriteString(w, opts.Params.Get("label", "prefixes")+": "+string(rune('0'+len(ipset.Prefixes()))))
+		return err
+	})
+
+	parse, ok := InputFormat("test-upper")
+	if !ok {
+		t.Error("test-upper input format not registered")
+		return
+	}
+	nets, err := parse(strings.NewReader("2001:DB8::/32\n"), ParseOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ipset, err := MergePrefixes(nets)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	render, ok := OutputFormat("test-count")
+	if !ok {
+		t.Error("test-count output format not registered")
+		return
+	}
+	var buf bytes.Buffer
+	if err := render(&buf, ipset, RenderOptions{Params: Params{"label": "n"}}); err != nil {
+		t.Error(err)
+		return
+	}
+	if buf.String() != "n: 1" {
+		t.Errorf("got %q, want %q", buf.String(), "n: 1")
+	}
+	if !slices.Contains(InputFormats(), "test-upper") || !slices.Contains(OutputFormats(), "test-count") {
+		t.Errorf("registered formats not listed")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("duplicate registration expected panic")
+		}
+	}()
+	RegisterOutputFormat("subnets", func(io.Writer, *netipx.IPSet, RenderOptions) error { return nil })
+}
+
+func TestBuiltinOutputFormats(t *testing.T) {
+	ipset, err := MergePrefixes([]netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/25"),
+		netip.MustParsePrefix("192.0.2.128/26"),
+		netip.MustParsePrefix("198.51.100.7/32"),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	cases := []struct {
+		format   string
+		opts     RenderOptions
+		expected string
+	}{
+		{"subnets", RenderOptions{}, "192.0.2.0/25\n192.0.2.128/26\n198.51.100.7/32"},
+		{"subnets+ips", RenderOptions{Sep: ","}, "192.0.2.0/25,192.0.2.128/26,198.51.100.7"},
+		{"ranges", RenderOptions{}, "192.0.2.0-192.0.2.191\n198.51.100.7-198.51.100.7"},
+		{"ranges+ips", RenderOptions{}, "192.0.2.0-192.0.2.191\n198.51.100.7"},
+		{"subnets", RenderOptions{EOL: true}, "192.0.2.0/25\n192.0.2.128/26\n198.51.100.7/32\n"},
+		{"ranges+ips", RenderOptions{Sep: " ", PrefixEach: `"`, SuffixEach: `";`, EOL: true}, `"192.0.2.0-192.0.2.191"; "198.51.100.7"; `},
+		{"rtbh", RenderOptions{Params: Params{"rtbh-tag": "7"}}, "ip route 192.0.2.0 255.255.255.128 Null0 tag 7\n" +
+			"ip route 192.0.2.128 255.255.255.192 Null0 tag 7\nip route 198.51.100.7 255.255.255.255 Null0 tag 7"},
+	}
+	for _, c := range cases {
+		render, ok := OutputFormat(c.format)
+		if !ok {
+			t.Errorf("%s not registered", c.format)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := render(&buf, ipset, c.opts); err != nil {
+			t.Errorf("%s: %v", c.format, err)
+			continue
+		}
+		if buf.String() != c.expected {
+			t.Errorf("%s got %q, want %q", c.format, buf.String(), c.expected)
+		}
+	}
+
+	render, _ := OutputFormat("rtbh")
+	if err := render(io.Discard, ipset, RenderOptions{Params: Params{"rtbh-tag": "x"}}); err == nil {
+		t.Errorf("invalid rtbh-tag expected error")
+	}
+}
+
+func TestParams(t *testing.T) {
+	p := Params{"n": "3", "b": "true", "l": "a, b,,c"}
+	if n, err := p.Int("n", 1); err != nil || n != 3 {
+		t.Errorf("Int got %d, %v", n, err)
+	}
+	if n, err := p.Int("missing", 1); err != nil || n != 1 {
+		t.Errorf("Int default got %d, %v", n, err)
+	}
+	if b, err := p.Bool("b"); err != nil || !b {
+		t.Errorf("Bool got %v, %v", b, err)
+	}
+	if l := p.List("l"); !reflect.DeepEqual(l, []string{"a", "b", "c"}) {
+		t.Errorf("List got %v", l)
+	}
+	if v := p.Get("missing", "def"); v != "def" {
+		t.Errorf("Get default got %q", v)
+	}
+}
+
+func TestDetectJSONFormat(t *testing.T) {
+	cases := map[string]string{
+		`{"syncToken": "1", "createDate": "2024-01-01-00-00-00", "prefixes": []}`:   "aws",
+		`{"syncToken": "1", "creationTime": "2024-01-01T00:00:00", "prefixes": []}`: "gcp",
+		`{"changeNumber": 1, "cloud": "Public", "values": []}`:                      "azure",
+		`{"result": {"ipv4_cidrs": [], "ipv6_cidrs": []}, "success": true}`:         "cloudflare",
+		`{"type": "bundle", "objects": []}`:                                         "stix",
+		`{"Event": {"Attribute": []}}`:                                              "misp-json",
+		`["10.0.0.0/8", "192.0.2.1"]`:                                               "json",
+		`{"unrelated": true}`:                                                       "",
+		`not json`:                                                                  "",
+	}
+	for doc, expected := range cases {
+		if got := DetectJSONFormat([]byte(doc)); got != expected {
+			t.Errorf("DetectJSONFormat(%s) got %q, want %q", doc, got, expected)
+		}
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	cases := map[string]string{
+		"1":           "subnets+ips",
+		"4":           "ranges",
+		"Subnets+IPs": "subnets+ips",
+		"zeek-intel":  "zeek-intel",
+	}
+	for s, expected := range cases {
+		if got, err := ParseOutputFormat(s); err != nil || got != expected {
+			t.Errorf("ParseOutputFormat(%q) got %q, %v, want %q", s, got, err, expected)
+		}
+	}
+	// Registered with capitals
+	RegisterOutputFormat("MyFirewall", func(io.Writer, *netipx.IPSet, RenderOptions) error { return nil })
+	for _, s := range []string{"MyFirewall", "myfirewall", "MYFIREWALL"} {
+		if got, err := ParseOutputFormat(s); err != nil || got != "MyFirewall" {
+			t.Errorf("ParseOutputFormat(%q) got %q, %v, want MyFirewall", s, got, err)
+		}
+	}
+	for _, s := range []string{"0", "5", "99", "unknown", ""} {
+		if _, err := ParseOutputFormat(s); err == nil {
+			t.Errorf("ParseOutputFormat(%q) expected error", s)
+		}
+	}
+}
+
+func TestUnescapeSeparator(t *testing.T) {
+	cases := map[string]string{
+		", ":   ", ",
+		`\n`:   "\n",
+		`\r\n`: "\r\n",
+		`\t`:   "\t",
+		`\0`:   "\x00",
+		`a\\b`: `a\b`,
+		`\x1e`: "\x1e",
+		`;\n`:  ";\n",
+	}
+	for s, expected := range cases {
+		if got, err := UnescapeSeparator(s); err != nil || got != expected {
+			t.Errorf("UnescapeSeparator(%q) got %q, %v, want %q", s, got, err, expected)
+		}
+	}
+	for _, s := range []string{`\`, `\q`, `\x1`, `\xzz`} {
+		if _, err := UnescapeSeparator(s); err == nil {
+			t.Errorf("UnescapeSeparator(%q) expected error", s)
+		}
+	}
+}
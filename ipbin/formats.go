@@ -0,0 +1,376 @@
+package ipbin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+)
+
+// Built-in formats. The ipbin command registers the formats depending on
+// network lookups or local databases itself.
+func init() {
+	RegisterInputFormat("text", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		return parseIPSubnets(context.Background(), r, opts)
+	})
+	cloud := func(parse func(io.Reader, CloudFilter) ([]netip.Prefix, error)) ParserFunc {
+		return func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+			return parse(r, CloudFilter{Services: opts.Params.List("service"), Regions: opts.Params.List("region")})
+		}
+	}
+	RegisterInputFormat("aws", cloud(ParseAWSRanges))
+	RegisterInputFormat("azure", cloud(ParseAzureServiceTags))
+	RegisterInputFormat("gcp", cloud(ParseGCPRanges))
+	RegisterInputFormat("cloudflare", cloud(ParseCloudflareRanges))
+	RegisterInputFormat("p2p", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		return ParseP2P(r)
+	})
+	RegisterInputFormat("routes", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		return ParseRouteTable(r)
+	})
+	for _, format := range []string{"pcap", "extract"} {
+		RegisterInputFormat(format, func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+			counts, err := CountInputAddrs(format, r, opts.Params)
+			if err != nil {
+				return nil, err
+			}
+			if counts, err = counts.FilterParams(opts.Params); err != nil {
+				return nil, err
+			}
+			return counts.Prefixes(1), nil
+		})
+	}
+	RegisterInputFormat("json", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		return ParseJSONList(r, opts.Params.Get("json-path", ""))
+	})
+	RegisterInputFormat("ndjson", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		return ParseNDJSON(r, opts.Params.Get("json-path", ""))
+	})
+	RegisterInputFormat("yaml", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		return ParseYAMLList(r, opts.Params.Get("path", ""))
+	})
+	RegisterInputFormat("toml", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		return ParseTOMLList(r, opts.Params.Get("path", ""))
+	})
+	RegisterInputFormat("stix", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		return ParseSTIXBundle(r)
+	})
+	RegisterInputFormat("misp-csv", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		return ParseMISPCSV(r, opts.Params.List("misp-type"))
+	})
+	RegisterInputFormat("misp-json", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		return ParseMISPJSON(r, opts.Params.List("misp-type"))
+	})
+	RegisterInputFormat("mmdb", func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		// The networks of a MaxMind DB, e.g. a blocklist distributed as mmdb
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		db, err := NewMMDB(b)
+		if err != nil {
+			return nil, err
+		}
+		return db.Networks(), nil
+	})
+
+	// Single IPs as IPs, others as subnets
+	RegisterOutputFormat("subnets+ips", prefixText(TextCompact))
+	RegisterOutputFormat("ranges+ips", renderRanges(TextCompact))
+	RegisterOutputFormat("subnets", prefixText(TextFull))
+	RegisterOutputFormat("ranges", renderRanges(TextFull))
+	RegisterOutputFormat("rpz", prefixRecords(func(params Params) (func(netip.Prefix) string, error) {
+		target, err := RPZActionTarget(params.Get("rpz-action", "nxdomain"))
+		if err != nil {
+			return nil, err
+		}
+		return func(p netip.Prefix) string { return RPZRecord(p, target) }, nil
+	}))
+	RegisterOutputFormat("rtbh", prefixRecords(func(params Params) (func(netip.Prefix) string, error) {
+		tag, err := params.Int("rtbh-tag", 666)
+		if err != nil {
+			return nil, err
+		}
+		return func(p netip.Prefix) string { return RTBHRoute(p, tag) }, nil
+	}))
+	RegisterOutputFormat("exabgp", prefixRecords(func(params Params) (func(netip.Prefix) string, error) {
+		nextHop, community := params.Get("next-hop", "self"), params.Get("community", BlackholeCommunity)
+		return func(p netip.Prefix) string { return ExaBGPAnnounce(p, nextHop, community) }, nil
+	}))
+	RegisterOutputFormat("exabgp-flow", prefixRecords(func(Params) (func(netip.Prefix) string, error) {
+		return ExaBGPFlowAnnounce, nil
+	}))
+	RegisterOutputFormat("csv", renderAnnotated(WriteAnnotatedCSV))
+	RegisterOutputFormat("json", renderAnnotated(WriteAnnotatedJSON))
+	RegisterOutputFormat("iprep", prefixRecords(func(params Params) (func(netip.Prefix) string, error) {
+		category, err := params.Int("iprep-category", 1)
+		if err != nil {
+			return nil, err
+		}
+		score, err := params.Int("iprep-score", MaxIPRepScore)
+		if err != nil {
+			return nil, err
+		}
+		if category < 0 || category > MaxIPRepCategory {
+			return nil, fmt.Errorf("iprep category must be between 0 and %d", MaxIPRepCategory)
+		}
+		if score < 0 || score > MaxIPRepScore {
+			return nil, fmt.Errorf("iprep score must be between 0 and %d", MaxIPRepScore)
+		}
+		return func(p netip.Prefix) string { return IPRepRecord(p, category, score) }, nil
+	}))
+	RegisterOutputFormat("zeek-intel", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		// Zeek intel files require tab-separated fields and a header line,
+		// whatever the separator
+		source := opts.Params.Get("intel-source", "ipbin")
+		if _, err := io.WriteString(w, ZeekIntelHeader+"\n"); err != nil {
+			return err
+		}
+		for _, p := range ipset.Prefixes() {
+			if _, err := io.WriteString(w, ZeekIntelRecord(p, source)+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	RegisterOutputFormat("nginx", prefixRecords(func(Params) (func(netip.Prefix) string, error) {
+		return NginxDeny, nil
+	}))
+	RegisterOutputFormat("apache", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		// A <RequireAll> block granting access to everyone but the set
+		if _, err := io.WriteString(w, "<RequireAll>\n    Require all granted\n"); err != nil {
+			return err
+		}
+		for _, p := range ipset.Prefixes() {
+			if _, err := io.WriteString(w, "    "+ApacheRequireNotIP(p)+"\n"); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "</RequireAll>\n")
+		return err
+	})
+	RegisterOutputFormat("hosts-deny", prefixRecords(func(params Params) (func(netip.Prefix) string, error) {
+		daemon := params.Get("hosts-daemon", "ALL")
+		return func(p netip.Prefix) string { return HostsDenyRecord(p, daemon) }, nil
+	}))
+	RegisterOutputFormat("envoy", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		return writeJSON(w, EnvoyCidrRanges(ipset.Prefixes()))
+	})
+	RegisterOutputFormat("aws-waf", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		sets := WAFIPSets(ipset.Prefixes(), opts.Params.Get("waf-name", "ipbin"), opts.Params.Get("waf-scope", "REGIONAL"))
+		if id := opts.Params.Get("waf-id", ""); id != "" {
+			// A single update-ip-set payload
+			if len(sets) > 1 {
+				return fmt.Errorf("waf-id requires the set to fit in a single IP set, got %d", len(sets))
+			}
+			for i := range sets {
+				sets[i].Id, sets[i].LockToken, sets[i].IPAddressVersion = id, opts.Params.Get("waf-lock-token", ""), ""
+			}
+		}
+		if sets == nil {
+			sets = []WAFIPSet{}
+		}
+		return writeJSON(w, sets)
+	})
+	RegisterOutputFormat("aws-sg", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		perm, err := ParseIpPermission(opts.Params.Get("sg-protocol", "-1"), opts.Params.Get("sg-ports", ""))
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, SecurityGroupPayloads(ipset.Prefixes(), opts.Params.Get("sg-id", ""), perm))
+	})
+	RegisterOutputFormat("k8s-netpol", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		ingress, err := opts.Params.Bool("k8s-ingress")
+		if err != nil {
+			return err
+		}
+		maxEntries, err := opts.Params.Int("k8s-max-entries", DefaultManifestEntries)
+		if err != nil {
+			return err
+		}
+		return WriteNetworkPolicies(w, ipset.Prefixes(), NetworkPolicyOptions{
+			Name:       opts.Params.Get("k8s-name", "ipbin"),
+			Namespace:  opts.Params.Get("k8s-namespace", ""),
+			Ingress:    ingress,
+			MaxEntries: maxEntries,
+		})
+	})
+	RegisterOutputFormat("cilium-cidrgroup", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		maxEntries, err := opts.Params.Int("k8s-max-entries", DefaultManifestEntries)
+		if err != nil {
+			return err
+		}
+		return WriteCiliumCIDRGroups(w, ipset.Prefixes(), opts.Params.Get("k8s-name", "ipbin"), maxEntries)
+	})
+	RegisterOutputFormat("tfvars", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		return WriteTFVars(w, opts.Params.Get("tf-var", "prefixes"), ipset.Prefixes())
+	})
+	RegisterOutputFormat("tfvars-json", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		return WriteTFVarsJSON(w, opts.Params.Get("tf-var", "prefixes"), ipset.Prefixes())
+	})
+	RegisterOutputFormat("integers", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		style, err := IntegerStyleParams(opts.Params)
+		if err != nil {
+			return err
+		}
+		ranges := ipset.Ranges()
+		return writeRecords(w, opts, len(ranges), func(dst []byte, i int) []byte {
+			return AppendRangeIntegers(dst, ranges[i], style)
+		})
+	})
+	RegisterOutputFormat("clickhouse", prefixRecords(func(params Params) (func(netip.Prefix) string, error) {
+		value := params.Get("ch-value", "1")
+		return func(p netip.Prefix) string { return ClickHouseTrieRecord(p, value) }, nil
+	}))
+	RegisterOutputFormat("bigquery", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		ranges := ipset.Ranges()
+		return writeRecords(w, opts, len(ranges), func(dst []byte, i int) []byte {
+			return AppendBigQueryRange(dst, ranges[i])
+		})
+	})
+	RegisterOutputFormat("parquet", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		return WriteParquetRanges(w, ipset.Prefixes())
+	})
+	RegisterOutputFormat("sqlite", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		return WriteSQLite(w, ipset.Prefixes())
+	})
+	RegisterOutputFormat("rdns-zones", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		return WriteReverseZones(w, ipset.Prefixes(), reverseDNSOptions(opts.Params))
+	})
+	RegisterOutputFormat("rdns-delegation", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		return WriteReverseDelegations(w, ipset.Prefixes(), reverseDNSOptions(opts.Params))
+	})
+	RegisterOutputFormat("spf", func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		return WriteSPFRecords(w, ipset.Prefixes(), SPFOptions{Domain: opts.Params.Get("spf-domain", ""), All: opts.Params.Get("spf-all", "~all")})
+	})
+}
+
+// DetectJSONFormat returns the name of the input format of the JSON
+// document data: one of "aws", "azure", "gcp", "cloudflare", "stix" and
+// "misp-json", "json" for an array, or "" if it is not recognized.
+func DetectJSONFormat(data []byte) string {
+	var list []json.RawMessage
+	if json.Unmarshal(data, &list) == nil {
+		return "json"
+	}
+	var doc map[string]json.RawMessage
+	if json.Unmarshal(data, &doc) != nil {
+		return ""
+	}
+	has := func(key string) bool {
+		_, ok := doc[key]
+		return ok
+	}
+	switch {
+	case has("prefixes") && has("createDate"):
+		return "aws"
+	case has("prefixes") && has("creationTime"):
+		return "gcp"
+	case has("values") && has("cloud"):
+		return "azure"
+	case has("result") && bytes.Contains(doc["result"], []byte(`"ipv4_cidrs"`)):
+		return "cloudflare"
+	case has("objects"):
+		return "stix"
+	case has("Event") || has("response"):
+		return "misp-json"
+	}
+	return ""
+}
+
+// prefixRecords returns a renderer writing one record per prefix of the
+// set, separated by the separator. newRecord validates the parameters and
+// returns the function formatting a record.
+func prefixRecords(newRecord func(Params) (func(netip.Prefix) string, error)) RendererFunc {
+	return func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		record, err := newRecord(opts.Params)
+		if err != nil {
+			return err
+		}
+		prefixes := ipset.Prefixes()
+		return writeRecords(w, opts, len(prefixes), func(dst []byte, i int) []byte {
+			return append(dst, record(prefixes[i])...)
+		})
+	}
+}
+
+// prefixText returns a renderer writing the prefixes of the set in style,
+// without allocating per record.
+func prefixText(style TextStyle) RendererFunc {
+	return func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		prefixes := ipset.Prefixes()
+		return writeRecords(w, opts, len(prefixes), func(dst []byte, i int) []byte {
+			return AppendPrefixText(dst, prefixes[i], style)
+		})
+	}
+}
+
+// renderRanges returns a renderer writing the ranges of the set in style.
+func renderRanges(style TextStyle) RendererFunc {
+	return func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		ranges := ipset.Ranges()
+		return writeRecords(w, opts, len(ranges), func(dst []byte, i int) []byte {
+			return AppendRangeText(dst, ranges[i], style)
+		})
+	}
+}
+
+// renderAnnotated returns a renderer annotating the set with the
+// annotators of the options and writing it with write. If the "group-by"
+// parameter is set, prefixes are ordered by group and a summary of the
+// groups is written to opts.Summary.
+func renderAnnotated(write func(io.Writer, []AnnotatedPrefix) error) RendererFunc {
+	return func(w io.Writer, ipset *netipx.IPSet, opts RenderOptions) error {
+		aps, err := Annotate(ipset, opts.Annotators...)
+		if err != nil {
+			return err
+		}
+		if key := opts.Params.Get("group-by", ""); key != "" {
+			groups := GroupAnnotated(aps, key)
+			aps = aps[:0]
+			for _, g := range groups {
+				aps = append(aps, g.Prefixes...)
+			}
+			if opts.Summary != nil {
+				if err = WriteGroupSummary(opts.Summary, key, groups); err != nil {
+					return err
+				}
+			}
+		}
+		return write(w, aps)
+	}
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeRecords writes the n records rendered by record, wrapped and
+// separated as set by opts. record appends record i to dst. Records are
+// rendered by opts.Workers goroutines, so record must be safe for
+// concurrent use.
+func writeRecords(w io.Writer, opts RenderOptions, n int, record func(dst []byte, i int) []byte) error {
+	sep := opts.sep()
+	err := EncodeParallel(w, n, opts.Workers, func(dst []byte, i int) ([]byte, error) {
+		if i > 0 {
+			dst = append(dst, sep...)
+		}
+		dst = append(dst, opts.PrefixEach...)
+		dst = record(dst, i)
+		return append(dst, opts.SuffixEach...), nil
+	})
+	if err != nil {
+		return err
+	}
+	if opts.EOL && n > 0 {
+		_, err := io.WriteString(w, sep)
+		return err
+	}
+	return nil
+}
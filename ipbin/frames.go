@@ -0,0 +1,313 @@
+package ipbin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultFrameSize is the size of the data WriteFramed compresses per frame
+// unless told otherwise.
+const DefaultFrameSize = 1 << 20
+
+// maxFrameSize is the largest decompressed frame DecompressFramed
+// decompresses in parallel, larger ones being left to a single stream.
+const maxFrameSize = 1 << 26
+
+// WriteFramed writes data to w compressed with compression, "gzip" or
+// "zstd", in independent frames of frameSize bytes of data each
+// (DefaultFrameSize if 0), compressed by workers goroutines (GOMAXPROCS if 0
+// or less). The output is a valid gzip or zstd stream for any reader, with
+// the sizes DecompressFramed needs to decompress its frames in parallel:
+// gzip members have an extra field "IB" holding their size, like the BGZF
+// members of bioinformatics tools, and zstd frames their content size.
+func WriteFramed(w io.Writer, data []byte, compression string, frameSize, workers int) error {
+	if frameSize <= 0 {
+		frameSize = DefaultFrameSize
+	}
+	n := (len(data) + frameSize - 1) / frameSize
+	frame := func(i int) []byte { return data[i*frameSize : min((i+1)*frameSize, len(data))] }
+	switch compression {
+	case "gzip":
+		return EncodeParallel(w, n, workers, func(dst []byte, i int) ([]byte, error) {
+			return appendGzipMember(dst, frame(i))
+		})
+	case "zstd":
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return err
+		}
+		defer enc.Close()
+		return EncodeParallel(w, n, workers, func(dst []byte, i int) ([]byte, error) {
+			return enc.EncodeAll(frame(i), dst), nil
+		})
+	}
+	return fmt.Errorf("unknown compression: %s", compression)
+}
+
+// appendGzipMember appends the gzip member of data to dst, with its size in
+// its "IB" extra field.
+func appendGzipMember(dst, data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	start := buf.Len()
+	gz := gzip.NewWriter(buf)
+	gz.Extra = []byte{'I', 'B', 4, 0, 0, 0, 0, 0}
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	dst = buf.Bytes()
+	// After the 10-byte header and the 2-byte length of the extra field
+	binary.LittleEndian.PutUint32(dst[start+16:], uint32(len(dst)-start))
+	return dst, nil
+}
+
+// DecompressFramed returns the decompressed data, compressed with
+// compression, "gzip" or "zstd", failing with ErrInputTooLarge beyond
+// maxSize bytes if positive. The frames written by WriteFramed are
+// decompressed by workers goroutines (GOMAXPROCS if 0 or less) into their
+// place in the output; other streams are decompressed as a whole.
+func DecompressFramed(data []byte, compression string, workers int, maxSize int64) ([]byte, error) {
+	var frames []frameSpan
+	var ok bool
+	switch compression {
+	case "gzip":
+		frames, ok = gzipFrames(data)
+	case "zstd":
+		frames, ok = zstdFrames(data)
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", compression)
+	}
+	if !ok || len(frames) < 2 || workers == 1 {
+		return decompressStream(data, compression, maxSize)
+	}
+	size := 0
+	for i := range frames {
+		frames[i].off = size
+		size += frames[i].size
+	}
+	if maxSize > 0 && int64(size) > maxSize {
+		return nil, ErrInputTooLarge
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var dec *zstd.Decoder
+	if compression == "zstd" {
+		var err error
+		if dec, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(workers), zstd.WithDecoderMaxMemory(maxFrameSize)); err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+	}
+
+	out := make([]byte, size)
+	errs := make([]error, len(frames))
+	var next atomic.Int64
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for range min(workers, len(frames)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < len(frames) && !failed.Load(); i = int(next.Add(1) - 1) {
+				f := frames[i]
+				dst := out[f.off : f.off+f.size]
+				if dec != nil {
+					errs[i] = decompressZstdFrame(dec, dst, data[f.start:f.end])
+				} else {
+					errs[i] = decompressGzipMember(dst, data[f.start:f.end])
+				}
+				if errs[i] != nil {
+					errs[i] = fmt.Errorf("frame at offset %d: %w", f.start, errs[i])
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// frameSpan locates a compressed frame and its decompressed data
+type frameSpan struct {
+	start, end int // of the frame
+	off, size  int // of the data
+}
+
+// decompressStream decompresses data as a single stream
+func decompressStream(data []byte, compression string, maxSize int64) ([]byte, error) {
+	var r io.Reader
+	if compression == "gzip" {
+		gzr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gzr.Close()
+		r = gzr
+	} else {
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	if maxSize > 0 {
+		r = LimitReader(r, maxSize)
+	}
+	return io.ReadAll(r)
+}
+
+// gzipFrames returns the members of gzip data, if they all have the "IB"
+// extra field of WriteFramed.
+func gzipFrames(data []byte) ([]frameSpan, bool) {
+	var frames []frameSpan
+	for off := 0; off < len(data); {
+		m := data[off:]
+		// Header with an extra field (FLG.FEXTRA) starting with IB
+		if len(m) < 20 || m[0] != 0x1f || m[1] != 0x8b || m[2] != 8 || m[3]&4 == 0 ||
+			m[12] != 'I' || m[13] != 'B' || binary.LittleEndian.Uint16(m[14:]) != 4 {
+			return nil, false
+		}
+		n := int(binary.LittleEndian.Uint32(m[16:]))
+		if n < 20+8 || n > len(m) {
+			return nil, false
+		}
+		// The size of the data modulo 2^32 ends the member, which deflate
+		// compresses 1032 times at most
+		size := int(binary.LittleEndian.Uint32(m[n-4 : n]))
+		if size > maxFrameSize || size > 1032*n {
+			return nil, false
+		}
+		frames = append(frames, frameSpan{start: off, end: off + n, size: size})
+		off += n
+	}
+	return frames, true
+}
+
+// decompressGzipMember decompresses the gzip member into dst, of its size
+func decompressGzipMember(dst, member []byte) error {
+	gzr, err := gzip.NewReader(bytes.NewReader(member))
+	if err != nil {
+		return err
+	}
+	gzr.Multistream(false)
+	if _, err := io.ReadFull(gzr, dst); err != nil {
+		return err
+	}
+	// Checks the checksum of the member too
+	if n, err := gzr.Read(make([]byte, 1)); n > 0 || err != io.EOF {
+		if err == nil || err == io.EOF {
+			err = fmt.Errorf("member larger than its size")
+		}
+		return err
+	}
+	return nil
+}
+
+// zstdFrames returns the frames of zstd data, skipping skippable frames, if
+// they all have their content size.
+func zstdFrames(data []byte) ([]frameSpan, bool) {
+	var frames []frameSpan
+	for off := 0; off < len(data); {
+		f := data[off:]
+		if len(f) < 8 {
+			return nil, false
+		}
+		magic := binary.LittleEndian.Uint32(f)
+		if magic&0xfffffff0 == 0x184d2a50 {
+			n := 8 + int(binary.LittleEndian.Uint32(f[4:]))
+			if n > len(f) {
+				return nil, false
+			}
+			off += n
+			continue
+		}
+		if magic != 0xfd2fb528 {
+			return nil, false
+		}
+		// Frame header descriptor
+		fhd := f[4]
+		fcsFlag, single, checksum, dictFlag := fhd>>6, fhd&0x20 != 0, fhd&4 != 0, fhd&3
+		if fcsFlag == 0 && !single {
+			return nil, false // no content size
+		}
+		n := 5
+		if !single {
+			n++ // window descriptor
+		}
+		n += [4]int{0, 1, 2, 4}[dictFlag]
+		fcsSize := [4]int{1, 2, 4, 8}[fcsFlag]
+		if len(f) < n+fcsSize {
+			return nil, false
+		}
+		var size uint64
+		switch fcsSize {
+		case 1:
+			size = uint64(f[n])
+		case 2:
+			size = uint64(binary.LittleEndian.Uint16(f[n:])) + 256
+		case 4:
+			size = uint64(binary.LittleEndian.Uint32(f[n:]))
+		case 8:
+			size = binary.LittleEndian.Uint64(f[n:])
+		}
+		if size > maxFrameSize {
+			return nil, false
+		}
+		n += fcsSize
+		// Blocks, each with a 3-byte header: last block flag, type and size,
+		// and of 128 KiB of data at most
+		blocks := 0
+		for last := false; !last; blocks++ {
+			if len(f) < n+3 {
+				return nil, false
+			}
+			h := uint32(f[n]) | uint32(f[n+1])<<8 | uint32(f[n+2])<<16
+			last = h&1 != 0
+			blockSize := int(h >> 3)
+			if (h>>1)&3 == 1 {
+				blockSize = 1 // RLE block
+			}
+			n += 3 + blockSize
+		}
+		if checksum {
+			n += 4
+		}
+		if n > len(f) || size > uint64(blocks)<<17 {
+			return nil, false
+		}
+		frames = append(frames, frameSpan{start: off, end: off + n, size: int(size)})
+		off += n
+	}
+	return frames, true
+}
+
+// decompressZstdFrame decompresses the zstd frame into dst, of its size
+func decompressZstdFrame(dec *zstd.Decoder, dst, frame []byte) error {
+	out, err := dec.DecodeAll(frame, dst[:0:len(dst)])
+	if err != nil {
+		return err
+	}
+	if len(out) != len(dst) {
+		return fmt.Errorf("frame of %d bytes instead of %d", len(out), len(dst))
+	}
+	if len(out) > 0 && &out[0] != &dst[0] {
+		copy(dst, out)
+	}
+	return nil
+}
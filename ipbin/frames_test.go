@@ -0,0 +1,68 @@
+package ipbin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestFramed(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 300000)
+	for i := range data {
+		data[i] = byte(rng.Intn(16))
+	}
+	for _, compression := range []string{"gzip", "zstd"} {
+		var buf bytes.Buffer
+		if err := WriteFramed(&buf, data, compression, 64<<10, 0); err != nil {
+			t.Fatal(err)
+		}
+		framed := buf.Bytes()
+		got, err := DecompressFramed(framed, compression, 0, 0)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: DecompressFramed got %d bytes, %v", compression, len(got), err)
+		}
+		if frames, ok := map[string]func([]byte) ([]frameSpan, bool){"gzip": gzipFrames, "zstd": zstdFrames}[compression](framed); !ok || len(frames) != 5 {
+			t.Errorf("%s: got %d frames, %v", compression, len(frames), ok)
+		}
+		if _, err := DecompressFramed(framed, compression, 0, int64(len(data)-1)); err != ErrInputTooLarge {
+			t.Errorf("%s: DecompressFramed beyond the maximum size got %v", compression, err)
+		}
+
+		// A single stream for other readers
+		var r io.Reader
+		if compression == "gzip" {
+			r, err = gzip.NewReader(bytes.NewReader(framed))
+		} else {
+			r, err = zstd.NewReader(bytes.NewReader(framed))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: stream reader got %d bytes, %v", compression, len(got), err)
+		}
+
+		corrupt := bytes.Clone(framed)
+		corrupt[len(corrupt)/2] ^= 0xff
+		if got, err := DecompressFramed(corrupt, compression, 0, 0); err == nil && bytes.Equal(got, data) {
+			t.Errorf("%s: DecompressFramed of a corrupt frame succeeded", compression)
+		}
+	}
+
+	// Streams not written in frames
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	gz.Close()
+	if got, err := DecompressFramed(buf.Bytes(), "gzip", 0, 0); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("DecompressFramed of a gzip stream got %d bytes, %v", len(got), err)
+	}
+	if _, err := DecompressFramed(buf.Bytes(), "gzip", 0, 1000); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("DecompressFramed of a gzip stream beyond the maximum size got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package ipbin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GoBGPDefaultPort is the port of the gRPC API of GoBGP daemons.
+const GoBGPDefaultPort = "50051"
+
+// GoBGPClient adds and deletes paths of the global RIB of a GoBGP daemon
+// through its gRPC API, the AddPath and DeletePath calls of
+// apipb.GobgpApi, over a single HTTP/2 connection.
+type GoBGPClient struct {
+	// FlowSpec, if set, makes the paths flowspec rules (RFC 8955, RFC 8956)
+	// discarding the traffic destined to the prefixes, with a traffic-rate
+	// of 0, instead of unicast routes; their next-hop and community are
+	// left out.
+	FlowSpec bool
+
+	addr        string
+	nextHop     string
+	communities []uint32
+	client      *http.Client
+}
+
+// NewGoBGPClient returns a client of the GoBGP daemon at addr, host[:port],
+// announcing paths to nextHop, "self" for the daemon itself, with
+// community, e.g. BlackholeCommunity, none if empty.
+func NewGoBGPClient(addr, nextHop, community string) (*GoBGPClient, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, GoBGPDefaultPort)
+	}
+	if nextHop != "self" {
+		if _, err := netip.ParseAddr(nextHop); err != nil {
+			return nil, fmt.Errorf("invalid next-hop %q", nextHop)
+		}
+	}
+	c := &GoBGPClient{addr: addr, nextHop: nextHop}
+	if community != "" {
+		v, err := parseCommunity(community)
+		if err != nil {
+			return nil, err
+		}
+		c.communities = []uint32{v}
+	}
+	// gRPC without TLS, as GoBGP serves it by default
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	c.client = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{Protocols: protocols, MaxConnsPerHost: 1},
+	}
+	return c, nil
+}
+
+// parseCommunity parses a standard community, as high:low or a number
+func parseCommunity(s string) (uint32, error) {
+	high, low, ok := strings.Cut(s, ":")
+	if !ok {
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid community %q", s)
+		}
+		return uint32(v), nil
+	}
+	h, err1 := strconv.ParseUint(high, 10, 16)
+	l, err2 := strconv.ParseUint(low, 10, 16)
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("invalid community %q", s)
+	}
+	return uint32(h<<16 | l), nil
+}
+
+// Announce adds the path of p to the global RIB.
+func (c *GoBGPClient) Announce(p netip.Prefix) error {
+	// AddPathRequest: table_type (1) GLOBAL, the default, and path (3)
+	return c.call("AddPath", pbBytes(nil, 3, c.path(p, false)))
+}
+
+// Withdraw deletes the path of p, added by Announce, from the global RIB.
+func (c *GoBGPClient) Withdraw(p netip.Prefix) error {
+	// DeletePathRequest: table_type (1) GLOBAL, family (3) and path (4)
+	req := pbBytes(nil, 3, c.family(p))
+	return c.call("DeletePath", pbBytes(req, 4, c.path(p, true)))
+}
+
+// Close closes the connection to the daemon.
+func (c *GoBGPClient) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// path returns the apipb.Path message of p
+func (c *GoBGPClient) path(p netip.Prefix, withdraw bool) []byte {
+	p = p.Masked()
+	if c.FlowSpec {
+		// FlowSpecIPPrefix: type (1) destination prefix, prefix_len (2),
+		// prefix (3); FlowSpecNLRI: rules (1)
+		rule := pbVarint(nil, 1, 1)
+		rule = pbVarint(rule, 2, uint64(p.Bits()))
+		rule = pbBytes(rule, 3, []byte(p.Addr().String()))
+		// Path as below, with ExtendedCommunitiesAttribute, communities
+		// (1), of a TrafficRateExtended of rate 0, its default: discard
+		path := pbBytes(nil, 1, pbAny("FlowSpecNLRI", pbBytes(nil, 1, pbAny("FlowSpecIPPrefix", rule))))
+		path = pbBytes(path, 2, pbAny("OriginAttribute", nil))
+		path = pbBytes(path, 2, pbAny("ExtendedCommunitiesAttribute", pbBytes(nil, 1, pbAny("TrafficRateExtended", nil))))
+		if withdraw {
+			path = pbVarint(path, 5, 1)
+		}
+		return pbBytes(path, 9, c.family(p))
+	}
+	nextHop := c.nextHop
+	if nextHop == "self" {
+		// The unspecified address, for the daemon's own, as with the gobgp
+		// client
+		nextHop = "0.0.0.0"
+		if p.Addr().Is6() {
+			nextHop = "::"
+		}
+	}
+	// IPAddressPrefix: prefix_len (1), prefix (2)
+	nlri := pbVarint(nil, 1, uint64(p.Bits()))
+	nlri = pbBytes(nlri, 2, []byte(p.Addr().String()))
+	// Path: nlri (1), pattrs (2), is_withdraw (5), family (9), the
+	// attributes being OriginAttribute, origin (1) IGP, NextHopAttribute,
+	// next_hop (1), and CommunitiesAttribute, communities (1) packed
+	path := pbBytes(nil, 1, pbAny("IPAddressPrefix", nlri))
+	path = pbBytes(path, 2, pbAny("OriginAttribute", nil))
+	path = pbBytes(path, 2, pbAny("NextHopAttribute", pbBytes(nil, 1, []byte(nextHop))))
+	if len(c.communities) > 0 {
+		var packed []byte
+		for _, v := range c.communities {
+			packed = binary.AppendUvarint(packed, uint64(v))
+		}
+		path = pbBytes(path, 2, pbAny("CommunitiesAttribute", pbBytes(nil, 1, packed)))
+	}
+	if withdraw {
+		path = pbVarint(path, 5, 1)
+	}
+	return pbBytes(path, 9, c.family(p))
+}
+
+// family returns the apipb.Family message of the paths of p: afi (1)
+// AFI_IP or AFI_IP6 and safi (2) SAFI_UNICAST, or SAFI_FLOW_SPEC_UNICAST
+// with FlowSpec
+func (c *GoBGPClient) family(p netip.Prefix) []byte {
+	afi, safi := uint64(1), uint64(1)
+	if p.Addr().Is6() {
+		afi = 2
+	}
+	if c.FlowSpec {
+		safi = 133
+	}
+	return pbVarint(pbVarint(nil, 1, afi), 2, safi)
+}
+
+// call makes the unary gRPC call method of apipb.GobgpApi with the request
+// message req, the response being of no interest
+func (c *GoBGPClient) call(method string, req []byte) error {
+	body := make([]byte, 5, 5+len(req))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(req)))
+	body = append(body, req...)
+	u := url.URL{Scheme: "http", Host: c.addr, Path: "/apipb.GobgpApi/" + method}
+	r, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set("TE", "trailers")
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("gobgp %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	// The status is in the trailers, after the response message
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return fmt.Errorf("gobgp %s: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gobgp %s: unexpected status %s", method, resp.Status)
+	}
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// Responses without message have it in the headers
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		if m, err := url.PathUnescape(message); err == nil {
+			message = m
+		}
+		return fmt.Errorf("gobgp %s: status %s: %s", method, status, message)
+	}
+	return nil
+}
+
+// pbVarint appends the varint field of a protobuf message to dst, nothing
+// for 0, the default
+func pbVarint(dst []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return dst
+	}
+	dst = binary.AppendUvarint(dst, uint64(field)<<3)
+	return binary.AppendUvarint(dst, v)
+}
+
+// pbBytes appends the length-delimited field of a protobuf message, bytes,
+// string or message, to dst
+func pbBytes(dst []byte, field int, b []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(field)<<3|2)
+	dst = binary.AppendUvarint(dst, uint64(len(b)))
+	return append(dst, b...)
+}
+
+// pbAny returns the google.protobuf.Any message of the apipb message msg of
+// type typ: type_url (1) and value (2)
+func pbAny(typ string, msg []byte) []byte {
+	return pbBytes(pbBytes(nil, 1, []byte("type.googleapis.com/apipb."+typ)), 2, msg)
+}
@@ -0,0 +1,138 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pbFields returns the length-delimited and varint fields of a protobuf
+// message, the varints as their decimal strings
+func pbFields(t *testing.T, msg []byte) map[int][]string {
+	fields := map[int][]string{}
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		msg = msg[n:]
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(msg)
+			fields[int(key>>3)] = append(fields[int(key>>3)], strconv.FormatUint(v, 10))
+			msg = msg[n:]
+		case 2:
+			l, n := binary.Uvarint(msg)
+			fields[int(key>>3)] = append(fields[int(key>>3)], string(msg[n:n+int(l)]))
+			msg = msg[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func TestGoBGPClient(t *testing.T) {
+	var calls []string
+	var paths []map[int][]string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != "application/grpc" || len(body) < 5 ||
+			int(binary.BigEndian.Uint32(body[1:])) != len(body)-5 {
+			t.Errorf("unexpected request %s %v, %d bytes", r.Proto, r.Header, len(body))
+		}
+		calls = append(calls, r.URL.Path)
+		req := pbFields(t, body[5:])
+		if r.URL.Path == "/apipb.GobgpApi/AddPath" {
+			paths = append(paths, pbFields(t, []byte(req[3][0])))
+		} else {
+			paths = append(paths, pbFields(t, []byte(req[4][0])))
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		if strings.Contains(string(body), "192.0.2.99") {
+			w.Header().Set("Grpc-Status", "3")
+			w.Header().Set("Grpc-Message", "invalid%20path")
+			return
+		}
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	c, err := NewGoBGPClient(srv.Listener.Addr().String(), "self", BlackholeCommunity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Announce(netip.MustParsePrefix("2001:db8::/48")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Withdraw(netip.MustParsePrefix("192.0.2.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "/apipb.GobgpApi/AddPath" || calls[1] != "/apipb.GobgpApi/DeletePath" {
+		t.Fatalf("got calls %v", calls)
+	}
+
+	// The prefix, next-hop and community of the path, and the withdrawal
+	nlri := pbFields(t, []byte(paths[0][1][0]))
+	if nlri[1][0] != "type.googleapis.com/apipb.IPAddressPrefix" || !strings.Contains(nlri[2][0], "2001:db8::") {
+		t.Errorf("got NLRI %q", nlri)
+	}
+	var attrs []string
+	for _, a := range paths[0][2] {
+		attrs = append(attrs, pbFields(t, []byte(a))[1][0])
+	}
+	if want := "type.googleapis.com/apipb.OriginAttribute type.googleapis.com/apipb.NextHopAttribute type.googleapis.com/apipb.CommunitiesAttribute"; strings.Join(attrs, " ") != want {
+		t.Errorf("got attributes %v", attrs)
+	}
+	nextHop := pbFields(t, []byte(pbFields(t, []byte(paths[0][2][1]))[2][0]))
+	if nextHop[1][0] != "::" {
+		t.Errorf("got next-hop %q", nextHop[1][0])
+	}
+	communities := pbFields(t, []byte(pbFields(t, []byte(paths[0][2][2]))[2][0]))
+	if v, _ := binary.Uvarint([]byte(communities[1][0])); v != 65535<<16|666 {
+		t.Errorf("got community %d", v)
+	}
+	if len(paths[0][5]) != 0 || len(paths[1][5]) != 1 || paths[1][5][0] != "1" {
+		t.Errorf("got is_withdraw %q, %q", paths[0][5], paths[1][5])
+	}
+
+	if err := c.Announce(netip.MustParsePrefix("192.0.2.99/32")); err == nil || !strings.Contains(err.Error(), "status 3: invalid path") {
+		t.Errorf("failed call got %v", err)
+	}
+
+	// Flowspec rules discarding the traffic to the prefix
+	c.FlowSpec = true
+	if err := c.Announce(netip.MustParsePrefix("198.51.100.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	flow := paths[len(paths)-1]
+	nlri = pbFields(t, []byte(flow[1][0]))
+	rule := pbFields(t, []byte(pbFields(t, []byte(pbFields(t, []byte(nlri[2][0]))[1][0]))[2][0]))
+	if nlri[1][0] != "type.googleapis.com/apipb.FlowSpecNLRI" || rule[1][0] != "1" || rule[2][0] != "24" || rule[3][0] != "198.51.100.0" {
+		t.Errorf("got flowspec NLRI %q, rule %q", nlri, rule)
+	}
+	attrs = nil
+	for _, a := range flow[2] {
+		attrs = append(attrs, pbFields(t, []byte(a))[1][0])
+	}
+	if want := "type.googleapis.com/apipb.OriginAttribute type.googleapis.com/apipb.ExtendedCommunitiesAttribute"; strings.Join(attrs, " ") != want {
+		t.Errorf("got flowspec attributes %v", attrs)
+	}
+	if family := pbFields(t, []byte(flow[9][0])); family[1][0] != "1" || family[2][0] != "133" {
+		t.Errorf("got flowspec family %q", family)
+	}
+
+	if _, err := NewGoBGPClient("localhost", "self", "65535"); err != nil {
+		t.Errorf("numeric community got %v", err)
+	}
+	if _, err := NewGoBGPClient("localhost", "self", "65536:1"); err == nil {
+		t.Errorf("invalid community succeeded")
+	}
+}
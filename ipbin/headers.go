@@ -0,0 +1,213 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+)
+
+// The header bytes from 162 up, after the prefix lengths of the plain
+// IPv4 (0–32) and IPv6 (33–161) prefix records, are reserved for the other
+// kinds of records and blocks of binary sets. Those assigned so far are
+// ExpiryHeader (162), ValueHeader (163), ZeroRunHeader (164), RangeHeader
+// (165), BlockHeader (252), ExtensionHeader (253), ContainerHeader (254)
+// and EndHeader (255).
+// Decoders reject the others, so that later versions can assign them
+// without older ones misreading their sets.
+const (
+	// RangeHeader is the header byte of a range record, holding the
+	// addresses of an arbitrary range rather than a prefix: it is followed
+	// by the size of the addresses, 4 or 16, then by the first and last
+	// addresses. Decoders of sets read it as its prefixes.
+	RangeHeader = 165
+	// ExtensionHeader is the header byte of an extension block, which
+	// later versions may put between records: it is followed by the length
+	// of the block as a uvarint, then by the block, of MaxValueSize bytes at
+	// most, which decoders skip.
+	ExtensionHeader = 253
+	// EndHeader is the header byte of the end-of-stream marker, a single
+	// byte record which may end the records of a set, e.g. so that readers
+	// of a stream tell a whole set from a truncated one. Another set may
+	// follow it, as after the records of a set without marker.
+	EndHeader = 255
+)
+
+// RecordKind is the kind of a record or block of a binary set, given by its
+// header byte.
+type RecordKind uint8
+
+const (
+	KindReserved  RecordKind = iota // not assigned yet, rejected
+	KindIPv4                        // plain IPv4 prefix record
+	KindIPv6                        // plain IPv6 prefix record
+	KindExpiry                      // expiry of the record following
+	KindValue                       // value of the record following
+	KindZeroRun                     // IPv6 prefix record of format v2
+	KindRange                       // range record
+	KindExtension                   // extension block
+	KindContainer                   // metadata block
+	KindEnd                         // end-of-stream marker
+	KindBlock                       // header of a block of records
+)
+
+// headerKinds registers the header bytes assigned from 162 up
+var headerKinds = map[byte]RecordKind{
+	ExpiryHeader:    KindExpiry,
+	ValueHeader:     KindValue,
+	ZeroRunHeader:   KindZeroRun,
+	RangeHeader:     KindRange,
+	BlockHeader:     KindBlock,
+	ExtensionHeader: KindExtension,
+	ContainerHeader: KindContainer,
+	EndHeader:       KindEnd,
+}
+
+var kindNames = [...]string{"reserved", "IPv4 prefix", "IPv6 prefix", "expiry", "value", "zero run IPv6 prefix", "range", "extension block", "metadata block", "end of stream", "block"}
+
+func (k RecordKind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("RecordKind(%d)", k)
+}
+
+// HeaderKind returns the kind of the records or blocks starting with the
+// header byte b.
+func HeaderKind(b byte) RecordKind {
+	switch {
+	case b <= 32:
+		return KindIPv4
+	case b <= 161:
+		return KindIPv6
+	}
+	return headerKinds[b]
+}
+
+// AppendEncodedRange appends the range record of r to dst.
+func AppendEncodedRange(dst []byte, r netipx.IPRange) ([]byte, error) {
+	if !r.IsValid() {
+		return nil, fmt.Errorf("invalid range %v", r)
+	}
+	if r.From().Is4() {
+		from, to := r.From().As4(), r.To().As4()
+		dst = append(dst, RangeHeader, 4)
+		dst = append(dst, from[:]...)
+		return append(dst, to[:]...), nil
+	}
+	from, to := r.From().As16(), r.To().As16()
+	dst = append(dst, RangeHeader, 16)
+	dst = append(dst, from[:]...)
+	return append(dst, to[:]...), nil
+}
+
+// AppendExtension appends an extension block of data to dst.
+func AppendExtension(dst, data []byte) ([]byte, error) {
+	if len(data) > MaxValueSize {
+		return nil, fmt.Errorf("extension block of %d bytes exceeds %d", len(data), MaxValueSize)
+	}
+	dst = append(dst, ExtensionHeader)
+	dst = binary.AppendUvarint(dst, uint64(len(data)))
+	return append(dst, data...), nil
+}
+
+// record is a record or block of a binary set, as read by readRecord
+type record struct {
+	kind   RecordKind // KindIPv4 or KindIPv6 for prefix records, whatever their encoding
+	prefix ExpiringPrefix
+	rng    netipx.IPRange // of range records
+	value  string
+	valued bool
+
+	// Of block headers
+	blockSize, blockRecords int
+	blockCRC                uint32
+}
+
+// first returns the first address of the record, invalid for blocks
+func (r record) first() netip.Addr {
+	if r.kind == KindRange {
+		return r.rng.From()
+	}
+	return r.prefix.Prefix.Masked().Addr()
+}
+
+// appendPrefixes appends the prefixes of the record to dst
+func (r record) appendPrefixes(dst []netip.Prefix) []netip.Prefix {
+	switch r.kind {
+	case KindRange:
+		return r.rng.AppendPrefixes(dst)
+	case KindIPv4, KindIPv6:
+		return append(dst, r.prefix.Prefix)
+	}
+	return dst
+}
+
+// readRecord reads the record or block at the start of buf, dispatching on
+// its header byte, and returns it along with the number of bytes read.
+// Reserved header bytes are errors.
+func readRecord(buf []byte) (record, int, error) {
+	if len(buf) == 0 {
+		return record{}, 0, io.EOF
+	}
+	switch kind := HeaderKind(buf[0]); kind {
+	case KindRange:
+		if len(buf) < 2 {
+			return record{}, 0, io.ErrUnexpectedEOF
+		}
+		size := int(buf[1])
+		if size != 4 && size != 16 {
+			return record{}, 0, fmt.Errorf("invalid range address size %d", size)
+		}
+		n := 2 + 2*size
+		if len(buf) < n {
+			return record{}, 0, io.ErrUnexpectedEOF
+		}
+		from, _ := netip.AddrFromSlice(buf[2 : 2+size])
+		to, _ := netip.AddrFromSlice(buf[2+size : n])
+		r := netipx.IPRangeFrom(from, to)
+		if !r.IsValid() {
+			return record{}, 0, fmt.Errorf("invalid range %v-%v", from, to)
+		}
+		return record{kind: kind, rng: r}, n, nil
+	case KindExtension:
+		size, n := binary.Uvarint(buf[1:])
+		if n < 0 || size > MaxValueSize {
+			return record{}, 0, errors.New("invalid extension block length")
+		} else if n == 0 || len(buf) < 1+n+int(size) {
+			return record{}, 0, io.ErrUnexpectedEOF
+		}
+		return record{kind: kind}, 1 + n + int(size), nil
+	case KindBlock:
+		return readBlockHeader(buf)
+	case KindEnd:
+		return record{kind: kind}, 1, nil
+	case KindContainer:
+		// Of the next of concatenated sets
+		_, n, err := ReadMetadataFromBytes(buf)
+		if err != nil {
+			return record{}, 0, err
+		}
+		return record{kind: kind}, n, nil
+	case KindReserved:
+		return record{}, 0, fmt.Errorf("unexpected %s header byte %d", kind, buf[0])
+	}
+	value, off, err := readValue(buf)
+	if err != nil {
+		return record{}, 0, err
+	}
+	ep, n, err := readExpiringRecord(buf[off:])
+	if err == io.EOF && off > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return record{}, 0, err
+	}
+	kind := KindIPv6
+	if ep.Prefix.Addr().Is4() {
+		kind = KindIPv4
+	}
+	return record{kind: kind, prefix: ep, value: value, valued: off > 0}, off + n, nil
+}
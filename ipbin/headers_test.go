@@ -0,0 +1,81 @@
+package ipbin
+
+import (
+	"errors"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHeaderKind(t *testing.T) {
+	for b := 0; b < 256; b++ {
+		kind := HeaderKind(byte(b))
+		switch {
+		case b <= 32 && kind != KindIPv4, b > 32 && b <= 161 && kind != KindIPv6:
+			t.Errorf("HeaderKind(%d) got %v", b, kind)
+		}
+		if kind != KindReserved {
+			continue
+		}
+		// Decoders reject the header bytes not assigned yet
+		if _, err := DecodeAll([]byte{byte(b), 0, 0, 0, 0}, DecodeOptions{}); err == nil {
+			t.Errorf("DecodeAll of reserved header byte %d succeeded", b)
+		}
+	}
+	for b, want := range map[byte]RecordKind{ExpiryHeader: KindExpiry, ValueHeader: KindValue, ZeroRunHeader: KindZeroRun, RangeHeader: KindRange, ExtensionHeader: KindExtension, ContainerHeader: KindContainer, EndHeader: KindEnd} {
+		if got := HeaderKind(b); got != want {
+			t.Errorf("HeaderKind(%d) got %v, want %v", b, got, want)
+		}
+	}
+}
+
+func TestRangeRecords(t *testing.T) {
+	var records []byte
+	records, _ = AppendEncoded(records, netip.MustParsePrefix("10.0.0.0/8"))
+	records, err := AppendExtension(records, []byte("skipped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"192.0.2.1-192.0.2.6", "2001:db8::-2001:db8::1"} {
+		if records, err = AppendEncodedRange(records, netipx.MustParseIPRange(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records = append(records, EndHeader)
+
+	prefixes, err := DecodeAll(records, DecodeOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []netip.Prefix
+	for _, s := range []string{"10.0.0.0/8", "192.0.2.1/32", "192.0.2.2/31", "192.0.2.4/31", "192.0.2.6/32", "2001:db8::/127"} {
+		expected = append(expected, netip.MustParsePrefix(s))
+	}
+	if !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("DecodeAll got %v\nwant %v", prefixes, expected)
+	}
+	if vps, err := DecodeValued(records, time.Time{}); err != nil || len(vps) != len(expected) {
+		t.Errorf("DecodeValued got %v, %v", vps, err)
+	}
+	if stats, err := BinaryStats(records, time.Now()); err != nil || stats.IPv4 != 5 || stats.IPv6 != 1 {
+		t.Errorf("BinaryStats got %+v, %v", stats, err)
+	}
+	if sorted, err := RecordsSorted(records); err != nil || !sorted {
+		t.Errorf("RecordsSorted got %v, %v", sorted, err)
+	}
+
+	for _, b := range [][]byte{{RangeHeader}, {RangeHeader, 4, 1, 2, 3, 4}, {ExtensionHeader, 3, 'a'}} {
+		if _, err := DecodeAll(b, DecodeOptions{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("DecodeAll(%v) got %v, want io.ErrUnexpectedEOF", b, err)
+		}
+	}
+	// Ranges backwards or of invalid address size
+	for _, b := range [][]byte{{RangeHeader, 4, 1, 2, 3, 4, 1, 2, 3, 3}, {RangeHeader, 6}} {
+		if _, err := DecodeAll(b, DecodeOptions{}); err == nil {
+			t.Errorf("DecodeAll(%v) succeeded", b)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package ipbin
+
+import (
+	"net/netip"
+	"strconv"
+)
+
+// Limits of Suricata IP reputation categories and scores.
+const (
+	MaxIPRepCategory = 60
+	MaxIPRepScore    = 127
+)
+
+// IPRepRecord returns a Suricata IP reputation file line
+// (https://docs.suricata.io/en/latest/reputation/ipreputation/ip-reputation-format.html)
+// giving prefix p the reputation score in category, where category is
+// the id of a category of the categories file.
+//
+// Example:
+//   - 192.0.2.0/24 → 192.0.2.0/24,1,127
+//   - 192.0.2.1/32 → 192.0.2.1,1,127
+func IPRepRecord(p netip.Prefix, category, score int) string {
+	return FormatPrefixCompact(p) + "," + strconv.Itoa(category) + "," + strconv.Itoa(score)
+}
+
+// ZeekIntelHeader is the header line of Zeek Intelligence Framework files
+// made of ZeekIntelRecord lines.
+const ZeekIntelHeader = "#fields\tindicator\tindicator_type\tmeta.source"
+
+// ZeekIntelRecord returns a Zeek Intelligence Framework file line
+// (https://docs.zeek.org/en/master/frameworks/intel.html) for prefix p,
+// an Intel::ADDR indicator for single addresses and an Intel::SUBNET
+// indicator otherwise. Fields are tab-separated; an empty source is
+// written as "-".
+//
+// Example:
+//   - 192.0.2.0/24 → 192.0.2.0/24	Intel::SUBNET	ipbin
+//   - 192.0.2.1/32 → 192.0.2.1	Intel::ADDR	ipbin
+func ZeekIntelRecord(p netip.Prefix, source string) string {
+	typ := "Intel::SUBNET"
+	if p.IsSingleIP() {
+		typ = "Intel::ADDR"
+	}
+	if source == "" {
+		source = "-"
+	}
+	return FormatPrefixCompact(p) + "\t" + typ + "\t" + source
+}
@@ -0,0 +1,39 @@
+package ipbin
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIPRepRecord(t *testing.T) {
+	cases := []struct {
+		prefix   string
+		expected string
+	}{
+		{"192.0.2.0/24", "192.0.2.0/24,3,90"},
+		{"192.0.2.1/32", "192.0.2.1,3,90"},
+		{"2001:db8::/32", "2001:db8::/32,3,90"},
+	}
+	for _, c := range cases {
+		if got := IPRepRecord(netip.MustParsePrefix(c.prefix), 3, 90); got != c.expected {
+			t.Errorf("IPRepRecord(%s) got %q, want %q", c.prefix, got, c.expected)
+		}
+	}
+}
+
+func TestZeekIntelRecord(t *testing.T) {
+	cases := []struct {
+		prefix   string
+		source   string
+		expected string
+	}{
+		{"192.0.2.0/24", "feed", "192.0.2.0/24\tIntel::SUBNET\tfeed"},
+		{"192.0.2.1/32", "feed", "192.0.2.1\tIntel::ADDR\tfeed"},
+		{"2001:db8::1/128", "", "2001:db8::1\tIntel::ADDR\t-"},
+	}
+	for _, c := range cases {
+		if got := ZeekIntelRecord(netip.MustParsePrefix(c.prefix), c.source); got != c.expected {
+			t.Errorf("ZeekIntelRecord(%s) got %q, want %q", c.prefix, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package ipbin
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultIndexBlockSize is the size of the blocks of records BuildIndex
+// indexes by default: one lookup reads a single block.
+const DefaultIndexBlockSize = 4096
+
+// ErrNotIndexed is returned by OpenIndexed for a set without an index.
+var ErrNotIndexed = errors.New("binary set has no index")
+
+// IndexEntry locates a block of records of a sorted binary set.
+type IndexEntry struct {
+	First  netip.Addr // address of the first record of the block
+	Offset int64      // offset of the block from the start of the records
+}
+
+// BuildIndex returns the index of records, the records of a merged set
+// such as written from an IPSet, in blocks of about blockSize bytes
+// (DefaultIndexBlockSize if 0). Stored in the metadata of the set, it lets
+// OpenIndexed look addresses up by reading a single block.
+func BuildIndex(records []byte, blockSize int) ([]IndexEntry, error) {
+	if blockSize <= 0 {
+		blockSize = DefaultIndexBlockSize
+	}
+	var index []IndexEntry
+	start := -blockSize // offset of the current block
+	var prev netip.Addr
+	for off := 0; off < len(records); {
+		rec, n, err := readRecord(records[off:])
+		if err != nil {
+			return nil, fmt.Errorf("offset %d: %w", off, err)
+		}
+		addr := rec.first()
+		if !addr.IsValid() {
+			// Blocks are indexed by their first record
+			off += n
+			continue
+		}
+		if prev.IsValid() && addr.Less(prev) {
+			return nil, fmt.Errorf("offset %d: records not sorted", off)
+		}
+		if off+n-start > blockSize {
+			index = append(index, IndexEntry{First: addr, Offset: int64(off)})
+			start = off
+		}
+		prev = addr
+		off += n
+	}
+	return index, nil
+}
+
+// IndexedSet looks addresses up in an indexed binary set without reading it
+// all: after its metadata, each lookup reads the one block of records which
+// may cover the address. The set may be a local file or a remote object
+// read with HTTP range requests (see OpenRemote). It must not be
+// compressed or encrypted.
+type IndexedSet struct {
+	Metadata Metadata
+
+	r       io.ReaderAt
+	records int64 // offset of the records
+	size    int64
+}
+
+// OpenIndexed opens the indexed binary set of the given size read from r.
+// It returns ErrNotIndexed if the set has no index.
+func OpenIndexed(r io.ReaderAt, size int64) (*IndexedSet, error) {
+	// The metadata block is read in one go if it is small enough, in two
+	// otherwise
+	head := make([]byte, min(size, DefaultIndexBlockSize))
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(head) == 0 || head[0] != ContainerHeader {
+		return nil, ErrNotIndexed
+	}
+	l, n := binary.Uvarint(head[1:])
+	if n <= 0 || l > uint64(size) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if end := int64(1+n) + int64(l); end > int64(len(head)) {
+		if end > size {
+			return nil, io.ErrUnexpectedEOF
+		}
+		head = make([]byte, end)
+		if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	m, off, err := ReadMetadataFromBytes(head)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Index) == 0 {
+		return nil, ErrNotIndexed
+	}
+	s := &IndexedSet{Metadata: m, r: r, records: int64(off), size: size}
+	for i, e := range m.Index {
+		if e.Offset < 0 || s.records+e.Offset >= size || i > 0 && e.Offset <= m.Index[i-1].Offset {
+			return nil, fmt.Errorf("invalid index entry %d", i)
+		}
+	}
+	return s, nil
+}
+
+// Lookup returns the record covering addr, expired or not, and whether
+// there is one.
+func (s *IndexedSet) Lookup(addr netip.Addr) (ExpiringPrefix, bool, error) {
+	index := s.Metadata.Index
+	// The covering record, if any, is the last one starting at or before
+	// addr, in the last block starting at or before addr
+	i := sort.Search(len(index), func(i int) bool { return addr.Less(index[i].First) }) - 1
+	if i < 0 {
+		return ExpiringPrefix{}, false, nil
+	}
+	end := s.size
+	if i+1 < len(index) {
+		end = s.records + index[i+1].Offset
+	}
+	block := make([]byte, end-s.records-index[i].Offset)
+	if _, err := s.r.ReadAt(block, s.records+index[i].Offset); err != nil && err != io.EOF {
+		return ExpiringPrefix{}, false, err
+	}
+	for off := 0; off < len(block); {
+		rec, n, err := readRecord(block[off:])
+		if err != nil {
+			return ExpiringPrefix{}, false, fmt.Errorf("offset %d: %w", s.records+index[i].Offset+int64(off), err)
+		}
+		switch rec.kind {
+		case KindIPv4, KindIPv6:
+			if rec.prefix.Prefix.Contains(addr) {
+				return rec.prefix, true, nil
+			}
+		case KindRange:
+			if rec.rng.Contains(addr) {
+				for _, p := range rec.rng.Prefixes() {
+					if p.Contains(addr) {
+						return ExpiringPrefix{Prefix: p}, true, nil
+					}
+				}
+			}
+		}
+		if first := rec.first(); first.IsValid() && addr.Less(first) {
+			break
+		}
+		off += n
+	}
+	return ExpiringPrefix{}, false, nil
+}
+
+// HTTPReaderAt reads a remote object with HTTP range requests, e.g. an
+// object of S3 or GCS through its public or presigned HTTPS URL.
+type HTTPReaderAt struct {
+	URL string
+	// Client makes the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// Context bounds the requests, none if nil.
+	Context context.Context
+}
+
+// ReadAt reads len(b) bytes at offset off of the object.
+func (h *HTTPReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	resp, err := h.do(fmt.Sprintf("bytes=%d-%d", off, off+int64(len(b))-1))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, io.EOF
+	case http.StatusOK:
+		return 0, errors.New("server does not support range requests")
+	default:
+		return 0, fmt.Errorf("remote set: %s", resp.Status)
+	}
+	n, err := io.ReadFull(resp.Body, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Size returns the size of the object, from the Content-Range of a range
+// request for its first byte: unlike HEAD requests, it works with URLs
+// presigned for GET.
+func (h *HTTPReaderAt) Size() (int64, error) {
+	resp, err := h.do("bytes=0-0")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, nil // empty object
+	case http.StatusOK:
+		return 0, errors.New("server does not support range requests")
+	default:
+		return 0, fmt.Errorf("remote set: %s", resp.Status)
+	}
+	// bytes 0-0/<size>
+	_, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, errors.New("remote set: unknown size")
+	}
+	return size, nil
+}
+
+func (h *HTTPReaderAt) do(byteRange string) (*http.Response, error) {
+	ctx := h.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", byteRange)
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// OpenRemote opens the indexed binary set at url, an http or https URL, for
+// lookups with range requests. client is http.DefaultClient if nil.
+func OpenRemote(ctx context.Context, url string, client *http.Client) (*IndexedSet, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("not an http URL: %s", url)
+	}
+	h := &HTTPReaderAt{URL: url, Client: client, Context: ctx}
+	size, err := h.Size()
+	if err != nil {
+		return nil, err
+	}
+	return OpenIndexed(h, size)
+}
@@ -0,0 +1,123 @@
+package ipbin
+
+import (
+	"bytes"
+	"context"
+	"go4.org/netipx"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// indexedSet returns a binary set of many prefixes, indexed in small blocks
+func indexedSet(t *testing.T) ([]byte, *netipx.IPSet) {
+	var b netipx.IPSetBuilder
+	for i := range 5000 {
+		b.AddPrefix(netip.PrefixFrom(netip.AddrFrom4([4]byte{10, byte(i / 256), byte(i % 256), 0}), 25))
+		b.AddPrefix(netip.PrefixFrom(netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, byte(i / 256), byte(i % 256)}), 48))
+	}
+	ipset, _ := b.IPSet()
+	var records bytes.Buffer
+	if err := WriteEncodedAll(&records, ipset.Prefixes()); err != nil {
+		t.Fatal(err)
+	}
+	index, err := BuildIndex(records.Bytes(), 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteContainer(&buf, Metadata{Source: "test", Index: index}, records.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), ipset
+}
+
+func testLookups(t *testing.T, s *IndexedSet, ipset *netipx.IPSet) {
+	for _, a := range []string{"0.0.0.1", "10.0.0.0", "10.0.0.127", "10.0.0.128", "10.1.200.77", "10.19.135.5", "10.19.136.0",
+		"11.0.0.0", "::1", "2001:db8::1", "2001:db8:1387::", "2001:db8:1388::", "ffff::"} {
+		addr := netip.MustParseAddr(a)
+		ep, ok, err := s.Lookup(addr)
+		if err != nil {
+			t.Errorf("Lookup(%s): %v", a, err)
+			continue
+		}
+		want, wantOK := CoveringPrefix(ipset, addr)
+		if ok != wantOK || ok && ep.Prefix != want {
+			t.Errorf("Lookup(%s) = %s, %v, want %s, %v", a, ep.Prefix, ok, want, wantOK)
+		}
+	}
+}
+
+func TestIndexedSet(t *testing.T) {
+	data, ipset := indexedSet(t)
+	m, _, err := ReadMetadataFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Index) < 10 || m.Index[0].Offset != 0 || m.Index[0].First != netip.MustParseAddr("10.0.0.0") {
+		t.Errorf("got index %v", m.Index)
+	}
+	if prefixes, err := DecodeAll(data, DecodeOptions{}); err != nil || len(prefixes) != len(ipset.Prefixes()) {
+		t.Errorf("DecodeAll got %d prefixes, %v", len(prefixes), err)
+	}
+
+	s, err := OpenIndexed(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Metadata.Source != "test" {
+		t.Errorf("got metadata %+v", s.Metadata)
+	}
+	testLookups(t, s, ipset)
+
+	plain := AppendMetadata(nil, Metadata{Source: "test"})
+	if _, err := OpenIndexed(bytes.NewReader(plain), int64(len(plain))); err != ErrNotIndexed {
+		t.Errorf("set without index got %v", err)
+	}
+	if _, err := BuildIndex([]byte{32, 1, 1, 1, 1, 32, 1, 1, 1, 0}, 0); err == nil {
+		t.Errorf("unsorted records expected error")
+	}
+}
+
+func TestOpenRemote(t *testing.T) {
+	data, ipset := indexedSet(t)
+	var requested atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.Header.Get("Range") == "" {
+			t.Errorf("%s without range", r.Method)
+		}
+		rec := httptest.NewRecorder()
+		http.ServeContent(rec, r, "set.bin", time.Time{}, bytes.NewReader(data))
+		requested.Add(int64(rec.Body.Len()))
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+
+	s, err := OpenRemote(context.Background(), srv.URL+"/set.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testLookups(t, s, ipset)
+	if n := requested.Load(); n >= int64(len(data)) {
+		t.Errorf("read %d bytes of %d", n, len(data))
+	}
+
+	if _, err := OpenRemote(context.Background(), srv.URL+"/set.bin", nil); err != nil {
+		t.Error(err)
+	}
+	noRange := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer noRange.Close()
+	if _, err := OpenRemote(context.Background(), noRange.URL, nil); err == nil || !strings.Contains(err.Error(), "range requests") {
+		t.Errorf("server without ranges got %v", err)
+	}
+}
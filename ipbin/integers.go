@@ -0,0 +1,94 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"go4.org/netipx"
+	"net/netip"
+	"strconv"
+)
+
+// IntegerStyle selects how AppendRangeIntegers writes addresses.
+type IntegerStyle struct {
+	// Hex writes hexadecimal integers, zero-padded to their width, instead
+	// of decimal ones.
+	Hex bool
+	// IPv4As128 writes IPv4 addresses as the 128-bit integers of their
+	// IPv4-mapped IPv6 addresses instead of 32-bit integers.
+	IPv4As128 bool
+	// IPv6Halves writes IPv6 addresses as two 64-bit integers, the high
+	// then the low half, instead of a 128-bit integer.
+	IPv6Halves bool
+}
+
+// IntegerStyleParams returns the style of the "int-base" (dec or hex),
+// "int-ipv4" (uint32 or uint128) and "int-ipv6" (uint128 or uint64x2)
+// parameters.
+func IntegerStyleParams(params Params) (IntegerStyle, error) {
+	var style IntegerStyle
+	switch base := params.Get("int-base", "dec"); base {
+	case "dec":
+	case "hex":
+		style.Hex = true
+	default:
+		return style, fmt.Errorf("unknown integer base: %s", base)
+	}
+	switch v4 := params.Get("int-ipv4", "uint32"); v4 {
+	case "uint32":
+	case "uint128":
+		style.IPv4As128 = true
+	default:
+		return style, fmt.Errorf("unknown IPv4 integer type: %s", v4)
+	}
+	switch v6 := params.Get("int-ipv6", "uint128"); v6 {
+	case "uint128":
+	case "uint64x2":
+		style.IPv6Halves = true
+	default:
+		return style, fmt.Errorf("unknown IPv6 integer type: %s", v6)
+	}
+	return style, nil
+}
+
+// AppendRangeIntegers appends the first and last addresses of r to dst as
+// integers in style, separated by commas, e.g. "3221225984,3221226239" for
+// 192.0.2.0/24, or "2306139568115548160,0,2306139572410515455,
+// 18446744073709551615" for 2001:db8::/32 as 64-bit halves.
+func AppendRangeIntegers(dst []byte, r netipx.IPRange, style IntegerStyle) []byte {
+	dst = appendAddrInteger(dst, r.From(), style)
+	return appendAddrInteger(append(dst, ','), r.To(), style)
+}
+
+// appendAddrInteger appends addr to dst as integers in style.
+func appendAddrInteger(dst []byte, addr netip.Addr, style IntegerStyle) []byte {
+	if addr.Is4() && style.IPv4As128 {
+		addr = netip.AddrFrom16(addr.As16())
+	}
+	switch {
+	case addr.Is4() && style.Hex:
+		a := addr.As4()
+		return appendPaddedHex(dst, uint64(binary.BigEndian.Uint32(a[:])), 8)
+	case addr.Is4():
+		return AppendAddrDecimal(dst, addr)
+	}
+	a := addr.As16()
+	hi, lo := binary.BigEndian.Uint64(a[:8]), binary.BigEndian.Uint64(a[8:])
+	switch {
+	case style.IPv6Halves && style.Hex:
+		return appendPaddedHex(append(appendPaddedHex(dst, hi, 16), ','), lo, 16)
+	case style.IPv6Halves:
+		return strconv.AppendUint(append(strconv.AppendUint(dst, hi, 10), ','), lo, 10)
+	case style.Hex:
+		return appendPaddedHex(appendPaddedHex(dst, hi, 16), lo, 16)
+	}
+	return AppendAddrDecimal(dst, addr)
+}
+
+// appendPaddedHex appends v to dst in hexadecimal, zero-padded to width
+// digits.
+func appendPaddedHex(dst []byte, v uint64, width int) []byte {
+	for i := width - 1; i >= 0; i-- {
+		dst = append(dst, "0123456789abcdef"[v>>(4*i)&0xf])
+	}
+	return dst
+}
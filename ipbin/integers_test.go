@@ -0,0 +1,41 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+	"net/netip"
+	"testing"
+)
+
+func TestAppendRangeIntegers(t *testing.T) {
+	v4 := netipx.RangeOfPrefix(netip.MustParsePrefix("192.0.2.0/24"))
+	v6 := netipx.RangeOfPrefix(netip.MustParsePrefix("2001:db8::/32"))
+	tests := []struct {
+		r     netipx.IPRange
+		style IntegerStyle
+		want  string
+	}{
+		{v4, IntegerStyle{}, "3221225984,3221226239"},
+		{v4, IntegerStyle{Hex: true}, "c0000200,c00002ff"},
+		{v4, IntegerStyle{IPv4As128: true}, "281473902969344,281473902969599"},
+		{v4, IntegerStyle{IPv4As128: true, Hex: true}, "00000000000000000000ffffc0000200,00000000000000000000ffffc00002ff"},
+		{v6, IntegerStyle{}, "42540766411282592856903984951653826560,42540766490510755371168322545197776895"},
+		{v6, IntegerStyle{IPv6Halves: true}, "2306139568115548160,0,2306139572410515455,18446744073709551615"},
+		{v6, IntegerStyle{IPv6Halves: true, Hex: true}, "20010db800000000,0000000000000000,20010db8ffffffff,ffffffffffffffff"},
+		{v6, IntegerStyle{Hex: true}, "20010db8000000000000000000000000,20010db8ffffffffffffffffffffffff"},
+	}
+	for _, tt := range tests {
+		if got := string(AppendRangeIntegers(nil, tt.r, tt.style)); got != tt.want {
+			t.Errorf("%v %+v got %s, want %s", tt.r, tt.style, got, tt.want)
+		}
+	}
+
+	style, err := IntegerStyleParams(Params{"int-base": "hex", "int-ipv6": "uint64x2"})
+	if err != nil || style != (IntegerStyle{Hex: true, IPv6Halves: true}) {
+		t.Errorf("IntegerStyleParams got %+v, %v", style, err)
+	}
+	for _, params := range []Params{{"int-base": "oct"}, {"int-ipv4": "uint64"}, {"int-ipv6": "uint256"}} {
+		if _, err := IntegerStyleParams(params); err == nil {
+			t.Errorf("IntegerStyleParams(%v): expected an error", params)
+		}
+	}
+}
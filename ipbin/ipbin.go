@@ -115,7 +115,167 @@ func ReadPrefixFromBytes(buf []byte) (netip.Prefix, int, error) {
 		prefix := netip.PrefixFrom(netip.AddrFrom16(ipv6), prefixLen)
 		return prefix, numBytes, nil
 
+	case hdr == ZeroRunHeader: // IPv6 of format v2
+		if len(buf) < 3 {
+			return netip.Prefix{}, 0, io.ErrUnexpectedEOF
+		}
+		prefixLen := int(buf[1])
+		if prefixLen > 128 {
+			return netip.Prefix{}, 0, fmt.Errorf("invalid prefix length %d", prefixLen)
+		}
+		prefixBytesLen := (prefixLen + 7) / 8
+		off, run := int(buf[2]>>4), int(buf[2]&0xf)+1
+		if off+run > prefixBytesLen {
+			return netip.Prefix{}, 0, fmt.Errorf("invalid zero run %d+%d", off, run)
+		}
+		numBytes := 3 + prefixBytesLen - run
+		if len(buf) < numBytes {
+			return netip.Prefix{}, 0, io.ErrUnexpectedEOF
+		}
+		var ipv6 [16]byte
+		copy(ipv6[:off], buf[3:])
+		copy(ipv6[off+run:prefixBytesLen], buf[3+off:numBytes])
+		prefix := netip.PrefixFrom(netip.AddrFrom16(ipv6), prefixLen)
+		return prefix, numBytes, nil
+
 	default:
-		return netip.Prefix{}, 0, fmt.Errorf("invalid prefix header byte %d", hdr)
+		return netip.Prefix{}, 0, fmt.Errorf("invalid prefix header byte %d (%s)", hdr, HeaderKind(hdr))
+	}
+}
+
+// ZeroRunHeader is the header byte of the IPv6 records of format v2 which
+// leave out a run of zero bytes of their address: it is followed by the
+// prefix length, a byte holding the offset of the run in its high 4 bits
+// and its length minus 1 in its low 4 bits, then the
+// ceil(prefixLen / 8) bytes of the address but the run. Readers of format
+// v1 reject these records.
+const ZeroRunHeader = 164
+
+// ReadPrefix reads exactly one encoded prefix, of format v1 or v2, from r,
+// e.g. a network connection through a bufio.Reader, without buffering the
+// bytes following it. It returns io.EOF if r ends before the record and
+// io.ErrUnexpectedEOF if it ends within it.
+func ReadPrefix(r io.ByteReader) (netip.Prefix, error) {
+	var buf [3 + 16]byte
+	hdr, err := r.ReadByte()
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	buf[0] = hdr
+	n := 1
+	readByte := func() error {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		buf[n] = b
+		n++
+		return err
+	}
+	size := 1 // of the record, once its header is read
+	switch {
+	case hdr <= 32:
+		size += (int(hdr) + 7) / 8
+	case hdr <= 161:
+		size += (int(hdr) - 33 + 7) / 8
+	case hdr == ZeroRunHeader:
+		if err := readByte(); err != nil {
+			return netip.Prefix{}, err
+		}
+		if err := readByte(); err != nil {
+			return netip.Prefix{}, err
+		}
+		prefixLen, run := int(buf[1]), int(buf[2]&0xf)+1
+		if prefixLen > 128 || int(buf[2]>>4)+run > (prefixLen+7)/8 {
+			// Rejected by ReadPrefixFromBytes
+			size = n
+		} else {
+			size = 3 + (prefixLen+7)/8 - run
+		}
+	}
+	for n < size {
+		if err := readByte(); err != nil {
+			return netip.Prefix{}, err
+		}
+	}
+	p, _, err := ReadPrefixFromBytes(buf[:n])
+	return p, err
+}
+
+// AppendEncodedV2 is AppendEncoded in format v2: IPv6 prefixes whose
+// address bytes have a run of zeros, like 2001:db8::1/128 or
+// fd00:0:0:1::/64, are encoded without the longest one, when shorter.
+func AppendEncodedV2(dst []byte, p netip.Prefix) ([]byte, error) {
+	b, n, err := EncodePrefix(p)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Addr().Is6() {
+		return append(dst, b[:n]...), nil
+	}
+	// The longest run of zero bytes of the address, of 16 at most
+	payload := b[1:n]
+	off, run := 0, 0
+	for i := 0; i < len(payload); {
+		j := i
+		for j < len(payload) && payload[j] == 0 {
+			j++
+		}
+		if j-i > run {
+			off, run = i, j-i
+		}
+		i = j + 1
+	}
+	// Worth the 2 bytes of the length and the run
+	if run < 3 {
+		return append(dst, b[:n]...), nil
+	}
+	dst = append(dst, ZeroRunHeader, byte(p.Bits()), byte(off<<4|(run-1)))
+	dst = append(dst, payload[:off]...)
+	return append(dst, payload[off+run:]...), nil
+}
+
+// AppendRecordsV2 appends the records of a binary set, without metadata
+// block, to dst in format v2, their prefixes encoded by AppendEncodedV2,
+// keeping their expiry and values. Blocks of records are written anew,
+// other records and blocks are kept as they are.
+func AppendRecordsV2(dst, records []byte) ([]byte, error) {
+	for off := 0; off < len(records); {
+		rec, n, err := readRecord(records[off:])
+		if err != nil {
+			return nil, &ParseError{Offset: off, Err: err}
+		}
+		if rec.kind == KindBlock {
+			// Of new size and checksum
+			end := off + n + rec.blockSize
+			if end > len(records) {
+				return nil, &ParseError{Offset: off, Err: io.ErrUnexpectedEOF}
+			}
+			block, err := AppendRecordsV2(nil, records[off+n:end])
+			if err != nil {
+				return nil, err
+			}
+			dst = appendBlock(dst, block, rec.blockRecords)
+			off = end
+			continue
+		}
+		if rec.kind != KindIPv4 && rec.kind != KindIPv6 {
+			dst = append(dst, records[off:off+n]...)
+			off += n
+			continue
+		}
+		// The prefix ends the record, after its value and expiry, if any
+		_, start, _ := readValue(records[off:])
+		if records[off+start] == ExpiryHeader {
+			start += 1 + 8
+		}
+		dst = append(dst, records[off:off+start]...)
+		if records[off+start] == ZeroRunHeader {
+			dst = append(dst, records[off+start:off+n]...)
+		} else if dst, err = AppendEncodedV2(dst, rec.prefix.Prefix); err != nil {
+			return nil, err
+		}
+		off += n
 	}
+	return dst, nil
 }
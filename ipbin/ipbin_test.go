@@ -2,8 +2,10 @@ package ipbin
 
 import (
 	"bytes"
+	"io"
 	"net/netip"
 	"testing"
+	"time"
 )
 
 type testCase struct {
@@ -59,3 +61,91 @@ func TestDecodePrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestEncodeV2(t *testing.T) {
+	for _, tc := range []struct {
+		p    string
+		want []byte
+	}{
+		{"1.2.3.0/24", []byte{24, 1, 2, 3}},
+		{"2001:db8:abcd:1234::/64", []byte{64 + 33, 0x20, 0x01, 0x0d, 0xb8, 0xab, 0xcd, 0x12, 0x34}},
+		{"2001:db8::1/128", []byte{ZeroRunHeader, 128, 4<<4 | 10, 0x20, 0x01, 0x0d, 0xb8, 0x01}},
+		{"fd00:0:0:1::/64", []byte{ZeroRunHeader, 64, 1<<4 | 5, 0xfd, 0x01}},
+		{"::/128", []byte{ZeroRunHeader, 128, 0<<4 | 15}},
+	} {
+		p := netip.MustParsePrefix(tc.p)
+		got, err := AppendEncodedV2(nil, p)
+		if err != nil || !bytes.Equal(got, tc.want) {
+			t.Errorf("AppendEncodedV2(%v) got %v, %v, want %v", p, got, err, tc.want)
+		}
+		if decoded, n, err := ReadPrefixFromBytes(got); err != nil || decoded != p || n != len(got) {
+			t.Errorf("ReadPrefixFromBytes(%v) got %v, %d, %v", got, decoded, n, err)
+		}
+	}
+
+	var v1 []byte
+	v1, _ = AppendEncodedValued(v1, ValuedPrefix{Prefix: netip.MustParsePrefix("2001:db8::1/128"), Value: "7"})
+	v1, _ = AppendEncodedExpiring(v1, ExpiringPrefix{Prefix: netip.MustParsePrefix("2001:db8::2/128"), Expires: time.Unix(1<<31, 0)})
+	v1, _ = AppendEncoded(v1, netip.MustParsePrefix("10.0.0.0/8"))
+	v2, err := AppendRecordsV2(nil, v1)
+	if err != nil || len(v2) != len(v1)-2*9 {
+		t.Errorf("AppendRecordsV2 got %v, %v", v2, err)
+	}
+	if again, err := AppendRecordsV2(nil, v2); err != nil || !bytes.Equal(again, v2) {
+		t.Errorf("AppendRecordsV2 of format v2 got %v, %v", again, err)
+	}
+	got, err := DecodeValued(v2, time.Time{})
+	if err != nil || len(got) != 3 || got[0].Value != "7" || got[1].Prefix != netip.MustParsePrefix("2001:db8::2/128") {
+		t.Errorf("DecodeValued of format v2 got %v, %v", got, err)
+	}
+
+	if _, _, err := ReadPrefixFromBytes([]byte{ZeroRunHeader, 16, 1<<4 | 1, 0x20}); err == nil {
+		t.Error("ReadPrefixFromBytes of a zero run beyond the prefix succeeded")
+	}
+	if _, _, err := ReadPrefixFromBytes([]byte{ZeroRunHeader, 128, 4<<4 | 10, 0x20}); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadPrefixFromBytes of a truncated record got %v", err)
+	}
+}
+
+func TestReadPrefix(t *testing.T) {
+	var buf []byte
+	for _, tc := range cases {
+		buf = append(buf, tc.b...)
+	}
+	buf, _ = AppendEncodedV2(buf, netip.MustParsePrefix("2001:db8::1/128"))
+	r := bytes.NewReader(buf)
+	for _, tc := range cases {
+		if p, err := ReadPrefix(r); err != nil || p != tc.p {
+			t.Fatalf("ReadPrefix got %v, %v, want %v", p, err, tc.p)
+		}
+	}
+	if p, err := ReadPrefix(r); err != nil || p != netip.MustParsePrefix("2001:db8::1/128") {
+		t.Errorf("ReadPrefix of format v2 got %v, %v", p, err)
+	}
+	if _, err := ReadPrefix(r); err != io.EOF {
+		t.Errorf("ReadPrefix at the end got %v, want io.EOF", err)
+	}
+	if _, err := ReadPrefix(bytes.NewReader([]byte{32, 1, 5})); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadPrefix of a truncated record got %v", err)
+	}
+}
+
+func FuzzReadPrefix(f *testing.F) {
+	for _, tc := range cases {
+		f.Add(tc.b)
+	}
+	f.Add([]byte{ZeroRunHeader, 128, 4<<4 | 10, 0x20, 0x01, 0x0d, 0xb8, 0x01})
+	f.Add([]byte{ZeroRunHeader, 16, 1<<4 | 1, 0x20})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// ReadPrefix reads what ReadPrefixFromBytes reads, and nothing more
+		want, n, wantErr := ReadPrefixFromBytes(b)
+		r := bytes.NewReader(b)
+		got, err := ReadPrefix(r)
+		if (err == nil) != (wantErr == nil) || got != want {
+			t.Fatalf("ReadPrefix(%x) got %v, %v, want %v, %v", b, got, err, want, wantErr)
+		}
+		if err == nil && int(r.Size())-r.Len() != n {
+			t.Errorf("ReadPrefix(%x) read %d bytes, want %d", b, int(r.Size())-r.Len(), n)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package ipbin
+
+import (
+	"fmt"
+	"go4.org/netipx"
+	"net"
+	"net/netip"
+)
+
+// PrefixesFromIPNets converts nets, as used by older libraries and APIs
+// like the name constraints of x509.Certificate, into prefixes. IPv4
+// networks are IPv4 prefixes, whatever the length of their IP. Nil
+// networks and non-contiguous masks are an error.
+func PrefixesFromIPNets(nets []*net.IPNet) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, len(nets))
+	for i, n := range nets {
+		if n == nil {
+			return nil, fmt.Errorf("network %d: nil", i+1)
+		}
+		p, ok := prefixFromIPNet(n)
+		if !ok {
+			return nil, fmt.Errorf("network %d: invalid network %v", i+1, n)
+		}
+		prefixes[i] = p
+	}
+	return prefixes, nil
+}
+
+// prefixFromIPNet converts n into a prefix, an IPv4 one for an IPv4 or
+// IPv4-mapped IP with a 4 or 16-byte mask.
+func prefixFromIPNet(n *net.IPNet) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(n.IP)
+	ones, bits := n.Mask.Size()
+	if !ok || bits == 0 {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	switch {
+	case addr.Is4() && bits == 128:
+		if ones < 96 {
+			return netip.Prefix{}, false
+		}
+		ones -= 96
+	case addr.Is6() && bits == 32:
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(addr, ones), true
+}
+
+// MergeIPNets merges nets into the minimal set of covering prefixes.
+func MergeIPNets(nets []*net.IPNet) (*netipx.IPSet, error) {
+	prefixes, err := PrefixesFromIPNets(nets)
+	if err != nil {
+		return nil, err
+	}
+	return MergePrefixes(prefixes)
+}
+
+// IPNetsFromPrefixes converts prefixes into networks, masked, with 4-byte
+// IPs for IPv4 prefixes.
+func IPNetsFromPrefixes(prefixes []netip.Prefix) []*net.IPNet {
+	nets := make([]*net.IPNet, len(prefixes))
+	for i, p := range prefixes {
+		nets[i] = netipx.PrefixIPNet(p.Masked())
+	}
+	return nets
+}
+
+// IPNets returns the prefixes of ipset as networks.
+func IPNets(ipset *netipx.IPSet) []*net.IPNet {
+	return IPNetsFromPrefixes(ipset.Prefixes())
+}
@@ -0,0 +1,46 @@
+package ipbin
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestIPNets(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("10.0.0.0/25")
+	_, v6, _ := net.ParseCIDR("2001:db8::/32")
+	// An IPv4 network with a 16-byte IP and mask, as some APIs return
+	v4in6 := &net.IPNet{IP: net.ParseIP("10.0.0.128"), Mask: net.CIDRMask(121, 128)}
+	prefixes, err := PrefixesFromIPNets([]*net.IPNet{v4, v6, v4in6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/25"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("10.0.0.128/25"),
+	}
+	if !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("PrefixesFromIPNets got %v, want %v", prefixes, expected)
+	}
+
+	ipset, err := MergeIPNets([]*net.IPNet{v4, v6, v4in6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nets := IPNets(ipset)
+	if len(nets) != 2 || nets[0].String() != "10.0.0.0/24" || len(nets[0].IP) != 4 || nets[1].String() != "2001:db8::/32" {
+		t.Errorf("IPNets got %v", nets)
+	}
+	if got := IPNetsFromPrefixes([]netip.Prefix{netip.MustParsePrefix("192.0.2.1/24")}); got[0].String() != "192.0.2.0/24" {
+		t.Errorf("IPNetsFromPrefixes got %v", got)
+	}
+
+	bad := &net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.IPv4Mask(255, 0, 255, 0)}
+	for _, nets := range [][]*net.IPNet{{nil}, {bad}} {
+		if _, err := PrefixesFromIPNets(nets); err == nil {
+			t.Errorf("%v: expected an error", nets)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package ipbin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+	"time"
+)
+
+// JournalOp is the operation of a journal entry.
+type JournalOp byte
+
+const (
+	JournalAdd    JournalOp = '+'
+	JournalRemove JournalOp = '-'
+)
+
+// JournalEntry records that Prefix was added to or removed from a set at
+// Time.
+//
+// A journal is an append-only concatenation of entries, each encoded as the
+// operation byte ('+' or '-'), the time as a big-endian int64 of Unix
+// seconds, then the encoded prefix.
+type JournalEntry struct {
+	Time   time.Time
+	Op     JournalOp
+	Prefix netip.Prefix
+}
+
+func (e JournalEntry) String() string {
+	return fmt.Sprintf("%s %c %s", e.Time.UTC().Format(time.RFC3339), e.Op, e.Prefix)
+}
+
+// AppendJournalEntry appends the encoded entry e to dst.
+func AppendJournalEntry(dst []byte, e JournalEntry) ([]byte, error) {
+	if e.Op != JournalAdd && e.Op != JournalRemove {
+		return nil, fmt.Errorf("invalid journal operation %q", e.Op)
+	}
+	dst = append(dst, byte(e.Op))
+	dst = binary.BigEndian.AppendUint64(dst, uint64(e.Time.Unix()))
+	return AppendEncoded(dst, e.Prefix)
+}
+
+// ReadJournal reads the entries of a journal.
+func ReadJournal(r io.Reader) ([]JournalEntry, error) {
+	data, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	var entries []JournalEntry
+	for len(data) > 0 {
+		op := JournalOp(data[0])
+		if op != JournalAdd && op != JournalRemove {
+			return nil, fmt.Errorf("invalid journal operation byte %d", data[0])
+		}
+		if len(data) < 1+8 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		t := time.Unix(int64(binary.BigEndian.Uint64(data[1:9])), 0).UTC()
+		p, n, err := ReadPrefixFromBytes(data[9:])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, JournalEntry{Time: t, Op: op, Prefix: p})
+		data = data[9+n:]
+	}
+	return entries, nil
+}
+
+// Replay returns the set resulting from applying, in order, the entries of
+// journal made at or before at.
+func Replay(journal []JournalEntry, at time.Time) (*netipx.IPSet, error) {
+	var b netipx.IPSetBuilder
+	for _, e := range journal {
+		if e.Time.After(at) {
+			continue
+		}
+		if e.Op == JournalAdd {
+			b.AddPrefix(e.Prefix)
+		} else {
+			b.RemovePrefix(e.Prefix)
+		}
+	}
+	return b.IPSet()
+}
+
+// JournalChanges returns the entries at t turning prev into next: the
+// removal of the addresses of prev missing from next, then the addition of
+// those new in next.
+func JournalChanges(prev, next *netipx.IPSet, t time.Time) ([]JournalEntry, error) {
+	var removed, added netipx.IPSetBuilder
+	removed.AddSet(prev)
+	removed.RemoveSet(next)
+	added.AddSet(next)
+	added.RemoveSet(prev)
+	var entries []JournalEntry
+	for _, c := range []struct {
+		b  *netipx.IPSetBuilder
+		op JournalOp
+	}{{&removed, JournalRemove}, {&added, JournalAdd}} {
+		set, err := c.b.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range set.Prefixes() {
+			entries = append(entries, JournalEntry{Time: t, Op: c.op, Prefix: p})
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,75 @@
+package ipbin
+
+import (
+	"bytes"
+	"go4.org/netipx"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	v0, err := MergePrefixes([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/23")})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	v1, err := MergePrefixes([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/24"), netip.MustParsePrefix("2001:db8::/32")})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var journal []JournalEntry
+	for _, c := range []struct {
+		prev, next *netipx.IPSet
+		t          time.Time
+	}{{&netipx.IPSet{}, v0, t0}, {v0, v1, t1}} {
+		entries, err := JournalChanges(c.prev, c.next, c.t)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		journal = append(journal, entries...)
+	}
+	expected := []JournalEntry{
+		{t0, JournalAdd, netip.MustParsePrefix("10.0.0.0/23")},
+		{t1, JournalRemove, netip.MustParsePrefix("10.0.1.0/24")},
+		{t1, JournalAdd, netip.MustParsePrefix("2001:db8::/32")},
+	}
+	if !reflect.DeepEqual(journal, expected) {
+		t.Errorf("JournalChanges got %v\nwant %v", journal, expected)
+	}
+
+	var b []byte
+	for _, e := range journal {
+		if b, err = AppendJournalEntry(b, e); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	read, err := ReadJournal(bytes.NewReader(b))
+	if err != nil || !reflect.DeepEqual(read, journal) {
+		t.Errorf("ReadJournal got %v, %v", read, err)
+	}
+	if _, err := ReadJournal(bytes.NewReader(b[:len(b)-1])); err == nil {
+		t.Errorf("truncated journal expected error")
+	}
+
+	for _, c := range []struct {
+		at       time.Time
+		expected *netipx.IPSet
+	}{{t0.Add(-time.Second), &netipx.IPSet{}}, {t0, v0}, {t1.Add(-time.Second), v0}, {t1, v1}} {
+		set, err := Replay(journal, c.at)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !set.Equal(c.expected) {
+			t.Errorf("Replay at %v got %v, want %v", c.at, set.Prefixes(), c.expected.Prefixes())
+		}
+	}
+}
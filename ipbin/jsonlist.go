@@ -0,0 +1,19 @@
+package ipbin
+
+import (
+	"encoding/json"
+	"io"
+	"net/netip"
+)
+
+// ParseJSONList parses the addresses, prefixes and ranges selected by path
+// (see parsePath) in an arbitrary JSON document, like a vendor feed without
+// a parser of its own, e.g. with ".data[].ip" or ".blocklist[]". Like
+// ParseYAMLList, strings may hold several entries separated by commas.
+func ParseJSONList(r io.Reader, path string) ([]netip.Prefix, error) {
+	var doc any
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return parseDocumentPrefixes([]any{doc}, path)
+}
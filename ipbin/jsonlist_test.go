@@ -0,0 +1,57 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONList(t *testing.T) {
+	input := `{
+  "meta": {"count": 3},
+  "data": [
+    {"ip": "192.0.2.1", "score": 90},
+    {"ip": "2001:db8::/32", "score": 75},
+    {"ip": null, "score": 10}
+  ],
+  "ranges": ["10.0.0.0/8, 10.1.0.0/16"]
+}`
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{".data[].ip", []string{"192.0.2.1/32", "2001:db8::/32"}},
+		{".data[] | .ip", []string{"192.0.2.1/32", "2001:db8::/32"}},
+		{".data[0].ip", []string{"192.0.2.1/32"}},
+		{".ranges", []string{"10.0.0.0/8", "10.1.0.0/16"}},
+		{".missing", nil},
+	}
+	for _, tt := range tests {
+		nets, err := ParseJSONList(strings.NewReader(input), tt.path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		var want []netip.Prefix
+		for _, s := range tt.want {
+			want = append(want, netip.MustParsePrefix(s))
+		}
+		if !reflect.DeepEqual(nets, want) {
+			t.Errorf("%s got %v, want %v", tt.path, nets, want)
+		}
+	}
+
+	nets, err := ParseJSONList(strings.NewReader(`["192.0.2.0/24", "198.51.100.7"]`), "")
+	if err != nil || len(nets) != 2 {
+		t.Errorf("array got %v, %v", nets, err)
+	}
+	for _, path := range []string{".data[].score", ".data", ".meta.count"} {
+		if _, err := ParseJSONList(strings.NewReader(input), path); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+	if _, err := ParseJSONList(strings.NewReader(`{"a": `), ""); err == nil {
+		t.Error("expected an error for truncated JSON")
+	}
+}
@@ -0,0 +1,112 @@
+package ipbin
+
+import (
+	"bufio"
+	"io"
+	"net/netip"
+	"strconv"
+)
+
+// DefaultManifestEntries is the default number of CIDRs per Kubernetes
+// manifest written by WriteNetworkPolicies and WriteCiliumCIDRGroups,
+// keeping objects well below the etcd request size limit and fast to
+// apply.
+const DefaultManifestEntries = 1000
+
+// chunkPrefixes splits prefixes into chunks of at most size prefixes, or a
+// single chunk if size is not positive.
+func chunkPrefixes(prefixes []netip.Prefix, size int) [][]netip.Prefix {
+	if size <= 0 {
+		size = len(prefixes)
+	}
+	var chunks [][]netip.Prefix
+	for len(prefixes) > size {
+		chunks = append(chunks, prefixes[:size])
+		prefixes = prefixes[size:]
+	}
+	return append(chunks, prefixes)
+}
+
+// chunkName returns the name of the i-th (0-based) object holding a chunk
+// of a set named name: name, then name-2, name-3...
+func chunkName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return name + "-" + strconv.Itoa(i+1)
+}
+
+// NetworkPolicyOptions configures WriteNetworkPolicies.
+type NetworkPolicyOptions struct {
+	Name      string
+	Namespace string // omitted if empty
+	// Ingress allows traffic from the prefixes instead of traffic to them.
+	Ingress bool
+	// MaxEntries is the maximum number of ipBlocks per policy,
+	// DefaultManifestEntries if 0.
+	MaxEntries int
+}
+
+// WriteNetworkPolicies writes Kubernetes NetworkPolicy manifests allowing
+// egress traffic to prefixes (or ingress traffic from them) for all pods
+// of the namespace, as a multi-document YAML stream. Prefixes are spread
+// over as many policies as needed to keep at most opts.MaxEntries ipBlocks
+// per policy; the policies are named as the chunks of WAFIPSets are.
+func WriteNetworkPolicies(w io.Writer, prefixes []netip.Prefix, opts NetworkPolicyOptions) error {
+	if opts.MaxEntries == 0 {
+		opts.MaxEntries = DefaultManifestEntries
+	}
+	policyType, direction, peer := "Egress", "egress", "to"
+	if opts.Ingress {
+		policyType, direction, peer = "Ingress", "ingress", "from"
+	}
+	bw := bufio.NewWriter(w)
+	for i, chunk := range chunkPrefixes(prefixes, opts.MaxEntries) {
+		if i > 0 {
+			bw.WriteString("---\n")
+		}
+		bw.WriteString("apiVersion: networking.k8s.io/v1\nkind: NetworkPolicy\nmetadata:\n")
+		bw.WriteString("  name: " + chunkName(opts.Name, i) + "\n")
+		if opts.Namespace != "" {
+			bw.WriteString("  namespace: " + opts.Namespace + "\n")
+		}
+		bw.WriteString("spec:\n  podSelector: {}\n  policyTypes:\n  - " + policyType + "\n")
+		if len(chunk) == 0 {
+			// No peers: the policy isolates the pods without allowing anything
+			continue
+		}
+		bw.WriteString("  " + direction + ":\n  - " + peer + ":\n")
+		for _, p := range chunk {
+			bw.WriteString("    - ipBlock:\n        cidr: " + p.Masked().String() + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteCiliumCIDRGroups writes CiliumCIDRGroup manifests holding prefixes,
+// as a multi-document YAML stream, with at most maxEntries CIDRs per group
+// (DefaultManifestEntries if 0). The groups are named as the chunks of
+// WAFIPSets are, and can be selected together in CiliumNetworkPolicies by
+// listing them in fromCIDRSet/toCIDRSet cidrGroupRef entries.
+func WriteCiliumCIDRGroups(w io.Writer, prefixes []netip.Prefix, name string, maxEntries int) error {
+	if maxEntries == 0 {
+		maxEntries = DefaultManifestEntries
+	}
+	bw := bufio.NewWriter(w)
+	for i, chunk := range chunkPrefixes(prefixes, maxEntries) {
+		if i > 0 {
+			bw.WriteString("---\n")
+		}
+		bw.WriteString("apiVersion: cilium.io/v2alpha1\nkind: CiliumCIDRGroup\nmetadata:\n")
+		bw.WriteString("  name: " + chunkName(name, i) + "\n")
+		if len(chunk) == 0 {
+			bw.WriteString("spec:\n  externalCIDRs: []\n")
+			continue
+		}
+		bw.WriteString("spec:\n  externalCIDRs:\n")
+		for _, p := range chunk {
+			bw.WriteString("  - " + p.Masked().String() + "\n")
+		}
+	}
+	return bw.Flush()
+}
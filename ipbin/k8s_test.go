@@ -0,0 +1,74 @@
+package ipbin
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func TestWriteNetworkPolicies(t *testing.T) {
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("198.51.100.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	var buf bytes.Buffer
+	err := WriteNetworkPolicies(&buf, prefixes, NetworkPolicyOptions{Name: "allow", Namespace: "web", MaxEntries: 2})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow
+  namespace: web
+spec:
+  podSelector: {}
+  policyTypes:
+  - Egress
+  egress:
+  - to:
+    - ipBlock:
+        cidr: 192.0.2.0/24
+    - ipBlock:
+        cidr: 198.51.100.1/32
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-2
+  namespace: web
+spec:
+  podSelector: {}
+  policyTypes:
+  - Egress
+  egress:
+  - to:
+    - ipBlock:
+        cidr: 2001:db8::/32
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteCiliumCIDRGroups(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCiliumCIDRGroups(&buf, []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}, "blocklist", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := `apiVersion: cilium.io/v2alpha1
+kind: CiliumCIDRGroup
+metadata:
+  name: blocklist
+spec:
+  externalCIDRs:
+  - 192.0.2.0/24
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,71 @@
+package ipbin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// ErrInputTooLarge is returned when reading more than ParseOptions.MaxBytes
+// bytes of input.
+var ErrInputTooLarge = errors.New("input too large")
+
+// LimitReader returns a reader reading from r which fails with
+// ErrInputTooLarge instead of returning more than n bytes. Unlike
+// io.LimitReader, it does not silently truncate the input.
+func LimitReader(r io.Reader, n int64) io.Reader {
+	return &limitedReader{r: r, n: n}
+}
+
+type limitedReader struct {
+	r io.Reader
+	n int64 // remaining bytes
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// Tell the end of the input from more of it
+		var b [1]byte
+		if n, err := l.r.Read(b[:]); n > 0 {
+			return 0, ErrInputTooLarge
+		} else if err != nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// checkEntries returns an error if nets has more than maxEntries prefixes,
+// unless maxEntries is 0.
+func checkEntries(nets []netip.Prefix, maxEntries int) error {
+	if maxEntries > 0 && len(nets) > maxEntries {
+		return fmt.Errorf("%w (maximum %d)", ErrTooManyRecords, maxEntries)
+	}
+	return nil
+}
+
+// limitParser enforces the limits and the default route policy of
+// ParseOptions around parse. Parsers which can, like the text one, check
+// MaxEntries as they go too.
+func limitParser(parse ParserFunc) ParserFunc {
+	return func(r io.Reader, opts ParseOptions) ([]netip.Prefix, error) {
+		if opts.MaxBytes > 0 {
+			r = LimitReader(r, opts.MaxBytes)
+		}
+		nets, err := parse(r, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkEntries(nets, opts.MaxEntries); err != nil {
+			return nil, err
+		}
+		return ApplyDefaultRoutePolicy(nets, opts.DefaultRoutes)
+	}
+}
@@ -0,0 +1,41 @@
+package ipbin
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLimitReader(t *testing.T) {
+	b, err := io.ReadAll(LimitReader(strings.NewReader("1.2.3.4\n"), 8))
+	if err != nil || string(b) != "1.2.3.4\n" {
+		t.Errorf("input at the limit got %q, %v", b, err)
+	}
+	if _, err := io.ReadAll(LimitReader(strings.NewReader("1.2.3.4\n"), 7)); err != ErrInputTooLarge {
+		t.Errorf("input over the limit got %v", err)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	parse, _ := InputFormat("text")
+	input := strings.Repeat("0.0.0.0-255.255.255.255\n", 100)
+	if nets, err := parse(strings.NewReader(input), ParseOptions{MaxEntries: 100}); err != nil || len(nets) != 100 {
+		t.Errorf("got %d prefixes, %v", len(nets), err)
+	}
+	if _, err := parse(strings.NewReader(input), ParseOptions{MaxEntries: 99}); !errors.Is(err, ErrTooManyRecords) {
+		t.Errorf("MaxEntries got %v", err)
+	}
+	if _, err := parse(strings.NewReader(input), ParseOptions{MaxBytes: int64(len(input)) - 1}); err != ErrInputTooLarge {
+		t.Errorf("MaxBytes got %v", err)
+	}
+
+	// Formats without their own checks are limited after parsing
+	parse, _ = InputFormat("stix")
+	bundle := `{"type": "bundle", "objects": [
+		{"type": "indicator", "pattern": "[ipv4-addr:value = '192.0.2.1']"},
+		{"type": "indicator", "pattern": "[ipv4-addr:value = '192.0.2.2']"}]}`
+	if _, err := parse(strings.NewReader(bundle), ParseOptions{MaxEntries: 1}); !errors.Is(err, ErrTooManyRecords) {
+		t.Errorf("stix MaxEntries got %v", err)
+	}
+}
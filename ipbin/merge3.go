@@ -0,0 +1,82 @@
+package ipbin
+
+import (
+	"fmt"
+	"go4.org/netipx"
+	"net/netip"
+)
+
+// Merge3Conflict is a change of one side of a three-way merge overlapping
+// an opposite change of the other side.
+type Merge3Conflict struct {
+	// Added is a prefix added by one side.
+	Added netip.Prefix
+	// Removed is a prefix of the base removed by the other side,
+	// overlapping Added.
+	Removed netip.Prefix
+	// Ours is set if ours added Added and theirs removed Removed, unset if
+	// the other way around.
+	Ours bool
+}
+
+func (c Merge3Conflict) String() string {
+	adder, remover := "theirs", "ours"
+	if c.Ours {
+		adder, remover = remover, adder
+	}
+	return fmt.Sprintf("%s added %s, %s removed %s", adder, c.Added, remover, c.Removed)
+}
+
+// Merge3 merges the changes of ours and theirs to base, e.g. the versions
+// of a set edited on two branches: the addresses of the result are those
+// of base removed by neither side, and those added by either.
+//
+// Like the lines of a text merge, the sides are also compared by the
+// prefixes of the sets, as in DiffPrefixes, and a prefix added by one side
+// overlapping a prefix removed by the other is reported as a conflict, e.g.
+// ours widening 10.0.0.0/24 to 10.0.0.0/23 while theirs removes it. The
+// result then holds the addresses of both changes which do not overlap,
+// 10.0.1.0/24 in the example, to be reviewed.
+func Merge3(base, ours, theirs *netipx.IPSet) (*netipx.IPSet, []Merge3Conflict, error) {
+	var kept netipx.IPSetBuilder
+	kept.AddSet(base)
+	kept.Intersect(ours)
+	kept.Intersect(theirs)
+	keptSet, err := kept.IPSet()
+	if err != nil {
+		return nil, nil, err
+	}
+	var b netipx.IPSetBuilder
+	b.AddSet(ours)
+	b.AddSet(theirs)
+	b.RemoveSet(base)
+	b.AddSet(keptSet)
+	merged, err := b.IPSet()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oursAdded, oursRemoved := DiffPrefixes(base.Prefixes(), ours.Prefixes())
+	theirsAdded, theirsRemoved := DiffPrefixes(base.Prefixes(), theirs.Prefixes())
+	conflicts := overlappingPrefixes(oursAdded, theirsRemoved, true)
+	conflicts = append(conflicts, overlappingPrefixes(theirsAdded, oursRemoved, false)...)
+	return merged, conflicts, nil
+}
+
+// overlappingPrefixes returns the conflicts of the added prefixes
+// overlapping the removed ones, both sorted and disjoint.
+func overlappingPrefixes(added, removed []netip.Prefix, ours bool) []Merge3Conflict {
+	var conflicts []Merge3Conflict
+	for i, j := 0, 0; i < len(added) && j < len(removed); {
+		a, r := netipx.RangeOfPrefix(added[i]), netipx.RangeOfPrefix(removed[j])
+		if a.Overlaps(r) {
+			conflicts = append(conflicts, Merge3Conflict{Added: added[i], Removed: removed[j], Ours: ours})
+		}
+		if a.To().Less(r.To()) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,57 @@
+package ipbin
+
+import (
+	"fmt"
+	"go4.org/netipx"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	set := func(s string) *netipx.IPSet {
+		var b netipx.IPSetBuilder
+		for _, p := range strings.Fields(s) {
+			b.AddPrefix(netip.MustParsePrefix(p))
+		}
+		ipset, err := b.IPSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ipset
+	}
+	tests := []struct {
+		base, ours, theirs string
+		want               string
+		conflicts          string
+	}{
+		// Both sides add and remove different prefixes
+		{
+			"10.0.0.0/24 10.2.0.0/24 2001:db8::/32",
+			"10.0.0.0/24 10.1.0.0/24 2001:db8::/32",
+			"10.0.0.0/24 10.2.0.0/24 10.3.0.0/24",
+			"[10.0.0.0/24 10.1.0.0/24 10.3.0.0/24]", "[]",
+		},
+		// The same change on both sides
+		{"10.0.0.0/24", "10.0.0.0/24 10.1.0.0/24", "10.0.0.0/24 10.1.0.0/24", "[10.0.0.0/24 10.1.0.0/24]", "[]"},
+		// Ours widens what theirs removes
+		{"10.0.0.0/24", "10.0.0.0/23", "", "[10.0.1.0/24]", "[ours added 10.0.0.0/23, theirs removed 10.0.0.0/24]"},
+		// Theirs splits what ours removes, keeping part of it
+		{
+			"10.0.0.0/24 192.0.2.0/24", "192.0.2.0/24", "10.0.0.0/25 192.0.2.0/24",
+			"[192.0.2.0/24]", "[theirs added 10.0.0.0/25, ours removed 10.0.0.0/24]",
+		},
+	}
+	for _, tt := range tests {
+		merged, conflicts, err := Merge3(set(tt.base), set(tt.ours), set(tt.theirs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(merged.Prefixes()); got != tt.want {
+			t.Errorf("%s / %s / %s: got %s, want %s", tt.base, tt.ours, tt.theirs, got, tt.want)
+		}
+		if got := fmt.Sprint(conflicts); got != tt.conflicts {
+			t.Errorf("%s / %s / %s: conflicts %s, want %s", tt.base, tt.ours, tt.theirs, got, tt.conflicts)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package ipbin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// MISPIPTypes are the MISP attribute types carrying an IP address. They
+// are the default selection of ParseMISPCSV and ParseMISPJSON.
+var MISPIPTypes = []string{"ip-src", "ip-dst", "ip-src|port", "ip-dst|port", "domain|ip"}
+
+// appendMISPAttribute appends the address of a MISP attribute to nets if
+// its type is one of types (MISPIPTypes if empty). Composite types carry the
+// address in their ip component: "1.2.3.4|80" for ip-src|port and
+// ip-dst|port, "example.com|1.2.3.4" for domain|ip.
+func appendMISPAttribute(nets []netip.Prefix, types []string, typ, value string) ([]netip.Prefix, error) {
+	if len(types) == 0 {
+		types = MISPIPTypes
+	}
+	if !matchAny(types, typ) {
+		return nets, nil
+	}
+	switch typ {
+	case "ip-src|port", "ip-dst|port":
+		value, _, _ = strings.Cut(value, "|")
+	case "domain|ip":
+		_, value, _ = strings.Cut(value, "|")
+	case "ip-src", "ip-dst":
+	default:
+		return nets, nil
+	}
+	nets, err := appendParsedPrefix(nets, value)
+	if err != nil {
+		return nil, fmt.Errorf("misp: invalid %s attribute %q: %w", typ, value, err)
+	}
+	return nets, nil
+}
+
+// ParseMISPCSV parses a MISP CSV export (restSearch with returnFormat csv,
+// or a CSV feed), returning the addresses of the attributes whose type is
+// one of types (MISPIPTypes if empty). The first row must be a header
+// naming the "type" and "value" columns.
+func ParseMISPCSV(r io.Reader, types []string) (nets []netip.Prefix, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	typeCol, valueCol := -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case "type":
+			typeCol = i
+		case "value":
+			valueCol = i
+		}
+	}
+	if typeCol < 0 || valueCol < 0 {
+		return nil, errors.New("misp: csv header lacks type or value column")
+	}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nets, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if typeCol >= len(record) || valueCol >= len(record) {
+			continue
+		}
+		if nets, err = appendMISPAttribute(nets, types, record[typeCol], record[valueCol]); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type mispAttribute struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type mispEvent struct {
+	Attribute []mispAttribute `json:"Attribute"`
+	Object    []struct {
+		Attribute []mispAttribute `json:"Attribute"`
+	} `json:"Object"`
+}
+
+// ParseMISPJSON parses MISP JSON: a feed event file ({"Event": {...}}), a
+// restSearch attribute export ({"response": {"Attribute": [...]}}) or a
+// restSearch event export ({"response": [{"Event": {...}}, ...]}),
+// returning the addresses of the attributes, including object attributes,
+// whose type is one of types (MISPIPTypes if empty).
+func ParseMISPJSON(r io.Reader, types []string) (nets []netip.Prefix, err error) {
+	var doc struct {
+		Event    *mispEvent      `json:"Event"`
+		Response json.RawMessage `json:"response"`
+	}
+	if err = json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	var attrs []mispAttribute
+	addEvent := func(e *mispEvent) {
+		attrs = append(attrs, e.Attribute...)
+		for _, o := range e.Object {
+			attrs = append(attrs, o.Attribute...)
+		}
+	}
+	if doc.Event != nil {
+		addEvent(doc.Event)
+	}
+	if len(doc.Response) > 0 {
+		if doc.Response[0] == '[' {
+			var events []struct {
+				Event mispEvent `json:"Event"`
+			}
+			if err = json.Unmarshal(doc.Response, &events); err != nil {
+				return nil, err
+			}
+			for i := range events {
+				addEvent(&events[i].Event)
+			}
+		} else {
+			var resp struct {
+				Attribute []mispAttribute `json:"Attribute"`
+			}
+			if err = json.Unmarshal(doc.Response, &resp); err != nil {
+				return nil, err
+			}
+			attrs = append(attrs, resp.Attribute...)
+		}
+	}
+	for _, a := range attrs {
+		if nets, err = appendMISPAttribute(nets, types, a.Type, a.Value); err != nil {
+			return nil, err
+		}
+	}
+	return nets, nil
+}
@@ -0,0 +1,66 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMISPCSV(t *testing.T) {
+	input := `uuid,event_id,category,type,value,comment,to_ids,date
+5c0a...,1,Network activity,ip-dst,198.51.100.1,"C2, seen twice",1,1545214800
+5c0b...,1,Network activity,domain,example.com,,1,1545214800
+5c0c...,1,Network activity,ip-src|port,203.0.113.0/24|443,,1,1545214800
+5c0d...,2,Network activity,domain|ip,example.org|2001:db8::1,,0,1545214800
+`
+	nets, err := ParseMISPCSV(strings.NewReader(input), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("198.51.100.1/32"),
+		netip.MustParsePrefix("203.0.113.0/24"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v, want %v", nets, expected)
+	}
+
+	nets, err = ParseMISPCSV(strings.NewReader(input), []string{"ip-dst"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if expected := []netip.Prefix{netip.MustParsePrefix("198.51.100.1/32")}; !reflect.DeepEqual(nets, expected) {
+		t.Errorf("ip-dst got %v, want %v", nets, expected)
+	}
+
+	if _, err := ParseMISPCSV(strings.NewReader("a,b\n1,2\n"), nil); err == nil {
+		t.Errorf("missing columns expected error")
+	}
+}
+
+func TestParseMISPJSON(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{"feed event", `{"Event": {"info": "x", "Attribute": [{"type": "ip-src", "value": "198.51.100.1"}, {"type": "md5", "value": "d41d8cd98f00b204e9800998ecf8427e"}],
+			"Object": [{"name": "ip-port", "Attribute": [{"type": "ip-dst", "value": "203.0.113.0/24"}]}]}}`},
+		{"attribute search", `{"response": {"Attribute": [{"type": "ip-src", "value": "198.51.100.1"}, {"type": "ip-dst|port", "value": "203.0.113.0/24|80"}]}}`},
+		{"event search", `{"response": [{"Event": {"Attribute": [{"type": "ip-src", "value": "198.51.100.1"}]}}, {"Event": {"Attribute": [{"type": "ip-dst", "value": "203.0.113.0/24"}]}}]}`},
+	}
+	expected := []netip.Prefix{netip.MustParsePrefix("198.51.100.1/32"), netip.MustParsePrefix("203.0.113.0/24")}
+	for _, c := range cases {
+		nets, err := ParseMISPJSON(strings.NewReader(c.input), nil)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(nets, expected) {
+			t.Errorf("%s: got %v, want %v", c.name, nets, expected)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package ipbin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// MMDB is a MaxMind DB (https://maxmind.github.io/MaxMind-DB/) held in
+// memory, such as the GeoLite2 country and city databases.
+type MMDB struct {
+	buf        []byte
+	data       []byte // data section
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // node reached after the 96 zero bits leading to IPv4 space
+	ipv4Bits   int  // number of those bits actually traversed
+}
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+var errMMDBCorrupt = errors.New("mmdb: invalid database")
+
+// OpenMMDB reads the MaxMind DB file at path.
+func OpenMMDB(path string) (*MMDB, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewMMDB(b)
+}
+
+// NewMMDB parses the MaxMind DB contained in b. The slice is retained.
+func NewMMDB(b []byte) (*MMDB, error) {
+	i := bytes.LastIndex(b, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, errors.New("mmdb: metadata not found")
+	}
+	meta, _, err := decodeMMDBValue(b[i+len(mmdbMetadataMarker):], 0)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := meta.(map[string]any)
+	if !ok {
+		return nil, errMMDBCorrupt
+	}
+	db := &MMDB{buf: b}
+	nodeCount, ok1 := m["node_count"].(uint64)
+	recordSize, ok2 := m["record_size"].(uint64)
+	ipVersion, ok3 := m["ip_version"].(uint64)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, errMMDBCorrupt
+	}
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, fmt.Errorf("mmdb: unsupported record size %d", recordSize)
+	}
+	db.nodeCount, db.recordSize, db.ipVersion = uint(nodeCount), uint(recordSize), uint(ipVersion)
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, errMMDBCorrupt
+	}
+	db.data = b[treeSize+16 : i]
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for ; db.ipv4Bits < 96 && node < db.nodeCount; db.ipv4Bits++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (db *MMDB) record(node uint, bit byte) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.buf[node*6+uint(bit)*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(db.buf[node*8+uint(bit)*4:]))
+	}
+}
+
+// start returns the node to start the lookup of addr from, the address
+// bytes to traverse and the number of tree bits preceding them.
+func (db *MMDB) start(addr netip.Addr) (node uint, ip []byte, skipped int, err error) {
+	if addr.Is4() {
+		ip4 := addr.As4()
+		if db.ipVersion == 4 {
+			return 0, ip4[:], 0, nil
+		}
+		return db.ipv4Start, ip4[:], db.ipv4Bits, nil
+	}
+	if db.ipVersion == 4 {
+		return 0, nil, 0, fmt.Errorf("mmdb: IPv6 address %s in an IPv4 database", addr)
+	}
+	ip16 := addr.As16()
+	return 0, ip16[:], 0, nil
+}
+
+// Lookup returns the record of the network containing addr and that
+// network. The record is nil if the database has no data for addr.
+func (db *MMDB) Lookup(addr netip.Addr) (record any, network netip.Prefix, err error) {
+	node, ip, skipped, err := db.start(addr)
+	if err != nil {
+		return nil, netip.Prefix{}, err
+	}
+	bits := skipped
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, ip[i/8]>>(7-i%8)&1)
+		bits++
+	}
+	bits -= skipped
+	if bits < 0 {
+		bits = 0 // IPv4 space is not delegated below ::/96
+	}
+	network, _ = addr.Prefix(bits)
+	record, err = db.resolve(node)
+	return record, network, err
+}
+
+// resolve decodes the data record a search tree record points to.
+func (db *MMDB) resolve(rec uint) (any, error) {
+	if rec <= db.nodeCount {
+		return nil, nil
+	}
+	offset := rec - db.nodeCount - 16
+	if offset >= uint(len(db.data)) {
+		return nil, errMMDBCorrupt
+	}
+	v, _, err := decodeMMDBValue(db.data, offset)
+	return v, err
+}
+
+// Split returns p split into the networks of the database, so that all
+// addresses of each returned prefix share the same record. Prefixes within
+// one network of the database are returned unchanged.
+func (db *MMDB) Split(p netip.Prefix) ([]netip.Prefix, error) {
+	p = p.Masked()
+	node, ip, _, err := db.start(p.Addr())
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < p.Bits(); i++ {
+		if node >= db.nodeCount {
+			return []netip.Prefix{p}, nil
+		}
+		node = db.record(node, ip[i/8]>>(7-i%8)&1)
+	}
+	var out []netip.Prefix
+	db.walk(node, p, &out)
+	return out, nil
+}
+
+// walk appends the networks of the subtree rooted at node, covering p.
+func (db *MMDB) walk(node uint, p netip.Prefix, out *[]netip.Prefix) {
+	if node >= db.nodeCount || p.Bits() == p.Addr().BitLen() {
+		*out = append(*out, p)
+		return
+	}
+	left, right := splitPrefix(p)
+	db.walk(db.record(node, 0), left, out)
+	db.walk(db.record(node, 1), right, out)
+}
+
+// Networks returns the networks of the database having a record, IPv4
+// networks first. In IPv6 databases, IPv4 networks are read from ::/96 and
+// the aliases of that subtree (e.g. ::ffff:0:0/96, 2002::/16) are skipped.
+func (db *MMDB) Networks() []netip.Prefix {
+	var out []netip.Prefix
+	if db.ipVersion == 4 {
+		db.networks(0, netip.MustParsePrefix("0.0.0.0/0"), db.nodeCount, &out)
+		return out
+	}
+	if db.ipv4Bits == 96 {
+		db.networks(db.ipv4Start, netip.MustParsePrefix("0.0.0.0/0"), db.nodeCount, &out)
+	}
+	db.networks(0, netip.MustParsePrefix("::/0"), db.ipv4Start, &out)
+	return out
+}
+
+// networks appends the networks having a record of the subtree rooted at
+// node, covering p, to out. Subtrees rooted at node skip are ignored.
+func (db *MMDB) networks(node uint, p netip.Prefix, skip uint, out *[]netip.Prefix) {
+	switch {
+	case node == skip && node < db.nodeCount:
+		return
+	case node > db.nodeCount:
+		*out = append(*out, p)
+	case node < db.nodeCount && p.Bits() < p.Addr().BitLen():
+		left, right := splitPrefix(p)
+		db.networks(db.record(node, 0), left, skip, out)
+		db.networks(db.record(node, 1), right, skip, out)
+	}
+}
+
+// splitPrefix returns the two halves of p.
+func splitPrefix(p netip.Prefix) (netip.Prefix, netip.Prefix) {
+	bits := p.Bits() + 1
+	left := netip.PrefixFrom(p.Addr(), bits)
+	if p.Addr().Is4() {
+		ip := p.Addr().As4()
+		ip[p.Bits()/8] |= 0x80 >> (p.Bits() % 8)
+		return left, netip.PrefixFrom(netip.AddrFrom4(ip), bits)
+	}
+	ip := p.Addr().As16()
+	ip[p.Bits()/8] |= 0x80 >> (p.Bits() % 8)
+	return left, netip.PrefixFrom(netip.AddrFrom16(ip), bits)
+}
+
+// MMDB data section types.
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// decodeMMDBValue decodes the value at offset of data section b, returning
+// it and the offset following it. Maps decode to map[string]any, arrays to
+// []any, unsigned integers to uint64 (*big.Int for uint128), int32 to
+// int32, double to float64 and float to float32.
+func decodeMMDBValue(b []byte, offset uint) (any, uint, error) {
+	if offset >= uint(len(b)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	ctrl := b[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+	if typ == mmdbPointer {
+		ss := uint(ctrl>>3) & 0x3
+		n := ss + 1
+		if offset+n > uint(len(b)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		var ptr uint
+		if ss < 3 {
+			ptr = uint(ctrl & 0x7)
+		}
+		for _, c := range b[offset : offset+n] {
+			ptr = ptr<<8 | uint(c)
+		}
+		ptr += [4]uint{0, 2048, 526336, 0}[ss]
+		v, _, err := decodeMMDBValue(b, ptr)
+		return v, offset + n, err
+	}
+	if typ == mmdbExtended {
+		if offset >= uint(len(b)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		typ = 7 + uint(b[offset])
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(b)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		var ext uint
+		for _, c := range b[offset : offset+n] {
+			ext = ext<<8 | uint(c)
+		}
+		size = [3]uint{29, 285, 65821}[n-1] + ext
+		offset += n
+	}
+
+	switch typ {
+	case mmdbMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := decodeMMDBValue(b, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errMMDBCorrupt
+			}
+			v, next, err := decodeMMDBValue(b, next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := decodeMMDBValue(b, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(b)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	payload := b[offset : offset+size]
+	offset += size
+	switch typ {
+	case mmdbString:
+		return string(payload), offset, nil
+	case mmdbBytes:
+		return append([]byte(nil), payload...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(payload)), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbInt32:
+		if size > 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		var u uint64
+		for _, c := range payload {
+			u = u<<8 | uint64(c)
+		}
+		if typ == mmdbInt32 {
+			return int32(u), offset, nil
+		}
+		return u, offset, nil
+	case mmdbUint128:
+		return new(big.Int).SetBytes(payload), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("mmdb: unsupported data type %d", typ)
+	}
+}
+
+// GeoIPAnnotator annotates prefixes with the ISO 3166-1 country code found
+// in a MaxMind country or city database ("country" attribute). The
+// registered country is used for networks without a located country.
+//
+// GeoIPAnnotator implements Splitter, so that prefixes spanning several
+// countries are annotated per country.
+type GeoIPAnnotator struct {
+	DB *MMDB
+}
+
+func (a *GeoIPAnnotator) Annotate(p netip.Prefix) (map[string]string, error) {
+	record, _, err := a.DB.Lookup(p.Addr())
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]string{}
+	m, _ := record.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := m[key].(map[string]any)
+		if code, ok := country["iso_code"].(string); ok {
+			attrs["country"] = code
+			break
+		}
+	}
+	return attrs, nil
+}
+
+func (a *GeoIPAnnotator) Split(p netip.Prefix) ([]netip.Prefix, error) {
+	return a.DB.Split(p)
+}
@@ -0,0 +1,178 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// mmdbTestNode is a search tree node of a database built by buildTestMMDB
+type mmdbTestNode struct {
+	child [2]*mmdbTestNode
+	leaf  bool
+	data  uint
+}
+
+func mmdbTestString(s string) []byte {
+	return append([]byte{mmdbString<<5 | byte(len(s))}, s...)
+}
+
+func mmdbTestUint(typ byte, v uint32) []byte {
+	return []byte{typ<<5 | 4, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// buildTestMMDB builds a database with 24-bit records mapping each prefix
+// to a {"country": {"iso_code": code}} record.
+func buildTestMMDB(ipVersion int, countries map[netip.Prefix]string) []byte {
+	var data []byte
+	root := &mmdbTestNode{}
+	for p, code := range countries {
+		ip := p.Addr().AsSlice()
+		bits := p.Bits()
+		if ipVersion == 6 && p.Addr().Is4() {
+			ip = append(make([]byte, 12), ip...)
+			bits += 96
+		}
+		n := root
+		for i := 0; i < bits; i++ {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if n.child[bit] == nil {
+				n.child[bit] = &mmdbTestNode{}
+			}
+			n = n.child[bit]
+		}
+		n.leaf, n.data = true, uint(len(data))
+		data = append(data, mmdbMap<<5|1)
+		data = append(data, mmdbTestString("country")...)
+		data = append(data, mmdbMap<<5|1)
+		data = append(data, mmdbTestString("iso_code")...)
+		data = append(data, mmdbTestString(code)...)
+	}
+
+	var nodes []*mmdbTestNode
+	index := map[*mmdbTestNode]uint{}
+	var number func(n *mmdbTestNode)
+	number = func(n *mmdbTestNode) {
+		index[n] = uint(len(nodes))
+		nodes = append(nodes, n)
+		for _, c := range n.child {
+			if c != nil && !c.leaf {
+				number(c)
+			}
+		}
+	}
+	number(root)
+	nodeCount := uint(len(nodes))
+
+	var b []byte
+	for _, n := range nodes {
+		for _, c := range n.child {
+			rec := nodeCount
+			switch {
+			case c == nil:
+			case c.leaf:
+				rec = nodeCount + 16 + c.data
+			default:
+				rec = index[c]
+			}
+			b = append(b, byte(rec>>16), byte(rec>>8), byte(rec))
+		}
+	}
+	b = append(b, make([]byte, 16)...)
+	b = append(b, data...)
+	b = append(b, mmdbMetadataMarker...)
+	b = append(b, mmdbMap<<5|3)
+	b = append(b, mmdbTestString("node_count")...)
+	b = append(b, mmdbTestUint(mmdbUint32, uint32(nodeCount))...)
+	b = append(b, mmdbTestString("record_size")...)
+	b = append(b, mmdbTestUint(mmdbUint16, 24)...)
+	b = append(b, mmdbTestString("ip_version")...)
+	b = append(b, mmdbTestUint(mmdbUint16, uint32(ipVersion))...)
+	return b
+}
+
+var testCountries = map[netip.Prefix]string{
+	netip.MustParsePrefix("1.0.0.0/9"):   "AU",
+	netip.MustParsePrefix("1.128.0.0/9"): "JP",
+	netip.MustParsePrefix("2.0.0.0/8"):   "FR",
+}
+
+func TestMMDBLookup(t *testing.T) {
+	for _, ipVersion := range []int{4, 6} {
+		db, err := NewMMDB(buildTestMMDB(ipVersion, testCountries))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		record, network, err := db.Lookup(netip.MustParseAddr("2.3.4.5"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		want := map[string]any{"country": map[string]any{"iso_code": "FR"}}
+		if !reflect.DeepEqual(record, want) || network != netip.MustParsePrefix("2.0.0.0/8") {
+			t.Errorf("ip_version %d: Lookup got %v %v", ipVersion, record, network)
+		}
+		record, _, err = db.Lookup(netip.MustParseAddr("3.0.0.1"))
+		if err != nil || record != nil {
+			t.Errorf("ip_version %d: Lookup of unknown address got %v, %v", ipVersion, record, err)
+		}
+	}
+}
+
+func TestMMDBNetworks(t *testing.T) {
+	countries := map[netip.Prefix]string{netip.MustParsePrefix("2001:db8::/32"): "DE"}
+	for p, code := range testCountries {
+		countries[p] = code
+	}
+	db, err := NewMMDB(buildTestMMDB(6, countries))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("1.0.0.0/9"),
+		netip.MustParsePrefix("1.128.0.0/9"),
+		netip.MustParsePrefix("2.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	if got := db.Networks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Networks got %v, want %v", got, want)
+	}
+}
+
+func TestGeoIPAnnotator(t *testing.T) {
+	db, err := NewMMDB(buildTestMMDB(4, testCountries))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var builder netipx.IPSetBuilder
+	builder.AddPrefix(netip.MustParsePrefix("1.0.0.0/8"))
+	builder.AddPrefix(netip.MustParsePrefix("2.0.0.0/8"))
+	ipset, _ := builder.IPSet()
+
+	aps, err := Annotate(ipset, &GeoIPAnnotator{DB: db})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []AnnotatedPrefix{
+		{netip.MustParsePrefix("1.0.0.0/9"), map[string]string{"country": "AU"}},
+		{netip.MustParsePrefix("1.128.0.0/9"), map[string]string{"country": "JP"}},
+		{netip.MustParsePrefix("2.0.0.0/8"), map[string]string{"country": "FR"}},
+	}
+	if !reflect.DeepEqual(aps, want) {
+		t.Errorf("Annotate got %v, want %v", aps, want)
+	}
+
+	kept := FilterAnnotated(aps, "country", []string{"au", "fr"}, true)
+	if got := AnnotatedPrefixes(kept); !reflect.DeepEqual(got, []netip.Prefix{want[0].Prefix, want[2].Prefix}) {
+		t.Errorf("FilterAnnotated keep got %v", got)
+	}
+	dropped := FilterAnnotated(aps, "country", []string{"AU", "FR"}, false)
+	if got := AnnotatedPrefixes(dropped); !reflect.DeepEqual(got, []netip.Prefix{want[1].Prefix}) {
+		t.Errorf("FilterAnnotated drop got %v", got)
+	}
+}
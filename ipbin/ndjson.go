@@ -0,0 +1,48 @@
+package ipbin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/netip"
+)
+
+// ParseNDJSON parses the addresses, prefixes and ranges selected by path
+// (see parsePath) in each record of newline-delimited JSON, like the
+// exports of Elasticsearch or the JSONEachRow output of ClickHouse, e.g.
+// with "._source.client.ip". Records are read one at a time, so inputs of
+// any size are streamed; records without the field are skipped.
+func ParseNDJSON(r io.Reader, path string) ([]netip.Prefix, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = "."
+	}
+	br := bufio.NewReader(r)
+	var nets []netip.Prefix
+	for line := 1; ; line++ {
+		record, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if record = bytes.TrimSpace(record); len(record) > 0 {
+			var doc any
+			if err := json.Unmarshal(record, &doc); err != nil {
+				return nil, &ParseError{Line: line, Err: err}
+			}
+			for _, n := range selectPath(doc, steps) {
+				var nerr error
+				if nets, nerr = appendNodePrefixes(nets, n, path); nerr != nil {
+					return nil, &ParseError{Line: line, Err: nerr}
+				}
+			}
+		}
+		if err != nil {
+			return nets, nil
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package ipbin
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNDJSON(t *testing.T) {
+	input := `{"_index":"logs","_source":{"client":{"ip":"192.0.2.1"},"status":403}}
+{"_index":"logs","_source":{"client":{"ip":"2001:db8::1"},"status":403}}
+
+{"_index":"logs","_source":{"status":200}}
+{"_index":"logs","_source":{"client":{"ip":"198.51.100.0/24"}}}`
+	nets, err := ParseNDJSON(strings.NewReader(input), "._source.client.ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+		netip.MustParsePrefix("198.51.100.0/24"),
+	}
+	if !reflect.DeepEqual(nets, want) {
+		t.Errorf("got %v, want %v", nets, want)
+	}
+
+	// A malformed record is located by its line
+	var perr *ParseError
+	_, err = ParseNDJSON(strings.NewReader("{\"ip\":\"192.0.2.1\"}\n{\"ip\":\n"), ".ip")
+	if !errors.As(err, &perr) || perr.Line != 2 {
+		t.Errorf("got %v, want a parse error on line 2", err)
+	}
+	_, err = ParseNDJSON(strings.NewReader("{\"ip\":\"192.0.2.1\"}\r\n{\"ip\":\"bogus\"}\r\n"), ".ip")
+	if !errors.As(err, &perr) || perr.Line != 2 {
+		t.Errorf("got %v, want a parse error on line 2", err)
+	}
+}
@@ -0,0 +1,135 @@
+package ipbin
+
+import (
+	"errors"
+	"go4.org/netipx"
+	"io/fs"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// Overrides are prefixes added to or removed from a set at runtime, e.g.
+// through the admin API of ipbin publish, whatever the inputs of the set.
+// They are persisted as a journal (see JournalEntry), so that they survive
+// restarts: additions as JournalAdd entries, removals as JournalRemove
+// ones. The last operation on an address wins.
+type Overrides struct {
+	path string
+
+	mu      sync.Mutex
+	added   *netipx.IPSet
+	removed *netipx.IPSet
+}
+
+// OpenOverrides returns the overrides persisted in the journal at path,
+// none if it does not exist yet.
+func OpenOverrides(path string) (*Overrides, error) {
+	o := &Overrides{path: path, added: &netipx.IPSet{}, removed: &netipx.IPSet{}}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := ReadJournal(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.apply(entries); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Add adds prefixes to the set, persisting them first.
+func (o *Overrides) Add(prefixes []netip.Prefix) error {
+	return o.record(JournalAdd, prefixes)
+}
+
+// Remove removes prefixes from the set, persisting them first.
+func (o *Overrides) Remove(prefixes []netip.Prefix) error {
+	return o.record(JournalRemove, prefixes)
+}
+
+// record appends the entries of op on prefixes to the journal, synced,
+// then applies them.
+func (o *Overrides) record(op JournalOp, prefixes []netip.Prefix) error {
+	now := time.Now()
+	entries := make([]JournalEntry, len(prefixes))
+	var data []byte
+	for i, p := range prefixes {
+		entries[i] = JournalEntry{Time: now, Op: op, Prefix: p.Masked()}
+		var err error
+		if data, err = AppendJournalEntry(data, entries[i]); err != nil {
+			return err
+		}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f, err := os.OpenFile(o.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return o.apply(entries)
+}
+
+// apply applies entries to the overrides, with o.mu held or not shared yet.
+func (o *Overrides) apply(entries []JournalEntry) error {
+	var added, removed netipx.IPSetBuilder
+	added.AddSet(o.added)
+	removed.AddSet(o.removed)
+	for _, e := range entries {
+		if e.Op == JournalAdd {
+			added.AddPrefix(e.Prefix)
+			removed.RemovePrefix(e.Prefix)
+		} else {
+			removed.AddPrefix(e.Prefix)
+			added.RemovePrefix(e.Prefix)
+		}
+	}
+	a, err := added.IPSet()
+	if err != nil {
+		return err
+	}
+	r, err := removed.IPSet()
+	if err != nil {
+		return err
+	}
+	o.added, o.removed = a, r
+	return nil
+}
+
+// Apply returns set with the overrides: without the removed addresses and
+// with the added ones.
+func (o *Overrides) Apply(set *netipx.IPSet) (*netipx.IPSet, error) {
+	o.mu.Lock()
+	added, removed := o.added, o.removed
+	o.mu.Unlock()
+	var b netipx.IPSetBuilder
+	b.AddSet(set)
+	b.RemoveSet(removed)
+	b.AddSet(added)
+	return b.IPSet()
+}
+
+// Sets returns the addresses added and removed by the overrides.
+func (o *Overrides) Sets() (added, removed *netipx.IPSet) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.added, o.removed
+}
@@ -0,0 +1,51 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.journal")
+	o, err := OpenOverrides(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b netipx.IPSetBuilder
+	b.AddPrefix(netip.MustParsePrefix("10.0.0.0/8"))
+	b.AddPrefix(netip.MustParsePrefix("192.0.2.0/24"))
+	feed, _ := b.IPSet()
+
+	if err := o.Add([]netip.Prefix{netip.MustParsePrefix("198.51.100.7/32"), netip.MustParsePrefix("203.0.113.1/24")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Remove([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/9"), netip.MustParsePrefix("203.0.113.0/25")}); err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.128.0.0/9"),
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("198.51.100.7/32"),
+		netip.MustParsePrefix("203.0.113.128/25"),
+	}
+	set, err := o.Apply(feed)
+	if err != nil || !reflect.DeepEqual(set.Prefixes(), want) {
+		t.Errorf("Apply got %v, %v", set.Prefixes(), err)
+	}
+
+	// Persisted across restarts
+	reopened, err := OpenOverrides(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set, err := reopened.Apply(feed); err != nil || !reflect.DeepEqual(set.Prefixes(), want) {
+		t.Errorf("Apply after reopening got %v, %v", set.Prefixes(), err)
+	}
+	added, removed := reopened.Sets()
+	if len(added.Prefixes()) != 2 || len(removed.Prefixes()) != 2 {
+		t.Errorf("Sets got %v, %v", added.Prefixes(), removed.Prefixes())
+	}
+}
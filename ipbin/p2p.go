@@ -0,0 +1,66 @@
+package ipbin
+
+import (
+	"bufio"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ParseP2P parses a PeerGuardian P2P blocklist, as still distributed by
+// Bluetack and iblocklist: one "description:start-end" IPv4 range per
+// line, the description possibly containing colons itself. Addresses may
+// be zero-padded, like 001.002.003.004. Empty lines and comments starting
+// with '#' are skipped.
+func ParseP2P(r io.Reader) (nets []netip.Prefix, err error) {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := normalizeLine(scanner.Text())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		i := strings.LastIndexByte(text, ':')
+		startS, endS, ok := strings.Cut(text[i+1:], "-")
+		if i < 0 || !ok {
+			return nil, &ParseError{Line: line, Err: fmt.Errorf("invalid P2P entry %q", text)}
+		}
+		start, err := parseP2PAddr(startS)
+		if err != nil {
+			return nil, &ParseError{Line: line, Err: err}
+		}
+		end, err := parseP2PAddr(endS)
+		if err != nil {
+			return nil, &ParseError{Line: line, Err: err}
+		}
+		rng := netipx.IPRangeFrom(start, end)
+		if !rng.IsValid() {
+			return nil, &ParseError{Line: line, Err: fmt.Errorf("invalid P2P range %s-%s", start, end)}
+		}
+		nets = rng.AppendPrefixes(nets)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nets, nil
+}
+
+// parseP2PAddr parses a possibly zero-padded IPv4 address, which
+// netip.ParseAddr rejects as ambiguous.
+func parseP2PAddr(s string) (netip.Addr, error) {
+	octets := strings.Split(strings.TrimSpace(s), ".")
+	if len(octets) != 4 {
+		return netip.Addr{}, fmt.Errorf("invalid P2P address %q", s)
+	}
+	var b [4]byte
+	for i, o := range octets {
+		n, err := strconv.ParseUint(o, 10, 8)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("invalid P2P address %q", s)
+		}
+		b[i] = byte(n)
+	}
+	return netip.AddrFrom4(b), nil
+}
@@ -0,0 +1,36 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testP2P = `# Bluetack level1
+Some ISP: Customer Block:001.002.004.000-001.002.007.255
+Bogon:10.0.0.0-10.0.0.1
+
+Single host:192.168.1.1-192.168.1.1
+`
+
+func TestParseP2P(t *testing.T) {
+	nets, err := ParseP2P(strings.NewReader(testP2P))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("1.2.4.0/22"),
+		netip.MustParsePrefix("10.0.0.0/31"),
+		netip.MustParsePrefix("192.168.1.1/32"),
+	}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v\nwant %v", nets, expected)
+	}
+
+	for _, s := range []string{"no range here", "x:1.2.3.4", "x:1.2.3.256-1.2.3.4", "x:1.2.3.9-1.2.3.4"} {
+		if _, err := ParseP2P(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
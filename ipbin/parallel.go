@@ -0,0 +1,141 @@
+package ipbin
+
+import (
+	"context"
+	"io"
+	"net/netip"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// parallelChunk is the number of records encoded by a worker at a time
+const parallelChunk = 16384
+
+// EncodeParallel writes the encodings of records 0 to n-1 to w, in order.
+// encode appends the encoding of record i to dst and must be safe for
+// concurrent use: chunks of records are encoded by workers goroutines,
+// GOMAXPROCS if workers is 0 or less, while an ordered writer writes them.
+// At most 2 chunks per worker are kept in memory.
+func EncodeParallel(w io.Writer, n, workers int, encode func(dst []byte, i int) ([]byte, error)) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers == 1 || n <= parallelChunk {
+		return encodeSerial(w, n, encode)
+	}
+
+	type chunk struct {
+		start, end int
+		buf        []byte
+		err        error
+		done       chan struct{}
+	}
+	jobs := make(chan *chunk)
+	ordered := make(chan *chunk, 2*workers)
+	stop := make(chan struct{})
+	defer close(stop)
+	for range workers {
+		go func() {
+			for c := range jobs {
+				for i := c.start; i < c.end && c.err == nil; i++ {
+					c.buf, c.err = encode(c.buf, i)
+				}
+				close(c.done)
+			}
+		}()
+	}
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		for start := 0; start < n; start += parallelChunk {
+			c := &chunk{start: start, end: min(start+parallelChunk, n), done: make(chan struct{})}
+			// A chunk is queued for writing before encoding, so that the
+			// queue bounds the chunks in memory
+			select {
+			case ordered <- c:
+			case <-stop:
+				return
+			}
+			select {
+			case jobs <- c:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for c := range ordered {
+		<-c.done
+		if c.err != nil {
+			return c.err
+		}
+		if _, err := w.Write(c.buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeSerial is EncodeParallel with a single worker.
+func encodeSerial(w io.Writer, n int, encode func(dst []byte, i int) ([]byte, error)) error {
+	buf := make([]byte, 0, 32*1024)
+	for i := 0; i < n; i++ {
+		var err error
+		if buf, err = encode(buf, i); err != nil {
+			return err
+		}
+		if len(buf) >= 32*1024 {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// decodeBlocks is decodeAllInto for sets of blocks of records, decoding the
+// blocks spans of buf by opts.Workers goroutines, GOMAXPROCS if 0 or less,
+// then appending their prefixes to dst in order.
+func decodeBlocks(ctx context.Context, dst []netip.Prefix, buf []byte, spans []blockSpan, opts DecodeOptions) ([]netip.Prefix, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	results := make([][]netip.Prefix, len(spans))
+	errs := make([]error, len(spans))
+	var next atomic.Int64
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for range min(workers, len(spans)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < len(spans) && !failed.Load(); i = int(next.Add(1) - 1) {
+				s := spans[i]
+				results[i], errs[i] = decodeRecords(ctx, make([]netip.Prefix, 0, s.records), buf, s.start, s.end, opts, -1)
+				if errs[i] != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	total := 0
+	for i, prefixes := range results {
+		if errs[i] != nil {
+			return dst, errs[i]
+		}
+		total += len(prefixes)
+	}
+	if err := ctx.Err(); err != nil {
+		return dst, err
+	}
+	prefixes := slices.Grow(dst, total)
+	for _, p := range results {
+		prefixes = append(prefixes, p...)
+	}
+	return prefixes, nil
+}
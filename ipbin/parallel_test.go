@@ -0,0 +1,50 @@
+package ipbin
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+type failWriter struct{ n int }
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if w.n--; w.n < 0 {
+		return 0, errors.New("disk full")
+	}
+	return len(p), nil
+}
+
+func TestEncodeParallel(t *testing.T) {
+	encode := func(dst []byte, i int) ([]byte, error) {
+		return append(strconv.AppendInt(dst, int64(i), 10), '\n'), nil
+	}
+	n := 5*parallelChunk + 7
+	var want, got bytes.Buffer
+	if err := EncodeParallel(&want, n, 1, encode); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := EncodeParallel(&got, n, 4, encode); err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) || !bytes.HasSuffix(want.Bytes(), []byte("\n"+strconv.Itoa(n-1)+"\n")) {
+		t.Errorf("parallel encoding differs from serial encoding")
+	}
+
+	errBad := errors.New("bad record")
+	failing := func(dst []byte, i int) ([]byte, error) {
+		if i == 3*parallelChunk+1 {
+			return nil, errBad
+		}
+		return encode(dst, i)
+	}
+	if err := EncodeParallel(&got, n, 4, failing); err != errBad {
+		t.Errorf("encoding error got %v", err)
+	}
+	if err := EncodeParallel(&failWriter{2}, n, 4, encode); err == nil || err.Error() != "disk full" {
+		t.Errorf("writing error got %v", err)
+	}
+}
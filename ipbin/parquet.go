@@ -0,0 +1,233 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"math"
+	"net/netip"
+)
+
+// parquetMagic starts and ends Parquet files.
+const parquetMagic = "PAR1"
+
+// Parquet physical types, encodings and other enumerations of the format
+// (https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift)
+const (
+	parquetByteArray    = 6
+	parquetFixedLen     = 7
+	parquetRequired     = 0
+	parquetUTF8         = 0
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetUncompressed = 0
+	parquetDataPage     = 0
+)
+
+// parquetColumn is a column chunk of a single PLAIN-encoded data page.
+type parquetColumn struct {
+	name   string
+	typ    int32
+	length int32 // of fixed-length byte arrays
+	utf8   bool
+	data   []byte
+}
+
+// WriteParquetRanges writes the prefixes as a Parquet file of one row per
+// prefix, with columns start_u128 and end_u128, the first and last
+// addresses as 16-byte big-endian unsigned integers, IPv4 addresses mapped
+// into IPv6 (::ffff:192.0.2.0), and prefix, the prefix as a string. The
+// addresses compare as byte strings, so that Spark or DuckDB join event
+// tables against the set with range conditions, e.g. in DuckDB
+//
+//	SELECT e.* FROM events e JOIN 'set.parquet' s
+//	ON ip_u128 BETWEEN s.start_u128 AND s.end_u128
+//
+// where ip_u128 is the address of the event in the same representation.
+func WriteParquetRanges(w io.Writer, prefixes []netip.Prefix) error {
+	columns := []parquetColumn{
+		{name: "start_u128", typ: parquetFixedLen, length: 16},
+		{name: "end_u128", typ: parquetFixedLen, length: 16},
+		{name: "prefix", typ: parquetByteArray, utf8: true},
+	}
+	for _, p := range prefixes {
+		r := netipx.RangeOfPrefix(p)
+		first, last := r.From().As16(), r.To().As16()
+		columns[0].data = append(columns[0].data, first[:]...)
+		columns[1].data = append(columns[1].data, last[:]...)
+		s := p.Masked().String()
+		columns[2].data = binary.LittleEndian.AppendUint32(columns[2].data, uint32(len(s)))
+		columns[2].data = append(columns[2].data, s...)
+	}
+
+	// The column chunks, each a data page and its header, then the file
+	// metadata
+	out := []byte(parquetMagic)
+	var meta thriftWriter
+	meta.i32(1, 1) // version
+	meta.list(2, thriftStruct, len(columns)+1)
+	meta.begin()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.end()
+	for _, c := range columns {
+		meta.begin()
+		meta.i32(1, c.typ)
+		if c.length > 0 {
+			meta.i32(2, c.length)
+		}
+		meta.i32(3, parquetRequired)
+		meta.str(4, c.name)
+		if c.utf8 {
+			meta.i32(6, parquetUTF8)
+			meta.field(10, thriftStruct) // logicalType, a STRING
+			meta.begin()
+			meta.field(1, thriftStruct)
+			meta.begin()
+			meta.end()
+			meta.end()
+		}
+		meta.end()
+	}
+	meta.i64(3, int64(len(prefixes)))
+	meta.list(4, thriftStruct, 1) // row groups
+	meta.begin()
+	meta.list(1, thriftStruct, len(columns))
+	var total int64
+	for _, c := range columns {
+		if len(c.data) > math.MaxInt32 {
+			return fmt.Errorf("parquet column %s of %d bytes too large", c.name, len(c.data))
+		}
+		var page thriftWriter
+		page.i32(1, parquetDataPage)
+		page.i32(2, int32(len(c.data)))
+		page.i32(3, int32(len(c.data)))
+		page.field(5, thriftStruct)
+		page.begin()
+		page.i32(1, int32(len(prefixes)))
+		page.i32(2, parquetPlain)
+		page.i32(3, parquetRLE)
+		page.i32(4, parquetRLE)
+		page.end()
+		page.stop()
+
+		offset, size := int64(len(out)), int64(len(page.b)+len(c.data))
+		out = append(append(out, page.b...), c.data...)
+		total += size
+
+		meta.begin() // ColumnChunk
+		meta.i64(2, offset)
+		meta.field(3, thriftStruct)
+		meta.begin() // ColumnMetaData
+		meta.i32(1, c.typ)
+		meta.list(2, thriftI32, 1)
+		meta.elemI32(parquetPlain)
+		meta.list(3, thriftBinary, 1)
+		meta.elemStr(c.name)
+		meta.i32(4, parquetUncompressed)
+		meta.i64(5, int64(len(prefixes)))
+		meta.i64(6, size)
+		meta.i64(7, size)
+		meta.i64(9, offset)
+		meta.end()
+		meta.end()
+	}
+	meta.i64(2, total)
+	meta.i64(3, int64(len(prefixes)))
+	meta.end()
+	meta.str(6, "ipbin")
+	meta.stop()
+
+	out = append(out, meta.b...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(meta.b)))
+	out = append(out, parquetMagic...)
+	_, err := w.Write(out)
+	return err
+}
+
+// Types of the Thrift compact protocol
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes structs in the Thrift compact protocol, as Parquet
+// metadata is encoded.
+type thriftWriter struct {
+	b    []byte
+	last []int16 // id of the last field of each struct being written
+}
+
+// field writes the header of field id of type typ.
+func (w *thriftWriter) field(id int16, typ byte) {
+	if len(w.last) == 0 {
+		w.last = append(w.last, 0) // the top-level struct
+	}
+	n := len(w.last) - 1
+	last := w.last[n]
+	w.last[n] = id
+	if delta := id - last; delta > 0 && delta <= 15 {
+		w.b = append(w.b, byte(delta)<<4|typ)
+		return
+	}
+	w.b = binary.AppendUvarint(append(w.b, typ), zigzag(int64(id)))
+}
+
+// begin starts a struct, the value of a field or an element of a list.
+func (w *thriftWriter) begin() {
+	w.last = append(w.last, 0)
+}
+
+// end terminates the struct started by begin.
+func (w *thriftWriter) end() {
+	w.b = append(w.b, 0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+// stop terminates the top-level struct.
+func (w *thriftWriter) stop() {
+	w.b = append(w.b, 0)
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.elemI32(v)
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.b = binary.AppendUvarint(w.b, zigzag(v))
+}
+
+func (w *thriftWriter) str(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.elemStr(s)
+}
+
+// list writes the header of a list field of n elements of type typ, to be
+// followed by the elements.
+func (w *thriftWriter) list(id int16, typ byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.b = append(w.b, byte(n)<<4|typ)
+		return
+	}
+	w.b = binary.AppendUvarint(append(w.b, 0xf0|typ), uint64(n))
+}
+
+func (w *thriftWriter) elemI32(v int32) {
+	w.b = binary.AppendUvarint(w.b, zigzag(int64(v)))
+}
+
+func (w *thriftWriter) elemStr(s string) {
+	w.b = append(binary.AppendUvarint(w.b, uint64(len(s))), s...)
+}
+
+// zigzag encodes a signed integer of the Thrift compact protocol.
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
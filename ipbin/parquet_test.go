@@ -0,0 +1,117 @@
+package ipbin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+// readThrift decodes a struct of the Thrift compact protocol into a map of
+// its fields, for the tests.
+func readThrift(t *testing.T, b []byte) (map[int16]any, []byte) {
+	t.Helper()
+	fields := map[int16]any{}
+	var last int16
+	for {
+		h := b[0]
+		b = b[1:]
+		if h == 0 {
+			return fields, b
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			v, n := binary.Uvarint(b)
+			id, b = int16(v>>1)^-int16(v&1), b[n:]
+		}
+		last = id
+		fields[id], b = readThriftValue(t, h&0x0f, b)
+	}
+}
+
+func readThriftValue(t *testing.T, typ byte, b []byte) (any, []byte) {
+	t.Helper()
+	switch typ {
+	case thriftI32, thriftI64:
+		v, n := binary.Uvarint(b)
+		return int64(v>>1) ^ -int64(v&1), b[n:]
+	case thriftBinary:
+		l, n := binary.Uvarint(b)
+		return string(b[n : n+int(l)]), b[n+int(l):]
+	case thriftList:
+		size, elemType := int(b[0]>>4), b[0]&0x0f
+		b = b[1:]
+		if size == 15 {
+			v, n := binary.Uvarint(b)
+			size, b = int(v), b[n:]
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i], b = readThriftValue(t, elemType, b)
+		}
+		return list, b
+	case thriftStruct:
+		return readThrift(t, b)
+	}
+	t.Fatalf("unexpected thrift type %d", typ)
+	return nil, nil
+}
+
+func TestWriteParquetRanges(t *testing.T) {
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	var buf bytes.Buffer
+	if err := WriteParquetRanges(&buf, prefixes); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte(parquetMagic)) || !bytes.HasSuffix(data, []byte(parquetMagic)) {
+		t.Fatalf("missing magic in %x", data)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta, rest := readThrift(t, data[len(data)-8-footerLen:len(data)-8])
+	if len(rest) != 0 {
+		t.Errorf("%d bytes after the file metadata", len(rest))
+	}
+	if meta[3] != int64(3) {
+		t.Errorf("num_rows got %v", meta[3])
+	}
+	schema := meta[2].([]any)
+	if len(schema) != 4 || schema[0].(map[int16]any)[5] != int64(3) {
+		t.Fatalf("schema got %v", schema)
+	}
+	var names []string
+	for _, e := range schema[1:] {
+		names = append(names, e.(map[int16]any)[4].(string))
+	}
+	if want := []string{"start_u128", "end_u128", "prefix"}; !slices.Equal(names, want) {
+		t.Errorf("columns got %v, want %v", names, want)
+	}
+
+	// The values of the data page of each column chunk
+	chunks := meta[4].([]any)[0].(map[int16]any)[1].([]any)
+	pageData := func(i int) []byte {
+		cm := chunks[i].(map[int16]any)[3].(map[int16]any)
+		offset, size := cm[9].(int64), cm[7].(int64)
+		page, rest := readThrift(t, data[offset:offset+size])
+		if page[2] != int64(len(rest)) || page[5].(map[int16]any)[1] != int64(3) {
+			t.Errorf("column %d page header got %v for %d bytes", i, page, len(rest))
+		}
+		return rest
+	}
+	start, end := pageData(0), pageData(1)
+	if got := netip.AddrFrom16([16]byte(start[16:32])).Unmap(); got != netip.MustParseAddr("192.0.2.1") {
+		t.Errorf("start of row 1 got %v", got)
+	}
+	if got := netip.AddrFrom16([16]byte(end[32:48])); got != netip.MustParseAddr("2001:db8:ffff:ffff:ffff:ffff:ffff:ffff") {
+		t.Errorf("end of row 2 got %v", got)
+	}
+	strs := pageData(2)
+	if n := binary.LittleEndian.Uint32(strs); string(strs[4:4+n]) != "10.0.0.0/8" {
+		t.Errorf("prefix of row 0 got %q", strs[4:4+n])
+	}
+}
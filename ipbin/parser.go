@@ -2,54 +2,291 @@ package ipbin
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"go4.org/netipx"
 	"io"
+	"math/bits"
 	"net/netip"
+	"slices"
 	"strings"
+	"unicode"
 )
 
+// ParseError is a malformed entry of an input, located by its line in text
+// input or by its offset in binary input.
+type ParseError struct {
+	Source string // input file or feed name, if known
+	Line   int    // 1-based line of text input, 0 for binary input
+	Offset int    // offset of the record in binary input
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Source != "" && e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.Source, e.Line, e.Err)
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseIPSubnets parses IPs, subnets and ranges, one or more per line
+// separated by whitespace. Empty lines, comments starting with '#' and
+// anything after a comma are ignored. Lines
+// are normalized first, so feeds produced on Windows, with CRLF line endings
+// and a UTF-8 byte order mark, parse like any other.
 func ParseIPSubnets(r io.Reader) (nets []netip.Prefix, err error) {
+	return parseIPSubnets(context.Background(), r, ParseOptions{})
+}
+
+// parseIPSubnets is ParseIPSubnets, failing as soon as there are more than
+// opts.MaxEntries prefixes unless it is 0, or once ctx is done, and
+// resolving host names with opts.Resolver if set.
+func parseIPSubnets(ctx context.Context, r io.Reader, opts ParseOptions) (nets []netip.Prefix, err error) {
 	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(line) == 0 || line[0] == '#' {
+	for line := 0; scanner.Scan(); line++ {
+		if line%ctxCheckInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if nets, err = appendLinePrefixes(ctx, nets, scanner.Text(), opts.Resolver); err != nil {
+			return nil, &ParseError{Line: line + 1, Err: err}
+		}
+		if err = checkEntries(nets, opts.MaxEntries); err != nil {
+			return nil, err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nets, nil
+}
+
+// appendLinePrefixes appends the prefixes of a ParseIPSubnets input line to
+// nets. A line may hold several entries separated by whitespace or tabs,
+// as in firewall exports, and a comment starting with '#' after them. Host
+// names are resolved with res, and are an error if it is nil.
+func appendLinePrefixes(ctx context.Context, nets []netip.Prefix, line string, res HostResolver) ([]netip.Prefix, error) {
+	// Most lines of feeds are a single IPv4 address or prefix
+	if p, ok := parseIPv4Fast(strings.TrimSuffix(line, "\r")); ok {
+		return append(nets, p), nil
+	}
+	line = normalizeLine(line)
+	if len(line) == 0 || line[0] == '#' {
+		return nets, nil
+	}
+	var err error
+	for _, entry := range lineEntries(strings.Split(line, ",")[0]) {
+		if res != nil && isHostname(entry) {
+			nets, err = appendHostPrefixes(ctx, nets, entry, res)
+		} else {
+			nets, err = appendEntryPrefixes(nets, entry)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nets, nil
+}
+
+// lineEntries splits s into its whitespace-separated entries, up to a
+// comment, keeping ranges written with spaces around the dash, like
+// "10.0.0.1 - 10.0.0.9", whole.
+func lineEntries(s string) []string {
+	var entries []string
+	for _, f := range strings.Fields(s) {
+		if f[0] == '#' {
+			break
+		}
+		if n := len(entries); n > 0 && (f[0] == '-' || strings.HasSuffix(entries[n-1], "-")) {
+			entries[n-1] += f
 			continue
 		}
-		s := strings.Split(line, ",")[0]
-		switch {
-		case strings.Contains(s, "-"):
-			rangeS := strings.Split(s, "-")
-			startIp, err := netip.ParseAddr(strings.TrimSpace(rangeS[0]))
+		entries = append(entries, f)
+	}
+	return entries
+}
+
+// appendListPrefixes appends the prefixes of the entries of s, separated
+// by commas or whitespace, like "10.0.0.0/8, 192.0.2.1 - 192.0.2.9", to nets.
+func appendListPrefixes(nets []netip.Prefix, s string) ([]netip.Prefix, error) {
+	for _, line := range strings.Split(s, "\n") {
+		for _, entry := range lineEntries(strings.ReplaceAll(line, ",", " ")) {
+			var err error
+			if nets, err = appendEntryPrefixes(nets, entry); err != nil {
+				return nil, fmt.Errorf("invalid entry %q: %w", entry, err)
+			}
+		}
+	}
+	return nets, nil
+}
+
+// appendEntryPrefixes appends the prefixes of a single IP, subnet or range
+// to nets.
+func appendEntryPrefixes(nets []netip.Prefix, s string) ([]netip.Prefix, error) {
+	if p, ok := parseIPv4Fast(s); ok {
+		return append(nets, p), nil
+	}
+	switch {
+	case strings.Contains(s, "-"):
+		rangeS := strings.Split(s, "-")
+		startIp, err := netip.ParseAddr(rangeS[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(s) > 1 {
+			endIp, err := netip.ParseAddr(rangeS[1])
 			if err != nil {
 				return nil, err
 			}
-			if len(s) > 1 {
-				endIp, err := netip.ParseAddr(strings.TrimSpace(rangeS[1]))
-				if err != nil {
-					return nil, err
-				}
-				nets = netipx.IPRangeFrom(startIp, endIp).AppendPrefixes(nets)
-			} else {
-				nets = append(nets, netip.PrefixFrom(startIp, startIp.BitLen()))
+			nets = netipx.IPRangeFrom(startIp, endIp).AppendPrefixes(nets)
+		} else {
+			nets = append(nets, netip.PrefixFrom(startIp, startIp.BitLen()))
+		}
+	case strings.Contains(s, "*"):
+		prefix, err := parseWildcard(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, prefix)
+	case strings.Contains(s, "/"):
+		prefix, err := parseNetmaskPrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, prefix)
+	default:
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, netip.PrefixFrom(ip, ip.BitLen()))
+	}
+	return nets, nil
+}
+
+// parseIPv4Fast parses s as a dotted-quad IPv4 address, optionally
+// followed by a prefix length, like 192.0.2.1 or 10.0.0.0/8, in one pass
+// without the generality of netip.ParseAddr, which dominates the parsing
+// of large IPv4 feeds. It reports false for anything else, including what
+// netip rejects, like leading zeros, left to the general parsing.
+func parseIPv4Fast(s string) (netip.Prefix, bool) {
+	var ip uint32
+	i := 0
+	for octet := 0; octet < 4; octet++ {
+		if octet > 0 {
+			if i == len(s) || s[i] != '.' {
+				return netip.Prefix{}, false
 			}
-		case strings.Contains(s, "/"):
-			prefix, err := netip.ParsePrefix(strings.TrimSpace(s))
-			if err != nil {
-				return nil, err
+			i++
+		}
+		start := i
+		var v uint32
+		for ; i < len(s) && i-start < 3; i++ {
+			d := s[i] - '0'
+			if d > 9 {
+				break
 			}
-			nets = append(nets, prefix)
-		default:
-			ip, err := netip.ParseAddr(strings.TrimSpace(s))
-			if err != nil {
-				return nil, err
+			v = v*10 + uint32(d)
+		}
+		if i == start || v > 255 || s[start] == '0' && i-start > 1 {
+			return netip.Prefix{}, false
+		}
+		ip = ip<<8 | v
+	}
+	bits := 32
+	if i < len(s) && s[i] == '/' {
+		i++
+		start := i
+		bits = 0
+		for ; i < len(s) && i-start < 2; i++ {
+			d := s[i] - '0'
+			if d > 9 {
+				break
 			}
-			nets = append(nets, netip.PrefixFrom(ip, ip.BitLen()))
+			bits = bits*10 + int(d)
+		}
+		if i == start || bits > 32 || s[start] == '0' && i-start > 1 {
+			return netip.Prefix{}, false
 		}
 	}
-	if err = scanner.Err(); err != nil {
-		return nil, err
+	if i != len(s) {
+		return netip.Prefix{}, false
 	}
-	return nets, nil
+	return netip.PrefixFrom(uint32ToIPv4(ip), bits), true
+}
+
+// parseWildcard parses an IPv4 wildcard, like 1.2.3.* or 10.*.*.*, whose
+// trailing octets are all '*', as the prefix it covers.
+func parseWildcard(s string) (netip.Prefix, error) {
+	octets := strings.Split(s, ".")
+	if len(octets) != 4 {
+		return netip.Prefix{}, fmt.Errorf("invalid wildcard %q", s)
+	}
+	n := slices.Index(octets, "*")
+	if n < 0 {
+		return netip.Prefix{}, fmt.Errorf("invalid wildcard %q", s)
+	}
+	for i := n; i < len(octets); i++ {
+		if octets[i] != "*" {
+			return netip.Prefix{}, fmt.Errorf("invalid wildcard %q: '*' octets must be trailing", s)
+		}
+		octets[i] = "0"
+	}
+	addr, err := netip.ParseAddr(strings.Join(octets, "."))
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, n*8), nil
+}
+
+// parseNetmaskPrefix parses a prefix like netip.ParsePrefix, also accepting
+// an IPv4 dotted netmask as its length, like 1.2.3.0/255.255.255.0.
+func parseNetmaskPrefix(s string) (netip.Prefix, error) {
+	addrS, maskS, _ := strings.Cut(s, "/")
+	if !strings.Contains(maskS, ".") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(addrS)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	mask, err := netip.ParseAddr(maskS)
+	if err != nil || !addr.Is4() || !mask.Is4() {
+		return netip.Prefix{}, fmt.Errorf("invalid netmask in %q", s)
+	}
+	length, ok := netmaskLength(mask)
+	if !ok {
+		return netip.Prefix{}, fmt.Errorf("non-contiguous netmask in %q", s)
+	}
+	return netip.PrefixFrom(addr, length), nil
+}
+
+// netmaskLength returns the prefix length of an IPv4 netmask, and false if
+// it is not contiguous.
+func netmaskLength(mask netip.Addr) (int, bool) {
+	m := ipv4ToUint32(mask)
+	length := 32 - bits.TrailingZeros32(m)
+	return length, m == ^uint32(0)<<(32-length)
+}
+
+// normalizeLine strips an input line of its surrounding Unicode whitespace,
+// including the '\r' of a CRLF line ending and no-break spaces, and of the
+// invisible byte order mark and zero-width spaces, which editors and
+// spreadsheet exports leave around entries and which would otherwise fail
+// to parse with confusing errors.
+func normalizeLine(line string) string {
+	return strings.TrimFunc(line, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '\uFEFF' || r == '\u200B'
+	})
 }
 
 // MergePrefixes takes a slice of netip.Prefix values and returns a new slice
@@ -62,9 +299,100 @@ func ParseIPSubnets(r io.Reader) (nets []netip.Prefix, err error) {
 // The function does not modify the input slice. The result is sorted and
 // non-overlapping.
 func MergePrefixes(prefixes []netip.Prefix) (*netipx.IPSet, error) {
+	return MergePrefixesCtx(context.Background(), prefixes)
+}
+
+// ErrNotSorted is returned by FromSortedPrefixes and JoinSortedPrefixes
+// for prefixes out of address order or overlapping.
+var ErrNotSorted = errors.New("prefixes not sorted and disjoint")
+
+// sortedRanges calls add with each range of adjacent prefixes, sorted by
+// address, IPv4 first, and disjoint, along with the indexes of its first
+// prefix and past its last one. It returns an error wrapping ErrNotSorted,
+// locating the first offending prefix, for prefixes not sorted and disjoint.
+func sortedRanges(prefixes []netip.Prefix, add func(r netipx.IPRange, start, end int)) error {
+	var from, to netip.Addr
+	start := 0
+	for i, p := range prefixes {
+		r := netipx.RangeOfPrefix(p)
+		switch {
+		case !r.IsValid():
+			return fmt.Errorf("entry %d: invalid prefix %s", i+1, p)
+		case !from.IsValid():
+			from, to = r.From(), r.To()
+		case !to.Less(r.From()):
+			return fmt.Errorf("entry %d, %s: %w", i+1, p, ErrNotSorted)
+		case to.Next() == r.From():
+			to = r.To()
+		default:
+			add(netipx.IPRangeFrom(from, to), start, i)
+			from, to, start = r.From(), r.To(), i
+		}
+	}
+	if from.IsValid() {
+		add(netipx.IPRangeFrom(from, to), start, len(prefixes))
+	}
+	return nil
+}
+
+// FromSortedPrefixes returns the set of prefixes sorted by address and
+// disjoint, failing like JoinSortedPrefixes otherwise, for converting lists
+// aggregated beforehand. Instead of merging the prefixes, it joins adjacent
+// ones into ranges in a single pass, leaving netipx.IPSetBuilder ranges
+// already in order.
+func FromSortedPrefixes(prefixes []netip.Prefix) (*netipx.IPSet, error) {
+	var builder netipx.IPSetBuilder
+	err := sortedRanges(prefixes, func(r netipx.IPRange, _, _ int) {
+		builder.AddRange(r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return builder.IPSet()
+}
+
+// JoinSortedPrefixes returns the prefixes of the merged set of prefixes
+// sorted by address, IPv4 first, and disjoint, e.g. a list aggregated
+// beforehand, in a single pass without building the set: adjacent prefixes
+// are joined, e.g. 10.0.0.0/25 and 10.0.0.128/25 into 10.0.0.0/24, and
+// prefixes already merged are returned as they are. It returns an error
+// wrapping ErrNotSorted, locating the first offending prefix, for prefixes
+// not sorted and disjoint.
+func JoinSortedPrefixes(prefixes []netip.Prefix) ([]netip.Prefix, error) {
+	var joined []netip.Prefix
+	err := sortedRanges(prefixes, func(r netipx.IPRange, start, end int) {
+		if p := prefixes[start]; end-start == 1 && p == p.Masked() {
+			if joined != nil {
+				joined = append(joined, p)
+			}
+			return
+		}
+		if joined == nil {
+			joined = append(make([]netip.Prefix, 0, len(prefixes)), prefixes[:start]...)
+		}
+		joined = r.AppendPrefixes(joined)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if joined == nil {
+		return prefixes, nil
+	}
+	return joined, nil
+}
+
+// HeadPrefixes returns the set of the first n prefixes of ipset, in address
+// order, e.g. to preview a large set. A negative n returns ipset itself.
+func HeadPrefixes(ipset *netipx.IPSet, n int) *netipx.IPSet {
+	prefixes := ipset.Prefixes()
+	if n < 0 || n >= len(prefixes) {
+		return ipset
+	}
 	builder := netipx.IPSetBuilder{}
-	for _, prefix := range prefixes {
+	for _, prefix := range prefixes[:n] {
 		builder.AddPrefix(prefix)
 	}
-	return builder.IPSet()
+	// The prefixes of a set are valid, so building cannot fail
+	head, _ := builder.IPSet()
+	return head
 }
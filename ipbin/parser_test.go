@@ -1,6 +1,7 @@
 package ipbin
 
 import (
+	"errors"
 	"net/netip"
 	"reflect"
 	"strings"
@@ -45,3 +46,177 @@ func TestParseIPSubnets(t *testing.T) {
 		return
 	}
 }
+
+func TestHeadPrefixes(t *testing.T) {
+	ipset, err := MergePrefixes([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("10.0.1.0/25"),
+		netip.MustParsePrefix("192.0.2.7/32"),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24"), netip.MustParsePrefix("10.0.1.0/25")}
+	if got := HeadPrefixes(ipset, 2).Prefixes(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v\nwant %v", got, expected)
+	}
+	if got := HeadPrefixes(ipset, 0).Prefixes(); len(got) != 0 {
+		t.Errorf("got %v, want none", got)
+	}
+	if got := HeadPrefixes(ipset, -1); got != ipset {
+		t.Errorf("negative n expected the whole set")
+	}
+}
+
+func TestFromSortedPrefixes(t *testing.T) {
+	var prefixes []netip.Prefix
+	for _, s := range []string{"10.0.0.0/25", "10.0.0.128/25", "10.0.2.0/24", "192.0.2.7/32", "2001:db8::/32"} {
+		prefixes = append(prefixes, netip.MustParsePrefix(s))
+	}
+	want, err := MergePrefixes(prefixes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FromSortedPrefixes(prefixes)
+	if err != nil || !reflect.DeepEqual(got.Ranges(), want.Ranges()) {
+		t.Errorf("got %v, %v, want %v", got, err, want.Ranges())
+	}
+	// Adjacent prefixes joined, merged ones as they are
+	if got, err := JoinSortedPrefixes(prefixes); err != nil || !reflect.DeepEqual(got, want.Prefixes()) {
+		t.Errorf("JoinSortedPrefixes got %v, %v, want %v", got, err, want.Prefixes())
+	}
+	merged := want.Prefixes()
+	if got, err := JoinSortedPrefixes(merged); err != nil || &got[0] != &merged[0] {
+		t.Errorf("JoinSortedPrefixes of merged prefixes got %v, %v", got, err)
+	}
+	if got, err := FromSortedPrefixes(nil); err != nil || len(got.Ranges()) != 0 {
+		t.Errorf("no prefixes got %v, %v", got, err)
+	}
+
+	// Out of order, overlapping, or IPv6 first
+	for _, bad := range [][]int{{1, 0}, {0, 0}, {4, 0}} {
+		unsorted := []netip.Prefix{prefixes[bad[0]], prefixes[bad[1]]}
+		if _, err := FromSortedPrefixes(unsorted); !errors.Is(err, ErrNotSorted) {
+			t.Errorf("FromSortedPrefixes(%v) got %v, want ErrNotSorted", unsorted, err)
+		}
+		if _, err := JoinSortedPrefixes(unsorted); !errors.Is(err, ErrNotSorted) {
+			t.Errorf("JoinSortedPrefixes(%v) got %v, want ErrNotSorted", unsorted, err)
+		}
+	}
+	overlapping := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("10.1.0.0/16")}
+	if _, err := JoinSortedPrefixes(overlapping); err == nil || err.Error() != "entry 2, 10.1.0.0/16: prefixes not sorted and disjoint" {
+		t.Errorf("JoinSortedPrefixes(%v) got %v", overlapping, err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, err := ParseIPSubnets(strings.NewReader("192.0.2.0/24\n# comment\n192.0.2.300\n"))
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 3 || !strings.HasPrefix(err.Error(), "line 3: ParseAddr") {
+		t.Errorf("got %v", err)
+	}
+	_, err = DecodeAll([]byte{24, 192, 0, 2, 24, 198}, DecodeOptions{})
+	if !errors.As(err, &perr) || perr.Offset != 4 || err.Error() != "offset 4: unexpected EOF" {
+		t.Errorf("decode got %v", err)
+	}
+}
+
+func TestParseIPSubnetsWindows(t *testing.T) {
+	input := "\uFEFF# exported on Windows\r\n1.2.3.4\r\n\r\n  # indented comment\r\n10.0.0.0/8 \r\n\u200B192.168.0.0 - 192.168.0.255\r\n"
+	nets, err := ParseIPSubnets(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("1.2.3.4/32"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.0.0/24"),
+	}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v\nwant %v", nets, expected)
+	}
+
+	sps, err := ParseIPSubnetsWithOrigin(strings.NewReader(input), "feed.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sps) != 3 || sps[1].Origin.Text != "10.0.0.0/8" || sps[1].Origin.Line != 5 {
+		t.Errorf("unexpected origins %+v", sps)
+	}
+}
+
+func TestParseIPSubnetsMultiEntry(t *testing.T) {
+	input := "1.2.3.0/24 5.6.7.0/24\n10.0.0.1\t10.0.0.2\t# hosts\n192.168.0.0 - 192.168.0.255 2001:db8::1\n172.16.0.0 -172.16.0.3, comment\n"
+	nets, err := ParseIPSubnets(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("1.2.3.0/24"),
+		netip.MustParsePrefix("5.6.7.0/24"),
+		netip.MustParsePrefix("10.0.0.1/32"),
+		netip.MustParsePrefix("10.0.0.2/32"),
+		netip.MustParsePrefix("192.168.0.0/24"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+		netip.MustParsePrefix("172.16.0.0/30"),
+	}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v\nwant %v", nets, expected)
+	}
+
+	if _, err := ParseIPSubnets(strings.NewReader("1.2.3.4 block\n")); err == nil {
+		t.Error("expected an error for a line with a word after the entry")
+	}
+}
+
+func TestParseIPSubnetsLegacyNotations(t *testing.T) {
+	input := "1.2.3.*\n10.*.*.*\n172.16.0.0/255.240.0.0\n192.168.1.0/255.255.255.255\n"
+	nets, err := ParseIPSubnets(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("1.2.3.0/24"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+		netip.MustParsePrefix("192.168.1.0/32"),
+	}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v\nwant %v", nets, expected)
+	}
+
+	for _, s := range []string{"1.*.3.*", "1.2.3.4*", "1.2.*", "10.0.0.0/255.0.255.0", "2001:db8::/255.255.0.0"} {
+		if _, err := ParseIPSubnets(strings.NewReader(s)); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func FuzzParseIPv4Fast(f *testing.F) {
+	for _, s := range []string{
+		"192.0.2.1", "10.0.0.0/8", "0.0.0.0/0", "255.255.255.255/32", "1.2.3.4/33", "01.2.3.4",
+		"1.2.3.4/08", "1.2.3", "1.2.3.4.5", "256.1.1.1", "1.2.3.4/", "2001:db8::1", "1.2.3.4 ", "",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		got, ok := parseIPv4Fast(s)
+		// Whatever it parses, netip parses alike
+		var want netip.Prefix
+		var err error
+		if strings.Contains(s, "/") {
+			want, err = netip.ParsePrefix(s)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(s)
+			want = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if ok && (err != nil || got != want) {
+			t.Errorf("parseIPv4Fast(%q) got %v, netip %v, %v", s, got, want, err)
+		}
+		if !ok && err == nil && want.Addr().Is4() {
+			t.Errorf("parseIPv4Fast(%q) failed, netip got %v", s, want)
+		}
+	})
+}
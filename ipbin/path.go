@@ -0,0 +1,174 @@
+package ipbin
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// pathStep is a step of a path selecting nodes of a document.
+type pathStep struct {
+	key   string
+	index int
+	kind  byte // 'k' for a member, 'i' for an element, '*' for all
+}
+
+// parsePath parses a path of jq-style steps: ".key", `."key"` or `["key"]`
+// selecting a member of objects, "[n]" an element of arrays, counted from
+// the end if negative, and "[]" all the elements of arrays or members of
+// objects, e.g. ".spec.allowedCIDRs" or ".prefixes[].ip_prefix". Steps
+// may be separated by pipes, as in ".items[] | .ip". The empty path and "."
+// select the whole document.
+func parsePath(path string) ([]pathStep, error) {
+	var steps []pathStep
+	s := path
+	if s != "" && s[0] != '.' && s[0] != '[' {
+		// A leading dot is optional, as in yq
+		s = "." + s
+	}
+	for s != "" {
+		switch {
+		case s[0] == '.' && (len(s) == 1 || s[1] == '.' || s[1] == '['):
+			s = s[1:]
+		case s[0] == '|' || s[0] == ' ' || s[0] == '?':
+			// The pipes of jq, ".items[] | .ip", and its optional operator,
+			// as selection never fails
+			s = s[1:]
+		case s[0] == '.' && s[1] == '"':
+			key, rest, err := quotedPathKey(s[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %s: %w", path, err)
+			}
+			steps, s = append(steps, pathStep{key: key, kind: 'k'}), rest
+		case s[0] == '.':
+			end := strings.IndexAny(s[1:], ".[]|? ")
+			if end < 0 {
+				end = len(s) - 1
+			}
+			steps, s = append(steps, pathStep{key: s[1 : 1+end], kind: 'k'}), s[1+end:]
+		case strings.HasPrefix(s, "[]"):
+			steps, s = append(steps, pathStep{kind: '*'}), s[2:]
+		case strings.HasPrefix(s, `["`):
+			key, rest, err := quotedPathKey(s[1:])
+			if err != nil || !strings.HasPrefix(rest, "]") {
+				return nil, fmt.Errorf("invalid path %s", path)
+			}
+			steps, s = append(steps, pathStep{key: key, kind: 'k'}), rest[1:]
+		case s[0] == '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %s: missing ]", path)
+			}
+			i, err := strconv.Atoi(strings.TrimSpace(s[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %s: invalid index %q", path, s[1:end])
+			}
+			steps, s = append(steps, pathStep{index: i, kind: 'i'}), s[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %s: unexpected %q", path, s)
+		}
+	}
+	return steps, nil
+}
+
+// quotedPathKey returns the key quoted at the start of s, and the rest of s.
+func quotedPathKey(s string) (key, rest string, err error) {
+	q, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", errors.New("invalid quoted key")
+	}
+	key, err = strconv.Unquote(q)
+	return key, s[len(q):], err
+}
+
+// selectPath returns the nodes selected by steps in a document decoded into
+// maps, slices and scalars, like encoding/json does. Members missing and
+// elements out of range select nothing.
+func selectPath(doc any, steps []pathStep) []any {
+	nodes := []any{doc}
+	for _, step := range steps {
+		var next []any
+		for _, n := range nodes {
+			switch n := n.(type) {
+			case map[string]any:
+				switch step.kind {
+				case 'k':
+					if v, ok := n[step.key]; ok {
+						next = append(next, v)
+					}
+				case '*':
+					keys := make([]string, 0, len(n))
+					for k := range n {
+						keys = append(keys, k)
+					}
+					slices.Sort(keys)
+					for _, k := range keys {
+						next = append(next, n[k])
+					}
+				}
+			case []any:
+				switch step.kind {
+				case 'i':
+					i := step.index
+					if i < 0 {
+						i += len(n)
+					}
+					if i >= 0 && i < len(n) {
+						next = append(next, n[i])
+					}
+				case '*':
+					next = append(next, n...)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// parseDocumentPrefixes returns the prefixes of the nodes selected by path
+// in docs: the addresses, prefixes and ranges of their strings, separated
+// by commas or whitespace, and of the strings of their arrays.
+func parseDocumentPrefixes(docs []any, path string) ([]netip.Prefix, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = "."
+	}
+	var nets []netip.Prefix
+	for _, doc := range docs {
+		for _, n := range selectPath(doc, steps) {
+			if nets, err = appendNodePrefixes(nets, n, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nets, nil
+}
+
+// appendNodePrefixes appends the prefixes of a node selected by path to
+// nets.
+func appendNodePrefixes(nets []netip.Prefix, n any, path string) ([]netip.Prefix, error) {
+	switch n := n.(type) {
+	case nil:
+		return nets, nil
+	case string:
+		return appendListPrefixes(nets, n)
+	case []any:
+		var err error
+		for _, v := range n {
+			if nets, err = appendNodePrefixes(nets, v, path); err != nil {
+				return nil, err
+			}
+		}
+		return nets, nil
+	case map[string]any:
+		return nil, fmt.Errorf("path %s selects an object, not addresses", path)
+	}
+	return nil, fmt.Errorf("path %s selects %v, not addresses", path, n)
+}
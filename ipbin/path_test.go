@@ -0,0 +1,56 @@
+package ipbin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectPath(t *testing.T) {
+	doc := map[string]any{
+		"spec": map[string]any{"allowedCIDRs": []any{"10.0.0.0/8", "192.0.2.1"}},
+		"rules": []any{
+			map[string]any{"name": "office", "cidr": "198.51.100.0/24"},
+			map[string]any{"name": "vpn", "cidr": "203.0.113.0/24"},
+		},
+		"odd.key": "2001:db8::/32",
+	}
+	tests := []struct {
+		path string
+		want []any
+	}{
+		{".spec.allowedCIDRs", []any{[]any{"10.0.0.0/8", "192.0.2.1"}}},
+		{"spec.allowedCIDRs[1]", []any{"192.0.2.1"}},
+		{".spec.allowedCIDRs[-1]", []any{"192.0.2.1"}},
+		{".spec.allowedCIDRs[2]", nil},
+		{".rules[].cidr", []any{"198.51.100.0/24", "203.0.113.0/24"}},
+		{".rules[]? | .cidr", []any{"198.51.100.0/24", "203.0.113.0/24"}},
+		{`.["odd.key"]`, []any{"2001:db8::/32"}},
+		{`."odd.key"`, []any{"2001:db8::/32"}},
+		{".spec[]", []any{[]any{"10.0.0.0/8", "192.0.2.1"}}},
+		{".missing.key", nil},
+		{".", []any{doc}},
+		{"", []any{doc}},
+	}
+	for _, tt := range tests {
+		steps, err := parsePath(tt.path)
+		if err != nil {
+			t.Errorf("parsePath(%q): %v", tt.path, err)
+			continue
+		}
+		if got := selectPath(doc, steps); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("selectPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	for _, path := range []string{".a[", ".a[x]", `.["a]`, ".a]"} {
+		if _, err := parsePath(path); err == nil {
+			t.Errorf("parsePath(%q): expected an error", path)
+		}
+	}
+
+	if _, err := parseDocumentPrefixes([]any{doc}, ".rules"); err == nil {
+		t.Error("expected an error for a path selecting objects")
+	}
+	if _, err := parseDocumentPrefixes([]any{doc}, ".rules[].name"); err == nil {
+		t.Error("expected an error for a path selecting names")
+	}
+}
@@ -0,0 +1,281 @@
+package ipbin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// PcapAddrs selects the addresses of the packets of a capture to count.
+type PcapAddrs int
+
+const (
+	PcapSource      PcapAddrs = iota // the source addresses
+	PcapDestination                  // the destination addresses
+	PcapBoth                         // both
+)
+
+var pcapAddrsNames = []string{
+	PcapSource:      "source",
+	PcapDestination: "destination",
+	PcapBoth:        "both",
+}
+
+func (a PcapAddrs) String() string {
+	if a >= 0 && int(a) < len(pcapAddrsNames) {
+		return pcapAddrsNames[a]
+	}
+	return fmt.Sprintf("PcapAddrs(%d)", int(a))
+}
+
+// ParsePcapAddrs returns the addresses named s: "source", "destination" or
+// "both".
+func ParsePcapAddrs(s string) (PcapAddrs, error) {
+	if i := slices.Index(pcapAddrsNames, strings.ToLower(s)); i >= 0 {
+		return PcapAddrs(i), nil
+	}
+	return 0, fmt.Errorf("unknown pcap addresses: %s", s)
+}
+
+// Link types of the captures whose packets CountPcapAddrs reads
+// (https://www.tcpdump.org/linktypes.html).
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLoop     = 108
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276
+)
+
+// pcapng block types
+const (
+	pcapngSectionHeader  = 0x0A0D0D0A
+	pcapngInterface      = 1
+	pcapngSimplePacket   = 3
+	pcapngEnhancedPacket = 6
+	pcapngByteOrderMagic = 0x1A2B3C4D
+	pcapngMaxBlockSize   = 64 << 20
+)
+
+// pcap file format
+const (
+	pcapMicroMagic       = 0xA1B2C3D4
+	pcapNanoMagic        = 0xA1B23C4D
+	pcapFileHeaderSize   = 24
+	pcapRecordHeaderSize = 16
+	pcapMaxPacketCapture = 256 << 10
+)
+
+// CountPcapAddrs counts the packets of each source or destination address,
+// or both, of the IPv4 and IPv6 packets of a capture, e.g. of an attack
+// written by tcpdump. It reads pcap and pcapng files of Ethernet, Linux
+// cooked, raw IP and loopback links; other packets are skipped.
+func CountPcapAddrs(r io.Reader, which PcapAddrs) (AddrCounts, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture: %w", err)
+	}
+	counts := AddrCounts{}
+	count := func(linkType int, data []byte) {
+		src, dst, ok := packetAddrs(linkType, data)
+		if !ok {
+			return
+		}
+		if which != PcapDestination {
+			counts.Add(src)
+		}
+		if which != PcapSource {
+			counts.Add(dst)
+		}
+	}
+	if binary.LittleEndian.Uint32(magic) == pcapngSectionHeader {
+		err = readPcapng(br, count)
+	} else {
+		err = readPcap(br, count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// readPcap calls packet with each packet of a classic pcap file.
+func readPcap(r io.Reader, packet func(linkType int, data []byte)) error {
+	var hdr [pcapFileHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return fmt.Errorf("invalid pcap header: %w", err)
+	}
+	var order binary.ByteOrder
+	switch m := binary.LittleEndian.Uint32(hdr[:]); {
+	case m == pcapMicroMagic || m == pcapNanoMagic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[:]) == pcapMicroMagic || binary.BigEndian.Uint32(hdr[:]) == pcapNanoMagic:
+		order = binary.BigEndian
+	default:
+		return errors.New("not a pcap or pcapng file")
+	}
+	linkType := int(order.Uint32(hdr[20:]) & 0xFFFF)
+	var rec [pcapRecordHeaderSize]byte
+	var data []byte
+	for {
+		if _, err := io.ReadFull(r, rec[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("truncated pcap record: %w", err)
+		}
+		n := order.Uint32(rec[8:])
+		if n > pcapMaxPacketCapture {
+			return fmt.Errorf("invalid pcap record length %d", n)
+		}
+		data = slices.Grow(data[:0], int(n))[:n]
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("truncated pcap record: %w", err)
+		}
+		packet(linkType, data)
+	}
+}
+
+// readPcapng calls packet with each packet of a pcapng file.
+func readPcapng(r io.Reader, packet func(linkType int, data []byte)) error {
+	var order binary.ByteOrder = binary.LittleEndian
+	type iface struct {
+		linkType int
+		snapLen  uint32
+	}
+	var ifaces []iface
+	var hdr [8]byte
+	var body []byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("truncated pcapng block: %w", err)
+		}
+		blockType, headerSize := order.Uint32(hdr[:]), uint32(8)
+		if binary.LittleEndian.Uint32(hdr[:]) == pcapngSectionHeader {
+			// A new section, whose byte order magic gives the order of
+			// its block lengths
+			var bom [4]byte
+			if _, err := io.ReadFull(r, bom[:]); err != nil {
+				return fmt.Errorf("truncated pcapng block: %w", err)
+			}
+			switch {
+			case binary.LittleEndian.Uint32(bom[:]) == pcapngByteOrderMagic:
+				order = binary.LittleEndian
+			case binary.BigEndian.Uint32(bom[:]) == pcapngByteOrderMagic:
+				order = binary.BigEndian
+			default:
+				return errors.New("invalid pcapng byte order magic")
+			}
+			blockType, headerSize, ifaces = pcapngSectionHeader, 12, ifaces[:0]
+		}
+		n := order.Uint32(hdr[4:])
+		if n < headerSize+4 || n%4 != 0 || n > pcapngMaxBlockSize {
+			return fmt.Errorf("invalid pcapng block length %d", n)
+		}
+		// The body, then the trailing copy of the length
+		body = slices.Grow(body[:0], int(n-headerSize))[:n-headerSize]
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("truncated pcapng block: %w", err)
+		}
+		body = body[:len(body)-4]
+
+		switch blockType {
+		case pcapngInterface:
+			if len(body) < 8 {
+				return errors.New("invalid pcapng interface block")
+			}
+			ifaces = append(ifaces, iface{int(order.Uint16(body)), order.Uint32(body[4:])})
+		case pcapngEnhancedPacket:
+			if len(body) < 20 {
+				return errors.New("invalid pcapng packet block")
+			}
+			id, capLen := order.Uint32(body), order.Uint32(body[12:])
+			if int(id) >= len(ifaces) || int(capLen) > len(body)-20 {
+				return errors.New("invalid pcapng packet block")
+			}
+			packet(ifaces[id].linkType, body[20:20+capLen])
+		case pcapngSimplePacket:
+			if len(body) < 4 || len(ifaces) == 0 {
+				return errors.New("invalid pcapng simple packet block")
+			}
+			capLen := min(order.Uint32(body), uint32(len(body)-4))
+			if ifaces[0].snapLen > 0 {
+				capLen = min(capLen, ifaces[0].snapLen)
+			}
+			packet(ifaces[0].linkType, body[4:4+capLen])
+		}
+	}
+}
+
+// packetAddrs returns the source and destination addresses of the IP packet
+// carried by a link layer frame, and false if it carries none.
+func packetAddrs(linkType int, frame []byte) (src, dst netip.Addr, ok bool) {
+	var ip []byte
+	switch linkType {
+	case linkTypeEthernet:
+		if len(frame) < 14 {
+			return src, dst, false
+		}
+		etherType := binary.BigEndian.Uint16(frame[12:])
+		ip = frame[14:]
+		// 802.1Q and 802.1ad VLAN tags
+		for (etherType == 0x8100 || etherType == 0x88A8) && len(ip) >= 4 {
+			etherType, ip = binary.BigEndian.Uint16(ip[2:]), ip[4:]
+		}
+		if etherType != 0x0800 && etherType != 0x86DD {
+			return src, dst, false
+		}
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+		ip = frame
+	case linkTypeNull, linkTypeLoop:
+		// The address family, whose values differ by OS, then the packet
+		if len(frame) < 4 {
+			return src, dst, false
+		}
+		ip = frame[4:]
+	case linkTypeLinuxSLL:
+		if len(frame) < 16 {
+			return src, dst, false
+		}
+		ip = frame[16:]
+	case linkTypeSLL2:
+		if len(frame) < 20 {
+			return src, dst, false
+		}
+		ip = frame[20:]
+	default:
+		return src, dst, false
+	}
+	return ipAddrs(ip)
+}
+
+// ipAddrs returns the source and destination addresses of an IPv4 or IPv6
+// packet, recognized by its version.
+func ipAddrs(ip []byte) (src, dst netip.Addr, ok bool) {
+	if len(ip) == 0 {
+		return src, dst, false
+	}
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return src, dst, false
+		}
+		return netip.AddrFrom4([4]byte(ip[12:16])), netip.AddrFrom4([4]byte(ip[16:20])), true
+	case 6:
+		if len(ip) < 40 {
+			return src, dst, false
+		}
+		return netip.AddrFrom16([16]byte(ip[8:24])), netip.AddrFrom16([16]byte(ip[24:40])), true
+	}
+	return src, dst, false
+}
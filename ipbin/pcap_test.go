@@ -0,0 +1,152 @@
+package ipbin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// testIPv4Packet returns the header of an IPv4 packet from src to dst.
+func testIPv4Packet(src, dst string) []byte {
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	s, d := netip.MustParseAddr(src).As4(), netip.MustParseAddr(dst).As4()
+	copy(ip[12:], s[:])
+	copy(ip[16:], d[:])
+	return ip
+}
+
+// testIPv6Packet returns the header of an IPv6 packet from src to dst.
+func testIPv6Packet(src, dst string) []byte {
+	ip := make([]byte, 40)
+	ip[0] = 0x60
+	s, d := netip.MustParseAddr(src).As16(), netip.MustParseAddr(dst).As16()
+	copy(ip[8:], s[:])
+	copy(ip[24:], d[:])
+	return ip
+}
+
+// testEthernetFrame returns an Ethernet frame of the given type, with a
+// VLAN tag if vlan.
+func testEthernetFrame(etherType uint16, vlan bool, payload []byte) []byte {
+	frame := make([]byte, 12)
+	if vlan {
+		frame = binary.BigEndian.AppendUint16(frame, 0x8100)
+		frame = binary.BigEndian.AppendUint16(frame, 42)
+	}
+	frame = binary.BigEndian.AppendUint16(frame, etherType)
+	return append(frame, payload...)
+}
+
+func testPcapFrames() [][]byte {
+	return [][]byte{
+		testEthernetFrame(0x0800, false, testIPv4Packet("198.51.100.1", "192.0.2.1")),
+		testEthernetFrame(0x0800, true, testIPv4Packet("198.51.100.1", "192.0.2.1")),
+		testEthernetFrame(0x86DD, false, testIPv6Packet("2001:db8::66", "2001:db8::1")),
+		testEthernetFrame(0x0806, false, make([]byte, 28)), // ARP
+		testEthernetFrame(0x0800, false, testIPv4Packet("203.0.113.9", "192.0.2.1")),
+	}
+}
+
+func testPcap(order binary.AppendByteOrder, frames [][]byte) []byte {
+	var b []byte
+	b = order.AppendUint32(b, pcapMicroMagic)
+	b = order.AppendUint16(b, 2)
+	b = order.AppendUint16(b, 4)
+	b = append(b, make([]byte, 8)...)
+	b = order.AppendUint32(b, 65535)
+	b = order.AppendUint32(b, linkTypeEthernet)
+	for _, f := range frames {
+		b = append(b, make([]byte, 8)...)
+		b = order.AppendUint32(b, uint32(len(f)))
+		b = order.AppendUint32(b, uint32(len(f)))
+		b = append(b, f...)
+	}
+	return b
+}
+
+func testPcapngBlock(order binary.AppendByteOrder, blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	var b []byte
+	b = order.AppendUint32(b, blockType)
+	b = order.AppendUint32(b, uint32(len(body)+12))
+	b = append(b, body...)
+	return order.AppendUint32(b, uint32(len(body)+12))
+}
+
+func testPcapng(order binary.AppendByteOrder, frames [][]byte) []byte {
+	var shb, idb []byte
+	shb = order.AppendUint32(shb, pcapngByteOrderMagic)
+	shb = order.AppendUint16(shb, 1)
+	shb = order.AppendUint16(shb, 0)
+	shb = order.AppendUint64(shb, ^uint64(0))
+	idb = order.AppendUint16(idb, linkTypeEthernet)
+	idb = order.AppendUint16(idb, 0)
+	idb = order.AppendUint32(idb, 0)
+	b := append(testPcapngBlock(order, pcapngSectionHeader, shb), testPcapngBlock(order, pcapngInterface, idb)...)
+	for i, f := range frames {
+		var epb []byte
+		if i%2 == 0 {
+			epb = order.AppendUint32(epb, 0)
+			epb = append(epb, make([]byte, 8)...)
+			epb = order.AppendUint32(epb, uint32(len(f)))
+			epb = order.AppendUint32(epb, uint32(len(f)))
+			b = append(b, testPcapngBlock(order, pcapngEnhancedPacket, append(epb, f...))...)
+		} else {
+			epb = order.AppendUint32(epb, uint32(len(f)))
+			b = append(b, testPcapngBlock(order, pcapngSimplePacket, append(epb, f...))...)
+		}
+	}
+	return b
+}
+
+func TestCountPcapAddrs(t *testing.T) {
+	sources := AddrCounts{
+		netip.MustParseAddr("198.51.100.1"): 2,
+		netip.MustParseAddr("2001:db8::66"): 1,
+		netip.MustParseAddr("203.0.113.9"):  1,
+	}
+	destinations := AddrCounts{
+		netip.MustParseAddr("192.0.2.1"):   3,
+		netip.MustParseAddr("2001:db8::1"): 1,
+	}
+	for name, capture := range map[string][]byte{
+		"pcap":       testPcap(binary.LittleEndian, testPcapFrames()),
+		"pcap big":   testPcap(binary.BigEndian, testPcapFrames()),
+		"pcapng":     testPcapng(binary.LittleEndian, testPcapFrames()),
+		"pcapng big": testPcapng(binary.BigEndian, testPcapFrames()),
+	} {
+		counts, err := CountPcapAddrs(bytes.NewReader(capture), PcapSource)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(counts, sources) {
+			t.Errorf("%s: sources got %v, want %v", name, counts, sources)
+		}
+		counts, err = CountPcapAddrs(bytes.NewReader(capture), PcapDestination)
+		if err != nil || !reflect.DeepEqual(counts, destinations) {
+			t.Errorf("%s: destinations got %v, %v, want %v", name, counts, err, destinations)
+		}
+		if counts, _ = CountPcapAddrs(bytes.NewReader(capture), PcapBoth); len(counts) != 5 {
+			t.Errorf("%s: both got %v", name, counts)
+		}
+	}
+
+	nets := sources.Prefixes(2)
+	if want := []netip.Prefix{netip.MustParsePrefix("198.51.100.1/32")}; !reflect.DeepEqual(nets, want) {
+		t.Errorf("Prefixes(2) got %v, want %v", nets, want)
+	}
+
+	capture := testPcap(binary.LittleEndian, testPcapFrames())
+	if _, err := CountPcapAddrs(bytes.NewReader(capture[:len(capture)-3]), PcapSource); err == nil {
+		t.Error("expected an error for a truncated capture")
+	}
+	if _, err := CountPcapAddrs(bytes.NewReader([]byte("1.2.3.4\n5.6.7.8\n10.0.0.0/8\n")), PcapSource); err == nil {
+		t.Error("expected an error for text input")
+	}
+}
@@ -0,0 +1,178 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"math"
+)
+
+// PrefixSet is a set of IPs persisted in the binary format. It embeds the
+// netipx.IPSet it holds, so that e.g. set.Contains(addr) works after
+// set.ReadFrom(f).
+type PrefixSet struct {
+	netipx.IPSet
+}
+
+// NewPrefixSet returns a PrefixSet holding ipset.
+func NewPrefixSet(ipset *netipx.IPSet) *PrefixSet {
+	return &PrefixSet{*ipset}
+}
+
+// WriteTo writes the prefixes of s to w as binary records. It implements
+// io.WriterTo.
+func (s *PrefixSet) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	buf := make([]byte, 0, 32*1024)
+	flush := func() error {
+		n, err := w.Write(buf)
+		written += int64(n)
+		buf = buf[:0]
+		return err
+	}
+	for _, p := range s.Prefixes() {
+		var err error
+		if buf, err = AppendEncoded(buf, p); err != nil {
+			return written, err
+		}
+		if len(buf) > cap(buf)-17 {
+			if err := flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, flush()
+}
+
+// ReadFrom replaces the content of s by the binary set read from r until
+// EOF, as decoded by DecodeAll with the default options. It implements
+// io.ReaderFrom.
+func (s *PrefixSet) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	prefixes, err := DecodeAll(data, DecodeOptions{})
+	if err != nil {
+		return int64(len(data)), err
+	}
+	ipset, err := MergePrefixes(prefixes)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	s.IPSet = *ipset
+	return int64(len(data)), nil
+}
+
+// MarshalBinary returns the prefixes of s as binary records, without
+// metadata. It implements encoding.BinaryMarshaler, which encoding/gob
+// uses instead of encoding the addresses of the set by reflection.
+func (s PrefixSet) MarshalBinary() ([]byte, error) {
+	var records []byte
+	for _, p := range s.Prefixes() {
+		var err error
+		if records, err = AppendEncoded(records, p); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// UnmarshalBinary replaces the content of s by the binary set data. It
+// implements encoding.BinaryUnmarshaler.
+func (s *PrefixSet) UnmarshalBinary(data []byte) error {
+	prefixes, err := DecodeAll(data, DecodeOptions{})
+	if err != nil {
+		return err
+	}
+	ipset, err := MergePrefixes(prefixes)
+	if err != nil {
+		return err
+	}
+	s.IPSet = *ipset
+	return nil
+}
+
+// MarshalMsgpack returns s as a MessagePack bin value holding its binary
+// records. It implements the Marshaler interface of msgpack libraries like
+// github.com/vmihailenco/msgpack, without depending on them.
+func (s PrefixSet) MarshalMsgpack() ([]byte, error) {
+	records, err := s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	switch n := len(records); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	case uint64(n) <= math.MaxUint32:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	default:
+		return nil, fmt.Errorf("set of %d bytes too large for MessagePack", n)
+	}
+	return append(b, records...), nil
+}
+
+// UnmarshalMsgpack replaces the content of s by the MessagePack bin value
+// data, or empties it if data is nil.
+func (s *PrefixSet) UnmarshalMsgpack(data []byte) error {
+	if len(data) == 1 && data[0] == 0xc0 {
+		s.IPSet = netipx.IPSet{}
+		return nil
+	}
+	var n, off int
+	switch {
+	case len(data) >= 2 && data[0] == 0xc4:
+		n, off = int(data[1]), 2
+	case len(data) >= 3 && data[0] == 0xc5:
+		n, off = int(binary.BigEndian.Uint16(data[1:])), 3
+	case len(data) >= 5 && data[0] == 0xc6:
+		n, off = int(binary.BigEndian.Uint32(data[1:])), 5
+	default:
+		return errors.New("invalid MessagePack set: not a bin value")
+	}
+	if len(data)-off != n {
+		return fmt.Errorf("invalid MessagePack set: %d bytes for a bin of %d", len(data)-off, n)
+	}
+	return s.UnmarshalBinary(data[off:])
+}
+
+// MarshalText returns s as a comma-separated list of its ranges, aggregated
+// like "192.0.2.0/24, 198.51.100.7, 203.0.113.1-203.0.113.9": ranges which
+// are prefixes in CIDR notation, single addresses without length. It
+// implements encoding.TextMarshaler, so that sets can be values of YAML,
+// TOML or JSON configuration files.
+func (s PrefixSet) MarshalText() ([]byte, error) {
+	var b []byte
+	for i, r := range s.Ranges() {
+		if i > 0 {
+			b = append(b, ", "...)
+		}
+		if p, ok := r.Prefix(); ok {
+			b = AppendPrefixText(b, p, TextCompact)
+		} else {
+			b = AppendRangeText(b, r, TextCompact)
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalText replaces the content of s by the comma-separated list of
+// addresses, prefixes and ranges text, as written by MarshalText or by hand.
+// It implements encoding.TextUnmarshaler.
+func (s *PrefixSet) UnmarshalText(text []byte) error {
+	nets, err := appendListPrefixes(nil, string(text))
+	if err != nil {
+		return err
+	}
+	ipset, err := MergePrefixes(nets)
+	if err != nil {
+		return err
+	}
+	s.IPSet = *ipset
+	return nil
+}
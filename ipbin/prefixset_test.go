@@ -0,0 +1,147 @@
+package ipbin
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"go4.org/netipx"
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+var (
+	_ io.WriterTo                = (*PrefixSet)(nil)
+	_ io.ReaderFrom              = (*PrefixSet)(nil)
+	_ encoding.BinaryMarshaler   = (*PrefixSet)(nil)
+	_ encoding.BinaryUnmarshaler = (*PrefixSet)(nil)
+	_ encoding.TextMarshaler     = (*PrefixSet)(nil)
+	_ encoding.TextUnmarshaler   = (*PrefixSet)(nil)
+)
+
+func TestPrefixSet(t *testing.T) {
+	ipset, err := MergePrefixes([]netip.Prefix{
+		netip.MustParsePrefix("1.3.0.0/16"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("1.5.5.5/32"),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	set := NewPrefixSet(ipset)
+	var buf bytes.Buffer
+	n, err := set.WriteTo(&buf)
+	if err != nil || n != 3+5+5 || int64(buf.Len()) != n {
+		t.Errorf("WriteTo got %d, %v", n, err)
+	}
+
+	var got PrefixSet
+	if n, err := got.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil || n != int64(buf.Len()) {
+		t.Errorf("ReadFrom got %d, %v", n, err)
+	}
+	if !reflect.DeepEqual(got.Prefixes(), ipset.Prefixes()) || !got.Contains(netip.MustParseAddr("1.3.7.7")) {
+		t.Errorf("ReadFrom got %v", got.Prefixes())
+	}
+	if _, err := got.ReadFrom(bytes.NewReader([]byte{16, 1})); err == nil {
+		t.Errorf("truncated set expected error")
+	}
+
+	// Streaming over a connection
+	client, server := net.Pipe()
+	go func() {
+		set.WriteTo(client)
+		client.Close()
+	}()
+	var streamed PrefixSet
+	if _, err := streamed.ReadFrom(server); err != nil || !reflect.DeepEqual(streamed.Prefixes(), ipset.Prefixes()) {
+		t.Errorf("streamed ReadFrom got %v, %v", streamed.Prefixes(), err)
+	}
+}
+
+func TestPrefixSetCodecs(t *testing.T) {
+	var b netipx.IPSetBuilder
+	b.AddPrefix(netip.MustParsePrefix("1.3.0.0/16"))
+	b.AddPrefix(netip.MustParsePrefix("2001:db8::/32"))
+	for i := range 100 {
+		b.Add(netip.AddrFrom4([4]byte{10, 0, byte(i), 1}))
+	}
+	ipset, _ := b.IPSet()
+
+	// A set in a message, as an RPC framework would send it
+	type message struct {
+		Name string
+		Set  PrefixSet
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(message{"blocklist", *NewPrefixSet(ipset)}); err != nil {
+		t.Fatal(err)
+	}
+	var got message
+	if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "blocklist" || !reflect.DeepEqual(got.Set.Prefixes(), ipset.Prefixes()) {
+		t.Errorf("gob got %v %v", got.Name, got.Set.Prefixes())
+	}
+
+	for _, ipset := range []*netipx.IPSet{ipset, HeadPrefixes(ipset, 2), HeadPrefixes(ipset, 0)} {
+		data, err := NewPrefixSet(ipset).MarshalMsgpack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var set PrefixSet
+		if err := set.UnmarshalMsgpack(data); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(set.Prefixes(), ipset.Prefixes()) {
+			t.Errorf("msgpack got %v, want %v", set.Prefixes(), ipset.Prefixes())
+		}
+	}
+	var set PrefixSet
+	if err := set.UnmarshalMsgpack([]byte{0xc4, 5, 24}); err == nil {
+		t.Error("expected an error for a truncated bin")
+	}
+	if err := set.UnmarshalMsgpack([]byte{0xa1, 'x'}); err == nil {
+		t.Error("expected an error for a string")
+	}
+}
+
+func TestPrefixSetText(t *testing.T) {
+	var set PrefixSet
+	in := "10.0.0.0/8, 192.168.1.1,192.168.1.2 , 203.0.113.1 - 203.0.113.9,,2001:db8::/32"
+	if err := set.UnmarshalText([]byte(in)); err != nil {
+		t.Fatal(err)
+	}
+	text, err := set.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "10.0.0.0/8, 192.168.1.1-192.168.1.2, 203.0.113.1-203.0.113.9, 2001:db8::/32"
+	if string(text) != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+
+	// As a value of a JSON configuration
+	var config struct{ Allow PrefixSet }
+	if err := json.Unmarshal([]byte(`{"Allow": "192.0.2.0/25, 192.0.2.128/25, 198.51.100.7"}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Allow":"192.0.2.0/24, 198.51.100.7"}`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	if err := set.UnmarshalText([]byte("10.0.0.0/8, bogus")); err == nil {
+		t.Error("expected an error for an invalid entry")
+	}
+	if err := set.UnmarshalText(nil); err != nil || len(set.Prefixes()) != 0 {
+		t.Errorf("empty text got %v, %v", set.Prefixes(), err)
+	}
+}
@@ -0,0 +1,116 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go4.org/netipx"
+	"time"
+)
+
+// Field numbers of the PrefixSet message of prefixset.proto
+const (
+	protoRecords   = 1
+	protoGenerated = 2
+	protoSource    = 3
+)
+
+// Protocol Buffers wire types
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireLen    = 2
+	wireI32    = 5
+)
+
+// MarshalProto returns ipset as a PrefixSet Protocol Buffers message of
+// prefixset.proto, with the generation time and source of m, so services
+// exchanging sets over gRPC share a schema.
+func MarshalProto(ipset *netipx.IPSet, m Metadata) ([]byte, error) {
+	var records []byte
+	for _, p := range ipset.Prefixes() {
+		var err error
+		if records, err = AppendEncoded(records, p); err != nil {
+			return nil, err
+		}
+	}
+	// Fields of default values are omitted, as in proto3 encodings
+	var b []byte
+	if len(records) > 0 {
+		b = protowireTag(b, protoRecords, wireLen)
+		b = binary.AppendUvarint(b, uint64(len(records)))
+		b = append(b, records...)
+	}
+	if !m.Generated.IsZero() {
+		b = protowireTag(b, protoGenerated, wireVarint)
+		b = binary.AppendUvarint(b, uint64(m.Generated.Unix()))
+	}
+	if m.Source != "" {
+		b = protowireTag(b, protoSource, wireLen)
+		b = binary.AppendUvarint(b, uint64(len(m.Source)))
+		b = append(b, m.Source...)
+	}
+	return b, nil
+}
+
+// UnmarshalProto reads a PrefixSet Protocol Buffers message of
+// prefixset.proto, returning its set along with its generation time and
+// source. Unknown fields are skipped, as Protocol Buffers requires.
+func UnmarshalProto(data []byte) (*netipx.IPSet, Metadata, error) {
+	var m Metadata
+	var records []byte
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, m, errors.New("invalid protobuf field tag")
+		}
+		data = data[n:]
+		field, wireType := tag>>3, tag&7
+		var value uint64
+		var bytes []byte
+		switch wireType {
+		case wireVarint:
+			if value, n = binary.Uvarint(data); n <= 0 {
+				return nil, m, fmt.Errorf("invalid protobuf field %d", field)
+			}
+		case wireI64:
+			n = 8
+		case wireI32:
+			n = 4
+		case wireLen:
+			var size uint64
+			if size, n = binary.Uvarint(data); n <= 0 || size > uint64(len(data)-n) {
+				return nil, m, fmt.Errorf("invalid protobuf field %d", field)
+			}
+			bytes = data[n : n+int(size)]
+			n += int(size)
+		default:
+			return nil, m, fmt.Errorf("unsupported protobuf wire type %d", wireType)
+		}
+		if n > len(data) {
+			return nil, m, fmt.Errorf("truncated protobuf field %d", field)
+		}
+		data = data[n:]
+		switch {
+		case field == protoRecords && wireType == wireLen:
+			records = bytes
+		case field == protoGenerated && wireType == wireVarint:
+			if value != 0 {
+				m.Generated = time.Unix(int64(value), 0).UTC()
+			}
+		case field == protoSource && wireType == wireLen:
+			m.Source = string(bytes)
+		}
+	}
+	prefixes, err := DecodeAll(records, DecodeOptions{})
+	if err != nil {
+		return nil, m, err
+	}
+	ipset, err := MergePrefixes(prefixes)
+	return ipset, m, err
+}
+
+// protowireTag appends the tag of a field to b.
+func protowireTag(b []byte, field, wireType uint64) []byte {
+	return binary.AppendUvarint(b, field<<3|wireType)
+}
@@ -0,0 +1,46 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProto(t *testing.T) {
+	var b netipx.IPSetBuilder
+	for _, s := range []string{"10.0.0.0/8", "192.168.1.1/32", "2001:db8::/32"} {
+		b.AddPrefix(netip.MustParsePrefix(s))
+	}
+	ipset, _ := b.IPSet()
+	m := Metadata{Generated: time.Unix(1700000000, 0).UTC(), Source: "feeds"}
+	data, err := MarshalProto(ipset, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An unknown varint field, as a newer schema may add
+	data = append(data, 4<<3|wireVarint, 0x96, 0x01)
+	got, gotM, err := UnmarshalProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Prefixes(), ipset.Prefixes()) {
+		t.Errorf("got %v, want %v", got.Prefixes(), ipset.Prefixes())
+	}
+	if !gotM.Generated.Equal(m.Generated) || gotM.Source != m.Source {
+		t.Errorf("got metadata %+v, want %+v", gotM, m)
+	}
+
+	// The empty set is the empty message, as proto3 omits default values
+	empty, _ := (&netipx.IPSetBuilder{}).IPSet()
+	if data, _ := MarshalProto(empty, Metadata{}); len(data) != 0 {
+		t.Errorf("empty set got %x", data)
+	}
+	if got, _, err := UnmarshalProto(nil); err != nil || len(got.Prefixes()) != 0 {
+		t.Errorf("empty message got %v, %v", got, err)
+	}
+	if _, _, err := UnmarshalProto([]byte{protoRecords<<3 | wireLen, 5, 24}); err == nil {
+		t.Error("expected an error for a truncated field")
+	}
+}
@@ -0,0 +1,251 @@
+package ipbin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Origin is the input line a prefix was parsed from.
+type Origin struct {
+	Source string // input file or feed name
+	Line   int    // 1-based line number
+	Text   string // the line as read
+}
+
+func (o Origin) String() string {
+	return fmt.Sprintf("%s:%d: %s", o.Source, o.Line, o.Text)
+}
+
+// SourcedPrefix is a prefix along with the input line it was parsed from.
+type SourcedPrefix struct {
+	Prefix netip.Prefix
+	Origin Origin
+}
+
+// ParseIPSubnetsWithOrigin parses r like ParseIPSubnets, retaining the
+// origin of each prefix in source. A range line yields several prefixes
+// sharing the same origin.
+func ParseIPSubnetsWithOrigin(r io.Reader, source string) (sps []SourcedPrefix, err error) {
+	scanner := bufio.NewScanner(r)
+	var nets []netip.Prefix
+	for line := 1; scanner.Scan(); line++ {
+		text := normalizeLine(scanner.Text())
+		if nets, err = appendLinePrefixes(context.Background(), nets[:0], text, nil); err != nil {
+			return nil, &ParseError{Source: source, Line: line, Err: err}
+		}
+		for _, p := range nets {
+			sps = append(sps, SourcedPrefix{Prefix: p, Origin: Origin{Source: source, Line: line, Text: text}})
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sps, nil
+}
+
+// SourcedPrefixes returns the prefixes of sps, e.g. to merge them.
+func SourcedPrefixes(sps []SourcedPrefix) []netip.Prefix {
+	nets := make([]netip.Prefix, len(sps))
+	for i, sp := range sps {
+		nets[i] = sp.Prefix
+	}
+	return nets
+}
+
+// CoveringPrefix returns the prefix of ipset containing addr.
+func CoveringPrefix(ipset *netipx.IPSet, addr netip.Addr) (netip.Prefix, bool) {
+	prefixes := ipset.Prefixes()
+	// Prefixes are sorted and disjoint, the candidate is the last one
+	// starting at or before addr
+	i, found := slices.BinarySearchFunc(prefixes, addr, func(p netip.Prefix, a netip.Addr) int {
+		return p.Addr().Compare(a)
+	})
+	if !found {
+		i--
+	}
+	if i < 0 || !prefixes[i].Contains(addr) {
+		return netip.Prefix{}, false
+	}
+	return prefixes[i], true
+}
+
+// Contributors returns the origins of the prefixes of sps overlapping p,
+// i.e. the input lines that contributed to p once merged, in input order
+// and without duplicates.
+func Contributors(sps []SourcedPrefix, p netip.Prefix) []Origin {
+	var origins []Origin
+	for _, sp := range sps {
+		if !sp.Prefix.Overlaps(p) {
+			continue
+		}
+		if n := len(origins); n > 0 && origins[n-1] == sp.Origin {
+			continue
+		}
+		origins = append(origins, sp.Origin)
+	}
+	return origins
+}
+
+// MaxSources is the maximum number of sources of a ProvenanceMap, one bit
+// each in a SourceMask.
+const MaxSources = 64
+
+// SourceMask has bit i set for the i-th source of a ProvenanceMap.
+type SourceMask uint64
+
+// ProvenanceMap records which sources cover each address of a merged set.
+// As an Annotator, it adds the "sources" attribute, the names of the
+// sources covering a prefix joined by "|", and "source_mask", their
+// SourceMask in hex.
+type ProvenanceMap struct {
+	names  []string
+	ranges []provenanceRange // sorted and disjoint
+}
+
+type provenanceRange struct {
+	r    netipx.IPRange
+	mask SourceMask
+}
+
+// MergeWithProvenance merges the prefixes of several sources, e.g. input
+// files or feeds, sources[i] being named names[i]. It returns the merged
+// set along with the ProvenanceMap of its addresses.
+func MergeWithProvenance(names []string, sources [][]netip.Prefix) (*netipx.IPSet, *ProvenanceMap, error) {
+	if len(names) != len(sources) {
+		return nil, nil, fmt.Errorf("got %d source names for %d sources", len(names), len(sources))
+	}
+	if len(sources) > MaxSources {
+		return nil, nil, fmt.Errorf("too many sources: %d, at most %d are tracked", len(sources), MaxSources)
+	}
+	// The mask is constant between the boundaries of the ranges of all
+	// sources
+	sets := make([]*netipx.IPSet, len(sources))
+	var all netipx.IPSetBuilder
+	var cuts []netip.Addr
+	for i, nets := range sources {
+		set, err := MergePrefixes(nets)
+		if err != nil {
+			return nil, nil, err
+		}
+		sets[i] = set
+		all.AddSet(set)
+		for _, r := range set.Ranges() {
+			cuts = append(cuts, r.From())
+			if next := r.To().Next(); next.IsValid() {
+				cuts = append(cuts, next)
+			}
+		}
+	}
+	slices.SortFunc(cuts, netip.Addr.Compare)
+	cuts = slices.Compact(cuts)
+
+	m := &ProvenanceMap{names: slices.Clone(names)}
+	for i, from := range cuts {
+		var mask SourceMask
+		for j, set := range sets {
+			if set.Contains(from) {
+				mask |= 1 << j
+			}
+		}
+		if mask == 0 {
+			continue
+		}
+		// Without a following boundary in its family, a range extends to
+		// the last address
+		to := lastAddr(from)
+		if i+1 < len(cuts) && cuts[i+1].Is4() == from.Is4() {
+			to = cuts[i+1].Prev()
+		}
+		if n := len(m.ranges); n > 0 && m.ranges[n-1].mask == mask && m.ranges[n-1].r.To().Next() == from {
+			m.ranges[n-1].r = netipx.IPRangeFrom(m.ranges[n-1].r.From(), to)
+			continue
+		}
+		m.ranges = append(m.ranges, provenanceRange{netipx.IPRangeFrom(from, to), mask})
+	}
+	merged, err := all.IPSet()
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, m, nil
+}
+
+// lastAddr returns the last address of the family of a.
+func lastAddr(a netip.Addr) netip.Addr {
+	if a.Is4() {
+		return netip.AddrFrom4([4]byte{255, 255, 255, 255})
+	}
+	return netip.AddrFrom16([16]byte{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255})
+}
+
+// first returns the index of the first range ending at or after a.
+func (m *ProvenanceMap) first(a netip.Addr) int {
+	i, _ := slices.BinarySearchFunc(m.ranges, a, func(pr provenanceRange, a netip.Addr) int {
+		return pr.r.From().Compare(a)
+	})
+	if i > 0 && m.ranges[i-1].r.To().Compare(a) >= 0 {
+		i--
+	}
+	return i
+}
+
+// Mask returns the sources covering addr.
+func (m *ProvenanceMap) Mask(addr netip.Addr) SourceMask {
+	if i := m.first(addr); i < len(m.ranges) && m.ranges[i].r.Contains(addr) {
+		return m.ranges[i].mask
+	}
+	return 0
+}
+
+// Names returns the names of the sources of mask, in source order.
+func (m *ProvenanceMap) Names(mask SourceMask) []string {
+	var names []string
+	for i, name := range m.names {
+		if mask&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (m *ProvenanceMap) Annotate(p netip.Prefix) (map[string]string, error) {
+	attrs := map[string]string{}
+	if mask := m.Mask(p.Masked().Addr()); mask != 0 {
+		attrs["sources"] = strings.Join(m.Names(mask), "|")
+		attrs["source_mask"] = fmt.Sprintf("%#x", uint64(mask))
+	}
+	return attrs, nil
+}
+
+// Split divides p at the boundaries of the ranges covered by distinct
+// sources.
+func (m *ProvenanceMap) Split(p netip.Prefix) ([]netip.Prefix, error) {
+	pr := netipx.RangeOfPrefix(p)
+	var out []netip.Prefix
+	cursor := pr.From()
+	for i := m.first(pr.From()); i < len(m.ranges) && cursor.IsValid() && cursor.Compare(pr.To()) <= 0; i++ {
+		r := m.ranges[i].r
+		if r.From().Compare(pr.To()) > 0 {
+			break
+		}
+		if r.From().Compare(cursor) > 0 {
+			out = netipx.IPRangeFrom(cursor, r.From().Prev()).AppendPrefixes(out)
+			cursor = r.From()
+		}
+		end := r.To()
+		if end.Compare(pr.To()) > 0 {
+			end = pr.To()
+		}
+		out = netipx.IPRangeFrom(cursor, end).AppendPrefixes(out)
+		cursor = end.Next()
+	}
+	if cursor.IsValid() && cursor.Compare(pr.To()) <= 0 {
+		out = netipx.IPRangeFrom(cursor, pr.To()).AppendPrefixes(out)
+	}
+	return out, nil
+}
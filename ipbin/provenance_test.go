@@ -0,0 +1,85 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	input := `# blocklist
+192.0.2.0-192.0.2.127
+198.51.100.0/24
+192.0.2.128/25
+192.0.2.7
+2001:db8::1`
+	sps, err := ParseIPSubnetsWithOrigin(strings.NewReader(input), "list.txt")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ipset, err := MergePrefixes(SourcedPrefixes(sps))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p, ok := CoveringPrefix(ipset, netip.MustParseAddr("192.0.2.200"))
+	if !ok || p != netip.MustParsePrefix("192.0.2.0/24") {
+		t.Errorf("CoveringPrefix got %v, %v", p, ok)
+	}
+	expected := []Origin{
+		{"list.txt", 2, "192.0.2.0-192.0.2.127"},
+		{"list.txt", 4, "192.0.2.128/25"},
+		{"list.txt", 5, "192.0.2.7"},
+	}
+	if got := Contributors(sps, p); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Contributors got %v\nwant %v", got, expected)
+	}
+
+	if p, ok := CoveringPrefix(ipset, netip.MustParseAddr("2001:db8::1")); !ok || p.Bits() != 128 {
+		t.Errorf("CoveringPrefix got %v, %v", p, ok)
+	}
+	for _, s := range []string{"192.0.1.255", "198.51.101.0", "2001:db8::2", "0.0.0.0"} {
+		if p, ok := CoveringPrefix(ipset, netip.MustParseAddr(s)); ok {
+			t.Errorf("CoveringPrefix(%s) got %v, want none", s, p)
+		}
+	}
+
+	if _, err := ParseIPSubnetsWithOrigin(strings.NewReader("192.0.2.0\nbogus\n"), "bad.txt"); err == nil || !strings.HasPrefix(err.Error(), "bad.txt:2:") {
+		t.Errorf("expected error with origin, got %v", err)
+	}
+}
+
+func TestMergeWithProvenance(t *testing.T) {
+	a := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/23"), netip.MustParsePrefix("255.255.255.255/32")}
+	b := []netip.Prefix{netip.MustParsePrefix("10.0.1.0/24"), netip.MustParsePrefix("10.0.2.0/24"), netip.MustParsePrefix("2001:db8::/32")}
+	ipset, m, err := MergeWithProvenance([]string{"a.txt", "b.txt"}, [][]netip.Prefix{a, b})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	aps, err := Annotate(ipset, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []AnnotatedPrefix{
+		{netip.MustParsePrefix("10.0.0.0/24"), map[string]string{"sources": "a.txt", "source_mask": "0x1"}},
+		{netip.MustParsePrefix("10.0.1.0/24"), map[string]string{"sources": "a.txt|b.txt", "source_mask": "0x3"}},
+		{netip.MustParsePrefix("10.0.2.0/24"), map[string]string{"sources": "b.txt", "source_mask": "0x2"}},
+		{netip.MustParsePrefix("255.255.255.255/32"), map[string]string{"sources": "a.txt", "source_mask": "0x1"}},
+		{netip.MustParsePrefix("2001:db8::/32"), map[string]string{"sources": "b.txt", "source_mask": "0x2"}},
+	}
+	if !reflect.DeepEqual(aps, expected) {
+		t.Errorf("got %v\nwant %v", aps, expected)
+	}
+	if mask := m.Mask(netip.MustParseAddr("10.0.3.0")); mask != 0 {
+		t.Errorf("Mask outside of the sources got %#x", mask)
+	}
+
+	if _, _, err := MergeWithProvenance([]string{"a"}, nil); err == nil {
+		t.Errorf("mismatched names expected error")
+	}
+}
@@ -0,0 +1,385 @@
+package ipbin
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Content types of the responses of a Publisher, with the version of the
+// set in the VersionHeader header and the epoch of the Publisher in the
+// EpochHeader header
+const (
+	SnapshotContentType    = "application/x-ipbin"
+	DiffContentType        = "application/x-ipbin-journal"
+	EventStreamContentType = "text/event-stream"
+	VersionHeader          = "X-Ipbin-Version"
+	EpochHeader            = "X-Ipbin-Epoch"
+)
+
+// DefaultPollTimeout is how long a Publisher holds a long-poll request
+// waiting for a new version by default.
+const DefaultPollTimeout = 30 * time.Second
+
+// Publisher distributes the versions of a set to Subscribers over HTTP
+// long-polling. A request for ?since=<version> is held until a newer
+// version is published, then answered with the journal entries turning
+// that version into the current one, or with the whole set if the version
+// is too old or unknown. Requests without since get the whole set at once.
+//
+// Versions are numbered from 1 by each Publisher, told apart by a random
+// epoch. A request whose ?epoch=<epoch> is not that of the Publisher, e.g.
+// of a subscriber that outlived a restart of the publisher, gets the whole
+// set as if without since.
+//
+// Requests accepting text/event-stream, as those of browser EventSources,
+// get instead a stream of server-sent events: "add" and "remove" events
+// with a prefix as data, the last of each version with <epoch>:<version>
+// as id, and "reset" events, before the prefixes of the whole set, telling
+// to clear the set. The stream starts after the version of ?since or of the
+// Last-Event-ID header of reconnecting clients, if any, and of the same
+// epoch.
+type Publisher struct {
+	// PollTimeout is how long a request is held, DefaultPollTimeout if 0.
+	// Requests timing out, or whose context is canceled, e.g. by a server
+	// shutting down, are answered with 304 Not Modified.
+	PollTimeout time.Duration
+	// History is the number of versions whose changes are kept to answer
+	// with diffs, 100 if 0.
+	History int
+
+	mu      sync.Mutex
+	epoch   string
+	set     *netipx.IPSet
+	version uint64
+	changes [][]JournalEntry // changes[i] turns version-len(changes)+i into the next one
+	updated chan struct{}    // closed when a version is published
+}
+
+// Publish makes ipset the current version of the set, waking up the
+// waiting subscribers. It is a no-op if ipset equals the current version.
+func (p *Publisher) Publish(ipset *netipx.IPSet) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prev := p.set
+	if prev == nil {
+		prev = &netipx.IPSet{}
+	}
+	entries, err := JournalChanges(prev, ipset, time.Now())
+	if err != nil {
+		return err
+	}
+	if p.set != nil && len(entries) == 0 {
+		return nil
+	}
+	history := p.History
+	if history <= 0 {
+		history = 100
+	}
+	p.changes = append(p.changes, entries)
+	if len(p.changes) > history {
+		p.changes = p.changes[len(p.changes)-history:]
+	}
+	p.set = ipset
+	p.version++
+	if p.updated != nil {
+		close(p.updated)
+	}
+	p.updated = make(chan struct{})
+	return nil
+}
+
+// Version returns the current version, 0 before the first Publish.
+func (p *Publisher) Version() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.version
+}
+
+// Epoch returns the random ID of the Publisher, telling its versions from
+// those of another one.
+func (p *Publisher) Epoch() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.epochLocked()
+}
+
+// epochLocked returns the epoch of the Publisher, drawing it on first use.
+func (p *Publisher) epochLocked() string {
+	if p.epoch == "" {
+		var b [8]byte
+		rand.Read(b[:])
+		p.epoch = hex.EncodeToString(b[:])
+	}
+	return p.epoch
+}
+
+// Current returns the current version of the set and its number, nil and
+// 0 before the first Publish.
+func (p *Publisher) Current() (*netipx.IPSet, uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.set, p.version
+}
+
+func (p *Publisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	poll := r.URL.Query().Has("since")
+	since, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	if err != nil && poll {
+		http.Error(w, "invalid since version", http.StatusBadRequest)
+		return
+	}
+	epoch := r.URL.Query().Get("epoch")
+	if strings.Contains(r.Header.Get("Accept"), EventStreamContentType) {
+		if id := r.Header.Get("Last-Event-ID"); id != "" {
+			if e, v, ok := strings.Cut(id, ":"); ok {
+				epoch, id = e, v
+			}
+			if since, err = strconv.ParseUint(id, 10, 64); err != nil {
+				http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+		}
+		p.serveEvents(w, r, epoch, since)
+		return
+	}
+	p.mu.Lock()
+	if p.updated == nil {
+		p.updated = make(chan struct{})
+	}
+	w.Header().Set(EpochHeader, p.epochLocked())
+	if epoch != "" && epoch != p.epoch {
+		// The versions of another Publisher
+		since = 0
+	}
+	if poll && since == p.version {
+		// Wait for the next version
+		updated := p.updated
+		p.mu.Unlock()
+		timeout := p.PollTimeout
+		if timeout <= 0 {
+			timeout = DefaultPollTimeout
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-updated:
+		case <-timer.C:
+			w.Header().Set(VersionHeader, strconv.FormatUint(since, 10))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			// The client is gone, or the server shutting down, in which
+			// case the subscriber polls again
+			w.Header().Set(VersionHeader, strconv.FormatUint(since, 10))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		p.mu.Lock()
+	}
+	set, version := p.set, p.version
+	var body bytes.Buffer
+	contentType := SnapshotContentType
+	if since > 0 && since < version && version-since <= uint64(len(p.changes)) {
+		contentType = DiffContentType
+		for _, entries := range p.changes[uint64(len(p.changes))-(version-since):] {
+			for _, e := range entries {
+				b, _ := AppendJournalEntry(body.AvailableBuffer(), e)
+				body.Write(b)
+			}
+		}
+	}
+	p.mu.Unlock()
+	if contentType == SnapshotContentType && set != nil {
+		if err := WriteEncodedAll(&body, set.Prefixes()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set(VersionHeader, strconv.FormatUint(version, 10))
+	w.Write(body.Bytes())
+}
+
+// serveEvents streams the changes after version since of epoch as
+// server-sent events, until the client is gone. Every PollTimeout without a
+// new version, a comment keeps the connection alive through proxies.
+func (p *Publisher) serveEvents(w http.ResponseWriter, r *http.Request, epoch string, since uint64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	p.mu.Lock()
+	current := p.epochLocked()
+	p.mu.Unlock()
+	if epoch != "" && epoch != current {
+		since = 0
+	}
+	w.Header().Set(EpochHeader, current)
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	timeout := p.PollTimeout
+	if timeout <= 0 {
+		timeout = DefaultPollTimeout
+	}
+	keepalive := time.NewTicker(timeout)
+	defer keepalive.Stop()
+	for {
+		p.mu.Lock()
+		if p.updated == nil {
+			p.updated = make(chan struct{})
+		}
+		version, updated := p.version, p.updated
+		var events []byte
+		if since != version && version > 0 {
+			if since > 0 && since < version && version-since <= uint64(len(p.changes)) {
+				for _, entries := range p.changes[uint64(len(p.changes))-(version-since):] {
+					for _, e := range entries {
+						event := "add"
+						if e.Op == JournalRemove {
+							event = "remove"
+						}
+						events = fmt.Appendf(events, "event: %s\ndata: %s\n\n", event, e.Prefix)
+					}
+				}
+			} else {
+				events = fmt.Appendf(events, "event: reset\ndata: %d\n\n", version)
+				for _, prefix := range p.set.Prefixes() {
+					events = fmt.Appendf(events, "event: add\ndata: %s\n\n", prefix)
+				}
+			}
+			if len(events) > 0 {
+				// The id of the last event of the version
+				events = fmt.Appendf(events[:len(events)-1], "id: %s:%d\n\n", current, version)
+			}
+		}
+		p.mu.Unlock()
+		if len(events) > 0 {
+			if _, err := w.Write(events); err != nil {
+				return
+			}
+			flusher.Flush()
+			since = version
+		}
+		select {
+		case <-updated:
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Subscriber follows the versions of a set distributed by a Publisher.
+type Subscriber struct {
+	// URL is the URL the Publisher is served at.
+	URL string
+	// Client makes the requests, http.DefaultClient if nil. Its timeout, if
+	// any, must exceed the PollTimeout of the Publisher.
+	Client *http.Client
+	// Token, if not empty, is sent as the bearer token of the requests, for
+	// Publishers behind an Authenticator.
+	Token string
+
+	set     *netipx.IPSet
+	epoch   string
+	version uint64
+	decoder Decoder // reused by the snapshots
+}
+
+// Version returns the version of the set last received, 0 if none.
+func (s *Subscriber) Version() uint64 {
+	return s.version
+}
+
+// Poll waits for a version of the set newer than the last one received and
+// returns it. It returns the current set and false if none was published
+// before the Publisher timed the request out.
+func (s *Subscriber) Poll(ctx context.Context) (*netipx.IPSet, bool, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, false, err
+	}
+	q := u.Query()
+	q.Set("since", strconv.FormatUint(s.version, 10))
+	if s.epoch != "" {
+		q.Set("epoch", s.epoch)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return s.set, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("publisher: %s", resp.Status)
+	}
+	version, err := strconv.ParseUint(resp.Header.Get(VersionHeader), 10, 64)
+	if err != nil {
+		return nil, false, fmt.Errorf("publisher: invalid %s header", VersionHeader)
+	}
+	var set *netipx.IPSet
+	switch resp.Header.Get("Content-Type") {
+	case DiffContentType:
+		entries, err := ReadJournal(resp.Body)
+		if err != nil {
+			return nil, false, err
+		}
+		var b netipx.IPSetBuilder
+		if s.set != nil {
+			b.AddSet(s.set)
+		}
+		for _, e := range entries {
+			if e.Op == JournalAdd {
+				b.AddPrefix(e.Prefix)
+			} else {
+				b.RemovePrefix(e.Prefix)
+			}
+		}
+		set, err = b.IPSet()
+		if err != nil {
+			return nil, false, err
+		}
+	default:
+		prefixes, err := s.decoder.Decode(resp.Body)
+		if err != nil {
+			return nil, false, err
+		}
+		if set, err = MergePrefixes(prefixes); err != nil {
+			return nil, false, err
+		}
+	}
+	s.set, s.epoch, s.version = set, resp.Header.Get(EpochHeader), version
+	return set, true, nil
+}
@@ -0,0 +1,212 @@
+package ipbin
+
+import (
+	"bufio"
+	"context"
+	"go4.org/netipx"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPubSub(t *testing.T) {
+	mustSet := func(prefixes ...string) *netipx.IPSet {
+		var b netipx.IPSetBuilder
+		for _, p := range prefixes {
+			b.AddPrefix(netip.MustParsePrefix(p))
+		}
+		set, _ := b.IPSet()
+		return set
+	}
+	pub := &Publisher{PollTimeout: 50 * time.Millisecond, History: 2}
+	srv := httptest.NewServer(pub)
+	defer srv.Close()
+	sub := &Subscriber{URL: srv.URL}
+	ctx := context.Background()
+
+	// Nothing published yet: the poll times out
+	if set, changed, err := sub.Poll(ctx); err != nil || changed || set != nil {
+		t.Errorf("Poll before Publish got %v, %v, %v", set, changed, err)
+	}
+
+	v1 := mustSet("10.0.0.0/8", "2001:db8::/32")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		pub.Publish(v1)
+	}()
+	set, changed, err := sub.Poll(ctx)
+	if err != nil || !changed || !reflect.DeepEqual(set.Prefixes(), v1.Prefixes()) || sub.Version() != 1 {
+		t.Errorf("Poll got %v, %v, %v, version %d", set, changed, err, sub.Version())
+	}
+
+	// Diffs from the last version received
+	v2 := mustSet("10.0.0.0/9", "192.0.2.0/24", "2001:db8::/32")
+	v3 := mustSet("10.0.0.0/9", "192.0.2.0/24")
+	pub.Publish(v2)
+	pub.Publish(v2)
+	pub.Publish(v3)
+	if pub.Version() != 3 {
+		t.Errorf("Version got %d", pub.Version())
+	}
+	if set, version := pub.Current(); set != v3 || version != 3 {
+		t.Errorf("Current got %v, %d", set, version)
+	}
+	set, changed, err = sub.Poll(ctx)
+	if err != nil || !changed || !reflect.DeepEqual(set.Prefixes(), v3.Prefixes()) || sub.Version() != 3 {
+		t.Errorf("Poll of a diff got %v, %v, %v, version %d", set, changed, err, sub.Version())
+	}
+
+	// Versions older than the history get the whole set
+	late := &Subscriber{URL: srv.URL}
+	pub.Publish(v1)
+	pub.Publish(v2)
+	pub.Publish(v3)
+	if set, changed, err := late.Poll(ctx); err != nil || !changed || !reflect.DeepEqual(set.Prefixes(), v3.Prefixes()) {
+		t.Errorf("late Poll got %v, %v, %v", set, changed, err)
+	}
+	set, changed, err = sub.Poll(ctx)
+	if err != nil || !changed || !reflect.DeepEqual(set.Prefixes(), v3.Prefixes()) || sub.Version() != 6 {
+		t.Errorf("Poll after the history got %v, %v, %v, version %d", set, changed, err, sub.Version())
+	}
+
+	// Polls canceled by the server, e.g. shutting down, are not modified
+	reqCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	w := httptest.NewRecorder()
+	pub.ServeHTTP(w, httptest.NewRequest("GET", "/?since=6", nil).WithContext(reqCtx))
+	if w.Code != http.StatusNotModified {
+		t.Errorf("canceled poll got status %d", w.Code)
+	}
+
+	// A Publisher restarted with as many versions, or more, has another
+	// epoch: its whole set is sent at once rather than waited for or
+	// diffed from the versions of the previous one
+	restarted := &Publisher{PollTimeout: 50 * time.Millisecond}
+	restartedSrv := httptest.NewServer(restarted)
+	defer restartedSrv.Close()
+	sub.URL = restartedSrv.URL
+	restarted.Publish(mustSet("198.51.100.0/24"))
+	for _, set := range []*netipx.IPSet{v1, v2, v1, v2, v3} {
+		restarted.Publish(set)
+	}
+	if restarted.Version() != sub.Version() || restarted.Epoch() == pub.Epoch() {
+		t.Fatalf("restarted Publisher at version %d, epoch %s", restarted.Version(), restarted.Epoch())
+	}
+	set, changed, err = sub.Poll(ctx)
+	if err != nil || !changed || !reflect.DeepEqual(set.Prefixes(), v3.Prefixes()) {
+		t.Errorf("Poll after a restart got %v, %v, %v", set, changed, err)
+	}
+	restarted.Publish(v1)
+	restarted.Publish(v2)
+	set, changed, err = sub.Poll(ctx)
+	if err != nil || !changed || !reflect.DeepEqual(set.Prefixes(), v2.Prefixes()) || sub.Version() != 8 {
+		t.Errorf("Poll of a diff after a restart got %v, %v, %v, version %d", set, changed, err, sub.Version())
+	}
+	sub.URL = srv.URL
+
+	// Publishers behind an Authenticator need the token
+	authSrv := httptest.NewServer((&Authenticator{Tokens: []string{"secret"}}).Handler(pub))
+	defer authSrv.Close()
+	if _, _, err := (&Subscriber{URL: authSrv.URL}).Poll(ctx); err == nil {
+		t.Error("Poll without token succeeded")
+	}
+	if set, changed, err := (&Subscriber{URL: authSrv.URL, Token: "secret"}).Poll(ctx); err != nil || !changed || !reflect.DeepEqual(set.Prefixes(), v3.Prefixes()) {
+		t.Errorf("Poll with token got %v, %v, %v", set, changed, err)
+	}
+}
+
+func TestPublisherEvents(t *testing.T) {
+	mustSet := func(prefixes ...string) *netipx.IPSet {
+		var b netipx.IPSetBuilder
+		for _, p := range prefixes {
+			b.AddPrefix(netip.MustParsePrefix(p))
+		}
+		set, _ := b.IPSet()
+		return set
+	}
+	pub := &Publisher{History: 1}
+	pub.Publish(mustSet("10.0.0.0/8"))
+	srv := httptest.NewServer(pub)
+	defer srv.Close()
+
+	// stream returns the next events of the stream after version since
+	stream := func(since string) (lines chan string, cancel func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		req.Header.Set("Accept", EventStreamContentType)
+		if since != "" {
+			req.Header.Set("Last-Event-ID", since)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != EventStreamContentType {
+			t.Errorf("Content-Type got %q", ct)
+		}
+		lines = make(chan string, 100)
+		go func() {
+			defer resp.Body.Close()
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			close(lines)
+		}()
+		return lines, cancel
+	}
+	next := func(lines chan string, n int) []string {
+		var got []string
+		for range n {
+			select {
+			case line := <-lines:
+				got = append(got, line)
+			case <-time.After(time.Second):
+				t.Fatalf("timed out after %q", got)
+			}
+		}
+		return got
+	}
+
+	epoch := pub.Epoch()
+	lines, cancel := stream("")
+	defer cancel()
+	want := []string{"event: reset", "data: 1", "", "event: add", "data: 10.0.0.0/8", "id: " + epoch + ":1", ""}
+	if got := next(lines, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("initial events got %q", got)
+	}
+	pub.Publish(mustSet("10.0.0.0/9", "192.0.2.0/24"))
+	want = []string{
+		"event: remove", "data: 10.128.0.0/9", "",
+		"event: add", "data: 192.0.2.0/24", "id: " + epoch + ":2", "",
+	}
+	if got := next(lines, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("change events got %q", got)
+	}
+
+	// Reconnecting clients resume after their last version, or from the
+	// whole set if it is older than the history
+	pub.Publish(mustSet("192.0.2.0/24"))
+	resumed, cancel := stream(epoch + ":2")
+	defer cancel()
+	want = []string{"event: remove", "data: 10.0.0.0/9", "id: " + epoch + ":3", ""}
+	if got := next(resumed, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed events got %q", got)
+	}
+	old, cancel := stream("1")
+	defer cancel()
+	want = []string{"event: reset", "data: 3", "", "event: add", "data: 192.0.2.0/24", "id: " + epoch + ":3", ""}
+	if got := next(old, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("events after an old version got %q", got)
+	}
+
+	// Versions of another epoch, e.g. before a restart, are reset
+	other, cancel := stream("0123456789abcdef:2")
+	defer cancel()
+	if got := next(other, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("events after another epoch got %q", got)
+	}
+}
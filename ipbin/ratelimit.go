@@ -0,0 +1,80 @@
+package ipbin
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the rate of the requests of each client of an HTTP
+// server with a token bucket: a client may make Burst requests at once,
+// then Rate per second.
+type RateLimiter struct {
+	// Rate is the sustained number of requests per second of a client.
+	Rate float64
+	// Burst is the number of requests a client may make at once, at least 1.
+	Burst int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+// tokenBucket is the bucket of a client, holding tokens at the time it was
+// last updated.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Allow takes a token from the bucket of client at now and reports whether
+// there was one, or if not, how long until there is.
+func (l *RateLimiter) Allow(client string, now time.Time) (bool, time.Duration) {
+	burst := float64(max(l.Burst, 1))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+	// Forget the buckets full again, which behave like new ones
+	if now.Sub(l.swept) >= time.Minute {
+		for c, b := range l.buckets {
+			if b.tokens+now.Sub(b.updated).Seconds()*l.Rate >= burst {
+				delete(l.buckets, c)
+			}
+		}
+		l.swept = now
+	}
+	b := l.buckets[client]
+	if b == nil {
+		b = &tokenBucket{tokens: burst, updated: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.updated).Seconds()*l.Rate)
+	b.updated = now
+	if b.tokens < 1 {
+		if l.Rate <= 0 {
+			return false, time.Duration(math.MaxInt64)
+		}
+		return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Handler returns a handler answering the requests of the clients over
+// their rate with 429 Too Many Requests and a Retry-After header, and
+// passing the others to next. Clients are told apart by RequestClient, so
+// that authenticated ones have their own bucket whatever their address.
+func (l *RateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.Allow(RequestClient(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(min(wait, time.Hour).Seconds())), 10))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
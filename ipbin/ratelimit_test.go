@@ -0,0 +1,46 @@
+package ipbin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := &RateLimiter{Rate: 2, Burst: 3}
+	now := time.Unix(1700000000, 0)
+	for i := range 3 {
+		if ok, _ := l.Allow("a", now); !ok {
+			t.Fatalf("request %d of the burst denied", i+1)
+		}
+	}
+	if ok, wait := l.Allow("a", now); ok || wait != 500*time.Millisecond {
+		t.Errorf("over the burst got %v, %v", ok, wait)
+	}
+	if ok, _ := l.Allow("b", now); !ok {
+		t.Error("another client denied")
+	}
+	if ok, _ := l.Allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("refilled token denied")
+	}
+	// Full buckets are forgotten
+	l.Allow("c", now.Add(2*time.Minute))
+	if len(l.buckets) != 1 {
+		t.Errorf("got %d buckets after a sweep", len(l.buckets))
+	}
+
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	codes := map[int]int{}
+	for range 4 {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		codes[w.Code]++
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+			t.Errorf("Retry-After got %q", w.Header().Get("Retry-After"))
+		}
+	}
+	if codes[http.StatusOK] != 3 || codes[http.StatusTooManyRequests] != 1 {
+		t.Errorf("handler got status counts %v", codes)
+	}
+}
@@ -0,0 +1,164 @@
+package ipbin
+
+import (
+	"encoding/json"
+	"fmt"
+	"go4.org/netipx"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RDAPAnnotator annotates prefixes with the registration data of the
+// network containing them, looked up with RDAP (RFC 9083). It sets the
+// "netname", "handle" and "holder" attributes.
+//
+// Responses are cached by the network range they describe, so prefixes
+// belonging to an already looked up network do not cause new requests.
+type RDAPAnnotator struct {
+	// BaseURL defaults to https://rdap.org, which redirects queries to
+	// the authoritative registry.
+	BaseURL string
+	// Client defaults to an http.Client with a 30 second timeout.
+	Client *http.Client
+	// Interval is the minimum delay between two requests, zero for no limit.
+	Interval time.Duration
+
+	mu    sync.Mutex
+	last  time.Time
+	cache []rdapNetwork
+}
+
+type rdapNetwork struct {
+	r     netipx.IPRange
+	attrs map[string]string
+}
+
+func (a *RDAPAnnotator) Annotate(p netip.Prefix) (map[string]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	pr := netipx.RangeOfPrefix(p)
+	for _, n := range a.cache {
+		if n.r.From().Compare(pr.From()) <= 0 && pr.To().Compare(n.r.To()) <= 0 {
+			return n.attrs, nil
+		}
+	}
+
+	if wait := a.Interval - time.Since(a.last); a.Interval > 0 && wait > 0 {
+		time.Sleep(wait)
+	}
+	a.last = time.Now()
+
+	n, err := a.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	a.cache = append(a.cache, n)
+	return n.attrs, nil
+}
+
+func (a *RDAPAnnotator) lookup(p netip.Prefix) (rdapNetwork, error) {
+	base := a.BaseURL
+	if base == "" {
+		base = "https://rdap.org"
+	}
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	req, err := http.NewRequest(http.MethodGet, base+"/ip/"+p.Masked().String(), nil)
+	if err != nil {
+		return rdapNetwork{}, err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return rdapNetwork{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// Unregistered space, remember it as such for this prefix only
+		return rdapNetwork{r: netipx.RangeOfPrefix(p), attrs: map[string]string{}}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return rdapNetwork{}, fmt.Errorf("rdap %s: unexpected status %s", p, resp.Status)
+	}
+
+	var doc struct {
+		Handle       string       `json:"handle"`
+		Name         string       `json:"name"`
+		StartAddress string       `json:"startAddress"`
+		EndAddress   string       `json:"endAddress"`
+		Entities     []rdapEntity `json:"entities"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return rdapNetwork{}, fmt.Errorf("rdap %s: %w", p, err)
+	}
+
+	n := rdapNetwork{r: netipx.RangeOfPrefix(p), attrs: map[string]string{}}
+	from, err1 := netip.ParseAddr(doc.StartAddress)
+	to, err2 := netip.ParseAddr(doc.EndAddress)
+	if r := netipx.IPRangeFrom(from, to); err1 == nil && err2 == nil && r.IsValid() {
+		n.r = r
+	}
+	if doc.Name != "" {
+		n.attrs["netname"] = doc.Name
+	}
+	if doc.Handle != "" {
+		n.attrs["handle"] = doc.Handle
+	}
+	if holder := rdapHolder(doc.Entities); holder != "" {
+		n.attrs["holder"] = holder
+	}
+	return n, nil
+}
+
+type rdapEntity struct {
+	Roles      []string          `json:"roles"`
+	VCardArray []json.RawMessage `json:"vcardArray"`
+}
+
+// rdapHolder returns the formatted name of the registrant entity, falling
+// back to any other entity if there is no registrant.
+func rdapHolder(entities []rdapEntity) string {
+	var fallback string
+	for _, e := range entities {
+		fn := e.formattedName()
+		for _, role := range e.Roles {
+			if role == "registrant" && fn != "" {
+				return fn
+			}
+		}
+		if fallback == "" {
+			fallback = fn
+		}
+	}
+	return fallback
+}
+
+// formattedName returns the "fn" property of the entity's jCard (RFC 7095).
+func (e rdapEntity) formattedName() string {
+	if len(e.VCardArray) != 2 {
+		return ""
+	}
+	var props [][]json.RawMessage
+	if err := json.Unmarshal(e.VCardArray[1], &props); err != nil {
+		return ""
+	}
+	for _, prop := range props {
+		if len(prop) < 4 {
+			continue
+		}
+		var name, value string
+		if json.Unmarshal(prop[0], &name) != nil || name != "fn" {
+			continue
+		}
+		if json.Unmarshal(prop[3], &value) == nil {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
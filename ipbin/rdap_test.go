@@ -0,0 +1,58 @@
+package ipbin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestRDAPAnnotator(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/ip/192.0.2.0/26", "/ip/192.0.2.128/25":
+			w.Write([]byte(`{
+			  "objectClassName": "ip network",
+			  "handle": "NET-192-0-2-0-1",
+			  "name": "TEST-NET-1",
+			  "startAddress": "192.0.2.0",
+			  "endAddress": "192.0.2.255",
+			  "entities": [
+			    {"roles": ["abuse"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Abuse Desk"]]]},
+			    {"roles": ["registrant"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example Holder"]]]}
+			  ]
+			}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	a := &RDAPAnnotator{BaseURL: srv.URL}
+	want := map[string]string{"netname": "TEST-NET-1", "handle": "NET-192-0-2-0-1", "holder": "Example Holder"}
+	for _, s := range []string{"192.0.2.0/26", "192.0.2.128/25"} {
+		attrs, err := a.Annotate(netip.MustParsePrefix(s))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(attrs, want) {
+			t.Errorf("Annotate(%s) got %v, want %v", s, attrs, want)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected cached response to be reused, got %d requests", requests)
+	}
+
+	attrs, err := a.Annotate(netip.MustParsePrefix("198.51.100.0/24"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(attrs) != 0 {
+		t.Errorf("Annotate of unregistered prefix got %v", attrs)
+	}
+}
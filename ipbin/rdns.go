@@ -0,0 +1,170 @@
+package ipbin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ReverseZone is a reverse DNS zone covering all or part of a prefix.
+type ReverseZone struct {
+	// Name is the fully qualified zone name, e.g. "2.0.192.in-addr.arpa.".
+	Name string
+	// Prefix is the prefix whose reverse names the zone holds.
+	Prefix netip.Prefix
+	// Classless is set for the zones of IPv4 prefixes longer than /24,
+	// named "first/length" within the zone of their /24 as in RFC 2317,
+	// e.g. "0/25.2.0.192.in-addr.arpa.". Their parent zone delegates them
+	// with CNAME records for each address.
+	Classless bool
+}
+
+// ReverseZones returns the in-addr.arpa or ip6.arpa zones holding the
+// reverse names of p: a single zone if p ends at an octet of IPv4 or a
+// nibble of IPv6, the zones of the next longer such prefixes otherwise,
+// e.g. 2.0.192.in-addr.arpa. and 3.0.192.in-addr.arpa. for 192.0.2.0/23,
+// and a classless zone for IPv4 prefixes longer than /24. A prefix spans
+// at most 128 zones.
+func ReverseZones(p netip.Prefix) []ReverseZone {
+	p = p.Masked()
+	step := 4
+	if p.Addr().Is4() {
+		step = 8
+		if p.Bits() > 24 && p.Bits() < 32 {
+			parent := netip.PrefixFrom(p.Addr(), 24).Masked()
+			first := p.Addr().As4()[3]
+			name := fmt.Sprintf("%d/%d.%s", first, p.Bits(), reverseZoneName(parent))
+			return []ReverseZone{{Name: name, Prefix: p, Classless: true}}
+		}
+	}
+	bits := (p.Bits() + step - 1) / step * step
+	zones := make([]ReverseZone, 1<<(bits-p.Bits()))
+	addr := p.Addr()
+	for i := range zones {
+		sub := netip.PrefixFrom(addr, bits)
+		zones[i] = ReverseZone{Name: reverseZoneName(sub), Prefix: sub}
+		addr = netipx.RangeOfPrefix(sub).To().Next()
+	}
+	return zones
+}
+
+// reverseZoneName returns the name of the reverse zone of p, which ends at
+// an octet of IPv4 or a nibble of IPv6.
+func reverseZoneName(p netip.Prefix) string {
+	var b strings.Builder
+	if p.Addr().Is4() {
+		a := p.Addr().As4()
+		for i := p.Bits()/8 - 1; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(a[i])) + ".")
+		}
+		b.WriteString("in-addr.arpa.")
+		return b.String()
+	}
+	a := p.Addr().As16()
+	for i := p.Bits()/4 - 1; i >= 0; i-- {
+		nibble := a[i/2] >> 4
+		if i%2 == 1 {
+			nibble = a[i/2] & 0xf
+		}
+		b.WriteString(strconv.FormatUint(uint64(nibble), 16) + ".")
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
+
+// ReverseDNSOptions configures WriteReverseZones and
+// WriteReverseDelegations.
+type ReverseDNSOptions struct {
+	// Nameservers are the fully qualified names of the nameservers of the
+	// zones, at least one.
+	Nameservers []string
+	// Hostmaster is the mailbox of the SOA records, as a name, e.g.
+	// "hostmaster.example.com.", by default hostmaster in the domain of
+	// the first nameserver.
+	Hostmaster string
+}
+
+// reverseDNSOptions returns the options of the "rdns-ns" and
+// "rdns-hostmaster" parameters.
+func reverseDNSOptions(params Params) ReverseDNSOptions {
+	return ReverseDNSOptions{Nameservers: params.List("rdns-ns"), Hostmaster: params.Get("rdns-hostmaster", "")}
+}
+
+func (o ReverseDNSOptions) check() error {
+	if len(o.Nameservers) == 0 {
+		return errors.New("reverse zones require at least one nameserver")
+	}
+	for _, ns := range o.Nameservers {
+		if !strings.HasSuffix(ns, ".") || strings.Contains(ns, " ") {
+			return fmt.Errorf("nameserver %q is not a fully qualified name", ns)
+		}
+	}
+	return nil
+}
+
+// hostmaster returns the SOA mailbox of the zones.
+func (o ReverseDNSOptions) hostmaster() string {
+	if o.Hostmaster != "" {
+		return o.Hostmaster
+	}
+	_, domain, ok := strings.Cut(o.Nameservers[0], ".")
+	if !ok || domain == "" {
+		domain = o.Nameservers[0]
+	}
+	return "hostmaster." + domain
+}
+
+// WriteReverseZones writes the scaffolding of the reverse zones of the
+// prefixes (see ReverseZones), one after the other: per zone, its origin, a
+// SOA record and the NS records of the nameservers, ready to be split into
+// zone files and filled with PTR records.
+func WriteReverseZones(w io.Writer, prefixes []netip.Prefix, opts ReverseDNSOptions) error {
+	if err := opts.check(); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, p := range prefixes {
+		for _, z := range ReverseZones(p) {
+			fmt.Fprintf(bw, "; %s\n$ORIGIN %s\n$TTL 3600\n", z.Prefix, z.Name)
+			fmt.Fprintf(bw, "@\tIN\tSOA\t%s %s ( 1 3600 900 604800 3600 )\n", opts.Nameservers[0], opts.hostmaster())
+			for _, ns := range opts.Nameservers {
+				fmt.Fprintf(bw, "@\tIN\tNS\t%s\n", ns)
+			}
+			bw.WriteString("\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteReverseDelegations writes the records delegating the reverse zones
+// of the prefixes (see ReverseZones) to the nameservers, to be included in
+// their parent zones: NS records, and for classless zones, the CNAME
+// records of RFC 2317 pointing the reverse names of their addresses into
+// them.
+func WriteReverseDelegations(w io.Writer, prefixes []netip.Prefix, opts ReverseDNSOptions) error {
+	if err := opts.check(); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, p := range prefixes {
+		for _, z := range ReverseZones(p) {
+			for _, ns := range opts.Nameservers {
+				fmt.Fprintf(bw, "%s\tIN\tNS\t%s\n", z.Name, ns)
+			}
+			if !z.Classless {
+				continue
+			}
+			parent := z.Name[strings.IndexByte(z.Name, '.')+1:]
+			for addr := z.Prefix.Addr(); z.Prefix.Contains(addr); addr = addr.Next() {
+				octet := strconv.Itoa(int(addr.As4()[3]))
+				fmt.Fprintf(bw, "%s.%s\tIN\tCNAME\t%s.%s\n", octet, parent, octet, z.Name)
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,85 @@
+package ipbin
+
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestReverseZones(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"10.0.0.0/8", []string{"10.in-addr.arpa."}},
+		{"192.0.2.0/24", []string{"2.0.192.in-addr.arpa."}},
+		{"192.0.2.0/23", []string{"2.0.192.in-addr.arpa.", "3.0.192.in-addr.arpa."}},
+		{"192.0.2.128/25", []string{"128/25.2.0.192.in-addr.arpa."}},
+		{"192.0.2.1/32", []string{"1.2.0.192.in-addr.arpa."}},
+		{"0.0.0.0/0", []string{"in-addr.arpa."}},
+		{"2001:db8::/32", []string{"8.b.d.0.1.0.0.2.ip6.arpa."}},
+		{"2001:db8::/31", []string{"8.b.d.0.1.0.0.2.ip6.arpa.", "9.b.d.0.1.0.0.2.ip6.arpa."}},
+		{"2001:db8:f0::/46", []string{
+			"0.f.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "1.f.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+			"2.f.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "3.f.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+		}},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127", []string{
+			"e.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.ip6.arpa.",
+			"f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.f.ip6.arpa.",
+		}},
+	}
+	for _, tt := range tests {
+		var names []string
+		for _, z := range ReverseZones(netip.MustParsePrefix(tt.prefix)) {
+			names = append(names, z.Name)
+		}
+		if strings.Join(names, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s got %v, want %v", tt.prefix, names, tt.want)
+		}
+	}
+	if n := len(ReverseZones(netip.MustParsePrefix("10.0.0.0/9"))); n != 128 {
+		t.Errorf("10.0.0.0/9 got %d zones, want 128", n)
+	}
+}
+
+func TestWriteReverseDNS(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("198.51.100.4/30")}
+	opts := ReverseDNSOptions{Nameservers: []string{"ns1.example.com.", "ns2.example.com."}}
+	var buf bytes.Buffer
+	if err := WriteReverseZones(&buf, prefixes[:1], opts); err != nil {
+		t.Fatal(err)
+	}
+	want := `; 192.0.2.0/24
+$ORIGIN 2.0.192.in-addr.arpa.
+$TTL 3600
+@	IN	SOA	ns1.example.com. hostmaster.example.com. ( 1 3600 900 604800 3600 )
+@	IN	NS	ns1.example.com.
+@	IN	NS	ns2.example.com.
+
+`
+	if buf.String() != want {
+		t.Errorf("zones got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteReverseDelegations(&buf, prefixes, ReverseDNSOptions{Nameservers: opts.Nameservers[:1]}); err != nil {
+		t.Fatal(err)
+	}
+	want = `2.0.192.in-addr.arpa.	IN	NS	ns1.example.com.
+4/30.100.51.198.in-addr.arpa.	IN	NS	ns1.example.com.
+4.100.51.198.in-addr.arpa.	IN	CNAME	4.4/30.100.51.198.in-addr.arpa.
+5.100.51.198.in-addr.arpa.	IN	CNAME	5.4/30.100.51.198.in-addr.arpa.
+6.100.51.198.in-addr.arpa.	IN	CNAME	6.4/30.100.51.198.in-addr.arpa.
+7.100.51.198.in-addr.arpa.	IN	CNAME	7.4/30.100.51.198.in-addr.arpa.
+`
+	if buf.String() != want {
+		t.Errorf("delegations got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	for _, opts := range []ReverseDNSOptions{{}, {Nameservers: []string{"ns1.example.com"}}} {
+		if err := WriteReverseZones(&buf, prefixes, opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package ipbin
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostResolver resolves host names into their addresses, like
+// *net.Resolver, with network "ip" for both A and AAAA records.
+type HostResolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// CachingResolver is a HostResolver looking each host up once, and each
+// lookup for at most Timeout. It is safe for concurrent use.
+type CachingResolver struct {
+	Resolver HostResolver  // e.g. net.DefaultResolver
+	Timeout  time.Duration // per lookup, none if 0
+
+	mu    sync.Mutex
+	cache map[string]cachedLookup
+}
+
+type cachedLookup struct {
+	addrs []netip.Addr
+	err   error
+}
+
+// LookupNetIP looks host up with Resolver, unless it already did for
+// network.
+func (c *CachingResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	key := network + " " + strings.ToLower(host)
+	c.mu.Lock()
+	l, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return l.addrs, l.err
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	l.addrs, l.err = c.Resolver.LookupNetIP(ctx, network, host)
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[string]cachedLookup)
+	}
+	c.cache[key] = l
+	c.mu.Unlock()
+	return l.addrs, l.err
+}
+
+// isHostname reports whether s looks like a host name rather than an
+// address, subnet or range: dot-separated labels of letters, digits, '-'
+// and '_', with at least a letter.
+func isHostname(s string) bool {
+	letter := false
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			letter = true
+		case r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.':
+		default:
+			return false
+		}
+	}
+	return letter && !strings.HasPrefix(s, ".") && !strings.Contains(s, "..")
+}
+
+// appendHostPrefixes appends the addresses of host, resolved with res, to
+// nets as single-address prefixes.
+func appendHostPrefixes(ctx context.Context, nets []netip.Prefix, host string, res HostResolver) ([]netip.Prefix, error) {
+	addrs, err := res.LookupNetIP(ctx, "ip", strings.TrimSuffix(host, "."))
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		a = a.Unmap().WithZone("")
+		nets = append(nets, netip.PrefixFrom(a, a.BitLen()))
+	}
+	return nets, nil
+}
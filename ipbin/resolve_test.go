@@ -0,0 +1,78 @@
+package ipbin
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeResolver struct {
+	hosts   map[string][]netip.Addr
+	lookups int
+}
+
+func (f *fakeResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	f.lookups++
+	if addrs, ok := f.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func TestParseResolve(t *testing.T) {
+	fake := &fakeResolver{hosts: map[string][]netip.Addr{
+		"mail.example.com": {netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")},
+		"my-host":          {netip.MustParseAddr("::ffff:198.51.100.7")},
+	}}
+	res := &CachingResolver{Resolver: fake}
+	parse, _ := InputFormat("text")
+	input := "10.0.0.0/8\nmail.example.com\nmy-host mail.example.com.\n1.2.3.4-1.2.3.5\n"
+	nets, err := parse(strings.NewReader(input), ParseOptions{Resolver: res})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+		netip.MustParsePrefix("198.51.100.7/32"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+		netip.MustParsePrefix("1.2.3.4/31"),
+	}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v\nwant %v", nets, expected)
+	}
+	if fake.lookups != 2 {
+		t.Errorf("got %d lookups, want 2", fake.lookups)
+	}
+
+	if _, err := parse(strings.NewReader("unknown.example.com\n"), ParseOptions{Resolver: res}); err == nil {
+		t.Error("expected an error for an unresolvable host")
+	}
+	if _, err := parse(strings.NewReader("mail.example.com\n"), ParseOptions{}); err == nil {
+		t.Error("expected an error for a host name without resolver")
+	}
+}
+
+func TestIsHostname(t *testing.T) {
+	for s, want := range map[string]bool{
+		"example.com":   true,
+		"my_host-1":     true,
+		"example.com.":  true,
+		"1.2.3.4":       false,
+		"1.2.3.*":       false,
+		"2001:db8::1":   false,
+		"10.0.0.0/8":    false,
+		".example.com":  false,
+		"example..com":  false,
+		"1.2.3.4-1.2.3": false,
+	} {
+		if got := isHostname(s); got != want {
+			t.Errorf("isHostname(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package ipbin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// rtfUp is the flag of the routes in use in the Linux route tables.
+const rtfUp = 0x1
+
+// ParseRouteTable parses a route table dump into the destinations of its
+// routes, snapshotting what a host routes, or denies with reject and
+// blackhole routes. It reads the Linux /proc/net/route and
+// /proc/net/ipv6_route files, and the output of "netstat -rn" on Linux, the
+// BSDs and macOS, recognized by their content. Routes not up in the Linux
+// files are skipped; the default routes are not.
+func ParseRouteTable(r io.Reader) ([]netip.Prefix, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	fields := strings.Fields(string(first))
+	switch {
+	case len(fields) > 0 && fields[0] == "Iface":
+		return parseProcRoute(data)
+	case len(fields) == 10 && len(fields[0]) == 32:
+		return parseProcIPv6Route(data)
+	default:
+		return parseNetstatRoutes(data)
+	}
+}
+
+// parseProcRoute parses /proc/net/route, whose destinations and masks are
+// hexadecimal in host byte order.
+func parseProcRoute(data []byte) (nets []netip.Prefix, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if line == 1 || len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 8 {
+			return nil, &ParseError{Line: line, Err: fmt.Errorf("invalid route %q", scanner.Text())}
+		}
+		dest, err1 := hex.DecodeString(fields[1])
+		flags, err2 := strconv.ParseUint(fields[3], 16, 32)
+		mask, err3 := hex.DecodeString(fields[7])
+		if err1 != nil || err2 != nil || err3 != nil || len(dest) != 4 || len(mask) != 4 {
+			return nil, &ParseError{Line: line, Err: fmt.Errorf("invalid route %q", scanner.Text())}
+		}
+		if flags&rtfUp == 0 {
+			continue
+		}
+		length, ok := netmaskLength(uint32ToIPv4(binary.LittleEndian.Uint32(mask)))
+		if !ok {
+			return nil, &ParseError{Line: line, Err: fmt.Errorf("non-contiguous netmask %s", fields[7])}
+		}
+		addr := uint32ToIPv4(binary.LittleEndian.Uint32(dest))
+		nets = append(nets, netip.PrefixFrom(addr, length).Masked())
+	}
+	return nets, scanner.Err()
+}
+
+// parseProcIPv6Route parses /proc/net/ipv6_route, whose destinations are
+// hexadecimal in network byte order.
+func parseProcIPv6Route(data []byte) (nets []netip.Prefix, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 10 {
+			return nil, &ParseError{Line: line, Err: fmt.Errorf("invalid route %q", scanner.Text())}
+		}
+		dest, err1 := hex.DecodeString(fields[0])
+		length, err2 := strconv.ParseUint(fields[1], 16, 8)
+		flags, err3 := strconv.ParseUint(fields[8], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || len(dest) != 16 || length > 128 {
+			return nil, &ParseError{Line: line, Err: fmt.Errorf("invalid route %q", scanner.Text())}
+		}
+		if flags&rtfUp == 0 {
+			continue
+		}
+		nets = append(nets, netip.PrefixFrom(netip.AddrFrom16([16]byte(dest)), int(length)).Masked())
+	}
+	return nets, scanner.Err()
+}
+
+// parseNetstatRoutes parses the output of "netstat -rn": with a Genmask
+// column on Linux, or with the abbreviated destinations of the BSDs and
+// macOS, like "default", "127", "10/8", "192.168.1" or "fe80::%lo0/64".
+func parseNetstatRoutes(data []byte) (nets []netip.Prefix, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var header []string
+	maskCol, ipv6 := -1, false
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 0:
+			continue
+		case fields[0] == "Destination":
+			header = fields
+			maskCol = -1
+			for i, f := range fields {
+				if f == "Genmask" {
+					maskCol = i
+				}
+			}
+			continue
+		case strings.HasSuffix(fields[0], ":") && len(fields) == 1:
+			// Section title of the BSDs, "Internet:" or "Internet6:"
+			header, ipv6 = nil, fields[0] == "Internet6:"
+			continue
+		case header == nil || len(fields) < 2:
+			continue
+		}
+		var p netip.Prefix
+		if maskCol >= 0 && maskCol < len(fields) {
+			p, err = parseNetmaskPrefix(fields[0] + "/" + fields[maskCol])
+		} else {
+			p, err = parseNetstatDestination(fields[0], ipv6 || strings.Contains(fields[1], ":"))
+		}
+		if err != nil {
+			return nil, &ParseError{Line: line, Err: err}
+		}
+		nets = append(nets, p.Masked())
+	}
+	return nets, scanner.Err()
+}
+
+// parseNetstatDestination parses a BSD netstat destination, whose missing
+// trailing IPv4 octets and prefix length are implied.
+func parseNetstatDestination(s string, ipv6 bool) (netip.Prefix, error) {
+	if s == "default" {
+		if ipv6 {
+			return netip.PrefixFrom(netip.IPv6Unspecified(), 0), nil
+		}
+		return netip.PrefixFrom(netip.IPv4Unspecified(), 0), nil
+	}
+	addrS, lengthS, hasLength := strings.Cut(s, "/")
+	addrS, _, _ = strings.Cut(addrS, "%") // zone of link-local addresses
+	if strings.Contains(addrS, ":") {
+		if !hasLength {
+			lengthS = "128"
+		}
+		return netip.ParsePrefix(addrS + "/" + lengthS)
+	}
+	octets := strings.Count(addrS, ".") + 1
+	if octets > 4 {
+		return netip.Prefix{}, fmt.Errorf("invalid netstat destination %q", s)
+	}
+	if !hasLength {
+		lengthS = strconv.Itoa(8 * octets)
+	}
+	return netip.ParsePrefix(addrS + strings.Repeat(".0", 4-octets) + "/" + lengthS)
+}
+
+// InterfaceAddrs returns the addresses of the network interface named
+// name, or of all interfaces if name is empty, as single-address prefixes.
+func InterfaceAddrs(name string) ([]netip.Prefix, error) {
+	var addrs []net.Addr
+	var err error
+	if name == "" {
+		addrs, err = net.InterfaceAddrs()
+	} else {
+		var ifi *net.Interface
+		if ifi, err = net.InterfaceByName(name); err == nil {
+			addrs, err = ifi.Addrs()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nets []netip.Prefix
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if addr, ok := netip.AddrFromSlice(ipnet.IP); ok {
+			addr = addr.Unmap()
+			nets = append(nets, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return nets, nil
+}
@@ -0,0 +1,79 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRouteTable(t *testing.T) {
+	for name, test := range map[string]struct {
+		dump     string
+		expected []string
+	}{
+		"proc": {
+			"Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+				"eth0\t00000000\t010200C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n" +
+				"eth0\t000200C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n" +
+				"eth0\t0000000A\t00000000\t0000\t0\t0\t0\t000000FF\t0\t0\t0\n",
+			[]string{"0.0.0.0/0", "192.0.2.0/24"},
+		},
+		"proc ipv6": {
+			"fd000000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0\n" +
+				"00000000000000000000000000000001 80 00000000000000000000000000000000 00 00000000000000000000000000000000 00000000 00000003 00000000 80200001       lo\n" +
+				"20010db8000000000000000000000000 20 00000000000000000000000000000000 00 00000000000000000000000000000000 00000000 00000003 00000000 00000000       lo\n",
+			[]string{"fd00::/64", "::1/128"},
+		},
+		"netstat linux": {
+			"Kernel IP routing table\n" +
+				"Destination     Gateway         Genmask         Flags   MSS Window  irtt Iface\n" +
+				"0.0.0.0         192.0.2.1       0.0.0.0         UG        0 0          0 eth0\n" +
+				"192.0.2.0       0.0.0.0         255.255.255.0   U         0 0          0 eth0\n",
+			[]string{"0.0.0.0/0", "192.0.2.0/24"},
+		},
+		"netstat bsd": {
+			"Routing tables\n\nInternet:\n" +
+				"Destination        Gateway            Flags        Netif Expire\n" +
+				"default            192.168.1.1        UGScg          en0\n" +
+				"10/8               link#4             UCS            en0      !\n" +
+				"127                127.0.0.1          UCS            lo0\n" +
+				"192.168.1          link#4             UCS            en0      !\n" +
+				"192.168.1.10/32    link#4             UCS            en0      !\n" +
+				"\nInternet6:\n" +
+				"Destination                             Gateway                         Flags         Netif Expire\n" +
+				"default                                 fe80::1%en0                     UGcg            en0\n" +
+				"::1                                     ::1                             UHL             lo0\n" +
+				"fe80::%lo0/64                           fe80::1%lo0                     UcI             lo0\n",
+			[]string{"0.0.0.0/0", "10.0.0.0/8", "127.0.0.0/8", "192.168.1.0/24", "192.168.1.10/32", "::/0", "::1/128", "fe80::/64"},
+		},
+	} {
+		nets, err := ParseRouteTable(strings.NewReader(test.dump))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		var expected []netip.Prefix
+		for _, s := range test.expected {
+			expected = append(expected, netip.MustParsePrefix(s))
+		}
+		if !reflect.DeepEqual(nets, expected) {
+			t.Errorf("%s: got %v\nwant %v", name, nets, expected)
+		}
+	}
+}
+
+func TestInterfaceAddrs(t *testing.T) {
+	nets, err := InterfaceAddrs("")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, p := range nets {
+		if !p.IsSingleIP() {
+			t.Errorf("got %s, want a single address", p)
+		}
+	}
+	if _, err := InterfaceAddrs("no-such-interface0"); err == nil {
+		t.Error("expected an error for an unknown interface")
+	}
+}
@@ -0,0 +1,88 @@
+package ipbin
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// RPZ policy actions and the CNAME targets they are expressed with in a
+// response-policy zone.
+var rpzActions = map[string]string{
+	"nxdomain": ".",
+	"nodata":   "*.",
+	"passthru": "rpz-passthru.",
+	"drop":     "rpz-drop.",
+}
+
+// RPZActionTarget returns the CNAME target for a named RPZ policy action
+// (nxdomain, nodata, passthru or drop).
+func RPZActionTarget(action string) (string, error) {
+	target, ok := rpzActions[strings.ToLower(action)]
+	if !ok {
+		return "", fmt.Errorf("unknown rpz action %q", action)
+	}
+	return target, nil
+}
+
+// RPZTriggerName returns the relative owner name of the rpz-ip trigger
+// matching prefix p.
+//
+// IPv4 prefixes are written as the prefix length followed by the address
+// octets in reverse order, IPv6 prefixes as the prefix length followed by
+// the 16-bit words in reverse order, with the longest run of zero words
+// replaced by "zz".
+//
+// Example:
+//   - 192.0.2.0/24 → 24.0.2.0.192.rpz-ip
+//   - 2001:db8::/32 → 32.zz.db8.2001.rpz-ip
+func RPZTriggerName(p netip.Prefix) string {
+	p = p.Masked()
+	addr := p.Addr()
+	var labels []string
+	if addr.Is4() {
+		ip := addr.As4()
+		for i := len(ip) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(ip[i])))
+		}
+	} else {
+		ip := addr.As16()
+		var words [8]uint16
+		for i := range words {
+			words[i] = uint16(ip[2*i])<<8 | uint16(ip[2*i+1])
+		}
+		// Find the longest run of zero words, as "::" would compress it.
+		zStart, zLen := -1, 0
+		for i := 0; i < len(words); {
+			if words[i] != 0 {
+				i++
+				continue
+			}
+			j := i
+			for j < len(words) && words[j] == 0 {
+				j++
+			}
+			if j-i > zLen && j-i > 1 {
+				zStart, zLen = i, j-i
+			}
+			i = j
+		}
+		for i := len(words) - 1; i >= 0; i-- {
+			if i >= zStart && i < zStart+zLen {
+				if i == zStart {
+					labels = append(labels, "zz")
+				}
+				continue
+			}
+			labels = append(labels, strconv.FormatUint(uint64(words[i]), 16))
+		}
+	}
+	return strconv.Itoa(p.Bits()) + "." + strings.Join(labels, ".") + ".rpz-ip"
+}
+
+// RPZRecord returns a zone file record triggering the policy expressed by
+// target (see RPZActionTarget) for addresses within prefix p.
+func RPZRecord(p netip.Prefix, target string) string {
+	return RPZTriggerName(p) + " CNAME " + target
+}
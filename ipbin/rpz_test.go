@@ -0,0 +1,40 @@
+package ipbin
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestRPZTriggerName(t *testing.T) {
+	cases := []struct {
+		p    netip.Prefix
+		want string
+	}{
+		{netip.MustParsePrefix("192.0.2.0/24"), "24.0.2.0.192.rpz-ip"},
+		{netip.MustParsePrefix("1.2.3.4/32"), "32.4.3.2.1.rpz-ip"},
+		{netip.MustParsePrefix("2001:db8::/32"), "32.zz.db8.2001.rpz-ip"},
+		{netip.MustParsePrefix("2001:2::3/128"), "128.3.zz.2.2001.rpz-ip"},
+		{netip.MustParsePrefix("2001:db8:0:1::/64"), "64.zz.1.0.db8.2001.rpz-ip"},
+		{netip.MustParsePrefix("::/0"), "0.zz.rpz-ip"},
+	}
+	for _, tc := range cases {
+		if got := RPZTriggerName(tc.p); got != tc.want {
+			t.Errorf("RPZTriggerName(%v) got %q, want %q", tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestRPZRecord(t *testing.T) {
+	target, err := RPZActionTarget("NXDOMAIN")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	got := RPZRecord(netip.MustParsePrefix("10.0.0.0/8"), target)
+	if want := "8.0.0.0.10.rpz-ip CNAME ."; got != want {
+		t.Errorf("RPZRecord got %q, want %q", got, want)
+	}
+	if _, err := RPZActionTarget("block"); err == nil {
+		t.Errorf("RPZActionTarget(%q) expected error", "block")
+	}
+}
@@ -0,0 +1,68 @@
+package ipbin
+
+import (
+	"errors"
+	"fmt"
+	"go4.org/netipx"
+	"math"
+	"net/netip"
+)
+
+// ErrSuspiciousCoverage is returned by SanityCheck for a set covering more
+// of the address space than its limits allow.
+var ErrSuspiciousCoverage = errors.New("suspiciously large coverage")
+
+// SanityLimits bounds what a sane merged set covers. A feed error, like a
+// stray /1 or a truncated mask, can turn a blocklist into most of the
+// Internet while passing every syntax check.
+type SanityLimits struct {
+	// MaxIPv4 is the maximum fraction of the IPv4 space covered, e.g. 0.01
+	// for 1%, unchecked if 0.
+	MaxIPv4 float64
+	// MaxIPv6 is the maximum fraction of the IPv6 space covered, unchecked
+	// if 0.
+	MaxIPv6 float64
+}
+
+// Coverage returns the fractions of the IPv4 and IPv6 address spaces
+// covered by ipset.
+func Coverage(ipset *netipx.IPSet) (ipv4, ipv6 float64) {
+	return PrefixCoverage(ipset.Prefixes())
+}
+
+// PrefixCoverage returns the fractions of the IPv4 and IPv6 address spaces
+// covered by prefixes, which must not overlap, e.g. those of a merged set.
+func PrefixCoverage(prefixes []netip.Prefix) (ipv4, ipv6 float64) {
+	for _, p := range prefixes {
+		if p.Addr().Is4() {
+			ipv4 += math.Ldexp(1, -p.Bits())
+		} else {
+			ipv6 += math.Ldexp(1, -p.Bits())
+		}
+	}
+	return ipv4, ipv6
+}
+
+// SanityCheck checks ipset against limits after merging, returning an
+// error wrapping ErrSuspiciousCoverage for each family covered beyond them.
+func SanityCheck(ipset *netipx.IPSet, limits SanityLimits) error {
+	return SanityCheckPrefixes(ipset.Prefixes(), limits)
+}
+
+// SanityCheckPrefixes is SanityCheck for the prefixes of a merged set.
+func SanityCheckPrefixes(prefixes []netip.Prefix, limits SanityLimits) error {
+	ipv4, ipv6 := PrefixCoverage(prefixes)
+	var errs []error
+	if limits.MaxIPv4 > 0 && ipv4 > limits.MaxIPv4 {
+		errs = append(errs, fmt.Errorf("%w: %s of the IPv4 space (maximum %s)", ErrSuspiciousCoverage, formatShare(ipv4), formatShare(limits.MaxIPv4)))
+	}
+	if limits.MaxIPv6 > 0 && ipv6 > limits.MaxIPv6 {
+		errs = append(errs, fmt.Errorf("%w: %s of the IPv6 space (maximum %s)", ErrSuspiciousCoverage, formatShare(ipv6), formatShare(limits.MaxIPv6)))
+	}
+	return errors.Join(errs...)
+}
+
+// formatShare formats a fraction as a percentage, e.g. 12.5%
+func formatShare(f float64) string {
+	return fmt.Sprintf("%.4g%%", f*100)
+}
@@ -0,0 +1,39 @@
+package ipbin
+
+import (
+	"errors"
+	"go4.org/netipx"
+	"net/netip"
+	"testing"
+)
+
+func TestSanityCheck(t *testing.T) {
+	var b netipx.IPSetBuilder
+	b.AddPrefix(netip.MustParsePrefix("10.0.0.0/8"))
+	b.AddPrefix(netip.MustParsePrefix("192.0.2.0/24"))
+	b.AddPrefix(netip.MustParsePrefix("2000::/4"))
+	ipset, _ := b.IPSet()
+
+	ipv4, ipv6 := Coverage(ipset)
+	if want := 1.0/256 + 1.0/(1<<24); ipv4 != want || ipv6 != 1.0/16 {
+		t.Errorf("Coverage got %v, %v", ipv4, ipv6)
+	}
+	if err := SanityCheck(ipset, SanityLimits{MaxIPv4: 0.01, MaxIPv6: 0.1}); err != nil {
+		t.Errorf("within limits got %v", err)
+	}
+	if err := SanityCheck(ipset, SanityLimits{}); err != nil {
+		t.Errorf("no limits got %v", err)
+	}
+	err := SanityCheck(ipset, SanityLimits{MaxIPv4: 0.001, MaxIPv6: 0.01})
+	if !errors.Is(err, ErrSuspiciousCoverage) {
+		t.Fatalf("beyond limits got %v", err)
+	}
+	want := "suspiciously large coverage: 0.3906% of the IPv4 space (maximum 0.1%)\n" +
+		"suspiciously large coverage: 6.25% of the IPv6 space (maximum 1%)"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if err := SanityCheckPrefixes(ipset.Prefixes(), SanityLimits{MaxIPv4: 0.001, MaxIPv6: 0.01}); err == nil || err.Error() != want {
+		t.Errorf("SanityCheckPrefixes got %v", err)
+	}
+}
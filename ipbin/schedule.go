@@ -0,0 +1,176 @@
+package ipbin
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron schedule of jobs, e.g. of the ipbin daemon.
+type Schedule struct {
+	// expr is the schedule as parsed
+	expr string
+	// every is the interval of @every schedules, 0 for cron expressions
+	every time.Duration
+	// The bit sets of the minutes (0-59), hours (0-23), days of the month
+	// (1-31), months (1-12) and days of the week (0-6, Sunday first)
+	minute, hour, dom, month, dow uint64
+	// Whether the days of the month or of the week are restricted, not
+	// starting with "*": if both are, either one matching is enough, as
+	// with cron
+	domSet, dowSet bool
+}
+
+// scheduleMacros are the cron expressions of the schedule shorthands.
+var scheduleMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// scheduleFields are the bounds of the fields of cron expressions.
+var scheduleFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseSchedule parses a schedule: a cron expression of 5 fields, minute,
+// hour, day of the month, month and day of the week, each "*" or a list of
+// numbers and ranges, optionally stepped, e.g. "*/15 * * * *" or
+// "0 6-18/2 * * 1-5"; one of the @yearly, @monthly, @weekly, @daily and
+// @hourly shorthands; or "@every" and a duration, e.g. "@every 10m".
+func ParseSchedule(s string) (Schedule, error) {
+	s = strings.TrimSpace(s)
+	if d, ok := strings.CutPrefix(s, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || every <= 0 {
+			return Schedule{}, fmt.Errorf("invalid schedule %q: invalid duration", s)
+		}
+		return Schedule{expr: s, every: every}, nil
+	}
+	expr := s
+	if strings.HasPrefix(s, "@") {
+		var ok bool
+		if expr, ok = scheduleMacros[s]; !ok {
+			return Schedule{}, fmt.Errorf("invalid schedule %q", s)
+		}
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(scheduleFields) {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: want 5 fields", s)
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseScheduleField(f, scheduleFields[i].min, scheduleFields[i].max)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid schedule %q: %s: %w", s, scheduleFields[i].name, err)
+		}
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+	return Schedule{
+		expr:   s,
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domSet: !strings.HasPrefix(fields[2], "*"), dowSet: !strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseScheduleField parses a field of a cron expression into the bit set
+// of its values.
+func parseScheduleField(f string, min, max int) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(f, ",") {
+		rng, stepS, stepped := strings.Cut(item, "/")
+		step := 1
+		if stepped {
+			var err error
+			if step, err = strconv.Atoi(stepS); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepS)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loS, hiS, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loS); err != nil {
+				return 0, fmt.Errorf("invalid value %q", item)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiS); err != nil {
+					return 0, fmt.Errorf("invalid value %q", item)
+				}
+			} else if stepped {
+				hi = max
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("%q out of range %d-%d", item, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first time of the schedule after t, in the location of
+// t, or the zero time if there is none within 5 years, e.g. for
+// "0 0 30 2 *".
+func (s Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	limit := t.AddDate(5, 0, 0)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<t.Minute()) == 0:
+			// Skip to the next minute of the set, or to the next hour
+			next := s.minute >> t.Minute() &^ 1
+			if next == 0 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			} else {
+				t = t.Add(time.Duration(bits.TrailingZeros64(next)) * time.Minute)
+			}
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchDay reports whether the day of t is in the schedule.
+func (s Schedule) matchDay(t time.Time) bool {
+	dom, dow := s.dom&(1<<t.Day()) != 0, s.dow&(1<<t.Weekday()) != 0
+	if s.domSet && s.dowSet {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// String returns the schedule as parsed.
+func (s Schedule) String() string {
+	return s.expr
+}
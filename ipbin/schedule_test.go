@@ -0,0 +1,50 @@
+package ipbin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, 5, 15, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		schedule string
+		want     time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 15, 10, 15, 0, 0, time.UTC)},
+		{"5 * * * *", time.Date(2024, 5, 15, 11, 5, 0, 0, time.UTC)},
+		{"0,30 6-18/4 * * *", time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 5, 16, 3, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 15, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 5, 16, 9, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either the day of the month or of the week
+		{"0 0 1 * 5", time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+		{"@every 10m", from.Add(10 * time.Minute)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.schedule)
+		if err != nil {
+			t.Errorf("%s: %v", tt.schedule, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.schedule, got, tt.want)
+		}
+		if s.String() != tt.schedule {
+			t.Errorf("%s: String() = %q", tt.schedule, s)
+		}
+	}
+	for _, s := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@often", "@every -1m", "a * * * *"} {
+		if _, err := ParseSchedule(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
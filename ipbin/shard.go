@@ -0,0 +1,219 @@
+package ipbin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go4.org/netipx"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ShardManifestFile is the name of the manifest of a sharded set directory.
+const ShardManifestFile = "manifest.json"
+
+// ShardManifest lists the shards of a sharded set.
+type ShardManifest struct {
+	Bits      int       `json:"bits"` // prefix length of the shards, 8 or 16
+	Generated time.Time `json:"generated"`
+	Source    string    `json:"source,omitempty"`
+	Shards    []Shard   `json:"shards"` // sorted by prefix
+}
+
+// Shard is a binary set file holding the part of a set within Prefix.
+type Shard struct {
+	Prefix  netip.Prefix `json:"prefix"`
+	File    string       `json:"file"`
+	Records int          `json:"records"`
+	SHA256  string       `json:"sha256"` // hex SHA-256 of the records
+}
+
+// shardPrefix returns the shard of the given length containing addr. IPv6
+// addresses are sharded by the same number of leading bits.
+func shardPrefix(addr netip.Addr, bits int) netip.Prefix {
+	p, _ := addr.Prefix(bits)
+	return p
+}
+
+// shardFile returns the file name of the shard p, e.g. v4-10.0.bin or
+// v6-2001.bin.
+func shardFile(p netip.Prefix) string {
+	b := p.Addr().AsSlice()
+	if p.Addr().Is4() {
+		if p.Bits() == 8 {
+			return fmt.Sprintf("v4-%d.bin", b[0])
+		}
+		return fmt.Sprintf("v4-%d.%d.bin", b[0], b[1])
+	}
+	if p.Bits() == 8 {
+		return fmt.Sprintf("v6-%02x.bin", b[0])
+	}
+	return fmt.Sprintf("v6-%02x%02x.bin", b[0], b[1])
+}
+
+// WriteSharded writes ipset to dir as a sharded set: one binary set file
+// per /8 or /16 (bits) holding addresses, with m as their metadata, and a
+// manifest listing them, written last. Prefixes shorter than the shards
+// are split across them. Consumers needing only part of the address space,
+// e.g. through OpenSharded, read only the shards they need.
+func WriteSharded(dir string, ipset *netipx.IPSet, bits int, m Metadata) (*ShardManifest, error) {
+	if bits != 8 && bits != 16 {
+		return nil, fmt.Errorf("invalid shard length /%d, must be 8 or 16", bits)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	m.Index = nil
+	manifest := &ShardManifest{Bits: bits, Generated: m.Generated.UTC().Truncate(time.Second), Source: m.Source}
+	var records []byte
+	var shard netip.Prefix
+	count := 0
+	flushShard := func() error {
+		if count == 0 {
+			return nil
+		}
+		var buf bytes.Buffer
+		if err := WriteContainer(&buf, m, records); err != nil {
+			return err
+		}
+		name := shardFile(shard)
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+		manifest.Shards = append(manifest.Shards, Shard{
+			Prefix:  shard,
+			File:    name,
+			Records: count,
+			SHA256:  fmt.Sprintf("%x", ContentHash(records)),
+		})
+		records, count = records[:0], 0
+		return nil
+	}
+	for _, p := range ipset.Prefixes() {
+		parts := []netip.Prefix{p}
+		if p.Bits() < bits {
+			parts = shardParts(p, bits)
+		}
+		for _, part := range parts {
+			if s := shardPrefix(part.Addr(), bits); s != shard {
+				if err := flushShard(); err != nil {
+					return nil, err
+				}
+				shard = s
+			}
+			var err error
+			if records, err = AppendEncoded(records, part); err != nil {
+				return nil, err
+			}
+			count++
+		}
+	}
+	if err := flushShard(); err != nil {
+		return nil, err
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(dir, "."+ShardManifestFile+".tmp")
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return nil, err
+	}
+	return manifest, os.Rename(tmp, filepath.Join(dir, ShardManifestFile))
+}
+
+// shardParts splits p into the shards of length bits it covers.
+func shardParts(p netip.Prefix, bits int) []netip.Prefix {
+	r := netipx.RangeOfPrefix(p)
+	var parts []netip.Prefix
+	for a := r.From(); a.IsValid() && !r.To().Less(a); {
+		part := netip.PrefixFrom(a, bits)
+		parts = append(parts, part)
+		a = netipx.PrefixLastIP(part).Next()
+	}
+	return parts
+}
+
+// ShardedSet looks addresses up in a sharded set directory, reading each
+// shard the first time an address within it is looked up. It is safe for
+// concurrent use.
+type ShardedSet struct {
+	Manifest ShardManifest
+
+	dir    string
+	mu     sync.Mutex
+	loaded map[netip.Prefix]*netipx.IPSet
+}
+
+// OpenSharded opens the sharded set written by WriteSharded to dir.
+func OpenSharded(dir string) (*ShardedSet, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ShardManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	s := &ShardedSet{dir: dir, loaded: make(map[netip.Prefix]*netipx.IPSet)}
+	if err := json.Unmarshal(b, &s.Manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", ShardManifestFile, err)
+	}
+	if s.Manifest.Bits != 8 && s.Manifest.Bits != 16 {
+		return nil, fmt.Errorf("%s: invalid shard length /%d", ShardManifestFile, s.Manifest.Bits)
+	}
+	return s, nil
+}
+
+// Shard returns the set of the shard containing addr, reading it if needed.
+// It returns an empty set if the shard has no addresses.
+func (s *ShardedSet) Shard(addr netip.Addr) (*netipx.IPSet, error) {
+	prefix := shardPrefix(addr, s.Manifest.Bits)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ipset, ok := s.loaded[prefix]; ok {
+		return ipset, nil
+	}
+	shards := s.Manifest.Shards
+	i := sort.Search(len(shards), func(i int) bool { return !shards[i].Prefix.Addr().Less(prefix.Addr()) })
+	ipset := &netipx.IPSet{}
+	if i < len(shards) && shards[i].Prefix == prefix {
+		// The file name comes from the manifest, keep it in dir
+		name := filepath.Base(shards[i].File)
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		prefixes, err := DecodeAll(data, DecodeOptions{ExpiredAt: time.Now()})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if ipset, err = MergePrefixes(prefixes); err != nil {
+			return nil, err
+		}
+	}
+	s.loaded[prefix] = ipset
+	return ipset, nil
+}
+
+// Lookup returns the prefix of the set covering addr and whether there is
+// one. Prefixes shorter than the shards are returned as their part within
+// the shard of addr.
+func (s *ShardedSet) Lookup(addr netip.Addr) (netip.Prefix, bool, error) {
+	ipset, err := s.Shard(addr)
+	if err != nil {
+		return netip.Prefix{}, false, err
+	}
+	p, ok := CoveringPrefix(ipset, addr)
+	return p, ok, nil
+}
+
+// Contains reports whether addr is in the set.
+func (s *ShardedSet) Contains(addr netip.Addr) (bool, error) {
+	ipset, err := s.Shard(addr)
+	if err != nil {
+		return false, err
+	}
+	return ipset.Contains(addr), nil
+}
@@ -0,0 +1,77 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSharded(t *testing.T) {
+	var b netipx.IPSetBuilder
+	for _, s := range []string{"8.0.0.0/7", "10.1.0.0/16", "10.2.3.0/24", "2001:db8::/32", "2a00::/12"} {
+		b.AddPrefix(netip.MustParsePrefix(s))
+	}
+	ipset, _ := b.IPSet()
+	dir := t.TempDir()
+	m := Metadata{Generated: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Source: "test"}
+	manifest, err := WriteSharded(dir, ipset, 8, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, s := range manifest.Shards {
+		files = append(files, s.File)
+	}
+	want := []string{"v4-8.bin", "v4-9.bin", "v4-10.bin", "v6-20.bin", "v6-2a.bin"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got shards %v, want %v", files, want)
+	}
+	if manifest.Shards[2].Records != 2 {
+		t.Errorf("got %+v", manifest.Shards[2])
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "v4-10.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := ReadMetadataFromBytes(data); got.Source != "test" || got.SHA256 == nil {
+		t.Errorf("got shard metadata %+v", got)
+	}
+
+	s, err := OpenSharded(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.Manifest, *manifest) {
+		t.Errorf("got manifest %+v, want %+v", s.Manifest, *manifest)
+	}
+	for _, c := range []struct {
+		addr, want string
+	}{
+		{"9.9.9.9", "9.0.0.0/8"},
+		{"10.2.3.4", "10.2.3.0/24"},
+		{"10.3.0.0", ""},
+		{"192.0.2.1", ""},
+		{"2001:db8::1", "2001:db8::/32"},
+		{"2a0f::1", "2a00::/12"},
+	} {
+		p, ok, err := s.Lookup(netip.MustParseAddr(c.addr))
+		if err != nil || ok != (c.want != "") || ok && p.String() != c.want {
+			t.Errorf("Lookup(%s) = %s, %v, %v, want %s", c.addr, p, ok, err, c.want)
+		}
+	}
+	if len(s.loaded) != 5 {
+		t.Errorf("loaded %d shards", len(s.loaded))
+	}
+
+	if _, err := WriteSharded(dir, ipset, 12, m); err == nil {
+		t.Errorf("invalid shard length expected error")
+	}
+	manifest, err = WriteSharded(t.TempDir(), ipset, 16, m)
+	if err != nil || len(manifest.Shards) != 512+2+1+16 || manifest.Shards[0].File != "v4-8.0.bin" {
+		t.Errorf("got %d shards, %v", len(manifest.Shards), err)
+	}
+}
@@ -0,0 +1,96 @@
+package ipbin
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrBadSignature is returned by VerifyReader when the signature does not
+// match the content or the key.
+var ErrBadSignature = errors.New("signature verification failed")
+
+// ed25519ph signs the SHA-512 digest of the content, so that it can be
+// streamed
+var ed25519ph = &ed25519.Options{Hash: crypto.SHA512}
+
+// digestReader returns the SHA-512 digest of the content of r.
+func digestReader(r io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// SignReader returns the detached Ed25519ph signature of the content of r,
+// e.g. of a binary set distributed as a blocklist.
+func SignReader(r io.Reader, key ed25519.PrivateKey) ([]byte, error) {
+	digest, err := digestReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return key.Sign(nil, digest, ed25519ph)
+}
+
+// VerifyReader checks that sig is the SignReader signature of the content
+// of r by the private key of pub. It returns ErrBadSignature if not.
+func VerifyReader(r io.Reader, sig []byte, pub ed25519.PublicKey) error {
+	digest, err := digestReader(r)
+	if err != nil {
+		return err
+	}
+	if ed25519.VerifyWithOptions(pub, digest, sig, ed25519ph) != nil {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// ParsePrivateKeyPEM parses a PEM-encoded PKCS #8 Ed25519 private key, as
+// generated by "openssl genpkey -algorithm ed25519".
+func ParsePrivateKeyPEM(b []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an Ed25519 private key: %T", key)
+	}
+	return priv, nil
+}
+
+// ParsePublicKeyPEM parses a PEM-encoded PKIX Ed25519 public key, as
+// written by "openssl pkey -pubout". The public key of a private key is
+// accepted too.
+func ParsePublicKeyPEM(b []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if block.Type == "PRIVATE KEY" {
+		priv, err := ParsePrivateKeyPEM(b)
+		if err != nil {
+			return nil, err
+		}
+		return priv.Public().(ed25519.PublicKey), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an Ed25519 public key: %T", key)
+	}
+	return pub, nil
+}
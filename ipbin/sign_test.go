@@ -0,0 +1,53 @@
+package ipbin
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestSignReader(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	content := []byte{24, 192, 0, 2, 32, 198, 51, 100, 7}
+	sig, err := SignReader(bytes.NewReader(content), priv)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := VerifyReader(bytes.NewReader(content), sig, pub); err != nil {
+		t.Errorf("VerifyReader got %v", err)
+	}
+	content[1] = 10
+	if err := VerifyReader(bytes.NewReader(content), sig, pub); err != ErrBadSignature {
+		t.Errorf("VerifyReader of modified content got %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if der, err = x509.MarshalPKIXPublicKey(pub); err != nil {
+		t.Error(err)
+		return
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if k, err := ParsePrivateKeyPEM(privPEM); err != nil || !k.Equal(priv) {
+		t.Errorf("ParsePrivateKeyPEM got %v", err)
+	}
+	for _, b := range [][]byte{pubPEM, privPEM} {
+		if k, err := ParsePublicKeyPEM(b); err != nil || !k.Equal(pub) {
+			t.Errorf("ParsePublicKeyPEM got %v", err)
+		}
+	}
+	if _, err := ParsePublicKeyPEM([]byte("garbage")); err == nil {
+		t.Errorf("invalid PEM expected error")
+	}
+}
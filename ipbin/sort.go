@@ -0,0 +1,235 @@
+package ipbin
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+)
+
+// DefaultSortMemory is the memory SortRecords sorts records within unless
+// told otherwise.
+const DefaultSortMemory = 256 << 20
+
+// sortBytesPerRecordByte is the memory sorting takes per byte of records:
+// the records themselves and a 32-byte span locating each, records taking
+// 4 bytes or more.
+const sortBytesPerRecordByte = 1 + 32/4
+
+// maxRecordSize is the size of the largest record: a value of
+// MaxValueSize bytes, an expiry and an IPv6 prefix.
+const maxRecordSize = 1 + binary.MaxVarintLen64 + MaxValueSize + 9 + 17
+
+// RecordsSorted reports whether the records of a binary set, without its
+// metadata block, are sorted by the address of their prefixes, as
+// BuildIndex needs them.
+func RecordsSorted(records []byte) (bool, error) {
+	var prev netip.Addr
+	for off := 0; off < len(records); {
+		rec, n, err := readRecord(records[off:])
+		if err != nil {
+			return false, &ParseError{Offset: off, Err: err}
+		}
+		off += n
+		addr := rec.first()
+		if !addr.IsValid() {
+			continue
+		}
+		if prev.IsValid() && addr.Less(prev) {
+			return false, nil
+		}
+		prev = addr
+	}
+	return true, nil
+}
+
+// SortRecords reads binary records from r, without metadata block, and
+// writes them to w sorted by the address of their prefixes, e.g. so that
+// arbitrary record streams can be indexed. Records are kept whole, with
+// their expiry or value, and those of the same address in their order;
+// extension blocks, end-of-stream markers, the headers of blocks of
+// records and the metadata blocks of concatenated sets, which have no
+// address, are dropped. It sorts runs of records fitting maxMemory bytes
+// (DefaultSortMemory if 0) in memory; beyond, it spills the sorted runs to
+// temporary files of dir, os.TempDir() if empty, then merges them.
+func SortRecords(ctx context.Context, w io.Writer, r io.Reader, maxMemory int64, dir string) error {
+	if maxMemory <= 0 {
+		maxMemory = DefaultSortMemory
+	}
+	buf := make([]byte, max(maxMemory/sortBytesPerRecordByte, 2*maxRecordSize))
+	var spans []recordSpan
+	var runs []*os.File
+	defer func() {
+		for _, f := range runs {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	var read int64 // offset of buf in r
+	for filled, eof := 0, false; !eof; {
+		n, err := io.ReadFull(r, buf[filled:])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			eof = true
+		} else if err != nil {
+			return err
+		}
+		filled += n
+
+		// Sort the whole records of buf, keeping the partial last one for
+		// the next run
+		spans = spans[:0]
+		off := 0
+		for off < filled {
+			if len(spans)%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			rec, n, err := readRecord(buf[off:filled])
+			if err == io.ErrUnexpectedEOF && !eof {
+				if off == 0 {
+					// Not even a record fits, e.g. a large metadata block
+					// of concatenated sets
+					return &ParseError{Offset: int(read), Err: fmt.Errorf("block of more than %d bytes", len(buf))}
+				}
+				break
+			}
+			if err != nil {
+				return &ParseError{Offset: int(read) + off, Err: err}
+			}
+			if addr := rec.first(); addr.IsValid() {
+				spans = append(spans, recordSpan{addr: addr, off: off, n: n})
+			}
+			off += n
+		}
+		slices.SortStableFunc(spans, func(a, b recordSpan) int { return a.addr.Compare(b.addr) })
+
+		if eof && runs == nil {
+			// All records fit in memory
+			return writeSpans(w, buf, spans)
+		}
+		f, err := os.CreateTemp(dir, "ipbin-sort-*")
+		if err != nil {
+			return err
+		}
+		runs = append(runs, f)
+		bw := bufio.NewWriter(f)
+		if err := writeSpans(bw, buf, spans); err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		filled = copy(buf, buf[off:filled])
+		read += int64(off)
+	}
+
+	// Merge the sorted runs, taking the records of the same address from
+	// the earliest run first
+	h := make(runHeap, 0, len(runs))
+	for i, f := range runs {
+		c := &runCursor{r: bufio.NewReaderSize(f, 2*maxRecordSize), run: i}
+		if err := c.next(); err != nil {
+			return err
+		}
+		if c.record != nil {
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+	bw := bufio.NewWriter(w)
+	for i := 0; len(h) > 0; i++ {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		c := h[0]
+		if _, err := bw.Write(c.record); err != nil {
+			return err
+		}
+		if err := c.next(); err != nil {
+			return err
+		}
+		if c.record != nil {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return bw.Flush()
+}
+
+// recordSpan locates a record in a run being sorted
+type recordSpan struct {
+	addr   netip.Addr
+	off, n int
+}
+
+// writeSpans writes the records of buf located by spans to w, in order
+func writeSpans(w io.Writer, buf []byte, spans []recordSpan) error {
+	bw := bufio.NewWriter(w)
+	for _, s := range spans {
+		if _, err := bw.Write(buf[s.off : s.off+s.n]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// runCursor reads the records of a sorted run in order
+type runCursor struct {
+	r      *bufio.Reader
+	run    int
+	addr   netip.Addr
+	record []byte // nil once the run is read
+	buf    []byte
+}
+
+// next reads the next record of the run
+func (c *runCursor) next() error {
+	peek, err := c.r.Peek(maxRecordSize)
+	if len(peek) == 0 {
+		c.record = nil
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	rec, n, err := readRecord(peek)
+	if err != nil {
+		// Written whole by SortRecords, unless the file was tampered with
+		return fmt.Errorf("sorted run: %w", err)
+	}
+	c.buf = append(c.buf[:0], peek[:n]...)
+	c.record, c.addr = c.buf, rec.first()
+	_, err = c.r.Discard(n)
+	return err
+}
+
+// runHeap orders the cursors of the runs by their current record
+type runHeap []*runCursor
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if c := h[i].addr.Compare(h[j].addr); c != 0 {
+		return c < 0
+	}
+	return h[i].run < h[j].run
+}
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)   { *h = append(*h, x.(*runCursor)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
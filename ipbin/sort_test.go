@@ -0,0 +1,65 @@
+package ipbin
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSortRecords(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var records []byte
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 50000 {
+		a := [4]byte{10, byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256))}
+		p := netip.PrefixFrom(netip.AddrFrom4(a), 32)
+		var err error
+		switch i % 3 {
+		case 0:
+			records, err = AppendEncoded(records, p)
+		case 1:
+			records, err = AppendEncodedExpiring(records, ExpiringPrefix{Prefix: p, Expires: expires})
+		case 2:
+			records, err = AppendEncodedValued(records, ValuedPrefix{Prefix: p, Value: "x"})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sorted, err := RecordsSorted(records); sorted || err != nil {
+		t.Errorf("RecordsSorted of random records got %v, %v", sorted, err)
+	}
+
+	dir := t.TempDir()
+	// In memory, and in runs spilled to dir
+	for _, maxMemory := range []int64{0, 1} {
+		var out bytes.Buffer
+		if err := SortRecords(context.Background(), &out, bytes.NewReader(records), maxMemory, dir); err != nil {
+			t.Fatal(err)
+		}
+		if out.Len() != len(records) {
+			t.Errorf("SortRecords with %d bytes wrote %d bytes, want %d", maxMemory, out.Len(), len(records))
+		}
+		if sorted, err := RecordsSorted(out.Bytes()); !sorted || err != nil {
+			t.Errorf("SortRecords with %d bytes got unsorted records, %v", maxMemory, err)
+		}
+		valued, err := DecodeValued(out.Bytes(), time.Time{})
+		if err != nil || len(valued) != 50000 {
+			t.Errorf("DecodeValued of the sorted records got %d, %v", len(valued), err)
+		}
+		if _, err := BuildIndex(out.Bytes(), 0); err != nil {
+			t.Errorf("BuildIndex of the sorted records got %v", err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("SortRecords left %d files", len(entries))
+	}
+
+	if err := SortRecords(context.Background(), &bytes.Buffer{}, bytes.NewReader(records[:len(records)-1]), 0, dir); err == nil {
+		t.Error("SortRecords of a truncated record succeeded")
+	}
+}
@@ -0,0 +1,140 @@
+package ipbin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Limits of SPF records: the strings of a TXT record hold at most 255
+// bytes, and a record is kept within spfMaxRecord bytes so that a UDP DNS
+// response holding it fits in 512 bytes (RFC 7208 section 3.4). An SPF
+// evaluation may cause at most 10 DNS lookups (section 4.6.4), one per
+// include, counting the include of the record of the set itself.
+const (
+	spfMaxString = 255
+	spfMaxRecord = 450
+	spfMaxChunks = 9
+)
+
+// SPFOptions configures SPFRecords.
+type SPFOptions struct {
+	// Domain is the name of the record of the set, e.g. "_spf.example.com",
+	// included by the SPF records of mail domains with
+	// "include:_spf.example.com".
+	Domain string
+	// All is the mechanism ending the record of Domain: "~all", "-all",
+	// "?all" or "+all", or none if empty.
+	All string
+}
+
+// SPFRecord is an SPF TXT record.
+type SPFRecord struct {
+	// Name is the fully qualified owner name, e.g. "_spf.example.com.".
+	Name string
+	// Strings are the character strings of the record, concatenated by
+	// SPF evaluations.
+	Strings []string
+}
+
+// SPFRecords returns the SPF records authorizing the prefixes as senders,
+// as ip4: and ip6: mechanisms. The record of opts.Domain holds them all if
+// they fit, otherwise it includes chunk records named "1.", "2." and so on
+// within opts.Domain holding them, at most 9. The record strings are split
+// at 255 bytes, and each record kept within the 512 bytes of a UDP DNS
+// response.
+func SPFRecords(prefixes []netip.Prefix, opts SPFOptions) ([]SPFRecord, error) {
+	domain := strings.TrimSuffix(opts.Domain, ".")
+	if domain == "" || strings.ContainsAny(domain, " \"") {
+		return nil, fmt.Errorf("invalid SPF domain %q", opts.Domain)
+	}
+	switch opts.All {
+	case "", "~all", "-all", "?all", "+all":
+	default:
+		return nil, fmt.Errorf("invalid SPF all mechanism %q", opts.All)
+	}
+
+	var chunks []string
+	text := "v=spf1"
+	for _, p := range prefixes {
+		m := "ip4:"
+		if p.Addr().Is6() {
+			m = "ip6:"
+		}
+		m = string(AppendPrefixText([]byte(m), p, TextCompact))
+		if text != "v=spf1" && spfRecordSize(text+" "+m) > spfMaxRecord {
+			chunks = append(chunks, text)
+			text = "v=spf1"
+		}
+		text += " " + m
+	}
+	all := ""
+	if opts.All != "" {
+		all = " " + opts.All
+	}
+	if chunks == nil && spfRecordSize(text+all) <= spfMaxRecord {
+		return []SPFRecord{{Name: domain + ".", Strings: spfStrings(text + all)}}, nil
+	}
+	if text != "v=spf1" {
+		chunks = append(chunks, text)
+	}
+	if len(chunks) > spfMaxChunks {
+		return nil, fmt.Errorf("%d SPF records exceed the 10 DNS lookups of an SPF evaluation, at most %d fit", len(chunks), spfMaxChunks)
+	}
+
+	records := make([]SPFRecord, 1, len(chunks)+1)
+	text = "v=spf1"
+	for i, chunk := range chunks {
+		name := strconv.Itoa(i+1) + "." + domain
+		text += " include:" + name
+		records = append(records, SPFRecord{Name: name + ".", Strings: spfStrings(chunk)})
+	}
+	if text += all; spfRecordSize(text) > spfMaxRecord {
+		return nil, errors.New("SPF domain too long to include the chunk records")
+	}
+	records[0] = SPFRecord{Name: domain + ".", Strings: spfStrings(text)}
+	return records, nil
+}
+
+// spfStrings splits the text of an SPF record into character strings of
+// at most 255 bytes, between its terms.
+func spfStrings(text string) []string {
+	var strs []string
+	for len(text) > spfMaxString {
+		i := strings.LastIndexByte(text[:spfMaxString], ' ') + 1
+		strs = append(strs, text[:i])
+		text = text[i:]
+	}
+	return append(strs, text)
+}
+
+// spfRecordSize returns the size of the TXT record data of the text of an
+// SPF record: its strings, each prefixed with its length.
+func spfRecordSize(text string) int {
+	return len(text) + len(spfStrings(text))
+}
+
+// WriteSPFRecords writes the SPF records of the prefixes (see SPFRecords)
+// as zone file TXT records.
+func WriteSPFRecords(w io.Writer, prefixes []netip.Prefix, opts SPFOptions) error {
+	records, err := SPFRecords(prefixes, opts)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, r := range records {
+		bw.WriteString(r.Name + "\tIN\tTXT\t")
+		for i, s := range r.Strings {
+			if i > 0 {
+				bw.WriteByte(' ')
+			}
+			bw.WriteString(strconv.Quote(s))
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,73 @@
+package ipbin
+
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestSPFRecords(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("198.51.100.7/32"), netip.MustParsePrefix("2001:db8::/32")}
+	var buf bytes.Buffer
+	if err := WriteSPFRecords(&buf, prefixes, SPFOptions{Domain: "_spf.example.com.", All: "~all"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "_spf.example.com.\tIN\tTXT\t\"v=spf1 ip4:192.0.2.0/24 ip4:198.51.100.7 ip6:2001:db8::/32 ~all\"\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	// 100 /24s need chunks, each within the limits
+	prefixes = nil
+	for i := range 100 {
+		prefixes = append(prefixes, netip.PrefixFrom(netip.AddrFrom4([4]byte{10, 0, byte(i), 0}), 24))
+	}
+	records, err := SPFRecords(prefixes, SPFOptions{Domain: "_spf.example.com", All: "-all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) < 3 {
+		t.Fatalf("got %d records, want chunks", len(records))
+	}
+	top := strings.Join(records[0].Strings, "")
+	if records[0].Name != "_spf.example.com." || !strings.HasPrefix(top, "v=spf1 include:1._spf.example.com include:2._spf.example.com") || !strings.HasSuffix(top, " -all") {
+		t.Errorf("top record %s %q", records[0].Name, top)
+	}
+	var mechs []string
+	for i, r := range records[1:] {
+		size := 0
+		for _, s := range r.Strings {
+			if len(s) > spfMaxString {
+				t.Errorf("%s: string of %d bytes", r.Name, len(s))
+			}
+			size += 1 + len(s)
+		}
+		if size > spfMaxRecord {
+			t.Errorf("%s: record of %d bytes", r.Name, size)
+		}
+		if want := string(rune('1'+i)) + "._spf.example.com."; r.Name != want {
+			t.Errorf("chunk %d named %s, want %s", i, r.Name, want)
+		}
+		text := strings.Join(r.Strings, "")
+		if !strings.HasPrefix(text, "v=spf1 ip4:") || strings.HasSuffix(text, "all") {
+			t.Errorf("%s: %q", r.Name, text)
+		}
+		mechs = append(mechs, strings.Fields(text)[1:]...)
+	}
+	if len(mechs) != 100 || mechs[0] != "ip4:10.0.0.0/24" || mechs[99] != "ip4:10.0.99.0/24" {
+		t.Errorf("got %d mechanisms %v", len(mechs), mechs)
+	}
+
+	for i := range 300 {
+		prefixes = append(prefixes, netip.PrefixFrom(netip.AddrFrom4([4]byte{10, 1, byte(i), 0}), 24))
+	}
+	if _, err := SPFRecords(prefixes, SPFOptions{Domain: "_spf.example.com"}); err == nil {
+		t.Error("expected an error for too many chunks")
+	}
+	for _, opts := range []SPFOptions{{}, {Domain: "example.com", All: "all"}} {
+		if _, err := SPFRecords(nil, opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package ipbin
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+	"os"
+)
+
+// mergeBytesPerPrefix is the memory netipx.IPSetBuilder takes at most per
+// prefix added: a 48-byte range, twice while its slice grows, and once
+// more in the normalized copy.
+const mergeBytesPerPrefix = 3 * 48
+
+// minSpillChunk is the least number of prefixes merged per spilled chunk,
+// so that tiny budgets do not open a file per prefix.
+const minSpillChunk = 4096
+
+// MergeMemory returns the estimated peak memory, in bytes, MergePrefixes
+// takes to merge n prefixes, besides the prefixes themselves.
+func MergeMemory(n int) int64 {
+	return int64(n) * mergeBytesPerPrefix
+}
+
+// MergePrefixesSpill is MergePrefixesCtx keeping the memory of the merge
+// within maxMemory bytes, e.g. in memory-limited containers. If
+// MergeMemory(len(prefixes)) exceeds maxMemory, it merges the prefixes in
+// chunks fitting the budget, spills the merged chunks to temporary files of
+// dir, os.TempDir() if empty, as binary records, then merges the sorted
+// files in one pass. Only the result then takes memory in proportion to
+// the set.
+func MergePrefixesSpill(ctx context.Context, prefixes []netip.Prefix, maxMemory int64, dir string) (*netipx.IPSet, error) {
+	if MergeMemory(len(prefixes)) <= maxMemory {
+		return MergePrefixesCtx(ctx, prefixes)
+	}
+	chunk := max(int(maxMemory/mergeBytesPerPrefix), minSpillChunk)
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	for start := 0; start < len(prefixes); start += chunk {
+		set, err := MergePrefixesCtx(ctx, prefixes[start:min(start+chunk, len(prefixes))])
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.CreateTemp(dir, "ipbin-merge-*")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		w := bufio.NewWriter(f)
+		if err := WriteEncodedAllCtx(ctx, w, set.Prefixes()); err != nil {
+			return nil, err
+		}
+		if err := w.Flush(); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	// Merge the chunks, whose prefixes are sorted, by their first address,
+	// joining overlapping and adjacent ranges before adding them
+	h := make(spillHeap, 0, len(files))
+	for _, f := range files {
+		c := &spillCursor{r: bufio.NewReader(f), name: f.Name()}
+		if err := c.next(); err != nil {
+			return nil, err
+		}
+		if c.ok {
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+	var builder netipx.IPSetBuilder
+	var cur netipx.IPRange
+	for i := 0; len(h) > 0; i++ {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		c := h[0]
+		r := netipx.RangeOfPrefix(c.prefix)
+		if next := cur.To().Next(); cur.IsValid() && next.IsValid() && !next.Less(r.From()) {
+			if cur.To().Less(r.To()) {
+				cur = netipx.IPRangeFrom(cur.From(), r.To())
+			}
+		} else {
+			if cur.IsValid() {
+				builder.AddRange(cur)
+			}
+			cur = r
+		}
+		if err := c.next(); err != nil {
+			return nil, err
+		}
+		if c.ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	if cur.IsValid() {
+		builder.AddRange(cur)
+	}
+	return builder.IPSet()
+}
+
+// spillCursor reads the prefixes of a spilled chunk in order
+type spillCursor struct {
+	r      *bufio.Reader
+	name   string
+	prefix netip.Prefix
+	ok     bool // whether prefix is set, false once the chunk is read
+}
+
+// next reads the next prefix of the chunk
+func (c *spillCursor) next() error {
+	p, err := ReadPrefix(c.r)
+	if err == io.EOF {
+		c.ok = false
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", c.name, err)
+	}
+	c.prefix = p
+	c.ok = true
+	return nil
+}
+
+// spillHeap orders the cursors of the chunks by their current prefix
+type spillHeap []*spillCursor
+
+func (h spillHeap) Len() int           { return len(h) }
+func (h spillHeap) Less(i, j int) bool { return h[i].prefix.Addr().Less(h[j].prefix.Addr()) }
+func (h spillHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *spillHeap) Push(x any)        { *h = append(*h, x.(*spillCursor)) }
+func (h *spillHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,51 @@
+package ipbin
+
+import (
+	"context"
+	"math/rand"
+	"net/netip"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMergePrefixesSpill(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var prefixes []netip.Prefix
+	for range 20000 {
+		if rng.Intn(4) == 0 {
+			var a [16]byte
+			a[0], a[1], a[2] = 0x20, 0x01, byte(rng.Intn(4))
+			rng.Read(a[3:6])
+			prefixes = append(prefixes, netip.PrefixFrom(netip.AddrFrom16(a), 24+rng.Intn(25)).Masked())
+		} else {
+			a := [4]byte{10, byte(rng.Intn(4)), byte(rng.Intn(256)), byte(rng.Intn(256))}
+			prefixes = append(prefixes, netip.PrefixFrom(netip.AddrFrom4(a), 20+rng.Intn(13)).Masked())
+		}
+	}
+	want, err := MergePrefixes(prefixes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	// Within the budget, and spilling chunks of minSpillChunk prefixes
+	for _, maxMemory := range []int64{MergeMemory(len(prefixes)), 1} {
+		got, err := MergePrefixesSpill(context.Background(), prefixes, maxMemory, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Ranges(), want.Ranges()) {
+			t.Errorf("MergePrefixesSpill with %d bytes got %d ranges, want %d", maxMemory, len(got.Ranges()), len(want.Ranges()))
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("MergePrefixesSpill left %d files", len(entries))
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := MergePrefixesSpill(cancelled, prefixes, 1, dir); err != context.Canceled {
+		t.Errorf("cancelled MergePrefixesSpill got %v", err)
+	}
+}
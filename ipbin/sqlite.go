@@ -0,0 +1,236 @@
+package ipbin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"go4.org/netipx"
+	"io"
+	"net/netip"
+	"slices"
+)
+
+// SQLiteSchema creates the table WriteSQLite writes: a WITHOUT ROWID table,
+// so that it is itself the index on its primary key.
+const SQLiteSchema = "CREATE TABLE ranges (start_u128 BLOB NOT NULL, end_u128 BLOB NOT NULL, prefix TEXT NOT NULL, PRIMARY KEY (start_u128, prefix)) WITHOUT ROWID"
+
+// SQLiteLookup is the query of WriteSQLite databases returning the prefix
+// containing the address ?1, given as a 16-byte blob like start_u128.
+const SQLiteLookup = "SELECT prefix FROM ranges WHERE start_u128 <= ?1 AND end_u128 >= ?1 ORDER BY start_u128 DESC LIMIT 1"
+
+// SQLiteAddressesSchema and SQLiteLookupsView create the lookup view of
+// WriteSQLite databases: the addresses inserted into the addresses table,
+// 16-byte blobs like start_u128, are listed by the lookups view with the
+// prefix containing them, NULL if none, each looked up like SQLiteLookup.
+const (
+	SQLiteAddressesSchema = "CREATE TABLE addresses (addr BLOB NOT NULL PRIMARY KEY) WITHOUT ROWID"
+	SQLiteLookupsView     = "CREATE VIEW lookups AS SELECT addr, (SELECT prefix FROM ranges WHERE start_u128 <= addr AND end_u128 >= addr ORDER BY start_u128 DESC LIMIT 1) AS prefix FROM addresses"
+)
+
+// SQLite file format (https://www.sqlite.org/fileformat2.html)
+const (
+	sqlitePageSize      = 4096
+	sqliteHeaderSize    = 100
+	sqliteTableLeaf     = 0x0d
+	sqliteIndexLeaf     = 0x0a
+	sqliteIndexInterior = 0x02
+	sqliteVersionNumber = 3040001 // the version of SQLite the format matches
+)
+
+// WriteSQLite writes the prefixes as a SQLite database of a table, ranges
+// (see SQLiteSchema), of one row per prefix with the first and last
+// addresses as 16-byte big-endian blobs in start_u128 and end_u128, IPv4
+// addresses mapped into IPv6 (::ffff:192.0.2.0), and the prefix as text.
+// The table is indexed on start_u128, so that SQLiteLookup looks an address
+// up in a single b-tree descent. The database also has the empty addresses
+// table and the lookups view looking its addresses up (see
+// SQLiteLookupsView).
+func WriteSQLite(w io.Writer, prefixes []netip.Prefix) error {
+	type row struct {
+		start, end [16]byte
+		prefix     string
+	}
+	rows := make([]row, len(prefixes))
+	for i, p := range prefixes {
+		r := netipx.RangeOfPrefix(p)
+		rows[i] = row{r.From().As16(), r.To().As16(), p.Masked().String()}
+	}
+	// IPv6 addresses below ::ffff:0.0.0.0 sort before IPv4 ones
+	slices.SortFunc(rows, func(a, b row) int {
+		if c := bytes.Compare(a.start[:], b.start[:]); c != 0 {
+			return c
+		}
+		return bytes.Compare([]byte(a.prefix), []byte(b.prefix))
+	})
+	records := make([][]byte, len(rows))
+	for i, r := range rows {
+		// The columns of the primary key first, as in WITHOUT ROWID tables
+		records[i] = sqliteRecord(r.start[:], r.prefix, r.end[:])
+	}
+
+	pages := [][]byte{nil} // page 1, the schema, written last
+	root := sqliteIndexTree(&pages, records)
+	addresses := make([]byte, sqlitePageSize)
+	sqlitePage(addresses, 0, sqliteIndexLeaf, nil, 0)
+	pages = append(pages, addresses)
+
+	page := make([]byte, sqlitePageSize)
+	copy(page, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(page[16:], sqlitePageSize)
+	page[18], page[19] = 1, 1                 // file format versions, rollback journal
+	page[21], page[22], page[23] = 64, 32, 32 // payload fractions
+	binary.BigEndian.PutUint32(page[24:], 1)  // file change counter
+	binary.BigEndian.PutUint32(page[28:], uint32(len(pages)))
+	binary.BigEndian.PutUint32(page[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(page[44:], 4) // schema format
+	binary.BigEndian.PutUint32(page[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(page[92:], 1) // version-valid-for
+	binary.BigEndian.PutUint32(page[96:], sqliteVersionNumber)
+	// The sqlite_schema table, of a row per table and view
+	var cells [][]byte
+	for i, schema := range [][]byte{
+		sqliteRecord("table", "ranges", "ranges", int64(root), SQLiteSchema),
+		sqliteRecord("table", "addresses", "addresses", int64(len(pages)), SQLiteAddressesSchema),
+		sqliteRecord("view", "lookups", "lookups", int64(0), SQLiteLookupsView),
+	} {
+		cell := appendSQLiteVarint(nil, uint64(len(schema)))
+		cell = appendSQLiteVarint(cell, uint64(i+1)) // rowid
+		cells = append(cells, append(cell, schema...))
+	}
+	sqlitePage(page, sqliteHeaderSize, sqliteTableLeaf, cells, 0)
+	pages[0] = page
+
+	for _, page := range pages {
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteIndexTree appends the pages of the index b-tree of the sorted
+// records to pages, returning the number of its root page. Each record is
+// in a single page: either a leaf, or an interior page where it divides the
+// records of two children.
+func sqliteIndexTree(pages *[][]byte, records [][]byte) uint32 {
+	maxRecord := 0
+	for _, r := range records {
+		maxRecord = max(maxRecord, len(r))
+	}
+	// Fixed fan-outs, from the largest cells and their cell pointers
+	leafCell := len(appendSQLiteVarint(nil, uint64(maxRecord))) + maxRecord + 2
+	perLeaf := (sqlitePageSize - 8) / leafCell
+	perInterior := (sqlitePageSize - 12) / (leafCell + 4)
+
+	add := func(flag byte, cells [][]byte, right uint32) uint32 {
+		page := make([]byte, sqlitePageSize)
+		sqlitePage(page, 0, flag, cells, right)
+		*pages = append(*pages, page)
+		return uint32(len(*pages))
+	}
+	cell := func(child uint32, record []byte) []byte {
+		var c []byte
+		if child != 0 {
+			c = binary.BigEndian.AppendUint32(c, child)
+		}
+		return append(appendSQLiteVarint(c, uint64(len(record))), record...)
+	}
+
+	// The leaves, and the records dividing them. A page is never left
+	// with a single record or child to spread over its successor.
+	var children []uint32
+	var dividers [][]byte
+	for i := 0; ; {
+		n := min(perLeaf, len(records)-i)
+		if len(records)-i-n == 1 {
+			n--
+		}
+		cells := make([][]byte, n)
+		for j := range cells {
+			cells[j] = cell(0, records[i+j])
+		}
+		children = append(children, add(sqliteIndexLeaf, cells, 0))
+		if i += n; i == len(records) {
+			break
+		}
+		dividers = append(dividers, records[i])
+		i++
+	}
+	// The interior levels, each page holding the dividers of its children
+	for len(children) > 1 {
+		var parents []uint32
+		var up [][]byte
+		for i := 0; i < len(children); {
+			n := min(perInterior+1, len(children)-i)
+			if len(children)-i-n == 1 {
+				n--
+			}
+			cells := make([][]byte, n-1)
+			for j := range cells {
+				cells[j] = cell(children[i+j], dividers[i+j])
+			}
+			parents = append(parents, add(sqliteIndexInterior, cells, children[i+n-1]))
+			if i += n; i < len(children) {
+				up = append(up, dividers[i-1])
+			}
+		}
+		children, dividers = parents, up
+	}
+	return children[0]
+}
+
+// sqlitePage lays out a b-tree page whose header is at offset off of page,
+// with its cell pointers after the header and its cells at the end.
+func sqlitePage(page []byte, off int, flag byte, cells [][]byte, right uint32) {
+	hdr := 8
+	if flag == sqliteIndexInterior {
+		hdr = 12
+		binary.BigEndian.PutUint32(page[off+8:], right)
+	}
+	page[off] = flag
+	binary.BigEndian.PutUint16(page[off+3:], uint16(len(cells)))
+	end := len(page)
+	for i, c := range cells {
+		end -= len(c)
+		copy(page[end:], c)
+		binary.BigEndian.PutUint16(page[off+hdr+2*i:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(page[off+5:], uint16(end))
+}
+
+// sqliteRecord encodes values, blobs, strings or integers, as a record.
+func sqliteRecord(values ...any) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case []byte:
+			types = appendSQLiteVarint(types, uint64(2*len(v)+12))
+			body = append(body, v...)
+		case string:
+			types = appendSQLiteVarint(types, uint64(2*len(v)+13))
+			body = append(body, v...)
+		case int64:
+			types = appendSQLiteVarint(types, 6)
+			body = binary.BigEndian.AppendUint64(body, uint64(v))
+		}
+	}
+	// The size of the header includes its own varint
+	size := len(types) + 1
+	if size > 127 {
+		size++
+	}
+	record := appendSQLiteVarint(nil, uint64(size))
+	return append(append(record, types...), body...)
+}
+
+// appendSQLiteVarint appends v to b as a SQLite varint, big-endian groups
+// of 7 bits, for values below 2^56.
+func appendSQLiteVarint(b []byte, v uint64) []byte {
+	n := 1
+	for v>>(7*n) != 0 {
+		n++
+	}
+	for i := n - 1; i > 0; i-- {
+		b = append(b, byte(v>>(7*i))|0x80)
+	}
+	return append(b, byte(v&0x7f))
+}
@@ -0,0 +1,105 @@
+package ipbin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+)
+
+// sqliteVarint decodes the SQLite varint at the start of b, for the tests.
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+func TestWriteSQLite(t *testing.T) {
+	var prefixes []netip.Prefix
+	for i := 0; i < 5000; i++ {
+		prefixes = append(prefixes, netip.PrefixFrom(netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)}), 32))
+	}
+	prefixes = append(prefixes, netip.MustParsePrefix("::1/128"), netip.MustParsePrefix("2001:db8::/32"))
+	var buf bytes.Buffer
+	if err := WriteSQLite(&buf, prefixes); err != nil {
+		t.Fatal(err)
+	}
+	db := buf.Bytes()
+	if !bytes.HasPrefix(db, []byte("SQLite format 3\x00")) || len(db)%sqlitePageSize != 0 {
+		t.Fatalf("invalid database of %d bytes", len(db))
+	}
+	if n := binary.BigEndian.Uint32(db[28:]); int(n) != len(db)/sqlitePageSize {
+		t.Errorf("header gives %d pages, want %d", n, len(db)/sqlitePageSize)
+	}
+	page := func(n uint32) []byte { return db[(n-1)*sqlitePageSize : n*sqlitePageSize] }
+
+	// The first schema row gives the root page
+	if page(1)[100] != sqliteTableLeaf || binary.BigEndian.Uint16(page(1)[103:]) != 3 {
+		t.Fatalf("invalid schema page")
+	}
+	cell := page(1)[binary.BigEndian.Uint16(page(1)[108:]):]
+	_, n1 := sqliteVarint(cell)
+	_, n2 := sqliteVarint(cell[n1:])
+	record := cell[n1+n2:]
+	if !bytes.Contains(record, []byte(SQLiteSchema)) {
+		t.Errorf("schema record %q lacks the schema", record)
+	}
+	root := binary.BigEndian.Uint64(record[bytes.Index(record, []byte("rangesranges"))+12:])
+
+	// The lookups view, and its empty addresses table, the last page
+	for i, sql := range []string{SQLiteAddressesSchema, SQLiteLookupsView} {
+		cell := page(1)[binary.BigEndian.Uint16(page(1)[110+2*i:]):]
+		_, n1 := sqliteVarint(cell)
+		_, n2 := sqliteVarint(cell[n1:])
+		if record := cell[n1+n2:]; !bytes.Contains(record, []byte(sql)) {
+			t.Errorf("schema record %q lacks %q", record, sql)
+		}
+	}
+	if last := page(uint32(len(db) / sqlitePageSize)); last[0] != sqliteIndexLeaf || binary.BigEndian.Uint16(last[3:]) != 0 {
+		t.Errorf("addresses table not an empty leaf")
+	}
+
+	// Walk the index in order, checking the records are sorted
+	var keys [][]byte
+	var walk func(n uint32)
+	walk = func(n uint32) {
+		p := page(n)
+		flag, hdr := p[0], 8
+		if flag == sqliteIndexInterior {
+			hdr = 12
+		} else if flag != sqliteIndexLeaf {
+			t.Fatalf("page %d of type %x", n, flag)
+		}
+		for i := 0; i < int(binary.BigEndian.Uint16(p[3:])); i++ {
+			c := p[binary.BigEndian.Uint16(p[hdr+2*i:]):]
+			if flag == sqliteIndexInterior {
+				walk(binary.BigEndian.Uint32(c))
+				c = c[4:]
+			}
+			size, n := sqliteVarint(c)
+			rec := c[n : n+int(size)]
+			// Header of 4 bytes, then the start_u128 blob
+			keys = append(keys, rec[4:20])
+		}
+		if flag == sqliteIndexInterior {
+			walk(binary.BigEndian.Uint32(p[8:]))
+		}
+	}
+	walk(uint32(root))
+	if len(keys) != len(prefixes) {
+		t.Fatalf("got %d records, want %d", len(keys), len(prefixes))
+	}
+	for i := 1; i < len(keys); i++ {
+		if bytes.Compare(keys[i-1], keys[i]) >= 0 {
+			t.Fatalf("record %d out of order: %x after %x", i, keys[i], keys[i-1])
+		}
+	}
+	if first := netip.AddrFrom16([16]byte(keys[0])); first != netip.MustParseAddr("::1") {
+		t.Errorf("first record got %v, want ::1", first)
+	}
+}
@@ -0,0 +1,131 @@
+package ipbin
+
+import (
+	"bytes"
+	"net/netip"
+	"time"
+	"unicode/utf8"
+)
+
+// DetectEncoding returns the outermost encoding of a set file from its
+// leading bytes: "encrypted", "gzip", "zstd", "binary" or "text".
+func DetectEncoding(b []byte) string {
+	switch {
+	case IsEncrypted(b):
+		return "encrypted"
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(b, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zstd"
+	case len(b) > 0 && b[0] == ContainerHeader:
+		return "binary"
+	}
+	// Text is printable UTF-8, binary records start with control bytes
+	if len(b) > 512 {
+		b = b[:512]
+	}
+	for len(b) > 0 {
+		r, n := utf8.DecodeRune(b)
+		if r == utf8.RuneError && n == 1 && len(b) >= utf8.UTFMax {
+			return "binary"
+		}
+		if r < ' ' && r != '\t' && r != '\n' && r != '\r' {
+			return "binary"
+		}
+		b = b[n:]
+	}
+	return "text"
+}
+
+// Stats summarizes the records of a binary set.
+type Stats struct {
+	Metadata    Metadata // zero if the set has no metadata block
+	HasMetadata bool
+	IPv4        int // number of IPv4 records
+	IPv6        int // number of IPv6 records
+	Expiring    int // number of records with an expiry
+	Expired     int // number of records expired at the time of the stats
+	Valued      int // number of records with a value
+	RecordBytes int // size of the records, without the metadata block
+	Sets        int // number of sets concatenated, 1 for a single set
+	Blocks      int // number of blocks of records
+	TextBytes   int // size of the records as newline-terminated text
+}
+
+// Records returns the number of records.
+func (s Stats) Records() int {
+	return s.IPv4 + s.IPv6
+}
+
+// BinaryStats returns the stats of the binary set buf at time now, decoding
+// its records one by one without building the set. The stats of
+// concatenated sets are those of their union, with the metadata of the
+// first.
+func BinaryStats(buf []byte, now time.Time) (Stats, error) {
+	var s Stats
+	m, n, err := ReadMetadataFromBytes(buf)
+	if err != nil {
+		return s, err
+	}
+	s.Metadata, s.HasMetadata = m, n > 0
+	buf = buf[n:]
+	s.RecordBytes, s.Sets = len(buf), 1
+	var blocks blockCheck
+	for off, ended := 0, false; off < len(buf); {
+		rec, n, err := readRecord(buf[off:])
+		if err == nil {
+			err = blocks.next(buf, off, rec, n)
+		}
+		if err != nil {
+			return s, err
+		}
+		off += n
+		if ended || rec.kind == KindContainer {
+			s.Sets++
+		}
+		if rec.kind == KindBlock {
+			s.Blocks++
+		}
+		ended = rec.kind == KindEnd
+		if rec.valued {
+			s.Valued++
+		}
+		if rec.kind == KindRange {
+			for _, p := range rec.rng.Prefixes() {
+				s.addPrefix(p)
+			}
+		} else if rec.kind == KindIPv4 || rec.kind == KindIPv6 {
+			s.addPrefix(rec.prefix.Prefix)
+		}
+		if ep := rec.prefix; !ep.Expires.IsZero() {
+			s.Expiring++
+			if ep.Expired(now) {
+				s.Expired++
+			}
+		}
+	}
+	if err := blocks.done(); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// PrefixStats returns the stats of prefixes as if encoded as a binary set
+// without metadata and expiries.
+func PrefixStats(prefixes []netip.Prefix) Stats {
+	var s Stats
+	for _, p := range prefixes {
+		s.addPrefix(p)
+		s.RecordBytes += 1 + (p.Bits()+7)/8
+	}
+	return s
+}
+
+func (s *Stats) addPrefix(p netip.Prefix) {
+	if p.Addr().Is4() {
+		s.IPv4++
+	} else {
+		s.IPv6++
+	}
+	s.TextBytes += len(p.String()) + 1
+}
@@ -0,0 +1,75 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	cases := []struct {
+		in   []byte
+		want string
+	}{
+		{[]byte(EncryptedMagic + "\x01"), "encrypted"},
+		{[]byte{0x1f, 0x8b, 8, 0}, "gzip"},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0}, "zstd"},
+		{AppendMetadata(nil, Metadata{Source: "a"}), "binary"},
+		{[]byte{16, 1, 3, 32, 1, 5, 5, 5}, "binary"},
+		{[]byte("1.3.0.0/16\r\n2001:db8::/32 # café\n"), "text"},
+		{nil, "text"},
+	}
+	for _, c := range cases {
+		if got := DetectEncoding(c.in); got != c.want {
+			t.Errorf("DetectEncoding(%q) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestBinaryStats(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var records []byte
+	for _, ep := range []ExpiringPrefix{
+		{Prefix: netip.MustParsePrefix("1.3.0.0/16"), Expires: now.Add(-time.Hour)},
+		{Prefix: netip.MustParsePrefix("2001:db8::/32")},
+		{Prefix: netip.MustParsePrefix("1.5.5.5/32"), Expires: now.Add(time.Hour)},
+	} {
+		var err error
+		if records, err = AppendEncodedExpiring(records, ep); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	buf := AppendMetadata(nil, Metadata{Source: "feed"})
+	got, err := BinaryStats(append(buf, records...), now)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := Stats{
+		Metadata:    Metadata{Source: "feed"},
+		HasMetadata: true,
+		IPv4:        2,
+		IPv6:        1,
+		Expiring:    2,
+		Expired:     1,
+		RecordBytes: len(records),
+		Sets:        1,
+		TextBytes:   len("1.3.0.0/16\n2001:db8::/32\n1.5.5.5/32\n"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got.Records() != 3 {
+		t.Errorf("Records got %d", got.Records())
+	}
+	if _, err := BinaryStats([]byte{16, 1}, now); err == nil {
+		t.Errorf("truncated record expected error")
+	}
+
+	s := PrefixStats([]netip.Prefix{netip.MustParsePrefix("1.3.0.0/16"), netip.MustParsePrefix("2001:db8::/32")})
+	if s.IPv4 != 1 || s.IPv6 != 1 || s.RecordBytes != 3+5 || s.TextBytes != 25 {
+		t.Errorf("PrefixStats got %+v", s)
+	}
+}
@@ -0,0 +1,134 @@
+package ipbin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// stixObject holds the fields of STIX 2.1 objects relevant to IP indicators.
+type stixObject struct {
+	Type        string `json:"type"`
+	Pattern     string `json:"pattern"`
+	PatternType string `json:"pattern_type"`
+	Revoked     bool   `json:"revoked"`
+	Value       string `json:"value"` // ipv4-addr and ipv6-addr objects
+}
+
+// stixAddrComparison matches the comparison expressions of a STIX pattern
+// on the value of an ipv4-addr or ipv6-addr object, e.g.
+// [ipv4-addr:value = '198.51.100.0/24'] or [ipv6-addr:value ISSUBSET '2001:db8::/32'].
+var stixAddrComparison = regexp.MustCompile(`ipv[46]-addr:value\s*(?:=|ISSUBSET)\s*'([^']*)'`)
+
+// appendSTIXPrefixes appends the prefixes of the indicators and address
+// objects in objects to nets.
+func appendSTIXPrefixes(nets []netip.Prefix, objects []stixObject) ([]netip.Prefix, error) {
+	var err error
+	for _, o := range objects {
+		switch o.Type {
+		case "indicator":
+			if o.Revoked || (o.PatternType != "" && o.PatternType != "stix") {
+				continue
+			}
+			for _, m := range stixAddrComparison.FindAllStringSubmatch(o.Pattern, -1) {
+				if nets, err = appendParsedPrefix(nets, m[1]); err != nil {
+					return nil, fmt.Errorf("stix: invalid address in pattern %q: %w", o.Pattern, err)
+				}
+			}
+		case "ipv4-addr", "ipv6-addr":
+			if nets, err = appendParsedPrefix(nets, o.Value); err != nil {
+				return nil, fmt.Errorf("stix: invalid %s value %q: %w", o.Type, o.Value, err)
+			}
+		}
+	}
+	return nets, nil
+}
+
+// ParseSTIXBundle parses a STIX 2.1 bundle (or a TAXII envelope), returning
+// the addresses and CIDR blocks of its ipv4-addr and ipv6-addr objects and
+// of the ipv4-addr:value and ipv6-addr:value comparisons in the patterns
+// of its indicators. Revoked indicators are skipped. Every address
+// comparison of a pattern is taken, regardless of the other terms of the
+// pattern.
+func ParseSTIXBundle(r io.Reader) ([]netip.Prefix, error) {
+	var doc struct {
+		Objects []stixObject `json:"objects"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return appendSTIXPrefixes(nil, doc.Objects)
+}
+
+// TAXIIClient fetches indicators from a TAXII 2.1 collection.
+type TAXIIClient struct {
+	// CollectionURL is the collection URL, e.g.
+	// https://example.com/api1/collections/91a7b528-80eb-42ed-a74d-c6fbd5a26116/.
+	CollectionURL string
+	// Username and Password are sent with HTTP basic authentication if
+	// Username is not empty.
+	Username string
+	Password string
+	// Client defaults to an http.Client with a 30 second timeout.
+	Client *http.Client
+}
+
+// Prefixes fetches all objects of the collection, following pagination,
+// and returns their prefixes as ParseSTIXBundle does.
+func (c *TAXIIClient) Prefixes() ([]netip.Prefix, error) {
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	u, err := url.Parse(c.CollectionURL)
+	if err != nil {
+		return nil, err
+	}
+	u = u.JoinPath("objects/")
+	var nets []netip.Prefix
+	for next := ""; ; {
+		q := u.Query()
+		if next != "" {
+			q.Set("next", next)
+		}
+		u.RawQuery = q.Encode()
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/taxii+json;version=2.1")
+		if c.Username != "" {
+			req.SetBasicAuth(c.Username, c.Password)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var envelope struct {
+			More    bool         `json:"more"`
+			Next    string       `json:"next"`
+			Objects []stixObject `json:"objects"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("taxii: unexpected status %s", resp.Status)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&envelope)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if nets, err = appendSTIXPrefixes(nets, envelope.Objects); err != nil {
+			return nil, err
+		}
+		if !envelope.More || envelope.Next == "" {
+			return nets, nil
+		}
+		next = envelope.Next
+	}
+}
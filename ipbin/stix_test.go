@@ -0,0 +1,86 @@
+package ipbin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSTIXBundle = `{
+  "type": "bundle",
+  "id": "bundle--5d0092c5-5f74-4287-9642-33f4c354e56d",
+  "objects": [
+    {"type": "indicator", "spec_version": "2.1", "pattern_type": "stix",
+     "pattern": "[ipv4-addr:value = '198.51.100.1' OR ipv4-addr:value ISSUBSET '203.0.113.0/24']"},
+    {"type": "indicator", "spec_version": "2.1", "pattern_type": "stix",
+     "pattern": "[ipv6-addr:value = '2001:db8::/32']"},
+    {"type": "indicator", "spec_version": "2.1", "pattern_type": "stix", "revoked": true,
+     "pattern": "[ipv4-addr:value = '192.0.2.1']"},
+    {"type": "indicator", "spec_version": "2.1", "pattern_type": "snort",
+     "pattern": "alert ip 192.0.2.2 any -> any any"},
+    {"type": "indicator", "spec_version": "2.1", "pattern_type": "stix",
+     "pattern": "[domain-name:value = 'example.com']"},
+    {"type": "ipv4-addr", "spec_version": "2.1", "value": "10.0.0.0/8"}
+  ]
+}`
+
+func TestParseSTIXBundle(t *testing.T) {
+	nets, err := ParseSTIXBundle(strings.NewReader(testSTIXBundle))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("198.51.100.1/32"),
+		netip.MustParsePrefix("203.0.113.0/24"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+	}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v, want %v", nets, expected)
+	}
+
+	if _, err := ParseSTIXBundle(strings.NewReader(`{"objects": [{"type": "indicator", "pattern": "[ipv4-addr:value = 'x']"}]}`)); err == nil {
+		t.Errorf("invalid address expected error")
+	}
+}
+
+func TestTAXIIClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "user" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api1/collections/c1/objects/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/taxii+json;version=2.1")
+		switch r.URL.Query().Get("next") {
+		case "":
+			w.Write([]byte(`{"more": true, "next": "p2", "objects": [{"type": "indicator", "pattern": "[ipv4-addr:value = '198.51.100.0/24']"}]}`))
+		case "p2":
+			w.Write([]byte(`{"more": false, "objects": [{"type": "indicator", "pattern": "[ipv4-addr:value = '203.0.113.7']"}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := &TAXIIClient{CollectionURL: srv.URL + "/api1/collections/c1/", Username: "user", Password: "secret"}
+	nets, err := c.Prefixes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []netip.Prefix{netip.MustParsePrefix("198.51.100.0/24"), netip.MustParsePrefix("203.0.113.7/32")}
+	if !reflect.DeepEqual(nets, expected) {
+		t.Errorf("got %v, want %v", nets, expected)
+	}
+
+	c.Password = "wrong"
+	if _, err := c.Prefixes(); err == nil {
+		t.Errorf("unauthorized fetch expected error")
+	}
+}
@@ -0,0 +1,105 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"go4.org/netipx"
+	"io"
+	"slices"
+)
+
+// MaxFrameSize is the maximum size of the frames of SendSet, which
+// ReceiveSet rejects larger frames against.
+const MaxFrameSize = 1 << 20
+
+// SendSet writes ipset to w, e.g. a net.Conn or a WebSocket stream, as a
+// message for ReceiveSet: frames of a big-endian uint32 length followed by
+// that many bytes of whole binary records, then an empty frame ending the
+// set. w is flushed after each frame if it has a Flush method, like
+// bufio.Writer or http.Flusher, so that peers decode the set as it comes.
+// Several sets may be sent in a row on the same connection.
+func SendSet(w io.Writer, ipset *netipx.IPSet) error {
+	frame := make([]byte, 4, 4+MaxFrameSize)
+	send := func() error {
+		binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+		if _, err := w.Write(frame); err != nil {
+			return err
+		}
+		frame = frame[:4]
+		return flush(w)
+	}
+	for _, p := range ipset.Prefixes() {
+		if len(frame)+17 > cap(frame) {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		var err error
+		if frame, err = AppendEncoded(frame, p); err != nil {
+			return err
+		}
+	}
+	if len(frame) > 4 {
+		if err := send(); err != nil {
+			return err
+		}
+	}
+	// The empty frame ends the set
+	return send()
+}
+
+// flush flushes w if it has a Flush method.
+func flush(w io.Writer) error {
+	switch f := w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
+
+// ReceiveSet reads a set sent by SendSet from r. It returns io.EOF if r
+// ends before the set starts, and fails on frames larger than MaxFrameSize
+// or sets of more than DefaultMaxRecords records.
+func ReceiveSet(r io.Reader) (*netipx.IPSet, error) {
+	var builder netipx.IPSetBuilder
+	var header [4]byte
+	var buf []byte
+	for records, first := 0, true; ; first = false {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF && !first {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		size := binary.BigEndian.Uint32(header[:])
+		if size == 0 {
+			return builder.IPSet()
+		}
+		if size > MaxFrameSize {
+			return nil, fmt.Errorf("frame of %d bytes exceeds %d", size, MaxFrameSize)
+		}
+		buf = slices.Grow(buf[:0], int(size))[:size]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		for data := buf; len(data) > 0; records++ {
+			if records == DefaultMaxRecords {
+				return nil, fmt.Errorf("%w (maximum %d)", ErrTooManyRecords, DefaultMaxRecords)
+			}
+			p, n, err := ReadPrefixFromBytes(data)
+			if err != nil {
+				if err == io.ErrUnexpectedEOF {
+					err = fmt.Errorf("record split across frames")
+				}
+				return nil, err
+			}
+			builder.AddPrefix(p)
+			data = data[n:]
+		}
+	}
+}
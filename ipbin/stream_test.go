@@ -0,0 +1,72 @@
+package ipbin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"go4.org/netipx"
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestSendSet(t *testing.T) {
+	var prefixes []netip.Prefix
+	for i := 0; i < 300000; i++ {
+		// Every other /32, so that the set spans several frames
+		prefixes = append(prefixes, netip.PrefixFrom(netip.AddrFrom4([4]byte{10, byte(i >> 15), byte(i >> 7), byte(i << 1)}), 32))
+	}
+	big, err := MergePrefixes(prefixes)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	small, err := MergePrefixes([]netip.Prefix{netip.MustParsePrefix("2001:db8::/32")})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	empty, _ := MergePrefixes(nil)
+
+	client, server := net.Pipe()
+	go func() {
+		w := bufio.NewWriter(client)
+		for _, ipset := range []*netipx.IPSet{big, small, empty} {
+			if err := SendSet(w, ipset); err != nil {
+				t.Error(err)
+			}
+		}
+		client.Close()
+	}()
+	for _, want := range []*netipx.IPSet{big, small, empty} {
+		got, err := ReceiveSet(server)
+		if err != nil || !reflect.DeepEqual(got.Prefixes(), want.Prefixes()) {
+			t.Errorf("ReceiveSet got %d prefixes, %v, want %d", len(got.Prefixes()), err, len(want.Prefixes()))
+		}
+	}
+	if _, err := ReceiveSet(server); err != io.EOF {
+		t.Errorf("ReceiveSet at the end got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := SendSet(&buf, small); err != nil {
+		t.Error(err)
+		return
+	}
+	b := buf.Bytes()
+	if !bytes.Equal(b, []byte{0, 0, 0, 5, 32 + 33, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0}) {
+		t.Errorf("SendSet got %v", b)
+	}
+	if _, err := ReceiveSet(bytes.NewReader(b[:7])); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated frame got %v", err)
+	}
+	if _, err := ReceiveSet(bytes.NewReader(b[:9])); err != io.ErrUnexpectedEOF {
+		t.Errorf("missing end frame got %v", err)
+	}
+	huge := binary.BigEndian.AppendUint32(nil, MaxFrameSize+1)
+	if _, err := ReceiveSet(bytes.NewReader(huge)); err == nil {
+		t.Errorf("oversized frame expected error")
+	}
+}
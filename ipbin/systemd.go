@@ -0,0 +1,97 @@
+package ipbin
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemdListenFDsStart is the first file descriptor passed by systemd
+// socket activation.
+const systemdListenFDsStart = 3
+
+// SystemdListeners returns the listening sockets passed by systemd socket
+// activation (LISTEN_PID and LISTEN_FDS, see sd_listen_fds(3)), in the
+// order of the ListenStream= lines of the socket unit, or nil if the
+// process was not socket activated. The variables are unset so that child
+// processes do not inherit them.
+func SystemdListeners() ([]net.Listener, error) {
+	n, err := systemdListenFDs(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if n == 0 || err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, n)
+	for i := range listeners {
+		fd := uintptr(systemdListenFDsStart + i)
+		f := os.NewFile(fd, "LISTEN_FD_"+strconv.Itoa(int(fd)))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: fd %d: %w", fd, err)
+		}
+		listeners[i] = l
+	}
+	return listeners, nil
+}
+
+// systemdListenFDs returns the number of sockets passed to this process
+// according to the LISTEN_PID and LISTEN_FDS variables.
+func systemdListenFDs(pid, fds string) (int, error) {
+	if pid == "" || fds == "" {
+		return 0, nil
+	}
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		// Meant for another process
+		return 0, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("socket activation: invalid LISTEN_FDS %q", fds)
+	}
+	return n, nil
+}
+
+// SystemdNotify sends state to the service manager, e.g. "READY=1",
+// "STOPPING=1" or "WATCHDOG=1" (see sd_notify(3)), and reports whether it
+// was sent: it is a no-op unless the process runs as a systemd service of
+// Type=notify, with a NOTIFY_SOCKET.
+func SystemdNotify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		// An abstract socket
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SystemdWatchdog returns the interval at which the service manager
+// expects "WATCHDOG=1" notifications (WATCHDOG_USEC, see
+// sd_watchdog_enabled(3)), or 0 if the watchdog is not enabled for this
+// process.
+func SystemdWatchdog() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,78 @@
+package ipbin
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSystemdListenFDs(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		pid, fds string
+		want     int
+		err      bool
+	}{
+		{"", "", 0, false},
+		{pid, "2", 2, false},
+		{"1", "2", 0, false},
+		{pid, "x", 0, true},
+	}
+	for _, tt := range tests {
+		n, err := systemdListenFDs(tt.pid, tt.fds)
+		if n != tt.want || (err != nil) != tt.err {
+			t.Errorf("%q %q: got %d, %v", tt.pid, tt.fds, n, err)
+		}
+	}
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if ls, err := SystemdListeners(); ls != nil || err != nil {
+		t.Errorf("got %v, %v for another process", ls, err)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("LISTEN_FDS not unset")
+	}
+}
+
+func TestSystemdNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := SystemdNotify("READY=1"); sent || err != nil {
+		t.Errorf("got %v, %v without a socket", sent, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	if sent, err := SystemdNotify("READY=1"); !sent || err != nil {
+		t.Fatalf("got %v, %v", sent, err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1" {
+		t.Errorf("received %q, %v", buf[:n], err)
+	}
+}
+
+func TestSystemdWatchdog(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "")
+	if d := SystemdWatchdog(); d != 30*time.Second {
+		t.Errorf("got %v", d)
+	}
+	t.Setenv("WATCHDOG_PID", "1")
+	if d := SystemdWatchdog(); d != 0 {
+		t.Errorf("got %v for another process", d)
+	}
+	t.Setenv("WATCHDOG_USEC", "")
+	if d := SystemdWatchdog(); d != 0 {
+		t.Errorf("got %v without a watchdog", d)
+	}
+}
@@ -0,0 +1,49 @@
+package ipbin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"strconv"
+)
+
+// terraformIdent matches valid Terraform variable names.
+var terraformIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// WriteTFVars writes prefixes as a Terraform variable definitions file
+// (.tfvars) assigning them to variable name, a list(string) or set(string):
+//
+//	name = [
+//	  "192.0.2.0/24",
+//	  "2001:db8::/32",
+//	]
+func WriteTFVars(w io.Writer, name string, prefixes []netip.Prefix) error {
+	if !terraformIdent.MatchString(name) {
+		return fmt.Errorf("invalid terraform variable name: %q", name)
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(name + " = [\n")
+	for _, p := range prefixes {
+		bw.WriteString("  " + strconv.Quote(p.Masked().String()) + ",\n")
+	}
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
+
+// WriteTFVarsJSON writes prefixes as a JSON Terraform variable definitions
+// file (.tfvars.json) assigning them to variable name.
+func WriteTFVarsJSON(w io.Writer, name string, prefixes []netip.Prefix) error {
+	if !terraformIdent.MatchString(name) {
+		return fmt.Errorf("invalid terraform variable name: %q", name)
+	}
+	cidrs := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		cidrs[i] = p.Masked().String()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string][]string{name: cidrs})
+}
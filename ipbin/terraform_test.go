@@ -0,0 +1,35 @@
+package ipbin
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func TestWriteTFVars(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("2001:db8::1/128")}
+
+	var buf bytes.Buffer
+	if err := WriteTFVars(&buf, "blocked_cidrs", prefixes); err != nil {
+		t.Error(err)
+		return
+	}
+	expected := "blocked_cidrs = [\n  \"192.0.2.0/24\",\n  \"2001:db8::1/128\",\n]\n"
+	if buf.String() != expected {
+		t.Errorf("WriteTFVars got %q, want %q", buf.String(), expected)
+	}
+
+	buf.Reset()
+	if err := WriteTFVarsJSON(&buf, "blocked_cidrs", prefixes); err != nil {
+		t.Error(err)
+		return
+	}
+	expected = "{\n  \"blocked_cidrs\": [\n    \"192.0.2.0/24\",\n    \"2001:db8::1/128\"\n  ]\n}\n"
+	if buf.String() != expected {
+		t.Errorf("WriteTFVarsJSON got %q, want %q", buf.String(), expected)
+	}
+
+	if err := WriteTFVars(&buf, "1cidrs", prefixes); err == nil {
+		t.Errorf("invalid variable name expected error")
+	}
+}
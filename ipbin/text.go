@@ -0,0 +1,52 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+	"net/netip"
+)
+
+// TextStyle selects how AppendPrefixText writes a prefix.
+type TextStyle int
+
+const (
+	// TextFull writes prefixes in CIDR notation, e.g. 192.0.2.7/32, and
+	// ranges as start-end, even of a single address.
+	TextFull TextStyle = iota
+	// TextCompact writes single addresses without their length, e.g.
+	// 192.0.2.7, and other prefixes in CIDR notation. Ranges of a single
+	// address are written as the address.
+	TextCompact
+)
+
+// AppendPrefixText appends the text of the masked prefix p in style to dst.
+// Unlike p.String(), it does not allocate if dst has room for it, e.g. to
+// render large sets.
+func AppendPrefixText(dst []byte, p netip.Prefix, style TextStyle) []byte {
+	p = p.Masked()
+	if style == TextCompact && p.IsSingleIP() {
+		return p.Addr().AppendTo(dst)
+	}
+	return p.AppendTo(dst)
+}
+
+// FormatPrefixCompact formats p as an address if it is a single address, as
+// a prefix otherwise, like the subnets+ips format.
+func FormatPrefixCompact(p netip.Prefix) string {
+	return string(AppendPrefixText(nil, p, TextCompact))
+}
+
+// AppendRangeText appends the text of r in style to dst: "start-end", or
+// the address of a single-address range in TextCompact style.
+func AppendRangeText(dst []byte, r netipx.IPRange, style TextStyle) []byte {
+	if style == TextCompact && r.From() == r.To() {
+		return r.From().AppendTo(dst)
+	}
+	return r.To().AppendTo(append(r.From().AppendTo(dst), '-'))
+}
+
+// FormatRange formats r in style like the ranges and ranges+ips formats:
+// "start-end", or the address of a single-address range in TextCompact
+// style.
+func FormatRange(r netipx.IPRange, style TextStyle) string {
+	return string(AppendRangeText(nil, r, style))
+}
@@ -0,0 +1,55 @@
+package ipbin
+
+import (
+	"go4.org/netipx"
+	"net/netip"
+	"testing"
+)
+
+func TestAppendPrefixText(t *testing.T) {
+	cases := []struct {
+		p     string
+		style TextStyle
+		want  string
+	}{
+		{"192.0.2.7/32", TextFull, "192.0.2.7/32"},
+		{"192.0.2.7/32", TextCompact, "192.0.2.7"},
+		{"192.0.2.7/24", TextCompact, "192.0.2.0/24"},
+		{"2001:db8::1/128", TextCompact, "2001:db8::1"},
+		{"2001:db8::/32", TextFull, "2001:db8::/32"},
+	}
+	for _, c := range cases {
+		if got := string(AppendPrefixText([]byte("x "), netip.MustParsePrefix(c.p), c.style)); got != "x "+c.want {
+			t.Errorf("AppendPrefixText(%s, %d) = %q, want %q", c.p, c.style, got, "x "+c.want)
+		}
+	}
+
+	p := netip.MustParsePrefix("2001:db8:abcd:1234::/64")
+	buf := make([]byte, 0, 64)
+	if n := testing.AllocsPerRun(100, func() { AppendPrefixText(buf, p, TextCompact) }); n != 0 {
+		t.Errorf("AppendPrefixText allocates %v times", n)
+	}
+}
+
+func TestFormatRange(t *testing.T) {
+	cases := []struct {
+		from, to string
+		style    TextStyle
+		want     string
+	}{
+		{"192.0.2.0", "192.0.2.9", TextFull, "192.0.2.0-192.0.2.9"},
+		{"192.0.2.0", "192.0.2.9", TextCompact, "192.0.2.0-192.0.2.9"},
+		{"192.0.2.7", "192.0.2.7", TextFull, "192.0.2.7-192.0.2.7"},
+		{"192.0.2.7", "192.0.2.7", TextCompact, "192.0.2.7"},
+		{"2001:db8::", "2001:db8::ff", TextCompact, "2001:db8::-2001:db8::ff"},
+	}
+	for _, c := range cases {
+		r := netipx.IPRangeFrom(netip.MustParseAddr(c.from), netip.MustParseAddr(c.to))
+		if got := FormatRange(r, c.style); got != c.want {
+			t.Errorf("FormatRange(%s, %d) = %q, want %q", r, c.style, got, c.want)
+		}
+	}
+	if got := FormatPrefixCompact(netip.MustParsePrefix("192.0.2.7/32")); got != "192.0.2.7" {
+		t.Errorf("FormatPrefixCompact got %q", got)
+	}
+}
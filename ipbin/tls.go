@@ -0,0 +1,130 @@
+package ipbin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// ServerTLSConfig returns the TLS configuration of a server presenting the
+// certificate and key of the PEM files certFile and keyFile. If
+// clientCAFile is not empty, clients must present a certificate signed by
+// one of the CAs of this PEM file (mutual TLS). The files are re-read when
+// they change, as seen at the next handshake, so that rotated certificates
+// are served without a restart; while the new files do not load, e.g.
+// when only the certificate has been replaced yet, the last ones are kept.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	r := &tlsReloader{certFile: certFile, keyFile: keyFile, caFile: clientCAFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return r.certificate() },
+	}
+	if clientCAFile != "" {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			c := config.Clone()
+			c.GetConfigForClient = nil
+			c.GetCertificate = nil
+			c.Certificates = []tls.Certificate{*cert}
+			c.ClientCAs = pool
+			return c, nil
+		}
+	}
+	return config, nil
+}
+
+// ClientTLSConfig returns the TLS configuration of a client verifying
+// servers with the CAs of the PEM file caFile, or with those of the system
+// if empty, and, if certFile is not empty, presenting the certificate and
+// key of the PEM files certFile and keyFile to servers requiring one. The
+// files are re-read when they change, as with ServerTLSConfig.
+func ClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	r := &tlsReloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return r.certificate() }
+	}
+	if caFile != "" {
+		// The CAs are only read once: a tls.Config verifying with the
+		// current ones would need to verify the chains itself
+		_, config.RootCAs = r.current()
+	}
+	return config, nil
+}
+
+// tlsReloader keeps a certificate and a CA pool loaded from their files,
+// re-reading them when the files change.
+type tlsReloader struct {
+	certFile, keyFile, caFile string
+
+	mu     sync.Mutex
+	states []fileState
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+}
+
+// load reads the files if they changed since the last successful load.
+func (r *tlsReloader) load() error {
+	var paths []string
+	for _, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	states := statFiles(paths)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.states != nil && slices.EqualFunc(states, r.states, fileState.equal) {
+		return nil
+	}
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: no PEM certificate", r.caFile)
+		}
+	}
+	r.states, r.cert, r.pool = states, cert, pool
+	return nil
+}
+
+// current returns the certificate and CA pool, reloaded if their files
+// changed and load, the last ones otherwise.
+func (r *tlsReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.load()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, r.pool
+}
+
+func (r *tlsReloader) certificate() (*tls.Certificate, error) {
+	cert, _ := r.current()
+	if cert == nil {
+		return nil, errors.New("no certificate")
+	}
+	return cert, nil
+}
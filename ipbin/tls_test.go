@@ -0,0 +1,132 @@
+package ipbin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a certificate for 127.0.0.1 signed by ca, or
+// self-signed if nil, and its key to dir, and returns their paths.
+func writeTestCert(t *testing.T, dir, name string, serial int64, ca *tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  ca == nil,
+	}
+	parent, signer := template, any(key)
+	if ca != nil {
+		parent, signer = ca.Leaf, ca.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey := writeTestCert(t, dir, "ca", 1, nil)
+	ca, err := tls.LoadX509KeyPair(caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, serverKey := writeTestCert(t, dir, "server", 2, &ca)
+	clientCert, clientKey := writeTestCert(t, dir, "client", 3, &ca)
+
+	if _, err := ServerTLSConfig(serverCert, caKey, caCert); err == nil {
+		t.Error("mismatched key accepted")
+	}
+	config, err := ServerTLSConfig(serverCert, serverKey, caCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}), ErrorLog: log.New(io.Discard, "", 0)}
+	go srv.Serve(l)
+	defer srv.Close()
+	url := "https://" + l.Addr().String() + "/"
+
+	get := func(certFile, keyFile string) (*http.Response, error) {
+		config, err := ClientTLSConfig(certFile, keyFile, caCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+	resp, err := get(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("mutual TLS got %v", err)
+	}
+	if serial := resp.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 2 {
+		t.Errorf("server certificate serial got %d", serial)
+	}
+	if _, err := get("", ""); err == nil {
+		t.Error("client without certificate accepted")
+	}
+
+	// Rotated certificates are served at the next handshake
+	writeTestCert(t, dir, "server", 4, &ca)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(serverCert, future, future)
+	os.Chtimes(serverKey, future, future)
+	if resp, err = get(clientCert, clientKey); err != nil {
+		t.Fatalf("after rotation got %v", err)
+	}
+	if serial := resp.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 4 {
+		t.Errorf("rotated server certificate serial got %d", serial)
+	}
+
+	// Broken files keep the last certificate
+	os.WriteFile(serverKey, []byte("garbage"), 0o600)
+	if resp, err = get(clientCert, clientKey); err != nil || resp.TLS.PeerCertificates[0].SerialNumber.Int64() != 4 {
+		t.Errorf("with a broken key got %v", err)
+	}
+}
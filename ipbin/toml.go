@@ -0,0 +1,347 @@
+package ipbin
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ParseTOMLList parses the addresses, prefixes and ranges selected by path
+// (see parsePath) in a TOML document, like ParseYAMLList, e.g. with
+// ".firewall.allow". Values other than strings, arrays and tables, like
+// numbers and dates, are kept as their text.
+func ParseTOMLList(r io.Reader, path string) ([]netip.Prefix, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeTOML(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return parseDocumentPrefixes([]any{doc}, path)
+}
+
+// tomlParser parses a TOML document into maps, slices and strings.
+type tomlParser struct {
+	s string
+	i int
+}
+
+// decodeTOML decodes a TOML document.
+func decodeTOML(data string) (map[string]any, error) {
+	p := &tomlParser{s: data}
+	root := map[string]any{}
+	table := root
+	for {
+		p.skipSpace(true)
+		if p.i == len(p.s) {
+			return root, nil
+		}
+		var err error
+		switch {
+		case strings.HasPrefix(p.s[p.i:], "[["):
+			// An element of an array of tables
+			p.i += 2
+			keys, err := p.keys()
+			if err != nil {
+				return nil, err
+			}
+			if !p.consume("]]") {
+				return nil, p.errorf("missing ]] after table name")
+			}
+			parent, err := p.table(root, keys[:len(keys)-1])
+			if err != nil {
+				return nil, err
+			}
+			last := keys[len(keys)-1]
+			tables, ok := parent[last].([]any)
+			if _, exists := parent[last]; exists && !ok {
+				return nil, p.errorf("%s is not an array of tables", strings.Join(keys, "."))
+			}
+			table = map[string]any{}
+			parent[last] = append(tables, table)
+		case p.s[p.i] == '[':
+			p.i++
+			keys, err := p.keys()
+			if err != nil {
+				return nil, err
+			}
+			if !p.consume("]") {
+				return nil, p.errorf("missing ] after table name")
+			}
+			if table, err = p.table(root, keys); err != nil {
+				return nil, err
+			}
+		default:
+			err = p.keyValue(table)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Up to the end of the line
+		p.skipSpace(false)
+		if p.i < len(p.s) && p.s[p.i] != '\n' && p.s[p.i] != '\r' {
+			return nil, p.errorf("unexpected %q", p.rest())
+		}
+	}
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return &ParseError{Line: strings.Count(p.s[:p.i], "\n") + 1, Err: fmt.Errorf("invalid TOML: "+format, args...)}
+}
+
+// rest returns the rest of the current line, for error messages.
+func (p *tomlParser) rest() string {
+	s, _, _ := strings.Cut(p.s[p.i:], "\n")
+	return strings.TrimSpace(s)
+}
+
+// skipSpace skips whitespace and comments, and newlines if newlines is
+// set.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; {
+		case c == ' ' || c == '\t':
+			p.i++
+		case (c == '\n' || c == '\r') && newlines:
+			p.i++
+		case c == '#':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// consume skips s if the input continues with it, after spaces.
+func (p *tomlParser) consume(s string) bool {
+	p.skipSpace(false)
+	if strings.HasPrefix(p.s[p.i:], s) {
+		p.i += len(s)
+		return true
+	}
+	return false
+}
+
+// keys parses a dotted key, like a.b or "a.b".c.
+func (p *tomlParser) keys() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		if p.i < len(p.s) && (p.s[p.i] == '"' || p.s[p.i] == '\'') {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, v.(string))
+		} else {
+			start := p.i
+			for p.i < len(p.s) && isTOMLBareKey(p.s[p.i]) {
+				p.i++
+			}
+			if p.i == start {
+				return nil, p.errorf("invalid key %q", p.rest())
+			}
+			keys = append(keys, p.s[start:p.i])
+		}
+		if !p.consume(".") {
+			return keys, nil
+		}
+	}
+}
+
+func isTOMLBareKey(c byte) bool {
+	return isAlnum(c) || c == '_' || c == '-'
+}
+
+// keyValue parses a key = value pair into table.
+func (p *tomlParser) keyValue(table map[string]any) error {
+	keys, err := p.keys()
+	if err != nil {
+		return err
+	}
+	if !p.consume("=") {
+		return p.errorf("missing = after key %s", strings.Join(keys, "."))
+	}
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	if table, err = p.table(table, keys[:len(keys)-1]); err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := table[last]; exists {
+		return p.errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+	table[last] = v
+	return nil
+}
+
+// table returns the table of the dotted key keys in t, creating it if
+// needed. The key of an array of tables is its last element.
+func (p *tomlParser) table(t map[string]any, keys []string) (map[string]any, error) {
+	for i, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			next := map[string]any{}
+			t[k], t = next, next
+		case map[string]any:
+			t = v
+		case []any:
+			var ok bool
+			if len(v) > 0 {
+				t, ok = v[len(v)-1].(map[string]any)
+			}
+			if !ok {
+				return nil, p.errorf("%s is not a table", strings.Join(keys[:i+1], "."))
+			}
+		default:
+			return nil, p.errorf("%s is not a table", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return t, nil
+}
+
+// value parses a value: a string, an array, an inline table, or the text of
+// another value.
+func (p *tomlParser) value() (any, error) {
+	p.skipSpace(false)
+	s := p.s[p.i:]
+	switch {
+	case strings.HasPrefix(s, `"""`), strings.HasPrefix(s, "'''"):
+		end := strings.Index(s[3:], s[:3])
+		if end < 0 {
+			return nil, p.errorf("unterminated multi-line string")
+		}
+		// Up to two quotes may precede the closing delimiter
+		for n := 0; n < 2 && end+6 < len(s) && s[end+6] == s[0]; n++ {
+			end++
+		}
+		v := strings.TrimPrefix(strings.TrimPrefix(s[3:3+end], "\r"), "\n")
+		p.i += end + 6
+		if s[0] == '\'' {
+			return v, nil
+		}
+		return p.unescape(v)
+	case strings.HasPrefix(s, `"`):
+		end := 1
+		for end < len(s) && s[end] != '"' && s[end] != '\n' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) || s[end] != '"' {
+			return nil, p.errorf("unterminated string")
+		}
+		p.i += end + 1
+		return p.unescape(s[1:end])
+	case strings.HasPrefix(s, "'"):
+		end := strings.IndexAny(s[1:], "'\n")
+		if end < 0 || s[1+end] != '\'' {
+			return nil, p.errorf("unterminated string")
+		}
+		p.i += end + 2
+		return s[1 : 1+end], nil
+	case strings.HasPrefix(s, "["):
+		p.i++
+		arr := []any{}
+		for {
+			p.skipSpace(true)
+			if p.i < len(p.s) && p.s[p.i] == ']' {
+				p.i++
+				return arr, nil
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+			p.skipSpace(true)
+			switch {
+			case p.i < len(p.s) && p.s[p.i] == ',':
+				p.i++
+			case p.i < len(p.s) && p.s[p.i] == ']':
+			default:
+				return nil, p.errorf("unterminated array")
+			}
+		}
+	case strings.HasPrefix(s, "{"):
+		p.i++
+		t := map[string]any{}
+		if p.consume("}") {
+			return t, nil
+		}
+		for {
+			if err := p.keyValue(t); err != nil {
+				return nil, err
+			}
+			if p.consume("}") {
+				return t, nil
+			}
+			if !p.consume(",") {
+				return nil, p.errorf("unterminated inline table")
+			}
+		}
+	}
+	// A number, boolean or date, kept as its text
+	end := strings.IndexAny(s, ",]}# \t\r\n")
+	if end < 0 {
+		end = len(s)
+	}
+	v := strings.TrimSpace(s[:end])
+	if v == "" {
+		return nil, p.errorf("missing value")
+	}
+	p.i += end
+	return v, nil
+}
+
+// unescape returns the value of the escaped content of a basic string.
+func (p *tomlParser) unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			break
+		}
+		switch c := s[i]; c {
+		case 'b', 'e', 'f', 'n', 'r', 't', '"', '\\':
+			b.WriteByte("\b\x1b\f\n\r\t\"\\"[strings.IndexByte(`befnrt"\`, c)])
+		case 'u', 'U':
+			n := 4
+			if c == 'U' {
+				n = 8
+			}
+			if i+n >= len(s) {
+				return "", p.errorf("invalid escape \\%s", s[i:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil {
+				return "", p.errorf("invalid escape \\%s", s[i:i+1+n])
+			}
+			b.WriteRune(rune(r))
+			i += n
+		case ' ', '\t', '\r', '\n':
+			// A line ending backslash, trimming the whitespace following it
+			for i+1 < len(s) && strings.IndexByte(" \t\r\n", s[i+1]) >= 0 {
+				i++
+			}
+		default:
+			return "", p.errorf("invalid escape \\%c", c)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,82 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOMLList(t *testing.T) {
+	input := `# Firewall configuration
+title = "edge"
+port = 8080
+
+[firewall]
+allow = [
+  "10.0.0.0/8",   # office
+  '192.0.2.1',
+  "192.0.2.9 - 192.0.2.10",
+]
+deny = """
+203.0.113.0/24
+2001:db8::/32"""
+"quoted.key" = { cidrs = ["100.64.0.0/10"] }
+
+[[firewall.rules]]
+name = "vpn"
+cidr = "172.16.0.0/12"
+
+[[firewall.rules]]
+name = "lab"
+cidr = "198.51.100.0/24"
+`
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{".firewall.allow", []string{"10.0.0.0/8", "192.0.2.1/32", "192.0.2.9/32", "192.0.2.10/32"}},
+		{"firewall.deny", []string{"203.0.113.0/24", "2001:db8::/32"}},
+		{`.firewall."quoted.key".cidrs`, []string{"100.64.0.0/10"}},
+		{".firewall.rules[].cidr", []string{"172.16.0.0/12", "198.51.100.0/24"}},
+	}
+	for _, tt := range tests {
+		nets, err := ParseTOMLList(strings.NewReader(input), tt.path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		var want []netip.Prefix
+		for _, s := range tt.want {
+			want = append(want, netip.MustParsePrefix(s))
+		}
+		if !reflect.DeepEqual(nets, want) {
+			t.Errorf("%s got %v, want %v", tt.path, nets, want)
+		}
+	}
+
+	doc, err := decodeTOML(`a = "tab\tquote\"\u00e9" # comment` + "\nb = 'C:\\path'\nc = 2024-01-01\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"a": "tab\tquote\"é", "b": `C:\path`, "c": "2024-01-01"}; !reflect.DeepEqual(doc, want) {
+		t.Errorf("got %v, want %v", doc, want)
+	}
+
+	for _, bad := range []string{
+		"a = [\"10.0.0.0/8\"\n", // unterminated array
+		"a = \"x\n",             // unterminated string
+		"a = 1\na = 2\n",        // duplicate key
+		"a = 1 b = 2\n",         // two pairs on a line
+		"[a\n",                  // unterminated table name
+		"a = 1\n[a.b]\n",        // a is not a table
+		"a = \"\\q\"\n",         // invalid escape
+	} {
+		if _, err := decodeTOML(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+	if _, err := ParseTOMLList(strings.NewReader(input), ""); err == nil {
+		t.Error("expected an error for the root table")
+	}
+}
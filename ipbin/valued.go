@@ -0,0 +1,162 @@
+package ipbin
+
+import (
+	"fmt"
+	"go4.org/netipx"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ValuedPrefix is a prefix tagged with a value, e.g. a confidence score or
+// a category.
+type ValuedPrefix struct {
+	Prefix netip.Prefix
+	Value  string
+}
+
+// MergePolicy resolves the value of addresses covered by several valued
+// prefixes with different values.
+type MergePolicy int
+
+const (
+	MergeMax      MergePolicy = iota // the greatest value, compared as numbers
+	MergeMin                         // the smallest value, compared as numbers
+	MergeLastWins                    // the value of the last prefix in input order
+	MergeConcat                      // the distinct values in input order, joined by "|"
+	MergeError                       // conflicting values are an error
+)
+
+var mergePolicyNames = []string{
+	MergeMax:      "max",
+	MergeMin:      "min",
+	MergeLastWins: "last-wins",
+	MergeConcat:   "concat",
+	MergeError:    "error",
+}
+
+func (p MergePolicy) String() string {
+	if p >= 0 && int(p) < len(mergePolicyNames) {
+		return mergePolicyNames[p]
+	}
+	return "MergePolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// ParseMergePolicy returns the policy named s: "max", "min", "last-wins",
+// "concat" or "error".
+func ParseMergePolicy(s string) (MergePolicy, error) {
+	if i := slices.Index(mergePolicyNames, strings.ToLower(s)); i >= 0 {
+		return MergePolicy(i), nil
+	}
+	return 0, fmt.Errorf("unknown merge policy: %s", s)
+}
+
+// valuedRange is the address range of an input prefix of MergeValued.
+type valuedRange struct {
+	r     netipx.IPRange
+	value string
+	index int // position in the input
+}
+
+// MergeValued merges valued prefixes into the minimal sorted list of
+// disjoint prefixes, resolving the value of addresses covered by several
+// prefixes with policy. Adjacent prefixes are only merged if their values
+// are equal.
+func MergeValued(prefixes []ValuedPrefix, policy MergePolicy) ([]ValuedPrefix, error) {
+	ranges := make([]valuedRange, len(prefixes))
+	var cuts []netip.Addr
+	for i, vp := range prefixes {
+		if !vp.Prefix.IsValid() {
+			return nil, fmt.Errorf("invalid prefix %v", vp.Prefix)
+		}
+		r := netipx.RangeOfPrefix(vp.Prefix)
+		ranges[i] = valuedRange{r: r, value: vp.Value, index: i}
+		cuts = append(cuts, r.From())
+		if next := r.To().Next(); next.IsValid() {
+			cuts = append(cuts, next)
+		}
+	}
+	slices.SortStableFunc(ranges, func(a, b valuedRange) int {
+		return a.r.From().Compare(b.r.From())
+	})
+	slices.SortFunc(cuts, netip.Addr.Compare)
+	cuts = slices.Compact(cuts)
+
+	// Sweep the boundaries, tracking the ranges covering each segment
+	var segments []valuedRange
+	var active []valuedRange
+	next := 0
+	for i, from := range cuts {
+		active = slices.DeleteFunc(active, func(vr valuedRange) bool {
+			return vr.r.To().Compare(from) < 0
+		})
+		for ; next < len(ranges) && ranges[next].r.From().Compare(from) <= 0; next++ {
+			active = append(active, ranges[next])
+		}
+		if len(active) == 0 {
+			continue
+		}
+		slices.SortFunc(active, func(a, b valuedRange) int {
+			return a.index - b.index
+		})
+		value, err := resolveValues(active, policy)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", from, err)
+		}
+		to := lastAddr(from)
+		if i+1 < len(cuts) && cuts[i+1].Is4() == from.Is4() {
+			to = cuts[i+1].Prev()
+		}
+		if n := len(segments); n > 0 && segments[n-1].value == value && segments[n-1].r.To().Next() == from {
+			segments[n-1].r = netipx.IPRangeFrom(segments[n-1].r.From(), to)
+			continue
+		}
+		segments = append(segments, valuedRange{r: netipx.IPRangeFrom(from, to), value: value})
+	}
+
+	var out []ValuedPrefix
+	for _, seg := range segments {
+		for _, p := range seg.r.Prefixes() {
+			out = append(out, ValuedPrefix{Prefix: p, Value: seg.value})
+		}
+	}
+	return out, nil
+}
+
+// resolveValues returns the value of addresses covered by the ranges
+// active, in input order, according to policy.
+func resolveValues(active []valuedRange, policy MergePolicy) (string, error) {
+	value := active[len(active)-1].value
+	switch policy {
+	case MergeLastWins:
+	case MergeMax, MergeMin:
+		best := 0.0
+		for i, vr := range active {
+			f, err := strconv.ParseFloat(vr.value, 64)
+			if err != nil {
+				return "", fmt.Errorf("value %q is not a number", vr.value)
+			}
+			if i == 0 || (policy == MergeMax && f > best) || (policy == MergeMin && f < best) {
+				best, value = f, vr.value
+			}
+		}
+	case MergeConcat:
+		var values []string
+		for _, vr := range active {
+			if !slices.Contains(values, vr.value) {
+				values = append(values, vr.value)
+			}
+		}
+		value = strings.Join(values, "|")
+	case MergeError:
+		for _, vr := range active {
+			if vr.value != value {
+				return "", fmt.Errorf("conflicting values %q and %q", vr.value, value)
+			}
+		}
+	default:
+		return "", fmt.Errorf("unknown merge policy: %v", policy)
+	}
+	return value, nil
+}
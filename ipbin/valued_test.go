@@ -0,0 +1,59 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestMergeValued(t *testing.T) {
+	input := []ValuedPrefix{
+		{netip.MustParsePrefix("10.0.0.0/23"), "50"},
+		{netip.MustParsePrefix("10.0.1.0/24"), "90"},
+		{netip.MustParsePrefix("10.0.2.0/24"), "50"},
+		{netip.MustParsePrefix("10.0.0.0/25"), "10"},
+	}
+	vp := func(p, v string) ValuedPrefix {
+		return ValuedPrefix{netip.MustParsePrefix(p), v}
+	}
+	cases := []struct {
+		policy   MergePolicy
+		expected []ValuedPrefix
+	}{
+		{MergeMax, []ValuedPrefix{vp("10.0.0.0/24", "50"), vp("10.0.1.0/24", "90"), vp("10.0.2.0/24", "50")}},
+		{MergeMin, []ValuedPrefix{vp("10.0.0.0/25", "10"), vp("10.0.0.128/25", "50"), vp("10.0.1.0/24", "50"), vp("10.0.2.0/24", "50")}},
+		{MergeLastWins, []ValuedPrefix{vp("10.0.0.0/25", "10"), vp("10.0.0.128/25", "50"), vp("10.0.1.0/24", "90"), vp("10.0.2.0/24", "50")}},
+		{MergeConcat, []ValuedPrefix{vp("10.0.0.0/25", "50|10"), vp("10.0.0.128/25", "50"), vp("10.0.1.0/24", "50|90"), vp("10.0.2.0/24", "50")}},
+	}
+	for _, c := range cases {
+		got, err := MergeValued(input, c.policy)
+		if err != nil {
+			t.Errorf("%v: %v", c.policy, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%v got %v\nwant %v", c.policy, got, c.expected)
+		}
+	}
+
+	if _, err := MergeValued(input, MergeError); err == nil {
+		t.Errorf("conflicting values expected error")
+	}
+	same := []ValuedPrefix{vp("10.0.0.0/24", "a"), vp("10.0.0.0/25", "a"), vp("2001:db8::/32", "b")}
+	got, err := MergeValued(same, MergeError)
+	if err != nil || !reflect.DeepEqual(got, []ValuedPrefix{vp("10.0.0.0/24", "a"), vp("2001:db8::/32", "b")}) {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if _, err := MergeValued([]ValuedPrefix{vp("10.0.0.0/24", "x"), vp("10.0.0.0/25", "1")}, MergeMax); err == nil {
+		t.Errorf("non-numeric value expected error")
+	}
+
+	for _, s := range []string{"max", "min", "last-wins", "concat", "error"} {
+		if p, err := ParseMergePolicy(s); err != nil || p.String() != s {
+			t.Errorf("ParseMergePolicy(%q) got %v, %v", s, p, err)
+		}
+	}
+	if _, err := ParseMergePolicy("avg"); err == nil {
+		t.Errorf("unknown policy expected error")
+	}
+}
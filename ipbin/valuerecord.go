@@ -0,0 +1,107 @@
+package ipbin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ValueHeader is the header byte of a valued record: it is followed by the
+// length of the value as a uvarint, the value, then by the expiring record
+// or encoded prefix it tags. Readers of prefixes only, like DecodeAll, skip
+// the value.
+const ValueHeader = 163
+
+// MaxValueSize is the maximum size of the value of a valued record.
+const MaxValueSize = 1 << 16
+
+// AppendEncodedValued appends the valued record of vp to dst, or the plain
+// encoded prefix if its value is empty.
+func AppendEncodedValued(dst []byte, vp ValuedPrefix) ([]byte, error) {
+	if vp.Value != "" {
+		if len(vp.Value) > MaxValueSize {
+			return nil, fmt.Errorf("value of %d bytes exceeds %d", len(vp.Value), MaxValueSize)
+		}
+		dst = append(dst, ValueHeader)
+		dst = binary.AppendUvarint(dst, uint64(len(vp.Value)))
+		dst = append(dst, vp.Value...)
+	}
+	return AppendEncoded(dst, vp.Prefix)
+}
+
+// ReadValuedPrefixFromBytes reads a valued record, or a record without
+// value, from buf and returns it along with the number of bytes read. The
+// expiry of the record, if any, is dropped.
+func ReadValuedPrefixFromBytes(buf []byte) (ValuedPrefix, int, error) {
+	value, off, err := readValue(buf)
+	if err != nil {
+		return ValuedPrefix{}, 0, err
+	}
+	ep, n, err := readExpiringRecord(buf[off:])
+	if err == io.EOF && off > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return ValuedPrefix{}, 0, err
+	}
+	return ValuedPrefix{Prefix: ep.Prefix, Value: value}, off + n, nil
+}
+
+// readValue reads the value of a valued record at the start of buf, if
+// any, returning it along with the number of bytes read, 0 if none.
+func readValue(buf []byte) (string, int, error) {
+	if len(buf) == 0 || buf[0] != ValueHeader {
+		return "", 0, nil
+	}
+	size, n := binary.Uvarint(buf[1:])
+	if n <= 0 || size > MaxValueSize {
+		if n == 0 {
+			return "", 0, io.ErrUnexpectedEOF
+		}
+		return "", 0, errors.New("invalid value length")
+	}
+	end := 1 + n + int(size)
+	if end > len(buf) {
+		return "", 0, io.ErrUnexpectedEOF
+	}
+	return string(buf[1+n : end]), end, nil
+}
+
+// DecodeValued decodes the records of a binary set with their values,
+// skipping its metadata block. The records without value, range records
+// among them, have an empty one; those expired at expiredAt, if not zero,
+// are dropped.
+func DecodeValued(buf []byte, expiredAt time.Time) ([]ValuedPrefix, error) {
+	_, off, err := ReadMetadataFromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	var vps []ValuedPrefix
+	var blocks blockCheck
+	for off < len(buf) {
+		rec, n, err := readRecord(buf[off:])
+		if err == nil {
+			err = blocks.next(buf, off, rec, n)
+		}
+		if err != nil {
+			return nil, &ParseError{Offset: off, Err: err}
+		}
+		off += n
+		if !expiredAt.IsZero() && rec.prefix.Expired(expiredAt) {
+			continue
+		}
+		if rec.kind == KindRange {
+			for _, p := range rec.rng.Prefixes() {
+				vps = append(vps, ValuedPrefix{Prefix: p})
+			}
+		} else if rec.kind == KindIPv4 || rec.kind == KindIPv6 {
+			vps = append(vps, ValuedPrefix{Prefix: rec.prefix.Prefix, Value: rec.value})
+		}
+	}
+	if err := blocks.done(); err != nil {
+		return nil, &ParseError{Offset: off, Err: err}
+	}
+	return vps, nil
+}
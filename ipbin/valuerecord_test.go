@@ -0,0 +1,65 @@
+package ipbin
+
+import (
+	"bytes"
+	"io"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValuedRecords(t *testing.T) {
+	vps := []ValuedPrefix{
+		{netip.MustParsePrefix("10.0.0.1/32"), "40"},
+		{netip.MustParsePrefix("192.0.2.0/24"), ""},
+		{netip.MustParsePrefix("2001:db8::/32"), "malware"},
+	}
+	var records []byte
+	for _, vp := range vps {
+		var err error
+		if records, err = AppendEncodedValued(records, vp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An expiring record with a value, and an expired one
+	records = append(records, ValueHeader, 2, '9', '9')
+	records, _ = AppendEncodedExpiring(records, ExpiringPrefix{netip.MustParsePrefix("198.51.100.0/24"), time.Unix(2000000000, 0)})
+	records = append(records, ValueHeader, 1, '1')
+	records, _ = AppendEncodedExpiring(records, ExpiringPrefix{netip.MustParsePrefix("203.0.113.0/24"), time.Unix(1000000000, 0)})
+
+	var buf bytes.Buffer
+	if err := WriteContainer(&buf, Metadata{Source: "test"}, records); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeValued(buf.Bytes(), time.Unix(1500000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append(vps, ValuedPrefix{netip.MustParsePrefix("198.51.100.0/24"), "99"})
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("DecodeValued got %v\nwant %v", got, expected)
+	}
+
+	// Readers of prefixes only skip the values
+	prefixes, err := DecodeAll(buf.Bytes(), DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prefixes) != 5 || prefixes[2] != netip.MustParsePrefix("2001:db8::/32") {
+		t.Errorf("DecodeAll got %v", prefixes)
+	}
+	if stats, err := BinaryStats(buf.Bytes(), time.Unix(1500000000, 0)); err != nil || stats.Valued != 4 || stats.Expired != 1 {
+		t.Errorf("BinaryStats got %+v, %v", stats, err)
+	}
+	vp, n, err := ReadValuedPrefixFromBytes(records)
+	if err != nil || vp != vps[0] || n != 1+1+2+5 {
+		t.Errorf("ReadValuedPrefixFromBytes got %v, %d, %v", vp, n, err)
+	}
+
+	for _, b := range [][]byte{{ValueHeader}, {ValueHeader, 3, 'a'}, {ValueHeader, 1, 'a'}} {
+		if _, _, err := ReadValuedPrefixFromBytes(b); err != io.ErrUnexpectedEOF {
+			t.Errorf("%v: got %v, want io.ErrUnexpectedEOF", b, err)
+		}
+	}
+}
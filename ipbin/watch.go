@@ -0,0 +1,58 @@
+package ipbin
+
+import (
+	"context"
+	"os"
+	"slices"
+	"time"
+)
+
+// fileState is what WatchFiles compares of a file between polls.
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func (s fileState) equal(o fileState) bool {
+	return s.exists == o.exists && s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+func statFiles(paths []string) []fileState {
+	states := make([]fileState, len(paths))
+	for i, path := range paths {
+		if fi, err := os.Stat(path); err == nil {
+			states[i] = fileState{true, fi.Size(), fi.ModTime()}
+		}
+	}
+	return states
+}
+
+// WatchFiles calls changed each time the files of paths change, once they
+// have not changed for debounce, until ctx is done. A file changes when it
+// is created, removed, or its size or modification time changes, as seen
+// by polling the files every poll: unlike file system notifications, this
+// also sees the files of network file systems, and the files replaced by
+// renaming others over them, as editors and downloaders do. It returns
+// ctx.Err().
+func WatchFiles(ctx context.Context, paths []string, poll, debounce time.Duration, changed func()) error {
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	last := statFiles(paths)
+	var pending bool
+	var changedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if cur := statFiles(paths); !slices.EqualFunc(cur, last, fileState.equal) {
+				last, pending, changedAt = cur, true, now
+			}
+			if pending && now.Sub(changedAt) >= debounce {
+				pending = false
+				changed()
+			}
+		}
+	}
+}
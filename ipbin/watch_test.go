@@ -0,0 +1,59 @@
+package ipbin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.0/24\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan time.Time, 10)
+	done := make(chan error)
+	go func() {
+		done <- WatchFiles(ctx, []string{path}, 5*time.Millisecond, 50*time.Millisecond, func() { changes <- time.Now() })
+	}()
+
+	// A burst of writes is debounced into one change
+	time.Sleep(20 * time.Millisecond)
+	var lastWrite time.Time
+	for i := range 3 {
+		if err := os.WriteFile(path, []byte("192.0.2.0/24\n198.51.100.0/24\n"[:13+i]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		lastWrite = time.Now()
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case at := <-changes:
+		if at.Sub(lastWrite) < 50*time.Millisecond {
+			t.Errorf("change reported %v after the last write, before the debounce", at.Sub(lastWrite))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+	}
+	select {
+	case <-changes:
+		t.Error("burst reported more than once")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// Removing the file is a change
+	os.Remove(path)
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("removal not reported")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,422 @@
+package ipbin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ParseYAMLList parses the addresses, prefixes and ranges selected by path
+// (see parsePath) in a YAML document, like a list kept in a configuration
+// repository: the strings selected, comma or whitespace separated, and the
+// strings of the sequences selected, e.g. with ".spec.allowedCIDRs". The
+// documents of a stream are all searched. Anchors, aliases and tags are not
+// supported.
+func ParseYAMLList(r io.Reader, path string) ([]netip.Prefix, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := decodeYAML(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return parseDocumentPrefixes(docs, path)
+}
+
+// yamlLine is a significant line of a YAML document.
+type yamlLine struct {
+	num    int // line number, from 1
+	indent int
+	text   string // without indentation, trailing spaces and comment
+}
+
+// yamlParser parses the block structure of a YAML document into maps,
+// slices and strings.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// decodeYAML decodes the documents of a YAML stream.
+func decodeYAML(data string) ([]any, error) {
+	var docs []any
+	var lines []yamlLine
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		p := &yamlParser{lines: lines}
+		doc, err := p.node(lines[0].indent)
+		if err != nil {
+			return err
+		}
+		if p.pos < len(lines) {
+			return p.errorf("unexpected %q", lines[p.pos].text)
+		}
+		docs, lines = append(docs, doc), nil
+		return nil
+	}
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		switch {
+		case line == "---" || strings.HasPrefix(line, "--- ") || line == "...":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if rest := strings.TrimSpace(strings.TrimPrefix(line, "---")); rest != "" && rest != "..." {
+				lines = append(lines, yamlLine{num: i + 1, text: rest})
+			}
+			continue
+		case strings.HasPrefix(line, "%"):
+			// A directive
+			continue
+		}
+		text := strings.TrimLeft(line, " ")
+		if text == "" {
+			continue
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(line) - len(text), text: text})
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// stripYAMLComment returns line without its comment, starting with a "#"
+// at the start of the line or after whitespace, outside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[{,:-", line[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	line := 0
+	if p.pos < len(p.lines) {
+		line = p.lines[p.pos].num
+	} else if len(p.lines) > 0 {
+		line = p.lines[len(p.lines)-1].num
+	}
+	return &ParseError{Line: line, Err: fmt.Errorf("invalid YAML: "+format, args...)}
+}
+
+// node parses the node starting at the current line, of the given
+// indentation.
+func (p *yamlParser) node(indent int) (any, error) {
+	l := p.lines[p.pos]
+	switch {
+	case isYAMLSeqItem(l.text):
+		return p.sequence(indent)
+	case l.text[0] != '[' && l.text[0] != '{':
+		if _, _, ok := yamlKey(l.text); ok {
+			return p.mapping(indent)
+		}
+	}
+	p.pos++
+	return p.inline(l.text)
+}
+
+// nested parses the node of the lines indented more than indent following
+// a key or a sequence indicator, null if there are none.
+func (p *yamlParser) nested(indent int) (any, error) {
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return p.node(p.lines[p.pos].indent)
+	}
+	return nil, nil
+}
+
+// sequence parses a block sequence of the given indentation.
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	seq := []any{}
+	for p.pos < len(p.lines) {
+		l := &p.lines[p.pos]
+		if l.indent != indent || !isYAMLSeqItem(l.text) {
+			break
+		}
+		rest := strings.TrimLeft(l.text[1:], " ")
+		var v any
+		var err error
+		if rest == "" {
+			p.pos++
+			v, err = p.nested(indent)
+		} else {
+			// The content of the item, as a line of its own indented by its
+			// offset, so that "- key: value" starts a mapping
+			l.indent += len(l.text) - len(rest)
+			l.text = rest
+			v, err = p.node(l.indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+// mapping parses a block mapping of the given indentation.
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		key, rest, ok := yamlKey(l.text)
+		if l.indent > indent || !ok {
+			return nil, p.errorf("unexpected %q", l.text)
+		}
+		p.pos++
+		var v any
+		var err error
+		switch {
+		case rest == "":
+			// A nested node, or a sequence indented as the key
+			if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSeqItem(p.lines[p.pos].text) {
+				v, err = p.sequence(indent)
+			} else {
+				v, err = p.nested(indent)
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			// A block scalar, kept as its lines
+			var b strings.Builder
+			for p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				b.WriteString(p.lines[p.pos].text)
+				b.WriteByte('\n')
+				p.pos++
+			}
+			v = b.String()
+		default:
+			v, err = p.inline(rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// inline parses a scalar or a flow collection, which may continue on the
+// following lines until its brackets are closed.
+func (p *yamlParser) inline(s string) (any, error) {
+	if s[0] == '[' || s[0] == '{' {
+		for !yamlFlowClosed(s) && p.pos < len(p.lines) {
+			s += " " + p.lines[p.pos].text
+			p.pos++
+		}
+		f := yamlFlow{s: s}
+		v, err := f.value()
+		if err == nil && strings.TrimSpace(f.s[f.i:]) != "" {
+			err = fmt.Errorf("unexpected %q", f.s[f.i:])
+		}
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return v, nil
+	}
+	v, err := yamlScalar(s)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return v, nil
+}
+
+// isYAMLSeqItem returns whether s starts a sequence item.
+func isYAMLSeqItem(s string) bool {
+	return s == "-" || strings.HasPrefix(s, "- ")
+}
+
+// yamlKey splits s into the key and the value of a mapping entry,
+// "key: value" or "key:".
+func yamlKey(s string) (key, rest string, ok bool) {
+	if s[0] == '"' || s[0] == '\'' {
+		n := yamlQuotedLen(s)
+		if n < 0 || n == len(s) || s[n] != ':' || n+1 < len(s) && s[n+1] != ' ' {
+			return "", "", false
+		}
+		key, err := yamlUnquote(s[:n])
+		return key, strings.TrimSpace(s[n+1:]), err == nil
+	}
+	i := strings.Index(s+" ", ": ")
+	if i <= 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[min(i+1, len(s)):]), true
+}
+
+// yamlScalar returns the value of a scalar: the unquoted string, nil for
+// null, or the plain string otherwise.
+func yamlScalar(s string) (any, error) {
+	switch {
+	case s[0] == '"' || s[0] == '\'':
+		if yamlQuotedLen(s) != len(s) {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return yamlUnquote(s)
+	case s[0] == '&' || s[0] == '*' || s[0] == '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported: %s", s)
+	case s == "~" || s == "null" || s == "Null" || s == "NULL":
+		return nil, nil
+	}
+	return s, nil
+}
+
+// yamlQuotedLen returns the length of the quoted string at the start of s,
+// -1 if it is not terminated.
+func yamlQuotedLen(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// yamlUnquote returns the value of a double- or single-quoted string.
+func yamlUnquote(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	v, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted string %s", s)
+	}
+	return v, nil
+}
+
+// yamlFlowClosed returns whether the brackets of the flow collection s are
+// all closed.
+func yamlFlowClosed(s string) bool {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			n := yamlQuotedLen(s[i:])
+			if n < 0 {
+				return false
+			}
+			i += n - 1
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// yamlFlow parses a flow collection, like [a, "b"] or {key: value}.
+type yamlFlow struct {
+	s string
+	i int
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.i < len(f.s) && (f.s[f.i] == ' ' || f.s[f.i] == '\t') {
+		f.i++
+	}
+}
+
+func (f *yamlFlow) value() (any, error) {
+	f.skipSpace()
+	if f.i == len(f.s) {
+		return nil, errors.New("unterminated flow collection")
+	}
+	switch c := f.s[f.i]; c {
+	case '[', '{':
+		f.i++
+		seq, m := []any{}, map[string]any{}
+		for {
+			f.skipSpace()
+			if f.i < len(f.s) && (f.s[f.i] == ']' && c == '[' || f.s[f.i] == '}' && c == '{') {
+				f.i++
+				if c == '{' {
+					return m, nil
+				}
+				return seq, nil
+			}
+			if c == '{' {
+				key, err := f.scalar(true)
+				if err != nil {
+					return nil, err
+				}
+				if f.skipSpace(); f.i == len(f.s) || f.s[f.i] != ':' {
+					return nil, errors.New("missing : in flow mapping")
+				}
+				f.i++
+				v, err := f.value()
+				if err != nil {
+					return nil, err
+				}
+				m[fmt.Sprint(key)] = v
+			} else {
+				v, err := f.value()
+				if err != nil {
+					return nil, err
+				}
+				seq = append(seq, v)
+			}
+			f.skipSpace()
+			switch {
+			case f.i < len(f.s) && f.s[f.i] == ',':
+				f.i++
+			case f.i < len(f.s) && (f.s[f.i] == ']' || f.s[f.i] == '}'):
+			default:
+				return nil, errors.New("unterminated flow collection")
+			}
+		}
+	}
+	return f.scalar(false)
+}
+
+// scalar parses a scalar of a flow collection, ending at a "," or a closing
+// bracket, or at a ": " if it is a key.
+func (f *yamlFlow) scalar(key bool) (any, error) {
+	f.skipSpace()
+	start := f.i
+	if f.i < len(f.s) && (f.s[f.i] == '"' || f.s[f.i] == '\'') {
+		n := yamlQuotedLen(f.s[f.i:])
+		if n < 0 {
+			return nil, fmt.Errorf("unterminated quoted string %s", f.s[f.i:])
+		}
+		f.i += n
+		return yamlUnquote(f.s[start:f.i])
+	}
+	for f.i < len(f.s) && strings.IndexByte(",]}", f.s[f.i]) < 0 {
+		if key && f.s[f.i] == ':' && (f.i+1 == len(f.s) || strings.IndexByte(" ,}", f.s[f.i+1]) >= 0) {
+			break
+		}
+		f.i++
+	}
+	s := strings.TrimSpace(f.s[start:f.i])
+	if s == "" {
+		return nil, nil
+	}
+	return yamlScalar(s)
+}
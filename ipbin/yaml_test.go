@@ -0,0 +1,77 @@
+package ipbin
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLList(t *testing.T) {
+	input := `# Allowlist of the ingress
+apiVersion: v1
+kind: Policy
+spec:
+  allowedCIDRs:
+    - 10.0.0.0/8        # office
+    - "192.0.2.1"
+    - '198.51.100.0/24'
+  blocked: [203.0.113.0/24, "2001:db8::/32",
+    192.0.2.9 - 192.0.2.10]
+  rules:
+  - name: vpn
+    cidr: 100.64.0.0/10
+  - name: "lab # 2"
+    cidr: 172.16.0.0/12, 172.20.0.1
+  notes: |
+    10.1.0.0/16
+    10.2.0.0/16
+---
+- 192.168.0.0/16
+`
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{".spec.allowedCIDRs", []string{"10.0.0.0/8", "192.0.2.1/32", "198.51.100.0/24"}},
+		{".spec.blocked", []string{"203.0.113.0/24", "2001:db8::/32", "192.0.2.9/32", "192.0.2.10/32"}},
+		{".spec.rules[].cidr", []string{"100.64.0.0/10", "172.16.0.0/12", "172.20.0.1/32"}},
+		{".spec.notes", []string{"10.1.0.0/16", "10.2.0.0/16"}},
+		{"[0]", []string{"192.168.0.0/16"}},
+	}
+	for _, tt := range tests {
+		nets, err := ParseYAMLList(strings.NewReader(input), tt.path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		var want []netip.Prefix
+		for _, s := range tt.want {
+			want = append(want, netip.MustParsePrefix(s))
+		}
+		if !reflect.DeepEqual(nets, want) {
+			t.Errorf("%s got %v, want %v", tt.path, nets, want)
+		}
+	}
+
+	docs, err := decodeYAML(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := docs[0].(map[string]any)["spec"].(map[string]any)["rules"]
+	if want := []any{map[string]any{"name": "vpn", "cidr": "100.64.0.0/10"}, map[string]any{"name": "lab # 2", "cidr": "172.16.0.0/12, 172.20.0.1"}}; !reflect.DeepEqual(rules, want) {
+		t.Errorf("rules got %v, want %v", rules, want)
+	}
+
+	for _, bad := range []string{
+		"a: 1\n  b: 2\n",          // unexpected indentation
+		"a: [1, 2\n",              // unterminated flow sequence
+		"a: \"x\n",                // unterminated string
+		"a: *anchor\n",            // aliases
+		"- 10.0.0.0/8\n- bogus\n", // invalid address
+	} {
+		if nets, err := ParseYAMLList(strings.NewReader(bad), ""); err == nil {
+			t.Errorf("%q got %v, expected an error", bad, nets)
+		}
+	}
+}